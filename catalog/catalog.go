@@ -0,0 +1,416 @@
+// Package catalog stores the databases and tables of a server, and their
+// configuration, in a bolt database.
+package catalog
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// SystemDB is the name of the database of system tables, which is not stored
+// in the catalog.
+const SystemDB = "rethinkdb"
+
+// DefaultDB is the database which is created with a new catalog.
+const DefaultDB = "test"
+
+var (
+	databasesBucketName = []byte("databases")
+	tablesBucketName    = []byte("tables")
+	serverBucketName    = []byte("server")
+	serverIDKey         = []byte("id")
+)
+
+// validName matches the names of databases and tables.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Database is a database of the catalog.
+type Database struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Table is a table of the catalog.
+type Table struct {
+	ID string `json:"id"`
+	// DB is the ID of the database of the table.
+	DB         string `json:"db"`
+	Name       string `json:"name"`
+	PrimaryKey string `json:"primary_key"`
+	// Durability is "hard" if writes are flushed to disk before they are
+	// acknowledged, or "soft".
+	Durability string `json:"durability"`
+	// WriteHook is run on each write of a row, or nil if the table has none.
+	WriteHook *WriteHook `json:"write_hook,omitempty"`
+}
+
+// WriteHook is the write hook of a table.
+type WriteHook struct {
+	// Function is the JSON encoding of the FUNC term of the hook, from
+	// which it is compiled.
+	Function []byte `json:"function"`
+	// Query is the readable form of the hook.
+	Query string `json:"query"`
+}
+
+// Catalog holds the databases and tables of a server.
+type Catalog struct {
+	db       *bolt.DB
+	serverID string
+}
+
+// Open opens the catalog of the given database, creating the default
+// database if there are no databases.
+func Open(db *bolt.DB) (*Catalog, error) {
+	var serverID string
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(tablesBucketName); err != nil {
+			return fmt.Errorf("unable to create tables bucket: %s", err)
+		}
+		server, err := tx.CreateBucketIfNotExists(serverBucketName)
+		if err != nil {
+			return fmt.Errorf("unable to create server bucket: %s", err)
+		}
+		if id := server.Get(serverIDKey); id != nil {
+			serverID = string(id)
+		} else {
+			serverID = NewID()
+			if err := server.Put(serverIDKey, []byte(serverID)); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(databasesBucketName) != nil {
+			return nil
+		}
+		if _, err := tx.CreateBucket(databasesBucketName); err != nil {
+			return fmt.Errorf("unable to create databases bucket: %s", err)
+		}
+		return putDatabase(tx, Database{ID: NewID(), Name: DefaultDB})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Catalog{db: db, serverID: serverID}, nil
+}
+
+// ServerID returns the ID of the server, which is generated when the catalog
+// is created.
+func (c *Catalog) ServerID() string {
+	return c.serverID
+}
+
+// NewID returns a random version 4 UUID, which identifies a database or table
+// or is the generated primary key of a row.
+func NewID() string {
+	var uuid [16]byte
+	rand.Read(uuid[:])
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+func putDatabase(tx *bolt.Tx, db Database) error {
+	encoded, err := json.Marshal(db)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(databasesBucketName).Put([]byte(db.ID), encoded)
+}
+
+func putTable(tx *bolt.Tx, table Table) error {
+	encoded, err := json.Marshal(table)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(tablesBucketName).Put([]byte(table.ID), encoded)
+}
+
+func listDatabases(tx *bolt.Tx) ([]Database, error) {
+	var dbs []Database
+	err := tx.Bucket(databasesBucketName).ForEach(func(_, v []byte) error {
+		var db Database
+		dbs = append(dbs, db)
+		return json.Unmarshal(v, &dbs[len(dbs)-1])
+	})
+	return dbs, err
+}
+
+func listTables(tx *bolt.Tx) ([]Table, error) {
+	var tables []Table
+	err := tx.Bucket(tablesBucketName).ForEach(func(_, v []byte) error {
+		var table Table
+		tables = append(tables, table)
+		return json.Unmarshal(v, &tables[len(tables)-1])
+	})
+	return tables, err
+}
+
+func opFailed(format string, args ...interface{}) *values.Error {
+	return values.NewError(ql2.Response_OP_FAILED, format, args...)
+}
+
+// update runs a write transaction. An error from the transaction which is not
+// already a query error becomes one.
+func (c *Catalog) update(fn func(tx *bolt.Tx) error) *values.Error {
+	err := c.db.Update(fn)
+	if verr, ok := err.(*values.Error); ok {
+		return verr
+	}
+	if err != nil {
+		return opFailed("Unable to write the catalog: %s", err)
+	}
+	return nil
+}
+
+func (c *Catalog) view(fn func(tx *bolt.Tx) error) *values.Error {
+	if err := c.db.View(fn); err != nil {
+		return opFailed("Unable to read the catalog: %s", err)
+	}
+	return nil
+}
+
+// Databases returns every database, ordered by name.
+func (c *Catalog) Databases() (dbs []Database, err *values.Error) {
+	err = c.view(func(tx *bolt.Tx) (err error) {
+		dbs, err = listDatabases(tx)
+		return err
+	})
+	sort.Slice(dbs, func(i, j int) bool { return dbs[i].Name < dbs[j].Name })
+	return dbs, err
+}
+
+// Tables returns every table, ordered by database and name.
+func (c *Catalog) Tables() (tables []Table, err *values.Error) {
+	err = c.view(func(tx *bolt.Tx) (err error) {
+		tables, err = listTables(tx)
+		return err
+	})
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].DB != tables[j].DB {
+			return tables[i].DB < tables[j].DB
+		}
+		return tables[i].Name < tables[j].Name
+	})
+	return tables, err
+}
+
+func findDatabase(tx *bolt.Tx, match func(Database) bool) (*Database, error) {
+	dbs, err := listDatabases(tx)
+	for _, db := range dbs {
+		if match(db) {
+			return &db, err
+		}
+	}
+	return nil, err
+}
+
+func findTable(tx *bolt.Tx, match func(Table) bool) (*Table, error) {
+	tables, err := listTables(tx)
+	for _, table := range tables {
+		if match(table) {
+			return &table, err
+		}
+	}
+	return nil, err
+}
+
+// Database returns the database with the given name.
+func (c *Catalog) Database(name string) (db Database, err *values.Error) {
+	err = c.view(func(tx *bolt.Tx) error {
+		found, err := findDatabase(tx, func(d Database) bool { return d.Name == name })
+		if found != nil {
+			db = *found
+		}
+		return err
+	})
+	if err == nil && db.ID == "" {
+		err = opFailed("Database `%s` does not exist.", name)
+	}
+	return db, err
+}
+
+// Table returns the table with the given name in the named database.
+func (c *Catalog) Table(dbName, name string) (table Table, err *values.Error) {
+	db, err := c.Database(dbName)
+	if err != nil {
+		return Table{}, err
+	}
+	err = c.view(func(tx *bolt.Tx) error {
+		found, err := findTable(tx, func(t Table) bool { return t.DB == db.ID && t.Name == name })
+		if found != nil {
+			table = *found
+		}
+		return err
+	})
+	if err == nil && table.ID == "" {
+		err = opFailed("Table `%s.%s` does not exist.", dbName, name)
+	}
+	return table, err
+}
+
+func checkName(kind, name string) *values.Error {
+	if !validName.MatchString(name) {
+		return values.NewError(ql2.Response_QUERY_LOGIC, "%s name `%s` invalid (Use A-Z, a-z, 0-9, _ and - only).", kind, name)
+	}
+	return nil
+}
+
+func checkDurability(durability string) *values.Error {
+	if durability != "hard" && durability != "soft" {
+		return values.NewError(ql2.Response_QUERY_LOGIC, "Durability option `%s` unrecognized (options are \"hard\" and \"soft\").", durability)
+	}
+	return nil
+}
+
+// CreateDatabase creates a database with the given name.
+func (c *Catalog) CreateDatabase(name string) (Database, *values.Error) {
+	if err := checkName("Database", name); err != nil {
+		return Database{}, err
+	}
+	if name == SystemDB {
+		return Database{}, opFailed("Database `%s` already exists.", name)
+	}
+	db := Database{ID: NewID(), Name: name}
+	err := c.update(func(tx *bolt.Tx) error {
+		existing, err := findDatabase(tx, func(d Database) bool { return d.Name == name })
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return opFailed("Database `%s` already exists.", name)
+		}
+		return putDatabase(tx, db)
+	})
+	return db, err
+}
+
+// RenameDatabase renames the database with the given ID.
+func (c *Catalog) RenameDatabase(id, name string) *values.Error {
+	if err := checkName("Database", name); err != nil {
+		return err
+	}
+	return c.update(func(tx *bolt.Tx) error {
+		existing, err := findDatabase(tx, func(d Database) bool { return d.Name == name && d.ID != id })
+		if err != nil {
+			return err
+		}
+		if existing != nil || name == SystemDB {
+			return opFailed("Database `%s` already exists.", name)
+		}
+		db, err := findDatabase(tx, func(d Database) bool { return d.ID == id })
+		if err != nil {
+			return err
+		}
+		if db == nil {
+			return opFailed("Database `%s` does not exist.", id)
+		}
+		db.Name = name
+		return putDatabase(tx, *db)
+	})
+}
+
+// DropDatabase drops the database with the given ID and its tables.
+func (c *Catalog) DropDatabase(id string) *values.Error {
+	return c.update(func(tx *bolt.Tx) error {
+		tables, err := listTables(tx)
+		if err != nil {
+			return err
+		}
+		for _, table := range tables {
+			if table.DB == id {
+				if err := tx.Bucket(tablesBucketName).Delete([]byte(table.ID)); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Bucket(databasesBucketName).Delete([]byte(id))
+	})
+}
+
+// CreateTable creates a table in the named database.
+func (c *Catalog) CreateTable(dbName, name, primaryKey, durability string) (Table, *values.Error) {
+	if err := checkName("Table", name); err != nil {
+		return Table{}, err
+	}
+	if err := checkDurability(durability); err != nil {
+		return Table{}, err
+	}
+	db, err := c.Database(dbName)
+	if err != nil {
+		return Table{}, err
+	}
+	table := Table{ID: NewID(), DB: db.ID, Name: name, PrimaryKey: primaryKey, Durability: durability}
+	err = c.update(func(tx *bolt.Tx) error {
+		existing, err := findTable(tx, func(t Table) bool { return t.DB == db.ID && t.Name == name })
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return opFailed("Table `%s.%s` already exists.", dbName, name)
+		}
+		return putTable(tx, table)
+	})
+	return table, err
+}
+
+// UpdateTable replaces the configuration of a table. Only its name and
+// durability may change.
+func (c *Catalog) UpdateTable(table Table) *values.Error {
+	if err := checkName("Table", table.Name); err != nil {
+		return err
+	}
+	if err := checkDurability(table.Durability); err != nil {
+		return err
+	}
+	return c.update(func(tx *bolt.Tx) error {
+		existing, err := findTable(tx, func(t Table) bool { return t.ID == table.ID })
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return opFailed("Table `%s` does not exist.", table.ID)
+		}
+		if existing.DB != table.DB || existing.PrimaryKey != table.PrimaryKey {
+			return opFailed("The database and primary key of a table may not be changed.")
+		}
+		conflict, err := findTable(tx, func(t Table) bool { return t.DB == table.DB && t.Name == table.Name && t.ID != table.ID })
+		if err != nil {
+			return err
+		}
+		if conflict != nil {
+			return opFailed("Table `%s` already exists.", table.Name)
+		}
+		return putTable(tx, table)
+	})
+}
+
+// SetWriteHook sets the write hook of the table with the given ID, or removes
+// it if hook is nil.
+func (c *Catalog) SetWriteHook(id string, hook *WriteHook) *values.Error {
+	return c.update(func(tx *bolt.Tx) error {
+		table, err := findTable(tx, func(t Table) bool { return t.ID == id })
+		if err != nil {
+			return err
+		}
+		if table == nil {
+			return opFailed("Table `%s` does not exist.", id)
+		}
+		table.WriteHook = hook
+		return putTable(tx, *table)
+	})
+}
+
+// DropTable drops the table with the given ID.
+func (c *Catalog) DropTable(id string) *values.Error {
+	return c.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tablesBucketName).Delete([]byte(id))
+	})
+}
@@ -0,0 +1,94 @@
+package catalog
+
+import (
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+)
+
+func openTestDB(t *testing.T) *bolt.DB {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestOpen(t *testing.T) {
+	db := openTestDB(t)
+	c, err := Open(db)
+	if err != nil {
+		t.Fatalf("unable to open catalog: %s", err)
+	}
+	dbs, verr := c.Databases()
+	if verr != nil {
+		t.Fatal(verr.Message)
+	}
+	if len(dbs) != 1 || dbs[0].Name != DefaultDB {
+		t.Errorf("expected only the %s database but got %v", DefaultDB, dbs)
+	}
+
+	// Reopening the catalog keeps its databases and the server ID.
+	if _, verr := c.CreateDatabase("other"); verr != nil {
+		t.Fatal(verr.Message)
+	}
+	reopened, err := Open(db)
+	if err != nil {
+		t.Fatalf("unable to reopen catalog: %s", err)
+	}
+	if reopened.ServerID() != c.ServerID() {
+		t.Errorf("expected server ID %s but got %s", c.ServerID(), reopened.ServerID())
+	}
+	if dbs, _ := reopened.Databases(); len(dbs) != 2 {
+		t.Errorf("expected 2 databases but got %v", dbs)
+	}
+}
+
+func TestTables(t *testing.T) {
+	c, err := Open(openTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, verr := c.CreateTable(DefaultDB, "users", "id", "hard")
+	if verr != nil {
+		t.Fatal(verr.Message)
+	}
+	if _, verr := c.CreateTable(DefaultDB, "users", "id", "hard"); verr == nil || verr.Type != ql2.Response_OP_FAILED {
+		t.Errorf("expected a duplicate table to fail but got %v", verr)
+	}
+	if _, verr := c.CreateTable(DefaultDB, "bad name", "id", "hard"); verr == nil || verr.Type != ql2.Response_QUERY_LOGIC {
+		t.Errorf("expected an invalid name to fail but got %v", verr)
+	}
+	if _, verr := c.CreateTable("missing", "users", "id", "hard"); verr == nil {
+		t.Error("expected a table in a missing database to fail")
+	}
+
+	users.Name, users.Durability = "people", "soft"
+	if verr := c.UpdateTable(users); verr != nil {
+		t.Fatal(verr.Message)
+	}
+	table, verr := c.Table(DefaultDB, "people")
+	if verr != nil {
+		t.Fatal(verr.Message)
+	}
+	if table != users {
+		t.Errorf("expected %v but got %v", users, table)
+	}
+	users.PrimaryKey = "name"
+	if verr := c.UpdateTable(users); verr == nil {
+		t.Error("expected changing the primary key to fail")
+	}
+
+	db, _ := c.Database(DefaultDB)
+	if verr := c.DropDatabase(db.ID); verr != nil {
+		t.Fatal(verr.Message)
+	}
+	if tables, _ := c.Tables(); len(tables) != 0 {
+		t.Errorf("expected the tables of the dropped database to be dropped but got %v", tables)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jlhawn/reboltdb/server"
+)
+
+// stringList is a flag which may be given more than once.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// serveConfig configures the serve command. It is read from the command line
+// and, for any options not given there, from a config file.
+type serveConfig struct {
+	// directory holds the bolt database of the server.
+	directory string
+	// bind holds the addresses on which to listen, or "all" for every
+	// address. It is localhost unless given, so that a server is only
+	// reachable from other hosts if it is asked to be.
+	bind       stringList
+	driverPort int
+	// portOffset is added to every port, so that several servers may run
+	// on one host.
+	portOffset      int
+	serverName      string
+	initialPassword string
+	// cacheSize is the cache size in MB reported by the server, or "auto".
+	// Bolt reads through the page cache of the operating system.
+	cacheSize string
+	// initialMmapSize is the initial size in bytes of bolt's memory map of
+	// the database file.
+	initialMmapSize int
+	logLevel        string
+	logFile         string
+	// shutdownTimeout is how long running queries are given to finish
+	// when the server shuts down.
+	shutdownTimeout time.Duration
+	tls             server.TLSOptions
+	configFile      string
+}
+
+// newServeFlags returns the flags of the serve command, which are also the
+// keys of its config file.
+func newServeFlags(cfg *serveConfig) *flag.FlagSet {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.StringVar(&cfg.directory, "directory", "reboltdb_data", "the directory in which to store data")
+	fs.Var(&cfg.bind, "bind", "an address on which to listen for driver connections, or `all` (may be given more than once; default localhost)")
+	fs.IntVar(&cfg.driverPort, "driver-port", 28015, "the port on which to listen for driver connections")
+	fs.IntVar(&cfg.portOffset, "port-offset", 0, "an offset added to every port")
+	fs.StringVar(&cfg.serverName, "server-name", "", "the name of the server (default: the hostname)")
+	fs.StringVar(&cfg.initialPassword, "initial-password", "", "the password of the admin user, if it does not exist yet")
+	fs.StringVar(&cfg.cacheSize, "cache-size", "auto", "the cache size of the server in MB, or `auto`")
+	fs.IntVar(&cfg.initialMmapSize, "initial-mmap-size", 0, "the initial size in bytes of the memory map of the database file")
+	fs.StringVar(&cfg.logLevel, "log-level", "info", "the level of messages to log: debug, info, warn or error")
+	fs.StringVar(&cfg.logFile, "log-file", "", "a file to which to log in addition to stderr")
+	fs.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 10*time.Second, "how long running queries are given to finish when the server shuts down")
+	fs.StringVar(&cfg.tls.CertFile, "tls-cert", "", "the certificate file with which to serve TLS on the driver port")
+	fs.StringVar(&cfg.tls.KeyFile, "tls-key", "", "the private key file of the TLS certificate")
+	fs.StringVar(&cfg.tls.CAFile, "tls-ca", "", "the certificate authorities file with which to verify client certificates, which are required if it is set")
+	fs.StringVar(&cfg.configFile, "config-file", "", "a file of `key=value` lines setting any of these options")
+	return fs
+}
+
+// parseServeConfig parses the arguments of the serve command and any config
+// file they name. Options given on the command line take precedence.
+func parseServeConfig(args []string) (*serveConfig, error) {
+	cfg := &serveConfig{}
+	fs := newServeFlags(cfg)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+	}
+
+	if cfg.configFile != "" {
+		given := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+		if err := readConfigFile(fs, cfg.configFile, given); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cfg.bind) == 0 {
+		cfg.bind = stringList{"localhost"}
+	}
+	if cfg.port() < 1 || cfg.port() > 65535 {
+		return nil, fmt.Errorf("invalid driver port: %d", cfg.port())
+	}
+	if cfg.cacheSize != "auto" {
+		if size, err := strconv.ParseFloat(cfg.cacheSize, 64); err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid cache size: %s", cfg.cacheSize)
+		}
+	}
+	if cfg.initialMmapSize < 0 {
+		return nil, fmt.Errorf("invalid initial mmap size: %d", cfg.initialMmapSize)
+	}
+	if cfg.shutdownTimeout < 0 {
+		return nil, fmt.Errorf("invalid shutdown timeout: %s", cfg.shutdownTimeout)
+	}
+	if _, err := log.ParseLevel(cfg.logLevel); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readConfigFile sets the flags named by the keys of a config file, unless
+// they were given on the command line. Each line is a `key=value` pair, a
+// bare key setting a boolean flag, or a comment beginning with `#`.
+func readConfigFile(fs *flag.FlagSet, path string, given map[string]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open config file: %s", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value := line, "true"
+		if i := strings.IndexByte(line, '='); i >= 0 {
+			key, value = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		}
+		if key == "config-file" || fs.Lookup(key) == nil {
+			return fmt.Errorf("%s:%d: unknown option `%s`", path, lineNum, key)
+		}
+		if given[key] {
+			continue
+		}
+		if err := fs.Set(key, value); err != nil {
+			return fmt.Errorf("%s:%d: invalid value for `%s`: %s", path, lineNum, key, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read config file: %s", err)
+	}
+	return nil
+}
+
+// secretFlags are the options whose values are secret, which are redacted
+// from the command line reported by the server_status table.
+var secretFlags = map[string]bool{"initial-password": true}
+
+// redactArgs returns a copy of the given command line with the values of
+// secret options redacted, whether given as `-name value` or `-name=value`.
+func redactArgs(args []string) []string {
+	redacted := append([]string(nil), args...)
+	for i := 0; i < len(redacted); i++ {
+		arg := redacted[i]
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+		if j := strings.IndexByte(name, '='); j >= 0 {
+			if secretFlags[name[:j]] {
+				redacted[i] = arg[:len(arg)-len(name)+j+1] + "<redacted>"
+			}
+			continue
+		}
+		if secretFlags[name] && i+1 < len(redacted) {
+			i++
+			redacted[i] = "<redacted>"
+		}
+	}
+	return redacted
+}
+
+// port returns the driver port after the port offset.
+func (cfg *serveConfig) port() int {
+	return cfg.driverPort + cfg.portOffset
+}
+
+// listenAddrs returns the addresses on which to listen for driver
+// connections.
+func (cfg *serveConfig) listenAddrs() []string {
+	port := strconv.Itoa(cfg.port())
+	addrs := make([]string, 0, len(cfg.bind))
+	for _, host := range cfg.bind {
+		if host == "all" {
+			return []string{net.JoinHostPort("", port)}
+		}
+		addrs = append(addrs, net.JoinHostPort(host, port))
+	}
+	return addrs
+}
+
+// cacheSizeMB returns the configured cache size, or zero if it is automatic.
+func (cfg *serveConfig) cacheSizeMB() float64 {
+	size, _ := strconv.ParseFloat(cfg.cacheSize, 64)
+	return size
+}
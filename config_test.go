@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseServeConfig(t *testing.T) {
+	cfg, err := parseServeConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.directory != "reboltdb_data" || cfg.port() != 28015 || !reflect.DeepEqual(cfg.listenAddrs(), []string{"localhost:28015"}) {
+		t.Errorf("unexpected defaults %+v", cfg)
+	}
+
+	cfg, err = parseServeConfig([]string{"-bind", "all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.listenAddrs(), []string{":28015"}) {
+		t.Errorf("expected to listen on every address but got %v", cfg.listenAddrs())
+	}
+
+	configFile := filepath.Join(t.TempDir(), "reboltdb.conf")
+	contents := `# A second server on this host.
+directory = /var/lib/reboltdb/second
+bind=127.0.0.1
+bind=::1
+port-offset=1
+server-name=second
+log-level=debug
+`
+	if err := os.WriteFile(configFile, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = parseServeConfig([]string{"-config-file", configFile, "-server-name", "override"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.directory != "/var/lib/reboltdb/second" || cfg.serverName != "override" || cfg.logLevel != "debug" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	if expected := []string{"127.0.0.1:28016", "[::1]:28016"}; !reflect.DeepEqual(cfg.listenAddrs(), expected) {
+		t.Errorf("expected to listen on %v but got %v", expected, cfg.listenAddrs())
+	}
+
+	for _, contents := range []string{"unknown=1\n", "driver-port=http\n", "config-file=other.conf\n"} {
+		if err := os.WriteFile(configFile, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseServeConfig([]string{"-config-file", configFile}); err == nil {
+			t.Errorf("expected config file %q to fail", contents)
+		}
+	}
+	for _, args := range [][]string{{"-driver-port", "70000"}, {"-cache-size", "lots"}, {"-log-level", "loud"}, {"extra"}} {
+		if _, err := parseServeConfig(args); err == nil {
+			t.Errorf("expected %v to fail", args)
+		}
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	args := []string{"reboltdb", "serve", "-initial-password", "secret", "--initial-password=secret", "-server-name", "initial-password"}
+	expected := []string{"reboltdb", "serve", "-initial-password", "<redacted>", "--initial-password=<redacted>", "-server-name", "initial-password"}
+	if actual := redactArgs(args); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q but got %q", expected, actual)
+	}
+	if args[3] != "secret" {
+		t.Errorf("expected the arguments to be copied but they were changed to %q", args)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jlhawn/reboltdb/jobs"
+	"github.com/jlhawn/reboltdb/server"
+	"github.com/jlhawn/reboltdb/stats"
+	"github.com/jlhawn/reboltdb/system"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+// maxAcceptDelay is the longest a listener waits before accepting again
+// after an error, such as running out of file descriptors.
+const maxAcceptDelay = time.Second
+
+// responseGrace is how long interrupted queries are given to send their
+// errors before their connections are closed.
+const responseGrace = time.Second
+
+// reqlServer serves driver connections, which it tracks so that they can be
+// drained when the server shuts down.
+type reqlServer struct {
+	system *system.System
+	users  *users.Store
+	jobs   *jobs.Registry
+	stats  *stats.Stats
+	// failures delays the errors of clients which keep failing to
+	// authenticate.
+	failures *server.AuthFailures
+
+	// draining is closed when the server begins to shut down, after which
+	// no connections are accepted and new queries are refused.
+	draining chan struct{}
+
+	mu sync.Mutex
+	// conns holds the open connections, with their query servers once
+	// their handshakes are done.
+	conns    map[net.Conn]*queryServer
+	handlers sync.WaitGroup
+}
+
+func newReqlServer(sys *system.System, userStore *users.Store, registry *jobs.Registry, counters *stats.Stats) *reqlServer {
+	return &reqlServer{
+		system:   sys,
+		users:    userStore,
+		jobs:     registry,
+		stats:    counters,
+		failures: server.NewAuthFailures(),
+		draining: make(chan struct{}),
+		conns:    map[net.Conn]*queryServer{},
+	}
+}
+
+func (s *reqlServer) isDraining() bool {
+	select {
+	case <-s.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// serve accepts connections from a listener until the server shuts down.
+// Errors accepting a connection are retried, with a delay which backs off,
+// unless the listener has been closed.
+func (s *reqlServer) serve(listener net.Listener) error {
+	var delay time.Duration
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isDraining() {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			if delay *= 2; delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay > maxAcceptDelay {
+				delay = maxAcceptDelay
+			}
+			log.Errorf("Unable to accept connection, retrying in %s: %s", delay, err)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		log.Infof("Accepted connection from %s", conn.RemoteAddr())
+
+		if !s.track(conn) {
+			conn.Close()
+			continue
+		}
+		go s.handleConnection(conn)
+	}
+}
+
+// track adds a connection to those which are closed when the server shuts
+// down, unless it already has.
+func (s *reqlServer) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isDraining() {
+		return false
+	}
+	s.conns[conn] = nil
+	s.handlers.Add(1)
+	return true
+}
+
+func (s *reqlServer) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+	s.handlers.Done()
+}
+
+func (s *reqlServer) handleConnection(conn net.Conn) {
+	defer s.untrack(conn)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	user, err := server.DoHandshake(conn, reader, s.users, s.failures)
+	if err != nil {
+		log.Errorf("Unable to perform handshake: %s", err)
+		return
+	}
+	s.stats.Connected()
+	defer s.stats.Disconnected()
+
+	qs := &queryServer{
+		cursors:  map[uint64]*cursor{},
+		conn:     conn,
+		reader:   reader,
+		system:   s.system,
+		jobs:     s.jobs,
+		stats:    s.stats,
+		users:    s.users,
+		user:     user,
+		draining: s.draining,
+	}
+	defer qs.closeCursors()
+
+	s.mu.Lock()
+	s.conns[conn] = qs
+	s.mu.Unlock()
+
+	if err := qs.handleQueries(); err != nil {
+		if s.isDraining() {
+			log.Debugf("Closed connection from %s: %s", conn.RemoteAddr(), err)
+			return
+		}
+		log.Errorf("Unable to handle queries: %s", err)
+		return
+	}
+}
+
+// queryServers returns the query servers of the open connections.
+func (s *reqlServer) queryServers() []*queryServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	servers := make([]*queryServer, 0, len(s.conns))
+	for _, qs := range s.conns {
+		if qs != nil {
+			servers = append(servers, qs)
+		}
+	}
+	return servers
+}
+
+// shutdown stops accepting connections from the given listeners and refuses
+// new queries. Changefeeds, which never finish, are interrupted at once, and
+// other queries are given up to the timeout to finish before they are
+// interrupted too. Then every connection is closed.
+func (s *reqlServer) shutdown(listeners []net.Listener, timeout time.Duration) {
+	s.mu.Lock()
+	close(s.draining)
+	s.mu.Unlock()
+	for _, listener := range listeners {
+		listener.Close()
+	}
+
+	for _, qs := range s.queryServers() {
+		qs.interruptFeeds()
+	}
+	if !s.jobs.Drain(timeout) {
+		running := s.jobs.List()
+		log.Warnf("Interrupting %d queries still running after %s", len(running), timeout)
+		for _, job := range running {
+			s.jobs.Interrupt(job.ID, jobs.ErrShutdown)
+		}
+	}
+
+	// Interrupted queries end promptly, once they have sent their errors.
+	deadline := time.Now().Add(responseGrace)
+	servers := s.queryServers()
+	for _, qs := range servers {
+		qs.stopWork()
+	}
+	for _, qs := range servers {
+		if !waitTimeout(&qs.inflight, time.Until(deadline)) {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	if !waitTimeout(&s.handlers, responseGrace) {
+		log.Warnf("Connections are still open after %s", responseGrace)
+	}
+}
+
+// waitTimeout waits for a WaitGroup up to the given timeout, returning
+// whether it finished.
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
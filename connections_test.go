@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/jobs"
+	"github.com/jlhawn/reboltdb/json"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/stats"
+)
+
+func TestShutdown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := jobs.NewRegistry()
+	srv := newReqlServer(nil, nil, registry, stats.New(nil))
+	served := make(chan error, 1)
+	go func() { served <- srv.serve(listener) }()
+
+	// The connection is closed during its handshake.
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for {
+		srv.mu.Lock()
+		n := len(srv.conns)
+		srv.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A running query is interrupted once the timeout passes.
+	job := registry.Start(&jobs.Job{Token: 1})
+	start := time.Now()
+	srv.shutdown([]net.Listener{listener}, 50*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the shutdown to wait for the running query but it took %s", elapsed)
+	}
+	if job.Err() != jobs.ErrShutdown {
+		t.Errorf("expected the running query to be interrupted but got %v", job.Err())
+	}
+
+	if err := <-served; err != nil {
+		t.Errorf("expected the listener to stop cleanly but got %s", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the connection to be closed but got %v", err)
+	}
+	if _, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		t.Error("expected new connections to be refused")
+	}
+}
+
+func TestDrainingRefusesQueries(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	draining := make(chan struct{})
+	close(draining)
+	qs := &queryServer{conn: serverConn, cursors: map[uint64]*cursor{}, jobs: jobs.NewRegistry(), draining: draining}
+
+	query, err := json.Parse([]byte(`[1, [24, [1, 2]], {}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if err := qs.runQuery(7, query); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var header [12]byte
+	if _, err := io.ReadFull(clientConn, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	if token := binary.LittleEndian.Uint64(header[:8]); token != 7 {
+		t.Errorf("expected a response to query 7 but got %d", token)
+	}
+	body := make([]byte, binary.LittleEndian.Uint32(header[8:]))
+	if _, err := io.ReadFull(clientConn, body); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "shutting down") {
+		t.Errorf("expected the query to be refused but got %s", body)
+	}
+}
+
+func TestStoppedRefusesContinue(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	qs := &queryServer{conn: serverConn, cursors: map[uint64]*cursor{3: {}}, jobs: jobs.NewRegistry(), draining: make(chan struct{})}
+	qs.stopWork()
+
+	query, err := json.Parse([]byte(`[2]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if err := qs.runQuery(3, query); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var header [12]byte
+	if _, err := io.ReadFull(clientConn, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, binary.LittleEndian.Uint32(header[8:]))
+	if _, err := io.ReadFull(clientConn, body); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "shutting down") {
+		t.Errorf("expected the continue to be refused but got %s", body)
+	}
+}
+
+func TestPanickingQueryFails(t *testing.T) {
+	qs := &queryServer{cursors: map[uint64]*cursor{}}
+	finished := false
+	panicking := values.NewStream(func() (values.Datum, *values.Error) { panic("boom") })
+	c := newCursor(panicking, jobs.NewRegistry().Start(&jobs.Job{Token: 5}), func() { finished = true })
+	qs.cursors[5] = c
+
+	r := qs.nextBatch(5, c)
+	if r.Type != ql2.Response_RUNTIME_ERROR || r.ErrorType != ql2.Response_INTERNAL {
+		t.Errorf("expected an internal RUNTIME_ERROR but got %+v", r)
+	}
+	if _, ok := qs.cursors[5]; ok || !finished {
+		t.Error("expected the cursor of the failed query to be closed")
+	}
+}
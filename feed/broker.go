@@ -0,0 +1,80 @@
+// Package feed implements changefeeds. A Broker publishes the changes made to
+// the rows of tables by each committed bolt write transaction to the feeds
+// which subscribe to them.
+package feed
+
+import (
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// Change is a change to a single row of a table. OldVal is nil if the row was
+// inserted and NewVal is nil if it was deleted.
+type Change struct {
+	DB, Table      string
+	OldVal, NewVal values.Datum
+}
+
+type tableName struct {
+	db, table string
+}
+
+// Broker delivers changes to the feeds which subscribe to them.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[tableName]map[*subscriber]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[tableName]map[*subscriber]struct{}{}}
+}
+
+// Record publishes the given changes once the given write transaction
+// commits. They are discarded if the transaction is rolled back.
+func (b *Broker) Record(tx *bolt.Tx, changes ...Change) {
+	tx.OnCommit(func() { b.Publish(changes...) })
+}
+
+// Publish delivers the given changes to every feed subscribed to them.
+func (b *Broker) Publish(changes ...Change) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, change := range changes {
+		for s := range b.subscribers[tableName{change.DB, change.Table}] {
+			s.push(change)
+		}
+	}
+}
+
+// Subscribe returns a feed of the changes described by the given
+// subscription. Changes are delivered to the feed from the moment it is
+// subscribed, so none are missed while any initial values are read.
+func (b *Broker) Subscribe(sub Subscription) values.Feed {
+	s := newSubscriber(b, sub)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	name := tableName{sub.DB, sub.Table}
+	if b.subscribers[name] == nil {
+		b.subscribers[name] = map[*subscriber]struct{}{}
+	}
+	b.subscribers[name][s] = struct{}{}
+
+	return values.NewFeed(s.next, s.notes(), s.close)
+}
+
+func (b *Broker) unsubscribe(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	name := tableName{s.sub.DB, s.sub.Table}
+	delete(b.subscribers[name], s)
+	if len(b.subscribers[name]) == 0 {
+		delete(b.subscribers, name)
+	}
+}
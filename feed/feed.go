@@ -0,0 +1,276 @@
+package feed
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// Subscription describes the changes delivered to a feed.
+type Subscription struct {
+	DB, Table string
+	// PrimaryKey is the field which identifies each row, used to squash
+	// the changes to a row together.
+	PrimaryKey string
+	// Select reports whether a row is one of those the feed is on, such as
+	// a single row or a range of rows. The value of a row which is not
+	// selected before or after a change is null in the feed. A nil Select
+	// selects every row of the table.
+	Select func(row values.Datum) bool
+	// Initial produces the current values of the selected rows, which the
+	// feed begins with if IncludeInitial is set.
+	Initial values.Stream
+	// Atom is set for a feed on a single row.
+	Atom bool
+	Options
+}
+
+// Document returns the document which describes a change in a feed: the old
+// and new values of the row, either of which may be null, and the type of the
+// change if types are included. Initial values have no old value.
+func Document(oldVal, newVal values.Datum, initial bool, opts Options) map[string]values.Datum {
+	doc := map[string]values.Datum{"new_val": orNull(newVal)}
+	if !initial {
+		doc["old_val"] = orNull(oldVal)
+	}
+	if opts.IncludeTypes {
+		changeType := "change"
+		switch {
+		case initial:
+			changeType = "initial"
+		case oldVal == nil || oldVal.IsNull():
+			changeType = "add"
+		case newVal == nil || newVal.IsNull():
+			changeType = "remove"
+		}
+		doc["type"] = values.NewString(changeType)
+	}
+	return doc
+}
+
+// StateDocument returns the document which marks the given state of a feed.
+func StateDocument(state string, opts Options) values.Datum {
+	doc := map[string]values.Datum{"state": values.NewString(state)}
+	if opts.IncludeTypes {
+		doc["type"] = values.NewString("state")
+	}
+	return values.NewObject(doc)
+}
+
+// SkippedDocument returns the document which reports that a feed skipped the
+// given number of changes because its queue was full.
+func SkippedDocument(skipped int) values.Datum {
+	return values.NewObject(map[string]values.Datum{
+		"error": values.NewString(fmt.Sprintf("Changefeed cache over array size limit, skipped %d elements.", skipped)),
+	})
+}
+
+func orNull(d values.Datum) values.Datum {
+	if d == nil {
+		return values.Null{}
+	}
+	return d
+}
+
+// The phases of a feed, which delivers its initial values before changes.
+const (
+	phaseInitializing = iota
+	phaseInitial
+	phaseReady
+	phaseChanges
+)
+
+// queuedChange is a change waiting to be read from a feed.
+type queuedChange struct {
+	Change
+	key      string
+	queuedAt time.Time
+}
+
+type subscriber struct {
+	broker *Broker
+	sub    Subscription
+	phase  int
+
+	mu    sync.Mutex
+	ready *sync.Cond
+	queue []*queuedChange
+	// squashable holds the queued change to each row by primary key, if
+	// changes are squashed.
+	squashable map[string]*queuedChange
+	skipped    int
+	closed     bool
+}
+
+func newSubscriber(b *Broker, sub Subscription) *subscriber {
+	s := &subscriber{broker: b, sub: sub, squashable: map[string]*queuedChange{}}
+	s.ready = sync.NewCond(&s.mu)
+	if sub.QueueSize <= 0 {
+		s.sub.QueueSize = DefaultQueueSize
+	}
+	return s
+}
+
+func (s *subscriber) notes() []ql2.Response_ResponseNote {
+	notes := []ql2.Response_ResponseNote{ql2.Response_SEQUENCE_FEED}
+	if s.sub.Atom {
+		notes[0] = ql2.Response_ATOM_FEED
+	}
+	if s.sub.IncludeStates {
+		notes = append(notes, ql2.Response_INCLUDES_STATES)
+	}
+	return notes
+}
+
+// selectChange nulls out the values of a change which are not selected. It
+// returns false if neither is.
+func (s *subscriber) selectChange(change Change) (Change, bool) {
+	if s.sub.Select != nil {
+		if change.OldVal != nil && !s.sub.Select(change.OldVal) {
+			change.OldVal = nil
+		}
+		if change.NewVal != nil && !s.sub.Select(change.NewVal) {
+			change.NewVal = nil
+		}
+	}
+	return change, change.OldVal != nil || change.NewVal != nil
+}
+
+// key returns the primary key of the row changed by the given change, or
+// false if it cannot be determined.
+func (s *subscriber) key(change Change) (string, bool) {
+	row := change.NewVal
+	if row == nil {
+		row = change.OldVal
+	}
+	if s.sub.PrimaryKey == "" || !row.IsObject() {
+		return "", false
+	}
+	pkey, ok := row.AsObject().Items()[s.sub.PrimaryKey]
+	if !ok {
+		return "", false
+	}
+	encoded, err := values.ToJSON(pkey)
+	return string(encoded), err == nil
+}
+
+func (s *subscriber) push(change Change) {
+	change, ok := s.selectChange(change)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	key, hasKey := s.key(change)
+	hasKey = hasKey && s.sub.Squash
+	if queued, ok := s.squashable[key]; hasKey && ok {
+		queued.NewVal = change.NewVal
+		return
+	}
+	if len(s.queue) >= s.sub.QueueSize {
+		s.skipped++
+		return
+	}
+	queued := &queuedChange{Change: change, key: key, queuedAt: time.Now()}
+	s.queue = append(s.queue, queued)
+	if hasKey {
+		s.squashable[key] = queued
+	}
+	s.ready.Signal()
+}
+
+func (s *subscriber) next() (values.Datum, *values.Error) {
+	switch s.phase {
+	case phaseInitializing:
+		s.phase = phaseInitial
+		if s.sub.IncludeStates && s.sub.IncludeInitial {
+			return StateDocument("initializing", s.sub.Options), nil
+		}
+		return s.next()
+	case phaseInitial:
+		if s.sub.IncludeInitial && s.sub.Initial != nil {
+			row, err := s.sub.Initial.NextItem()
+			if err != nil {
+				return nil, err
+			}
+			if row != nil {
+				return values.NewObject(Document(nil, row, true, s.sub.Options)), nil
+			}
+		}
+		s.phase = phaseReady
+		return s.next()
+	case phaseReady:
+		s.phase = phaseChanges
+		if s.sub.IncludeStates {
+			return StateDocument("ready", s.sub.Options), nil
+		}
+	}
+
+	for {
+		change, ok, skipped := s.nextChange()
+		switch {
+		case skipped > 0:
+			return SkippedDocument(skipped), nil
+		case !ok:
+			return nil, nil
+		}
+		// A squashed change may leave the row as it was.
+		if change.OldVal == nil && change.NewVal == nil {
+			continue
+		}
+		return values.NewObject(Document(change.OldVal, change.NewVal, false, s.sub.Options)), nil
+	}
+}
+
+// nextChange waits for the next change. It returns false once the feed is
+// closed or, instead of a change, the number of changes which were skipped.
+func (s *subscriber) nextChange() (Change, bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		for len(s.queue) == 0 && s.skipped == 0 && !s.closed {
+			s.ready.Wait()
+		}
+		if s.closed {
+			return Change{}, false, 0
+		}
+		if s.skipped > 0 {
+			skipped := s.skipped
+			s.skipped = 0
+			return Change{}, true, skipped
+		}
+		if wait := s.sub.SquashDelay - time.Since(s.queue[0].queuedAt); s.sub.Squash && wait > 0 {
+			// Give later changes a chance to be squashed into this one.
+			s.mu.Unlock()
+			time.Sleep(wait)
+			s.mu.Lock()
+			continue
+		}
+
+		queued := s.queue[0]
+		s.queue = s.queue[1:]
+		if s.squashable[queued.key] == queued {
+			delete(s.squashable, queued.key)
+		}
+		return queued.Change, true, 0
+	}
+}
+
+func (s *subscriber) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.ready.Broadcast()
+	s.mu.Unlock()
+
+	s.broker.unsubscribe(s)
+}
@@ -0,0 +1,228 @@
+package feed
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/jlhawn/reboltdb/json"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func parseRow(t *testing.T, data string) values.Datum {
+	t.Helper()
+	val, err := json.Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("unable to parse row %s: %s", data, err)
+	}
+	return values.FromJSON(val)
+}
+
+// expectDocs reads the next documents from the given feed and compares them
+// with the given JSON encodings.
+func expectDocs(t *testing.T, f values.Feed, expected ...string) {
+	t.Helper()
+	for _, want := range expected {
+		doc, err := f.NextItem()
+		if err != nil {
+			t.Fatalf("unable to read feed: %s", err.Message)
+		}
+		if doc == nil {
+			t.Fatalf("expected %s but the feed ended", want)
+		}
+		encoded, err := values.ToJSON(doc)
+		if err != nil {
+			t.Fatalf("unable to encode document: %s", err.Message)
+		}
+		if string(encoded) != want {
+			t.Errorf("expected %s but got %s", want, encoded)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	b := NewBroker()
+	f := b.Subscribe(Subscription{DB: "test", Table: "users", PrimaryKey: "id"})
+	defer f.Close()
+
+	// Changes to other tables and those of rolled back transactions are not
+	// delivered.
+	rollback := errors.New("rollback")
+	err = db.Update(func(tx *bolt.Tx) error {
+		b.Record(tx, Change{DB: "test", Table: "users", NewVal: parseRow(t, `{"id": 1}`)})
+		return rollback
+	})
+	if err != rollback {
+		t.Fatalf("expected the transaction to roll back but got %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b.Record(tx, Change{DB: "test", Table: "orders", NewVal: parseRow(t, `{"id": 1}`)})
+		b.Record(tx, Change{DB: "test", Table: "users", NewVal: parseRow(t, `{"id": 2}`)})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectDocs(t, f, `{"new_val":{"id":2},"old_val":null}`)
+}
+
+func TestSubscribe(t *testing.T) {
+	b := NewBroker()
+	rows := []values.Datum{parseRow(t, `{"id": 1, "n": 1}`), parseRow(t, `{"id": 2, "n": 5}`)}
+	f := b.Subscribe(Subscription{
+		DB: "test", Table: "users", PrimaryKey: "id",
+		Select: func(row values.Datum) bool {
+			return row.AsObject().Items()["n"].AsNumber().Float64() < 3
+		},
+		Initial: values.NewArray(rows[:1]).AsStream(),
+		Options: Options{IncludeInitial: true, IncludeStates: true, IncludeTypes: true, QueueSize: DefaultQueueSize},
+	})
+	defer f.Close()
+
+	b.Publish(
+		Change{DB: "test", Table: "users", OldVal: rows[0], NewVal: parseRow(t, `{"id": 1, "n": 2}`)},
+		Change{DB: "test", Table: "users", NewVal: parseRow(t, `{"id": 3, "n": 4}`)},
+		Change{DB: "test", Table: "users", OldVal: parseRow(t, `{"id": 1, "n": 2}`), NewVal: parseRow(t, `{"id": 1, "n": 3}`)},
+	)
+
+	expectDocs(t, f,
+		`{"state":"initializing","type":"state"}`,
+		`{"new_val":{"id":1,"n":1},"type":"initial"}`,
+		`{"state":"ready","type":"state"}`,
+		`{"new_val":{"id":1,"n":2},"old_val":{"id":1,"n":1},"type":"change"}`,
+		`{"new_val":null,"old_val":{"id":1,"n":2},"type":"remove"}`,
+	)
+}
+
+func TestSquash(t *testing.T) {
+	b := NewBroker()
+	f := b.Subscribe(Subscription{DB: "test", Table: "users", PrimaryKey: "id", Options: Options{Squash: true, QueueSize: DefaultQueueSize}})
+	defer f.Close()
+
+	b.Publish(
+		Change{DB: "test", Table: "users", NewVal: parseRow(t, `{"id": 1, "n": 1}`)},
+		Change{DB: "test", Table: "users", NewVal: parseRow(t, `{"id": 2}`)},
+		Change{DB: "test", Table: "users", OldVal: parseRow(t, `{"id": 1, "n": 1}`), NewVal: parseRow(t, `{"id": 1, "n": 2}`)},
+		Change{DB: "test", Table: "users", OldVal: parseRow(t, `{"id": 2}`)},
+		Change{DB: "test", Table: "users", NewVal: parseRow(t, `{"id": 3}`)},
+	)
+
+	// The insert and delete of the second row cancel out.
+	expectDocs(t, f,
+		`{"new_val":{"id":1,"n":2},"old_val":null}`,
+		`{"new_val":{"id":3},"old_val":null}`,
+	)
+}
+
+func TestQueueSize(t *testing.T) {
+	b := NewBroker()
+	f := b.Subscribe(Subscription{DB: "test", Table: "users", Options: Options{QueueSize: 1}})
+	defer f.Close()
+
+	for i := 0; i < 3; i++ {
+		b.Publish(Change{DB: "test", Table: "users", NewVal: values.NewNumber(float64(i))})
+	}
+
+	expectDocs(t, f,
+		`{"error":"Changefeed cache over array size limit, skipped 2 elements."}`,
+		`{"new_val":0,"old_val":null}`,
+	)
+}
+
+func TestClose(t *testing.T) {
+	b := NewBroker()
+	f := b.Subscribe(Subscription{DB: "test", Table: "users"})
+
+	done := make(chan values.Datum)
+	go func() {
+		doc, _ := f.NextItem()
+		done <- doc
+	}()
+	f.Close()
+	if doc := <-done; doc != nil {
+		t.Errorf("expected a closed feed to end but got %v", doc)
+	}
+	if len(b.subscribers) != 0 {
+		t.Errorf("expected a closed feed to be unsubscribed")
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	opts, err := ParseOptions(parseRow(t, `{"squash": 0.5, "include_types": true, "changefeed_queue_size": 10}`).AsObject())
+	if err != nil {
+		t.Fatalf("unable to parse options: %s", err.Message)
+	}
+	if !opts.Squash || opts.SquashDelay.Seconds() != 0.5 || !opts.IncludeTypes || opts.QueueSize != 10 {
+		t.Errorf("unexpected options %+v", opts)
+	}
+
+	for _, data := range []string{
+		`{"squash": -1}`,
+		`{"include_initial": 1}`,
+		`{"changefeed_queue_size": 0}`,
+		`{"bogus": true}`,
+	} {
+		if _, err := ParseOptions(parseRow(t, data).AsObject()); err == nil {
+			t.Errorf("expected options %s to be rejected", data)
+		}
+	}
+}
+
+func TestOrderedLimit(t *testing.T) {
+	b := NewBroker()
+	table := map[string]values.Datum{}
+	for _, data := range []string{`{"id": "a", "score": 10}`, `{"id": "b", "score": 8}`, `{"id": "c", "score": 5}`} {
+		row := parseRow(t, data)
+		table[row.AsObject().Items()["id"].AsString().Value()] = row
+	}
+	// The window is the two rows with the highest scores.
+	window := func() ([]values.Datum, *values.Error) {
+		var top []values.Datum
+		for _, row := range table {
+			score := row.AsObject().Items()["score"].AsNumber().Float64()
+			i := 0
+			for i < len(top) && top[i].AsObject().Items()["score"].AsNumber().Float64() > score {
+				i++
+			}
+			top = append(top[:i], append([]values.Datum{row}, top[i:]...)...)
+		}
+		if len(top) > 2 {
+			top = top[:2]
+		}
+		return top, nil
+	}
+	write := func(data string) {
+		row := parseRow(t, data)
+		id := row.AsObject().Items()["id"].AsString().Value()
+		b.Publish(Change{DB: "test", Table: "scores", OldVal: table[id], NewVal: row})
+		table[id] = row
+	}
+
+	source := b.Subscribe(Subscription{DB: "test", Table: "scores", PrimaryKey: "id"})
+	f := OrderedLimit(source, window, "id", Options{IncludeInitial: true, IncludeOffsets: true})
+	defer f.Close()
+
+	expectDocs(t, f,
+		`{"new_offset":0,"new_val":{"id":"a","score":10}}`,
+		`{"new_offset":1,"new_val":{"id":"b","score":8}}`,
+	)
+
+	// A row which moves into the window pushes out the last row.
+	write(`{"id": "c", "score": 12}`)
+	expectDocs(t, f, `{"new_offset":0,"new_val":{"id":"c","score":12},"old_offset":1,"old_val":{"id":"b","score":8}}`)
+
+	// A change to a row outside the window is ignored and a row may move
+	// within it.
+	write(`{"id": "b", "score": 1}`)
+	write(`{"id": "a", "score": 15}`)
+	expectDocs(t, f, `{"new_offset":0,"new_val":{"id":"a","score":15},"old_offset":1,"old_val":{"id":"a","score":10}}`)
+}
@@ -0,0 +1,195 @@
+package feed
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// orderedLimit is a feed on the first rows of a table in the order of an
+// index. Each change to the table which the source feed delivers is turned
+// into the changes to that window of rows.
+type orderedLimit struct {
+	source     values.Feed
+	window     func() ([]values.Datum, *values.Error)
+	primaryKey string
+	opts       Options
+
+	initialized bool
+	current     []values.Datum
+	pending     []values.Datum
+}
+
+// OrderedLimit returns a feed on the rows returned by window, which reads the
+// first rows of a table in the order of an index. The source feed must
+// deliver every change to the table and is subscribed before the window is
+// first read, so that no changes are missed. Rows are identified by the
+// given primary key.
+func OrderedLimit(source values.Feed, window func() ([]values.Datum, *values.Error), primaryKey string, opts Options) values.Feed {
+	l := &orderedLimit{source: source, window: window, primaryKey: primaryKey, opts: opts}
+
+	notes := []ql2.Response_ResponseNote{ql2.Response_ORDER_BY_LIMIT_FEED}
+	if opts.IncludeStates {
+		notes = append(notes, ql2.Response_INCLUDES_STATES)
+	}
+	return values.NewFeed(l.next, notes, source.Close)
+}
+
+func (l *orderedLimit) next() (values.Datum, *values.Error) {
+	if !l.initialized {
+		if err := l.initialize(); err != nil {
+			return nil, err
+		}
+	}
+
+	for len(l.pending) == 0 {
+		doc, err := l.source.NextItem()
+		if err != nil || doc == nil {
+			return nil, err
+		}
+		if _, ok := doc.AsObject().Items()["new_val"]; !ok {
+			// Pass on errors, such as skipped changes.
+			return doc, nil
+		}
+
+		rows, err := l.window()
+		if err != nil {
+			return nil, err
+		}
+		l.pending = l.diff(rows)
+		l.current = rows
+	}
+
+	doc := l.pending[0]
+	l.pending = l.pending[1:]
+	return doc, nil
+}
+
+func (l *orderedLimit) initialize() *values.Error {
+	rows, err := l.window()
+	if err != nil {
+		return err
+	}
+	l.initialized = true
+	l.current = rows
+
+	if l.opts.IncludeStates && l.opts.IncludeInitial {
+		l.pending = append(l.pending, StateDocument("initializing", l.opts))
+	}
+	if l.opts.IncludeInitial {
+		for i, row := range rows {
+			doc := Document(nil, row, true, l.opts)
+			if l.opts.IncludeOffsets {
+				doc["new_offset"] = values.NewNumber(float64(i))
+			}
+			l.pending = append(l.pending, values.NewObject(doc))
+		}
+	}
+	if l.opts.IncludeStates {
+		l.pending = append(l.pending, StateDocument("ready", l.opts))
+	}
+	return nil
+}
+
+// key identifies a row by its primary key.
+func (l *orderedLimit) key(row values.Datum) string {
+	if row.IsObject() {
+		if pkey, ok := row.AsObject().Items()[l.primaryKey]; ok {
+			row = pkey
+		}
+	}
+	encoded, _ := values.ToJSON(row)
+	return string(encoded)
+}
+
+// diff returns the documents which change the current window into the given
+// one. Each row which left the window is paired with one which entered it,
+// followed by the rows which changed but stayed in the window.
+func (l *orderedLimit) diff(rows []values.Datum) []values.Datum {
+	oldRows := make(map[string]values.Datum, len(l.current))
+	for _, row := range l.current {
+		oldRows[l.key(row)] = row
+	}
+	ranks := make(map[string]int, len(rows))
+	for i, row := range rows {
+		ranks[l.key(row)] = i
+	}
+
+	var removed, added, changed []values.Datum
+	for _, row := range l.current {
+		if _, ok := ranks[l.key(row)]; !ok {
+			removed = append(removed, row)
+		}
+	}
+	for _, row := range rows {
+		oldRow, ok := oldRows[l.key(row)]
+		switch {
+		case !ok:
+			added = append(added, row)
+		case !values.Equal(oldRow, row):
+			changed = append(changed, row)
+		}
+	}
+
+	// Offsets are the positions of rows in the window as each document is
+	// applied to it in turn.
+	working := append([]values.Datum(nil), l.current...)
+	var docs []values.Datum
+	emit := func(oldRow, newRow values.Datum) {
+		doc := Document(oldRow, newRow, false, l.opts)
+		oldOffset, newOffset := values.Datum(values.Null{}), values.Datum(values.Null{})
+		if oldRow != nil {
+			i := l.indexOf(working, oldRow)
+			working = append(working[:i], working[i+1:]...)
+			oldOffset = values.NewNumber(float64(i))
+		}
+		if newRow != nil {
+			i := l.insertionPoint(working, newRow, ranks)
+			working = append(working[:i], append([]values.Datum{newRow}, working[i:]...)...)
+			newOffset = values.NewNumber(float64(i))
+		}
+		if l.opts.IncludeOffsets {
+			doc["old_offset"] = oldOffset
+			doc["new_offset"] = newOffset
+		}
+		docs = append(docs, values.NewObject(doc))
+	}
+
+	for i := 0; i < len(removed) || i < len(added); i++ {
+		var oldRow, newRow values.Datum
+		if i < len(removed) {
+			oldRow = removed[i]
+		}
+		if i < len(added) {
+			newRow = added[i]
+		}
+		emit(oldRow, newRow)
+	}
+	for _, row := range changed {
+		emit(oldRows[l.key(row)], row)
+	}
+	return docs
+}
+
+func (l *orderedLimit) indexOf(rows []values.Datum, row values.Datum) int {
+	key := l.key(row)
+	for i, r := range rows {
+		if l.key(r) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertionPoint returns the position of the given row in the working window,
+// before the first row which follows it in the new window. Rows which have
+// yet to be removed from the window are passed over.
+func (l *orderedLimit) insertionPoint(rows []values.Datum, row values.Datum, ranks map[string]int) int {
+	rank := ranks[l.key(row)]
+	for i, r := range rows {
+		if other, ok := ranks[l.key(r)]; ok && other > rank {
+			return i
+		}
+	}
+	return len(rows)
+}
@@ -0,0 +1,85 @@
+package feed
+
+import (
+	"math"
+	"time"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// DefaultQueueSize is the default number of changes a feed holds before it
+// begins to skip them.
+const DefaultQueueSize = 100000
+
+// Options are the optional arguments of CHANGES.
+type Options struct {
+	// Squash combines the waiting changes to each row into one. If
+	// SquashDelay is positive, a change waits at least that long before it
+	// is delivered so that more changes may be combined with it.
+	Squash      bool
+	SquashDelay time.Duration
+	// IncludeInitial begins the feed with the current values of its rows.
+	IncludeInitial bool
+	// IncludeStates adds documents marking the end of the initial values.
+	IncludeStates bool
+	// IncludeTypes adds the type of each change: add, remove, change,
+	// initial or state.
+	IncludeTypes bool
+	// IncludeOffsets adds the positions of changed rows in the results of
+	// an ordered limit.
+	IncludeOffsets bool
+	// QueueSize is the number of changes a feed holds before it skips them.
+	QueueSize int
+}
+
+// ParseOptions parses the optional arguments of CHANGES.
+func ParseOptions(opts values.Object) (Options, *values.Error) {
+	options := Options{QueueSize: DefaultQueueSize}
+	if opts == nil {
+		return options, nil
+	}
+
+	for key, val := range opts.Items() {
+		var flag *bool
+		switch key {
+		case "squash":
+			switch {
+			case val.IsBool():
+				options.Squash = val.AsBool().Value()
+			case val.IsNumber() && val.AsNumber().Float64() >= 0:
+				options.Squash = true
+				options.SquashDelay = time.Duration(val.AsNumber().Float64() * float64(time.Second))
+			default:
+				return Options{}, optionError("Expected BOOL or a positive NUMBER for `squash`.")
+			}
+			continue
+		case "changefeed_queue_size":
+			if !val.IsNumber() || !val.AsNumber().IsInteger() || val.AsNumber().Float64() < 1 || val.AsNumber().Float64() > math.MaxInt32 {
+				return Options{}, optionError("Expected a positive integer for `changefeed_queue_size`.")
+			}
+			options.QueueSize = int(val.AsNumber().Int64())
+			continue
+		case "include_initial":
+			flag = &options.IncludeInitial
+		case "include_states":
+			flag = &options.IncludeStates
+		case "include_types":
+			flag = &options.IncludeTypes
+		case "include_offsets":
+			flag = &options.IncludeOffsets
+		default:
+			return Options{}, optionError("Unrecognized optional argument `%s`.", key)
+		}
+		if !val.IsBool() {
+			return Options{}, optionError("Expected BOOL for `%s`.", key)
+		}
+		*flag = val.AsBool().Value()
+	}
+	return options, nil
+}
+
+func optionError(format string, args ...interface{}) *values.Error {
+	return values.NewError(ql2.Response_QUERY_LOGIC, format, args...)
+}
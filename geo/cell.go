@@ -0,0 +1,147 @@
+package geo
+
+import (
+	"math"
+)
+
+const (
+	// maxCellLevel is the deepest level of the quadtree of cells. A cell at
+	// this level spans about 40 meters of longitude at the equator.
+	maxCellLevel = 20
+	// maxCoveringCells is the most cells used to cover a region.
+	maxCoveringCells = 8
+)
+
+// cellID identifies a cell of a quadtree over longitude and latitude. Each
+// digit from '0' to '3' selects a quadrant of the cell identified by the
+// digits before it, so the ID of a cell is a prefix of the IDs of all the
+// cells within it. The empty ID is the whole world.
+type cellID string
+
+// rect is a region bounded by lines of longitude and latitude.
+type rect struct {
+	minLon, minLat, maxLon, maxLat float64
+}
+
+// gridIndex returns the index of the cell containing the given coordinate at a
+// level of the quadtree with n cells spanning the given range.
+func gridIndex(coord, min, max float64, n int) int {
+	i := int((coord - min) / (max - min) * float64(n))
+	if i >= n {
+		i = n - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
+
+// covering returns the cells, all at the same level, which cover the given
+// regions. The level is the deepest at which at most maxCoveringCells cover
+// each region.
+func covering(regions ...rect) []cellID {
+	var cells []cellID
+	for _, r := range regions {
+		level, cols, rows := 0, [2]int{}, [2]int{}
+		for l := 0; l <= maxCellLevel; l++ {
+			n := 1 << uint(l)
+			c := [2]int{gridIndex(r.minLon, -180, 180, n), gridIndex(r.maxLon, -180, 180, n)}
+			w := [2]int{gridIndex(r.minLat, -90, 90, n), gridIndex(r.maxLat, -90, 90, n)}
+			if (c[1]-c[0]+1)*(w[1]-w[0]+1) > maxCoveringCells {
+				break
+			}
+			level, cols, rows = l, c, w
+		}
+		for col := cols[0]; col <= cols[1]; col++ {
+			for row := rows[0]; row <= rows[1]; row++ {
+				cells = append(cells, makeCellID(level, col, row))
+			}
+		}
+	}
+	return cells
+}
+
+// makeCellID returns the ID of the cell in the given column and row of the
+// grid at the given level of the quadtree.
+func makeCellID(level, col, row int) cellID {
+	id := make([]byte, level)
+	for i := range id {
+		bit := uint(level - 1 - i)
+		id[i] = '0' + byte((row>>bit&1)<<1|col>>bit&1)
+	}
+	return cellID(id)
+}
+
+// bound returns a region containing the given geometry.
+func bound(g Geometry) rect {
+	r := rect{minLon: 180, minLat: 90, maxLon: -180, maxLat: -90}
+	extend := func(p Point) {
+		r.minLon, r.maxLon = math.Min(r.minLon, p.Lon), math.Max(r.maxLon, p.Lon)
+		r.minLat, r.maxLat = math.Min(r.minLat, p.Lat), math.Max(r.maxLat, p.Lat)
+	}
+	for _, p := range g.vertices() {
+		extend(p)
+	}
+
+	north := vector{0, 0, 1}
+	g.edges(func(a, b Point) bool {
+		if math.Abs(a.Lon-b.Lon) > 180 {
+			// The edge crosses the antimeridian.
+			r.minLon, r.maxLon = -180, 180
+		}
+		// An edge may bulge towards a pole beyond the latitude of its
+		// endpoints. The furthest points of its great circle from the
+		// equator are the projections of the poles onto its plane.
+		va, vb := toVector(a), toVector(b)
+		n := va.cross(vb).normalize()
+		if top := north.sub(n.scale(n.z)).normalize(); top.norm() > 0 {
+			for _, v := range []vector{top, top.scale(-1)} {
+				if onArc(v, va, vb) {
+					extend(v.point())
+				}
+			}
+		}
+		return true
+	})
+
+	if g.Kind == PolygonKind {
+		if polygonContains(g, north) {
+			r.minLon, r.maxLon, r.maxLat = -180, 180, 90
+		}
+		if polygonContains(g, north.scale(-1)) {
+			r.minLon, r.maxLon, r.minLat = -180, 180, -90
+		}
+	}
+	return r
+}
+
+// circleBound returns regions containing every point within the given
+// distance of a center point on the given ellipsoid.
+func circleBound(center Point, e Ellipsoid, distance float64) []rect {
+	// No point is further in latitude than the distance along a meridian of
+	// a sphere with the smallest meridional radius of curvature of the
+	// ellipsoid, which is at the equator.
+	dLat := degrees(distance / (e.A * (1 - e.F) * (1 - e.F)))
+	r := rect{minLat: center.Lat - dLat, maxLat: center.Lat + dLat}
+	if r.minLat <= -90 || r.maxLat >= 90 {
+		r.minLat, r.maxLat = math.Max(r.minLat, -90), math.Min(r.maxLat, 90)
+		r.minLon, r.maxLon = -180, 180
+		return []rect{r}
+	}
+
+	dLon := dLat / math.Cos(radians(math.Max(math.Abs(r.minLat), math.Abs(r.maxLat))))
+	r.minLon, r.maxLon = center.Lon-dLon, center.Lon+dLon
+	switch {
+	case dLon >= 180:
+		r.minLon, r.maxLon = -180, 180
+	case r.minLon < -180:
+		wrapped := rect{minLon: r.minLon + 360, minLat: r.minLat, maxLon: 180, maxLat: r.maxLat}
+		r.minLon = -180
+		return []rect{r, wrapped}
+	case r.maxLon > 180:
+		wrapped := rect{minLon: -180, minLat: r.minLat, maxLon: r.maxLon - 360, maxLat: r.maxLat}
+		r.maxLon = 180
+		return []rect{r, wrapped}
+	}
+	return []rect{r}
+}
@@ -0,0 +1,158 @@
+package geo
+
+import (
+	"errors"
+	"math"
+)
+
+// Ellipsoid is a model of the shape of the Earth used to measure distances.
+// Distances are in the same unit as the semi-major axis.
+type Ellipsoid struct {
+	// A is the semi-major axis, the equatorial radius.
+	A float64
+	// F is the flattening.
+	F float64
+}
+
+var (
+	// WGS84 is the ellipsoid of the World Geodetic System, in meters.
+	WGS84 = Ellipsoid{A: 6378137, F: 1 / 298.257223563}
+	// UnitSphere is a sphere of radius one.
+	UnitSphere = Ellipsoid{A: 1, F: 0}
+)
+
+// vincentyIterations limits the iterations of Vincenty's formulae, which fail
+// to converge for nearly antipodal points.
+const vincentyIterations = 200
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
+func degrees(rad float64) float64 { return rad * 180 / math.Pi }
+
+// vincentyCoefficients returns the coefficients A and B of Vincenty's
+// formulae for the given square of the cosine of the azimuth at the equator.
+func (e Ellipsoid) vincentyCoefficients(cos2Alpha float64) (float64, float64) {
+	b := e.A * (1 - e.F)
+	u2 := cos2Alpha * (e.A*e.A - b*b) / (b * b)
+	A := 1 + u2/16384*(4096+u2*(-768+u2*(320-175*u2)))
+	B := u2 / 1024 * (256 + u2*(-128+u2*(74-47*u2)))
+	return A, B
+}
+
+func deltaSigma(B, sinSigma, cosSigma, cos2SigmaM float64) float64 {
+	return B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+		B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+}
+
+// Distance returns the length of the shortest path between two points on the
+// surface of this ellipsoid, using Vincenty's inverse formula.
+func (e Ellipsoid) Distance(p1, p2 Point) float64 {
+	f, b := e.F, e.A*(1-e.F)
+	L := radians(p2.Lon - p1.Lon)
+	U1 := math.Atan((1 - f) * math.Tan(radians(p1.Lat)))
+	U2 := math.Atan((1 - f) * math.Tan(radians(p2.Lat)))
+	sinU1, cosU1 := math.Sincos(U1)
+	sinU2, cosU2 := math.Sincos(U2)
+
+	lambda := L
+	for i := 0; i < vincentyIterations; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		sinSigma := math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			return 0 // The points coincide.
+		}
+		cosSigma := sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma := math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cos2Alpha := 1 - sinAlpha*sinAlpha
+		var cos2SigmaM float64
+		if cos2Alpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cos2Alpha
+		}
+		C := f / 16 * cos2Alpha * (4 + f*(4-3*cos2Alpha))
+		prev := lambda
+		lambda = L + (1-C)*f*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-prev) < 1e-12 {
+			A, B := e.vincentyCoefficients(cos2Alpha)
+			return b * A * (sigma - deltaSigma(B, sinSigma, cosSigma, cos2SigmaM))
+		}
+	}
+
+	// The formula did not converge, which only happens for nearly antipodal
+	// points, so fall back to the distance on a sphere of the mean radius.
+	return toVector(p1).angle(toVector(p2)) * (2*e.A + b) / 3
+}
+
+// Destination returns the point reached by travelling the given distance from
+// a point with the given initial bearing in degrees clockwise from north,
+// using Vincenty's direct formula.
+func (e Ellipsoid) Destination(p Point, bearing, distance float64) Point {
+	f, b := e.F, e.A*(1-e.F)
+	sinAlpha1, cosAlpha1 := math.Sincos(radians(bearing))
+	U1 := math.Atan((1 - f) * math.Tan(radians(p.Lat)))
+	sinU1, cosU1 := math.Sincos(U1)
+	sigma1 := math.Atan2(math.Tan(U1), cosAlpha1)
+	sinAlpha := cosU1 * sinAlpha1
+	cos2Alpha := 1 - sinAlpha*sinAlpha
+	A, B := e.vincentyCoefficients(cos2Alpha)
+
+	sigma := distance / (b * A)
+	var sinSigma, cosSigma, cos2SigmaM float64
+	for i := 0; i < vincentyIterations; i++ {
+		cos2SigmaM = math.Cos(2*sigma1 + sigma)
+		sinSigma, cosSigma = math.Sincos(sigma)
+		prev := sigma
+		sigma = distance/(b*A) + deltaSigma(B, sinSigma, cosSigma, cos2SigmaM)
+		if math.Abs(sigma-prev) < 1e-12 {
+			break
+		}
+	}
+	cos2SigmaM = math.Cos(2*sigma1 + sigma)
+	sinSigma, cosSigma = math.Sincos(sigma)
+
+	x := sinU1*sinSigma - cosU1*cosSigma*cosAlpha1
+	lat := math.Atan2(sinU1*cosSigma+cosU1*sinSigma*cosAlpha1, (1-f)*math.Hypot(sinAlpha, x))
+	lambda := math.Atan2(sinSigma*sinAlpha1, cosU1*cosSigma-sinU1*sinSigma*cosAlpha1)
+	C := f / 16 * cos2Alpha * (4 + f*(4-3*cos2Alpha))
+	L := lambda - (1-C)*f*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+
+	lon := math.Mod(p.Lon+degrees(L)+540, 360) - 180
+	return Point{Lon: lon, Lat: degrees(lat)}
+}
+
+// Circle returns the given number of vertices of a polygon approximating the
+// circle of the given radius around a center point.
+func (e Ellipsoid) Circle(center Point, radius float64, numVertices int) []Point {
+	points := make([]Point, numVertices)
+	for i := range points {
+		points[i] = e.Destination(center, 360*float64(i)/float64(numVertices), radius)
+	}
+	return points
+}
+
+// GeometryDistance returns the distance between a point and the closest part
+// of another geometry, which is zero if the geometry contains the point. At
+// least one of the geometries must be a point.
+func (e Ellipsoid) GeometryDistance(g1, g2 Geometry) (float64, error) {
+	if g1.Kind != PointKind {
+		g1, g2 = g2, g1
+	}
+	if g1.Kind != PointKind {
+		return 0, errors.New("Distance can only be computed between a point and another geometry.")
+	}
+	if g2.Kind == PointKind {
+		return e.Distance(g1.Point(), g2.Point()), nil
+	}
+
+	p := toVector(g1.Point())
+	if containsPoint(g2, p) {
+		return 0, nil
+	}
+	closest := toVector(g2.Rings[0][0])
+	g2.edges(func(a, b Point) bool {
+		if c := closestOnArc(p, toVector(a), toVector(b)); p.angle(c) < p.angle(closest) {
+			closest = c
+		}
+		return true
+	})
+	return e.Distance(g1.Point(), closest.point()), nil
+}
@@ -0,0 +1,148 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func mustPolygon(t *testing.T, points ...Point) Geometry {
+	t.Helper()
+	g, err := NewPolygon(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func mustLine(t *testing.T, points ...Point) Geometry {
+	t.Helper()
+	g, err := NewLine(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func mustPoint(t *testing.T, lon, lat float64) Geometry {
+	t.Helper()
+	g, err := NewPoint(Point{lon, lat})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestDistance(t *testing.T) {
+	testCases := []struct {
+		p1, p2   Point
+		e        Ellipsoid
+		expected float64
+	}{
+		{Point{-122.423246, 37.779388}, Point{-117.220406, 32.719464}, WGS84, 734125.2496},
+		{Point{0, 0}, Point{1, 0}, WGS84, 111319.4908},
+		{Point{0, 0}, Point{0, 0}, WGS84, 0},
+		{Point{0, 0}, Point{90, 0}, UnitSphere, math.Pi / 2},
+	}
+
+	for _, testCase := range testCases {
+		dist := testCase.e.Distance(testCase.p1, testCase.p2)
+		if math.Abs(dist-testCase.expected) > 1e-3*math.Max(1, testCase.expected/1e6) {
+			t.Errorf("distance from %v to %v: expected %v but got %v", testCase.p1, testCase.p2, testCase.expected, dist)
+		}
+	}
+}
+
+func TestDistanceAntipodal(t *testing.T) {
+	// Vincenty's formula does not converge for these nearly antipodal
+	// points, so the distance is approximated on a sphere.
+	dist := WGS84.Distance(Point{0, 0}, Point{179.7, 0.5})
+	if dist < 19.9e6 || dist > 20.1e6 {
+		t.Errorf("expected a distance of about 20,000km but got %vm", dist)
+	}
+}
+
+func TestDestination(t *testing.T) {
+	start := Point{-122.423246, 37.779388}
+	for _, bearing := range []float64{0, 45, 90, 180, 300} {
+		dest := WGS84.Destination(start, bearing, 5000)
+		if dist := WGS84.Distance(start, dest); math.Abs(dist-5000) > 1e-3 {
+			t.Errorf("bearing %v: expected a distance of 5000 but got %v", bearing, dist)
+		}
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	square := mustPolygon(t, Point{0, 0}, Point{10, 0}, Point{10, 10}, Point{0, 10})
+	inner := mustPolygon(t, Point{2, 2}, Point{4, 2}, Point{4, 4}, Point{2, 4})
+	holed, err := square.Subtract(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name                 string
+		g1, g2               Geometry
+		intersects, includes bool
+	}{
+		{"point inside", square, mustPoint(t, 5, 5), true, true},
+		{"point outside", square, mustPoint(t, 15, 5), false, false},
+		{"point on far side", square, mustPoint(t, -175, -5), false, false},
+		{"point in hole", holed, mustPoint(t, 3, 3), false, false},
+		{"point beside hole", holed, mustPoint(t, 6, 6), true, true},
+		{"crossing line", square, mustLine(t, Point{-5, 5}, Point{5, 5}), true, false},
+		{"contained line", square, mustLine(t, Point{1, 1}, Point{9, 9}), true, true},
+		{"line across hole", holed, mustLine(t, Point{1, 3}, Point{9, 3}), true, false},
+		{"disjoint line", square, mustLine(t, Point{20, 20}, Point{30, 30}), false, false},
+		{"contained polygon", square, inner, true, true},
+		{"polygon around hole", holed, mustPolygon(t, Point{1, 1}, Point{5, 1}, Point{5, 5}, Point{1, 5}), true, false},
+		{"enclosing polygon", inner, square, true, false},
+		{"crossing lines", mustLine(t, Point{0, 0}, Point{10, 10}), mustLine(t, Point{0, 10}, Point{10, 0}), true, false},
+		{"point on line", mustLine(t, Point{0, 0}, Point{0, 10}), mustPoint(t, 0, 5), true, false},
+	}
+
+	for _, testCase := range testCases {
+		if result := Intersects(testCase.g1, testCase.g2); result != testCase.intersects {
+			t.Errorf("%s: expected intersects to be %t", testCase.name, testCase.intersects)
+		}
+		if result := Intersects(testCase.g2, testCase.g1); result != testCase.intersects {
+			t.Errorf("%s: expected intersects to be symmetric", testCase.name)
+		}
+		if result := Includes(testCase.g1, testCase.g2); result != testCase.includes {
+			t.Errorf("%s: expected includes to be %t", testCase.name, testCase.includes)
+		}
+	}
+
+	if _, err := inner.Subtract(square); err == nil {
+		t.Errorf("expected an error subtracting a polygon which is not contained")
+	}
+}
+
+func TestGeometryDistance(t *testing.T) {
+	square := mustPolygon(t, Point{0, 0}, Point{1, 0}, Point{1, 1}, Point{0, 1})
+
+	if dist, err := WGS84.GeometryDistance(mustPoint(t, 0.5, 0.5), square); err != nil || dist != 0 {
+		t.Errorf("expected a point inside a polygon to be at distance 0 but got %v, %v", dist, err)
+	}
+	// The closest point of the polygon is in the middle of its southern
+	// edge, on the equator.
+	dist, err := WGS84.GeometryDistance(square, mustPoint(t, 0.5, -1))
+	if expected := WGS84.Distance(Point{0.5, -1}, Point{0.5, 0}); err != nil || math.Abs(dist-expected) > 1e-3 {
+		t.Errorf("expected a distance of %v but got %v, %v", expected, dist, err)
+	}
+	if _, err := WGS84.GeometryDistance(square, square); err == nil {
+		t.Errorf("expected an error measuring the distance between polygons")
+	}
+}
+
+func TestCircle(t *testing.T) {
+	center := Point{-122.423246, 37.779388}
+	circle := mustPolygon(t, WGS84.Circle(center, 1000, 32)...)
+	if !Includes(circle, mustPoint(t, center.Lon, center.Lat)) {
+		t.Errorf("expected a circle to include its center")
+	}
+	for _, p := range circle.Rings[0] {
+		if dist := WGS84.Distance(center, p); math.Abs(dist-1000) > 1e-3 {
+			t.Errorf("expected vertex %v to be 1000m from the center but it is %vm", p, dist)
+		}
+	}
+}
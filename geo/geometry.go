@@ -0,0 +1,154 @@
+// Package geo implements the geometry behind ReQL's geospatial terms: points,
+// lines and polygons on the surface of the Earth, the predicates and distances
+// between them, and a cell-based index of geometries stored in bolt.
+//
+// Edges between the vertices of lines and polygons are geodesics on a sphere,
+// as they are in RethinkDB, while distances are measured on an ellipsoid such
+// as WGS84.
+package geo
+
+import (
+	"fmt"
+)
+
+// Point is a position given as a longitude and latitude in degrees.
+type Point struct {
+	Lon, Lat float64
+}
+
+// Kind is the type of a geometry, named as it is in GeoJSON.
+type Kind string
+
+const (
+	PointKind   Kind = "Point"
+	LineKind    Kind = "LineString"
+	PolygonKind Kind = "Polygon"
+)
+
+// Geometry is a point, a line, or a polygon. A point has a single ring with a
+// single point. A line has a single ring with its vertices. A polygon has an
+// outer ring followed by any holes, each of which is closed: the last point
+// is the same as the first.
+type Geometry struct {
+	Kind  Kind
+	Rings [][]Point
+}
+
+// Validate returns an error if the given point is not a valid longitude and
+// latitude.
+func (p Point) Validate() error {
+	if p.Lon < -180 || p.Lon > 180 {
+		return fmt.Errorf("Longitude must be between -180 and 180. Got %v.", p.Lon)
+	}
+	if p.Lat < -90 || p.Lat > 90 {
+		return fmt.Errorf("Latitude must be between -90 and 90. Got %v.", p.Lat)
+	}
+	return nil
+}
+
+// NewPoint returns a point geometry.
+func NewPoint(p Point) (Geometry, error) {
+	if err := p.Validate(); err != nil {
+		return Geometry{}, err
+	}
+	return Geometry{Kind: PointKind, Rings: [][]Point{{p}}}, nil
+}
+
+// NewLine returns a line geometry through the given points.
+func NewLine(points []Point) (Geometry, error) {
+	if len(points) < 2 {
+		return Geometry{}, fmt.Errorf("Expected at least 2 points for a line but found %d.", len(points))
+	}
+	if err := validateRing(points); err != nil {
+		return Geometry{}, err
+	}
+	return Geometry{Kind: LineKind, Rings: [][]Point{points}}, nil
+}
+
+// NewPolygon returns a polygon geometry with the given outer ring and holes.
+// Each ring is closed if its last point is not the same as its first.
+func NewPolygon(rings ...[]Point) (Geometry, error) {
+	closed := make([][]Point, len(rings))
+	for i, ring := range rings {
+		if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+			ring = append(append([]Point(nil), ring...), ring[0])
+		}
+		if len(ring) < 4 {
+			return Geometry{}, fmt.Errorf("Expected at least 3 distinct points for a polygon but found %d.", len(ring)-1)
+		}
+		if err := validateRing(ring); err != nil {
+			return Geometry{}, err
+		}
+		closed[i] = ring
+	}
+	return Geometry{Kind: PolygonKind, Rings: closed}, nil
+}
+
+func validateRing(points []Point) error {
+	for _, p := range points {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	for i := 1; i < len(points); i++ {
+		if points[i] == points[i-1] {
+			return fmt.Errorf("Consecutive points must be distinct but found (%v, %v) twice.", points[i].Lon, points[i].Lat)
+		}
+	}
+	return nil
+}
+
+// Point returns the position of a point geometry.
+func (g Geometry) Point() Point {
+	return g.Rings[0][0]
+}
+
+// Fill returns the polygon enclosed by a line, closing the line if its last
+// point is not the same as its first.
+func (g Geometry) Fill() (Geometry, error) {
+	if g.Kind != LineKind {
+		return Geometry{}, fmt.Errorf("Expected a LineString but found a %s.", g.Kind)
+	}
+	return NewPolygon(g.Rings[0])
+}
+
+// Subtract returns this polygon with a hole in the shape of the given
+// polygon, which must be inside it and have no holes of its own.
+func (g Geometry) Subtract(inner Geometry) (Geometry, error) {
+	if g.Kind != PolygonKind {
+		return Geometry{}, fmt.Errorf("Expected a Polygon but found a %s.", g.Kind)
+	}
+	if inner.Kind != PolygonKind {
+		return Geometry{}, fmt.Errorf("Expected a Polygon but found a %s.", inner.Kind)
+	}
+	if len(inner.Rings) > 1 {
+		return Geometry{}, fmt.Errorf("Expected a Polygon with only an outer shell. This one has holes.")
+	}
+	if !Includes(g, inner) {
+		return Geometry{}, fmt.Errorf("The second argument to `polygon_sub` is not contained in the first one.")
+	}
+	rings := append(append([][]Point(nil), g.Rings...), inner.Rings[0])
+	return Geometry{Kind: PolygonKind, Rings: rings}, nil
+}
+
+// edges calls visit with each edge of the lines and rings of this geometry.
+// A point has no edges.
+func (g Geometry) edges(visit func(a, b Point) bool) bool {
+	for _, ring := range g.Rings {
+		for i := 1; i < len(ring); i++ {
+			if !visit(ring[i-1], ring[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// vertices returns every vertex of this geometry.
+func (g Geometry) vertices() []Point {
+	var points []Point
+	for _, ring := range g.Rings {
+		points = append(points, ring...)
+	}
+	return points
+}
@@ -0,0 +1,198 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// cellSeparator separates the cell ID from the key of the row in the keys of
+// index entries. It sorts before the digits of cell IDs so that the entries
+// of a cell come before those of the cells within it.
+const cellSeparator = '/'
+
+// nearestSteps is the number of times the search radius of Nearest may grow
+// before it reaches the maximum distance.
+const nearestSteps = 5
+
+// Index is a geospatial index stored in a bolt bucket. Each row of a table
+// is indexed by one or more geometries, which are stored under every cell
+// which covers them along with the key of the row.
+type Index struct {
+	bucket *bolt.Bucket
+}
+
+// NewIndex returns the geospatial index stored in the given bucket, which
+// may be nil to read an empty index.
+func NewIndex(bucket *bolt.Bucket) *Index {
+	return &Index{bucket: bucket}
+}
+
+// Neighbor is a row found by Nearest along with its distance.
+type Neighbor struct {
+	Key      []byte
+	Distance float64
+}
+
+func entryKey(cell cellID, key []byte) []byte {
+	entry := append([]byte(cell), cellSeparator)
+	return append(entry, key...)
+}
+
+func geometriesCovering(geometries []Geometry) []cellID {
+	regions := make([]rect, len(geometries))
+	for i, g := range geometries {
+		regions[i] = bound(g)
+	}
+	return covering(regions...)
+}
+
+// Insert indexes the row with the given key by the given geometries, which
+// replace any geometries it was indexed by in the same cells. To change the
+// geometries of a row, first Delete it using its old geometries.
+func (idx *Index) Insert(key []byte, geometries ...Geometry) error {
+	encoded, err := json.Marshal(geometries)
+	if err != nil {
+		return fmt.Errorf("unable to encode geometries: %s", err)
+	}
+	for _, cell := range geometriesCovering(geometries) {
+		if err := idx.bucket.Put(entryKey(cell, key), encoded); err != nil {
+			return fmt.Errorf("unable to put geo index entry: %s", err)
+		}
+	}
+	return nil
+}
+
+// Delete removes the row with the given key, which was indexed by the given
+// geometries, from the index.
+func (idx *Index) Delete(key []byte, geometries ...Geometry) error {
+	if idx.bucket == nil {
+		return nil
+	}
+	for _, cell := range geometriesCovering(geometries) {
+		if err := idx.bucket.Delete(entryKey(cell, key)); err != nil {
+			return fmt.Errorf("unable to delete geo index entry: %s", err)
+		}
+	}
+	return nil
+}
+
+// candidates returns the geometries of every row indexed in a cell which
+// overlaps the given regions, keyed by the key of the row.
+func (idx *Index) candidates(regions []rect) (map[string][]Geometry, error) {
+	found := map[string][]Geometry{}
+	if idx.bucket == nil {
+		return found, nil
+	}
+
+	scan := func(prefix []byte) error {
+		c := idx.bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			key := string(k[bytes.IndexByte(k, cellSeparator)+1:])
+			if _, ok := found[key]; ok {
+				continue
+			}
+			var geometries []Geometry
+			if err := json.Unmarshal(v, &geometries); err != nil {
+				return fmt.Errorf("unable to decode geo index entry: %s", err)
+			}
+			found[key] = geometries
+		}
+		return nil
+	}
+
+	for _, cell := range covering(regions...) {
+		// Rows are found in the cell itself, the cells within it, and the
+		// cells which contain it.
+		if err := scan([]byte(cell)); err != nil {
+			return nil, err
+		}
+		for level := 0; level < len(cell); level++ {
+			if err := scan(append([]byte(cell[:level]), cellSeparator)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return found, nil
+}
+
+// Intersecting returns the keys, in order, of the rows indexed by a geometry
+// which intersects the given geometry.
+func (idx *Index) Intersecting(g Geometry) ([][]byte, error) {
+	found, err := idx.candidates([]rect{bound(g)})
+	if err != nil {
+		return nil, err
+	}
+	var keys [][]byte
+	for key, geometries := range found {
+		for _, candidate := range geometries {
+			if Intersects(candidate, g) {
+				keys = append(keys, []byte(key))
+				break
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return keys, nil
+}
+
+// Nearest returns up to maxResults rows indexed by a geometry within maxDist
+// of the given point on the given ellipsoid, ordered by distance. The search
+// begins with a small radius around the point which grows until enough rows
+// are found.
+func (idx *Index) Nearest(center Point, e Ellipsoid, maxDist float64, maxResults int) ([]Neighbor, error) {
+	point, err := NewPoint(center)
+	if err != nil {
+		return nil, err
+	}
+
+	radius := maxDist
+	for i := 0; i < nearestSteps; i++ {
+		radius /= 4
+	}
+	for {
+		radius *= 4
+		if radius > maxDist {
+			radius = maxDist
+		}
+
+		found, err := idx.candidates(circleBound(center, e, radius))
+		if err != nil {
+			return nil, err
+		}
+		var neighbors []Neighbor
+		for key, geometries := range found {
+			nearest := -1.0
+			for _, candidate := range geometries {
+				dist, err := e.GeometryDistance(point, candidate)
+				if err != nil {
+					return nil, err
+				}
+				if nearest < 0 || dist < nearest {
+					nearest = dist
+				}
+			}
+			if nearest <= radius {
+				neighbors = append(neighbors, Neighbor{Key: []byte(key), Distance: nearest})
+			}
+		}
+
+		// Every row within the radius has been found, so once there are
+		// enough of them the nearest rows are among them.
+		if len(neighbors) >= maxResults || radius >= maxDist {
+			sort.Slice(neighbors, func(i, j int) bool {
+				if neighbors[i].Distance != neighbors[j].Distance {
+					return neighbors[i].Distance < neighbors[j].Distance
+				}
+				return bytes.Compare(neighbors[i].Key, neighbors[j].Key) < 0
+			})
+			if len(neighbors) > maxResults {
+				neighbors = neighbors[:maxResults]
+			}
+			return neighbors, nil
+		}
+	}
+}
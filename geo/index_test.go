@@ -0,0 +1,120 @@
+package geo
+
+import (
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestDB(t *testing.T) *bolt.DB {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestIndex(t *testing.T) {
+	db := openTestDB(t)
+	bucket := []byte("stores_location")
+
+	// Stores around San Francisco, one far away in Sydney, and a delivery
+	// area which spans the antimeridian.
+	stores := map[string]Geometry{
+		"mission":  mustPoint(t, -122.4194, 37.7599),
+		"sunset":   mustPoint(t, -122.4942, 37.7534),
+		"oakland":  mustPoint(t, -122.2711, 37.8044),
+		"sydney":   mustPoint(t, 151.2093, -33.8688),
+		"dateline": mustPolygon(t, Point{179, -1}, Point{-179, -1}, Point{-179, 1}, Point{179, 1}),
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(bucket)
+		if err != nil {
+			return err
+		}
+		idx := NewIndex(b)
+		for key, g := range stores {
+			if err := idx.Insert([]byte(key), g); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectKeys := func(keys [][]byte, expected ...string) {
+		t.Helper()
+		if len(keys) != len(expected) {
+			t.Fatalf("expected keys %q but got %q", expected, keys)
+		}
+		for i, key := range keys {
+			if string(key) != expected[i] {
+				t.Fatalf("expected keys %q but got %q", expected, keys)
+			}
+		}
+	}
+
+	db.View(func(tx *bolt.Tx) error {
+		idx := NewIndex(tx.Bucket(bucket))
+		sf := mustPolygon(t, Point{-122.52, 37.70}, Point{-122.35, 37.70}, Point{-122.35, 37.82}, Point{-122.52, 37.82})
+		keys, err := idx.Intersecting(sf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectKeys(keys, "mission", "sunset")
+
+		keys, err = idx.Intersecting(mustPoint(t, 180, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectKeys(keys, "dateline")
+
+		neighbors, err := idx.Nearest(Point{-122.4194, 37.7599}, WGS84, 20000, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(neighbors) != 2 || string(neighbors[0].Key) != "mission" || string(neighbors[1].Key) != "sunset" {
+			t.Fatalf("expected the mission and sunset stores to be nearest but got %v", neighbors)
+		}
+		if neighbors[0].Distance != 0 || neighbors[1].Distance < 6000 || neighbors[1].Distance > 7000 {
+			t.Errorf("unexpected distances %v", neighbors)
+		}
+
+		neighbors, err = idx.Nearest(Point{-122.4194, 37.7599}, WGS84, 1000, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(neighbors) != 1 {
+			t.Errorf("expected only one store within 1km but got %v", neighbors)
+		}
+
+		neighbors, err = idx.Nearest(Point{-179.5, 0.5}, WGS84, 100, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(neighbors) != 1 || string(neighbors[0].Key) != "dateline" {
+			t.Errorf("expected to find the area spanning the antimeridian but got %v", neighbors)
+		}
+		return nil
+	})
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		return NewIndex(tx.Bucket(bucket)).Delete([]byte("mission"), stores["mission"])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.View(func(tx *bolt.Tx) error {
+		keys, err := NewIndex(tx.Bucket(bucket)).Intersecting(mustPolygon(t, Point{-123, 37}, Point{-122, 37}, Point{-122, 38}, Point{-123, 38}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectKeys(keys, "oakland", "sunset")
+		return nil
+	})
+}
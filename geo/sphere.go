@@ -0,0 +1,267 @@
+package geo
+
+import (
+	"math"
+)
+
+// epsilon is the tolerance, in radians on the unit sphere, within which points
+// are considered to coincide. It is roughly a millimeter on the Earth.
+const epsilon = 1e-10
+
+// vector is a point on the unit sphere in Earth-centered coordinates.
+type vector struct {
+	x, y, z float64
+}
+
+func toVector(p Point) vector {
+	lon, lat := p.Lon*math.Pi/180, p.Lat*math.Pi/180
+	return vector{math.Cos(lat) * math.Cos(lon), math.Cos(lat) * math.Sin(lon), math.Sin(lat)}
+}
+
+func (v vector) point() Point {
+	return Point{
+		Lon: math.Atan2(v.y, v.x) * 180 / math.Pi,
+		Lat: math.Atan2(v.z, math.Hypot(v.x, v.y)) * 180 / math.Pi,
+	}
+}
+
+func (v vector) dot(w vector) float64 { return v.x*w.x + v.y*w.y + v.z*w.z }
+
+func (v vector) cross(w vector) vector {
+	return vector{v.y*w.z - v.z*w.y, v.z*w.x - v.x*w.z, v.x*w.y - v.y*w.x}
+}
+
+func (v vector) scale(s float64) vector { return vector{v.x * s, v.y * s, v.z * s} }
+func (v vector) sub(w vector) vector    { return vector{v.x - w.x, v.y - w.y, v.z - w.z} }
+func (v vector) norm() float64          { return math.Sqrt(v.dot(v)) }
+
+func (v vector) normalize() vector {
+	if n := v.norm(); n > 0 {
+		return v.scale(1 / n)
+	}
+	return v
+}
+
+// angle returns the angle between two unit vectors in radians.
+func (v vector) angle(w vector) float64 {
+	return math.Atan2(v.cross(w).norm(), v.dot(w))
+}
+
+// onArc reports whether the point x lies on the shorter great circle arc from
+// a to b.
+func onArc(x, a, b vector) bool {
+	n := a.cross(b)
+	if n.norm() < epsilon {
+		return x.angle(a) < epsilon
+	}
+	n = n.normalize()
+	if math.Abs(x.dot(n)) > epsilon {
+		return false
+	}
+	return a.cross(x).dot(n) >= -epsilon && x.cross(b).dot(n) >= -epsilon
+}
+
+// arcsIntersect reports whether the great circle arcs from a to b and from c
+// to d have any point in common, including their endpoints.
+func arcsIntersect(a, b, c, d vector) bool {
+	n1, n2 := a.cross(b), c.cross(d)
+	x := n1.cross(n2)
+	if x.norm() < epsilon {
+		// The arcs are on the same great circle, so they intersect only if
+		// they overlap.
+		return onArc(a, c, d) || onArc(b, c, d) || onArc(c, a, b) || onArc(d, a, b)
+	}
+	x = x.normalize()
+	return (onArc(x, a, b) && onArc(x, c, d)) || (onArc(x.scale(-1), a, b) && onArc(x.scale(-1), c, d))
+}
+
+// closestOnArc returns the point on the arc from a to b which is closest to p.
+func closestOnArc(p, a, b vector) vector {
+	n := a.cross(b).normalize()
+	projected := p.sub(n.scale(p.dot(n))).normalize()
+	if projected.norm() > 0 && onArc(projected, a, b) {
+		return projected
+	}
+	if p.angle(a) <= p.angle(b) {
+		return a
+	}
+	return b
+}
+
+// ringContains reports whether the given closed ring encloses the point p or
+// has p on its boundary.
+//
+// A ring within a hemisphere is tested in the gnomonic projection centered on
+// the ring, in which its edges are straight lines, so it encloses the smaller
+// of the two regions it divides the sphere into. Larger rings enclose the
+// region around which they wind as seen from p.
+func ringContains(ring []Point, p vector) bool {
+	vertices := make([]vector, len(ring))
+	var center vector
+	for i, point := range ring {
+		vertices[i] = toVector(point)
+		if i > 0 {
+			center = vector{center.x + vertices[i].x, center.y + vertices[i].y, center.z + vertices[i].z}
+		}
+	}
+	center = center.normalize()
+
+	for i := 1; i < len(vertices); i++ {
+		if onArc(p, vertices[i-1], vertices[i]) {
+			return true
+		}
+	}
+
+	inHemisphere := center.norm() > 0
+	for _, v := range vertices {
+		inHemisphere = inHemisphere && v.dot(center) > epsilon
+	}
+	if !inHemisphere {
+		return windingContains(vertices, p)
+	}
+	if p.dot(center) <= 0 {
+		return false
+	}
+
+	// Project onto the plane tangent to the sphere at the center and count
+	// the edges crossed by a ray from p.
+	e1 := vector{0, 0, 1}.cross(center).normalize()
+	if e1.norm() == 0 {
+		e1 = vector{1, 0, 0}
+	}
+	e2 := center.cross(e1)
+	project := func(v vector) (float64, float64) {
+		return v.dot(e1) / v.dot(center), v.dot(e2) / v.dot(center)
+	}
+	px, py := project(p)
+	inside := false
+	for i := 1; i < len(vertices); i++ {
+		xi, yi := project(vertices[i-1])
+		xj, yj := project(vertices[i])
+		if (yi > py) != (yj > py) && px < (xj-xi)*(py-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// windingContains reports whether the closed ring of the given vertices
+// winds around the point p.
+func windingContains(vertices []vector, p vector) bool {
+	var winding float64
+	for i := 1; i < len(vertices); i++ {
+		// The signed angle at p between the directions towards each end of
+		// the edge.
+		ta, tb := p.cross(vertices[i-1]), p.cross(vertices[i])
+		winding += math.Atan2(ta.cross(tb).dot(p), ta.dot(tb))
+	}
+	return math.Abs(winding) > math.Pi
+}
+
+// polygonContains reports whether the given polygon contains the point p: it
+// must be inside the outer ring but not strictly inside any hole.
+func polygonContains(g Geometry, p vector) bool {
+	if !ringContains(g.Rings[0], p) {
+		return false
+	}
+	for _, hole := range g.Rings[1:] {
+		if ringContains(hole, p) && !onRing(hole, p) {
+			return false
+		}
+	}
+	return true
+}
+
+func onRing(ring []Point, p vector) bool {
+	for i := 1; i < len(ring); i++ {
+		if onArc(p, toVector(ring[i-1]), toVector(ring[i])) {
+			return true
+		}
+	}
+	return false
+}
+
+// edgesCross reports whether any edge of the first geometry intersects any
+// edge of the second.
+func edgesCross(g1, g2 Geometry) bool {
+	crossed := false
+	g1.edges(func(a, b Point) bool {
+		va, vb := toVector(a), toVector(b)
+		g2.edges(func(c, d Point) bool {
+			crossed = arcsIntersect(va, vb, toVector(c), toVector(d))
+			return !crossed
+		})
+		return !crossed
+	})
+	return crossed
+}
+
+// containsPoint reports whether the given geometry contains or touches the
+// point p.
+func containsPoint(g Geometry, p vector) bool {
+	switch g.Kind {
+	case PointKind:
+		return toVector(g.Point()).angle(p) < epsilon
+	case LineKind:
+		return onRing(g.Rings[0], p)
+	}
+	return polygonContains(g, p)
+}
+
+// Intersects reports whether two geometries have any point in common.
+func Intersects(g1, g2 Geometry) bool {
+	if g1.Kind == PointKind {
+		return containsPoint(g2, toVector(g1.Point()))
+	}
+	if g2.Kind == PointKind {
+		return containsPoint(g1, toVector(g2.Point()))
+	}
+	if edgesCross(g1, g2) {
+		return true
+	}
+	// Without crossing edges, one geometry can only intersect the other by
+	// being entirely inside it.
+	return (g2.Kind == PolygonKind && polygonContains(g2, toVector(g1.Rings[0][0]))) ||
+		(g1.Kind == PolygonKind && polygonContains(g1, toVector(g2.Rings[0][0])))
+}
+
+// Includes reports whether the polygon g1 completely contains g2. It is
+// always false if g1 is not a polygon.
+func Includes(g1, g2 Geometry) bool {
+	if g1.Kind != PolygonKind {
+		return false
+	}
+	for _, p := range g2.vertices() {
+		if !polygonContains(g1, toVector(p)) {
+			return false
+		}
+	}
+	if g2.Kind == PointKind {
+		return true
+	}
+
+	// Every vertex is inside, so g2 is included unless one of its edges
+	// leaves the polygon between vertices or it encloses one of the holes.
+	crossesBoundary := false
+	g2.edges(func(a, b Point) bool {
+		va, vb := toVector(a), toVector(b)
+		g1.edges(func(c, d Point) bool {
+			vc, vd := toVector(c), toVector(d)
+			crossesBoundary = arcsIntersect(va, vb, vc, vd) && !onArc(vc, va, vb) && !onArc(vd, va, vb) &&
+				!onArc(va, vc, vd) && !onArc(vb, vc, vd)
+			return !crossesBoundary
+		})
+		return !crossesBoundary
+	})
+	if crossesBoundary {
+		return false
+	}
+	if g2.Kind == PolygonKind {
+		for _, hole := range g1.Rings[1:] {
+			if ringContains(g2.Rings[0], toVector(hole[0])) && !onRing(g2.Rings[0], toVector(hole[0])) {
+				return false
+			}
+		}
+	}
+	return true
+}
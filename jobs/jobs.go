@@ -0,0 +1,148 @@
+// Package jobs tracks the queries running on a server, which are listed in
+// the jobs system table and may be interrupted by deleting their rows.
+package jobs
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The reasons for which jobs are interrupted.
+var (
+	ErrDeleted  = errors.New("its job was deleted")
+	ErrShutdown = errors.New("the server is shutting down")
+)
+
+// Job is a running query.
+type Job struct {
+	ID string
+	// ClientAddress and ClientPort are the address of the connection on
+	// which the query was sent, with the token which identifies it on that
+	// connection.
+	ClientAddress string
+	ClientPort    int
+	Token         uint64
+	// Query is the term of the query, as ReQL.
+	Query   string
+	User    string
+	Started time.Time
+
+	interrupted chan struct{}
+	once        sync.Once
+	reason      error
+}
+
+// Duration returns how long the job has been running.
+func (j *Job) Duration() time.Duration {
+	return time.Since(j.Started)
+}
+
+// Interrupted returns a channel which is closed when the job is interrupted.
+func (j *Job) Interrupted() <-chan struct{} {
+	return j.interrupted
+}
+
+// Err returns the reason the job was interrupted, once it has been.
+func (j *Job) Err() error {
+	select {
+	case <-j.interrupted:
+		return j.reason
+	default:
+		return nil
+	}
+}
+
+func (j *Job) interrupt(reason error) {
+	j.once.Do(func() {
+		j.reason = reason
+		close(j.interrupted)
+	})
+}
+
+// Registry holds the running jobs of a server.
+type Registry struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+func NewRegistry() *Registry {
+	return &Registry{jobs: map[string]*Job{}}
+}
+
+// Start registers a job, which runs until it is finished, and sets its ID and
+// start time.
+func (r *Registry) Start(job *Job) *Job {
+	job.ID = newID()
+	job.Started = time.Now()
+	job.interrupted = make(chan struct{})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[job.ID] = job
+	return job
+}
+
+// Finish removes a job from the registry.
+func (r *Registry) Finish(job *Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.jobs, job.ID)
+}
+
+// List returns the running jobs, oldest first.
+func (r *Registry) List() []*Job {
+	r.mu.Lock()
+	jobs := make([]*Job, 0, len(r.jobs))
+	for _, job := range r.jobs {
+		jobs = append(jobs, job)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Started.Before(jobs[j].Started) })
+	return jobs
+}
+
+// Interrupt interrupts and removes the job with the given ID for the given
+// reason, returning whether it was running.
+func (r *Registry) Interrupt(id string, reason error) bool {
+	r.mu.Lock()
+	job, ok := r.jobs[id]
+	delete(r.jobs, id)
+	r.mu.Unlock()
+
+	if ok {
+		job.interrupt(reason)
+	}
+	return ok
+}
+
+// Drain waits up to the given timeout for every job to finish, returning
+// whether they did.
+func (r *Registry) Drain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		r.mu.Lock()
+		n := len(r.jobs)
+		r.mu.Unlock()
+		if n == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// newID returns a random version 4 UUID.
+func newID() string {
+	var uuid [16]byte
+	rand.Read(uuid[:])
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	first := r.Start(&Job{Token: 1})
+	second := r.Start(&Job{Token: 2})
+	if first.ID == second.ID {
+		t.Fatalf("expected distinct job IDs but got %s twice", first.ID)
+	}
+	if jobs := r.List(); len(jobs) != 2 || jobs[0] != first || jobs[1] != second {
+		t.Errorf("expected both jobs, oldest first, but got %v", jobs)
+	}
+
+	r.Finish(first)
+	if r.Interrupt(first.ID, ErrDeleted) {
+		t.Error("expected a finished job not to be interrupted")
+	}
+	select {
+	case <-first.Interrupted():
+		t.Error("expected the finished job not to be interrupted")
+	default:
+	}
+
+	if !r.Interrupt(second.ID, ErrShutdown) {
+		t.Error("expected the running job to be interrupted")
+	}
+	select {
+	case <-second.Interrupted():
+	default:
+		t.Error("expected the interrupted job's channel to be closed")
+	}
+	if second.Err() != ErrShutdown {
+		t.Errorf("expected the job to be interrupted by the shutdown but got %v", second.Err())
+	}
+	if jobs := r.List(); len(jobs) != 0 {
+		t.Errorf("expected no jobs but got %v", jobs)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	r := NewRegistry()
+	job := r.Start(&Job{Token: 1})
+	if r.Drain(20 * time.Millisecond) {
+		t.Error("expected a running job not to be drained")
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		r.Finish(job)
+	}()
+	if !r.Drain(time.Second) {
+		t.Error("expected the finished job to be drained")
+	}
+}
@@ -2,72 +2,226 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"io"
 	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	bolt "go.etcd.io/bbolt"
 	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
 
+	"github.com/jlhawn/reboltdb/catalog"
+	"github.com/jlhawn/reboltdb/jobs"
 	"github.com/jlhawn/reboltdb/json"
 	"github.com/jlhawn/reboltdb/query"
+	"github.com/jlhawn/reboltdb/query/values"
 	"github.com/jlhawn/reboltdb/server"
+	"github.com/jlhawn/reboltdb/stats"
+	"github.com/jlhawn/reboltdb/storage"
+	"github.com/jlhawn/reboltdb/system"
+	"github.com/jlhawn/reboltdb/users"
 )
 
+// usage is printed for unknown commands. The serve command is the default.
+const usage = `Usage: reboltdb [serve] [options]
+
+Run "reboltdb serve -help" for the options of the serve command.`
+
 func main() {
-	db, err := bolt.Open(".boltdb", 0666, nil)
-	if err != nil {
-		log.Fatalf("Unable to open underlying boltdb")
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if args[0] != "serve" {
+			fmt.Fprintf(os.Stderr, "Unknown command: %s\n%s\n", args[0], usage)
+			os.Exit(2)
+		}
+		args = args[1:]
 	}
-	defer db.Close()
 
-	listener, err := net.Listen("tcp", ":28015")
+	cfg, err := parseServeConfig(args)
+	if err == flag.ErrHelp {
+		return
+	}
 	if err != nil {
-		log.Fatalf("Unable to listen for tcp connections: %s", err)
+		fmt.Fprintf(os.Stderr, "Invalid options: %s\n", err)
+		os.Exit(2)
 	}
-	defer listener.Close()
 
-	log.Infof("Listening for TCP connections on %s", listener.Addr())
+	if err := serve(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	for {
-		conn, err := listener.Accept()
+// serve runs a server with the given configuration until it fails.
+func serve(cfg *serveConfig) error {
+	level, err := log.ParseLevel(cfg.logLevel)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(level)
+	if cfg.logFile != "" {
+		logFile, err := os.OpenFile(cfg.logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 		if err != nil {
-			log.Fatalf("Unable to accept connection: %s", err)
+			return fmt.Errorf("unable to open log file: %s", err)
 		}
+		defer logFile.Close()
+		log.SetOutput(io.MultiWriter(os.Stderr, logFile))
+	}
 
-		log.Infof("Accepted connection from %s", conn.RemoteAddr())
+	tlsConfig, err := server.TLSConfig(cfg.tls)
+	if err != nil {
+		return fmt.Errorf("unable to configure TLS: %s", err)
+	}
 
-		go handleConnection(conn, db)
+	if err := os.MkdirAll(cfg.directory, 0755); err != nil {
+		return fmt.Errorf("unable to create data directory: %s", err)
 	}
-}
+	// The database file is locked while it is open, so a second server
+	// given the same directory fails rather than waits.
+	db, err := bolt.Open(filepath.Join(cfg.directory, "data.boltdb"), 0666, &bolt.Options{
+		Timeout:         time.Second,
+		InitialMmapSize: cfg.initialMmapSize,
+	})
+	if err == bolt.ErrTimeout {
+		return fmt.Errorf("unable to open the database in %s: it is in use by another server", cfg.directory)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open the database in %s: %s", cfg.directory, err)
+	}
+	defer db.Close()
 
-func handleConnection(conn net.Conn, db *bolt.DB) {
-	defer conn.Close()
-	reader := bufio.NewReader(conn)
+	userStore, err := users.Open(db, cfg.initialPassword)
+	if err != nil {
+		return fmt.Errorf("unable to open users: %s", err)
+	}
 
-	if err := server.DoHandshake(conn, reader); err != nil {
-		log.Errorf("Unable to perform handshake: %s", err)
-		return
+	cat, err := catalog.Open(db)
+	if err != nil {
+		return fmt.Errorf("unable to open catalog: %s", err)
 	}
 
-	qs := &queryServer{
-		queryCache: map[uint64]struct{}{},
-		conn:       conn,
-		reader:     reader,
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("unable to get hostname: %s", err)
+	}
+	name := cfg.serverName
+	if name == "" {
+		name = serverName(hostname)
+	}
+	data, err := storage.Open(db, query.LoadFunction, query.RunWriteHook)
+	if err != nil {
+		return fmt.Errorf("unable to open table data: %s", err)
 	}
 
-	if err := qs.handleQueries(); err != nil {
-		log.Errorf("Unable to handle queries: %s", err)
-		return
+	registry := jobs.NewRegistry()
+	counters := stats.New(db)
+	sys := system.New(cat, data, userStore, registry, counters, system.Server{
+		ID:          cat.ServerID(),
+		Name:        name,
+		Hostname:    hostname,
+		ReqlPort:    cfg.port(),
+		CacheSizeMB: cfg.cacheSizeMB(),
+		Version:     "ReboltDB 0.1.0",
+		Started:     time.Now(),
+		Argv:        redactArgs(os.Args),
+	})
+
+	var listeners []net.Listener
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+	for _, addr := range cfg.listenAddrs() {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("unable to listen for tcp connections: %s", err)
+		}
+		if tlsConfig != nil {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
+		listeners = append(listeners, listener)
+		log.Infof("Listening for TCP connections on %s (TLS: %t)", listener.Addr(), tlsConfig != nil)
 	}
+
+	srv := newReqlServer(sys, userStore, registry, counters)
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			errs <- srv.serve(listener)
+		}(listener)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("unable to accept connections: %s", err)
+	case sig := <-signals:
+		log.Infof("Received %s, shutting down", sig)
+	}
+	srv.shutdown(listeners, cfg.shutdownTimeout)
+	log.Infof("Shut down")
+	return nil
+}
+
+// serverName returns the name of a server on the given host, which is the
+// hostname with any characters not allowed in names replaced.
+func serverName(hostname string) string {
+	name := []byte(hostname)
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			name[i] = '_'
+		}
+	}
+	return string(name)
 }
 
 type queryServer struct {
-	queryCache map[uint64]struct{}
-	conn       net.Conn
-	reader     *bufio.Reader
+	conn   net.Conn
+	reader *bufio.Reader
+	// system resolves the databases and tables named in queries.
+	system *system.System
+	// jobs holds the running queries of every connection.
+	jobs *jobs.Registry
+	// stats counts the queries of every connection. The connection is
+	// counted as an active client while running is not zero.
+	stats   *stats.Stats
+	running int32
+	// users holds the permissions of user, as whom the queries run.
+	users *users.Store
+	user  string
+	// draining is closed when the server begins to shut down, after which
+	// new queries are refused.
+	draining <-chan struct{}
+	// inflight tracks the queries which are being evaluated or continued.
+	// It is only added to while holding mu, and not at all once stopped is
+	// set, so that shutdown may wait for it.
+	inflight sync.WaitGroup
+
+	// writeMu serializes the responses to queries, which run concurrently.
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	stopped bool
+	// cursors holds the cursors of running queries by token.
+	cursors map[uint64]*cursor
+	// noreplies tracks the running queries which will not be replied to,
+	// which a NOREPLY_WAIT query waits for.
+	noreplies sync.WaitGroup
 }
 
 func (qs *queryServer) handleQueries() error {
@@ -99,8 +253,6 @@ func (qs *queryServer) handleQueries() error {
 		if err := qs.runQuery(token, queryVal); err != nil {
 			return fmt.Errorf("unable to handle query: %s", err)
 		}
-
-		return nil
 	}
 }
 
@@ -134,7 +286,41 @@ func (qs *queryServer) runQuery(token uint64, queryVal json.Value) error {
 		}
 
 		return qs.startQuery(token, queryArray[1], globalOptArgs)
-	case ql2.Query_CONTINUE, ql2.Query_STOP, ql2.Query_NOREPLY_WAIT, ql2.Query_SERVER_INFO:
+	case ql2.Query_CONTINUE:
+		qs.mu.Lock()
+		c, ok := qs.cursors[token]
+		qs.mu.Unlock()
+		if !ok {
+			return qs.writeResponse(token, errorResponse(ql2.Response_CLIENT_ERROR, values.NewError(ql2.Response_QUERY_LOGIC, "Token %d not in stream cache.", token)))
+		}
+
+		if !qs.startWork(false) {
+			return qs.writeResponse(token, errorResponse(ql2.Response_RUNTIME_ERROR, values.NewError(ql2.Response_OP_FAILED, "The server is shutting down.")))
+		}
+		go func() {
+			defer qs.inflight.Done()
+			qs.continueQuery(token, c)
+		}()
+		return nil
+	case ql2.Query_STOP:
+		qs.mu.Lock()
+		c, ok := qs.cursors[token]
+		delete(qs.cursors, token)
+		qs.mu.Unlock()
+		if ok {
+			c.close()
+		}
+
+		return qs.writeResponse(token, response{Type: ql2.Response_SUCCESS_SEQUENCE})
+	case ql2.Query_NOREPLY_WAIT:
+		go func() {
+			qs.noreplies.Wait()
+			if err := qs.writeResponse(token, response{Type: ql2.Response_WAIT_COMPLETE}); err != nil {
+				log.Errorf("Unable to respond to query %d: %s", token, err)
+			}
+		}()
+		return nil
+	case ql2.Query_SERVER_INFO:
 		return fmt.Errorf("query type %s not yet implemented", ql2.Query_QueryType_name[int32(queryType)])
 	default:
 		return fmt.Errorf("unrecognized QueryType: %d", queryType)
@@ -142,18 +328,229 @@ func (qs *queryServer) runQuery(token uint64, queryVal json.Value) error {
 }
 
 func (qs *queryServer) startQuery(token uint64, value json.Value, globalOptArgs json.Object) error {
-	log.Infof("Start Query Global OptArgs: %#v\n", globalOptArgs)
+	log.Debugf("Start Query Global OptArgs: %#v\n", globalOptArgs)
 
-	if _, isDuplicate := qs.queryCache[token]; isDuplicate {
+	qs.mu.Lock()
+	_, isDuplicate := qs.cursors[token]
+	qs.mu.Unlock()
+	if isDuplicate {
 		return fmt.Errorf("duplicate token: %d", token)
 	}
 
 	termTree, err := query.MakeTermTree(value)
 	if err != nil {
-		return fmt.Errorf("unable to parse term tree: %s", err)
+		return qs.writeResponse(token, errorResponse(ql2.Response_COMPILE_ERROR, values.NewError(ql2.Response_QUERY_LOGIC, "%s", err)))
 	}
 
-	log.Infof("Term Tree:\n%s\n", termTree)
+	log.Debugf("Term Tree:\n%s\n", termTree)
+
+	noreply := false
+	if val, ok := globalOptArgs["noreply"]; ok && val.IsBool() {
+		noreply = val.AsBool()
+	}
+
+	defaultDB := catalog.DefaultDB
+	if val, ok := globalOptArgs["db"]; ok {
+		if name, ok := databaseName(val); ok {
+			defaultDB = name
+		}
+	}
 
+	if !qs.startWork(true) {
+		if noreply {
+			return nil
+		}
+		return qs.writeResponse(token, errorResponse(ql2.Response_RUNTIME_ERROR, values.NewError(ql2.Response_OP_FAILED, "The server is shutting down.")))
+	}
+
+	if noreply {
+		qs.noreplies.Add(1)
+	}
+	go func() {
+		defer qs.inflight.Done()
+		if noreply {
+			defer qs.noreplies.Done()
+		}
+		job := qs.startJob(token, termTree)
+		r, c := qs.evalQuery(termTree, defaultDB, job)
+		if c == nil {
+			qs.finishJob(job)
+		} else {
+			// The cursor must be registered before the first batch is
+			// sent, so that the client may continue the query.
+			qs.mu.Lock()
+			qs.cursors[token] = c
+			qs.mu.Unlock()
+			r = qs.nextBatch(token, c)
+		}
+		if noreply {
+			return
+		}
+		if err := qs.writeResponse(token, r); err != nil {
+			log.Errorf("Unable to respond to query %d: %s", token, err)
+		}
+	}()
 	return nil
 }
+
+// startJob starts the job of the query with the given token, which is listed
+// in the jobs system table while it runs.
+func (qs *queryServer) startJob(token uint64, termTree *query.Term) *jobs.Job {
+	qs.stats.Query()
+	if atomic.AddInt32(&qs.running, 1) == 1 {
+		qs.stats.ClientActive()
+	}
+	job := &jobs.Job{Token: token, Query: termTree.String(), User: qs.user}
+	if addr, ok := qs.conn.RemoteAddr().(*net.TCPAddr); ok {
+		job.ClientAddress, job.ClientPort = addr.IP.String(), addr.Port
+	}
+	return qs.jobs.Start(job)
+}
+
+func (qs *queryServer) finishJob(job *jobs.Job) {
+	qs.jobs.Finish(job)
+	if atomic.AddInt32(&qs.running, -1) == 0 {
+		qs.stats.ClientIdle()
+	}
+}
+
+// evalQuery evaluates a query. The result is returned as a response unless it
+// is a sequence, in which case the cursor which returns it is. A panic while
+// evaluating it is returned as a RUNTIME_ERROR.
+func (qs *queryServer) evalQuery(termTree *query.Term, defaultDB string, job *jobs.Job) (r response, c *cursor) {
+	defer func() {
+		if p := recover(); p != nil {
+			r, c = errorResponse(ql2.Response_RUNTIME_ERROR, panicError(p)), nil
+		}
+	}()
+	ctx := query.NewContext().WithUser(qs.users, qs.user).WithCatalog(qs.system).WithDefaultDB(defaultDB).WithJob(job)
+	result, err := termTree.Eval(ctx)
+	if err != nil {
+		return errorResponse(ql2.Response_RUNTIME_ERROR, err), nil
+	}
+
+	switch {
+	case result.IsDatum():
+		return response{Type: ql2.Response_SUCCESS_ATOM, Results: []values.Datum{result.(values.Datum)}}, nil
+	case result.IsSequence():
+		return response{}, newCursor(result.(values.Sequence).AsStream(), job, func() { qs.finishJob(job) })
+	}
+	return errorResponse(ql2.Response_RUNTIME_ERROR, values.NewError(ql2.Response_QUERY_LOGIC, "Query result must be of type DATUM or STREAM.")), nil
+}
+
+func (qs *queryServer) continueQuery(token uint64, c *cursor) {
+	if err := qs.writeResponse(token, qs.nextBatch(token, c)); err != nil {
+		log.Errorf("Unable to respond to query %d: %s", token, err)
+	}
+}
+
+// nextBatch returns the response with the next batch of results from the
+// given cursor. The cursor is removed once its sequence ends. A changefeed
+// never ends unless it is stopped.
+func (qs *queryServer) nextBatch(token uint64, c *cursor) response {
+	batch, done, err := readBatch(c)
+	if err != nil || done {
+		qs.mu.Lock()
+		delete(qs.cursors, token)
+		qs.mu.Unlock()
+		c.close()
+	}
+	if err != nil {
+		return errorResponse(ql2.Response_RUNTIME_ERROR, err)
+	}
+
+	r := response{Type: ql2.Response_SUCCESS_PARTIAL, Results: batch}
+	if c.feed != nil {
+		r.Notes = c.feed.Notes()
+	}
+	if done {
+		r.Type = ql2.Response_SUCCESS_SEQUENCE
+	}
+	return r
+}
+
+// readBatch returns the next batch of results from the given cursor, which
+// ends with an error if reading it panics.
+func readBatch(c *cursor) (batch []values.Datum, done bool, err *values.Error) {
+	defer func() {
+		if p := recover(); p != nil {
+			batch, done, err = nil, true, panicError(p)
+		}
+	}()
+	return c.nextBatch()
+}
+
+// panicError logs a panic while evaluating a query and returns the error which
+// the query fails with, so that the connection and server keep serving.
+func panicError(p interface{}) *values.Error {
+	log.Errorf("Query panicked: %v\n%s", p, debug.Stack())
+	return values.NewError(ql2.Response_INTERNAL, "Internal error: %v", p)
+}
+
+// startWork adds a query which is about to be evaluated, or continued if
+// isNew is false, to inflight. New queries are refused once the server is
+// draining, and continued ones once stopWork has been called.
+func (qs *queryServer) startWork(isNew bool) bool {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	if qs.stopped {
+		return false
+	}
+	if isNew {
+		select {
+		case <-qs.draining:
+			return false
+		default:
+		}
+	}
+	qs.inflight.Add(1)
+	return true
+}
+
+// stopWork refuses any further work on the connection, after which inflight
+// may be waited for.
+func (qs *queryServer) stopWork() {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	qs.stopped = true
+}
+
+// interruptFeeds interrupts the changefeeds of the connection, which end with
+// an error.
+func (qs *queryServer) interruptFeeds() {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	for _, c := range qs.cursors {
+		if c.feed != nil {
+			qs.jobs.Interrupt(c.job.ID, jobs.ErrShutdown)
+		}
+	}
+}
+
+func (qs *queryServer) closeCursors() {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	for token, c := range qs.cursors {
+		c.close()
+		delete(qs.cursors, token)
+	}
+}
+
+// databaseName returns the name of the database of the given term, which is
+// how the db global optarg of a query is encoded: [DB, [name]].
+func databaseName(term json.Value) (string, bool) {
+	if !term.IsArray() {
+		return "", false
+	}
+	parts := term.AsArray()
+	if len(parts) < 2 || !parts[0].IsNumber() || ql2.Term_TermType(parts[0].AsInt64()) != ql2.Term_DB || !parts[1].IsArray() {
+		return "", false
+	}
+	args := parts[1].AsArray()
+	if len(args) != 1 || !args[0].IsString() {
+		return "", false
+	}
+	return args[0].AsString(), true
+}
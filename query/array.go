@@ -0,0 +1,283 @@
+package query
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_APPEND] = evalAppend
+	evalFuncs[ql2.Term_PREPEND] = evalPrepend
+	evalFuncs[ql2.Term_DIFFERENCE] = evalDifference
+	evalFuncs[ql2.Term_SET_INSERT] = evalSetInsert
+	evalFuncs[ql2.Term_SET_UNION] = evalSetUnion
+	evalFuncs[ql2.Term_SET_INTERSECTION] = evalSetIntersection
+	evalFuncs[ql2.Term_SET_DIFFERENCE] = evalSetDifference
+	evalFuncs[ql2.Term_INSERT_AT] = evalInsertAt
+	evalFuncs[ql2.Term_DELETE_AT] = evalDeleteAt
+	evalFuncs[ql2.Term_CHANGE_AT] = evalChangeAt
+	evalFuncs[ql2.Term_SPLICE_AT] = evalSpliceAt
+}
+
+// evalArrayAndDatum evaluates the two arguments of a term which takes an array
+// and a datum.
+func evalArrayAndDatum(ctx *Context, t *Term) (values.Array, values.Datum, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return values.Array{}, nil, err
+	}
+	arr, err := evalArray(ctx, t.Args[0])
+	if err != nil {
+		return values.Array{}, nil, err
+	}
+	val, err := evalDatum(ctx, t.Args[1])
+	if err != nil {
+		return values.Array{}, nil, err
+	}
+	return arr, val, nil
+}
+
+// evalArrayPair evaluates the two arguments of a term which takes two arrays.
+func evalArrayPair(ctx *Context, t *Term) (values.Array, values.Array, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return values.Array{}, values.Array{}, err
+	}
+	first, err := evalArray(ctx, t.Args[0])
+	if err != nil {
+		return values.Array{}, values.Array{}, err
+	}
+	second, err := evalArray(ctx, t.Args[1])
+	if err != nil {
+		return values.Array{}, values.Array{}, err
+	}
+	return first, second, nil
+}
+
+func evalAppend(ctx *Context, t *Term) (values.Top, *values.Error) {
+	arr, val, err := evalArrayAndDatum(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]values.Datum, 0, len(arr.Items())+1)
+	items = append(items, arr.Items()...)
+	return values.NewArray(append(items, val)), nil
+}
+
+func evalPrepend(ctx *Context, t *Term) (values.Top, *values.Error) {
+	arr, val, err := evalArrayAndDatum(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]values.Datum, 0, len(arr.Items())+1)
+	items = append(items, val)
+	return values.NewArray(append(items, arr.Items()...)), nil
+}
+
+// containsDatum reports whether any of the given items is equal to the given
+// datum.
+func containsDatum(items []values.Datum, d values.Datum) bool {
+	for _, item := range items {
+		if values.Equal(item, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// evalDifference removes every element of the first array which is equal to
+// any element of the second array. Unlike SET_DIFFERENCE, duplicates are
+// preserved.
+func evalDifference(ctx *Context, t *Term) (values.Top, *values.Error) {
+	arr, remove, err := evalArrayPair(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	var items []values.Datum
+	for _, item := range arr.Items() {
+		if !containsDatum(remove.Items(), item) {
+			items = append(items, item)
+		}
+	}
+	return values.NewArray(items), nil
+}
+
+// distinct returns the given items with any duplicates removed, keeping the
+// first occurrence of each.
+func distinct(items []values.Datum) []values.Datum {
+	var set []values.Datum
+	for _, item := range items {
+		if !containsDatum(set, item) {
+			set = append(set, item)
+		}
+	}
+	return set
+}
+
+func evalSetInsert(ctx *Context, t *Term) (values.Top, *values.Error) {
+	arr, val, err := evalArrayAndDatum(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	set := distinct(arr.Items())
+	if !containsDatum(set, val) {
+		set = append(set, val)
+	}
+	return values.NewArray(set), nil
+}
+
+func evalSetUnion(ctx *Context, t *Term) (values.Top, *values.Error) {
+	first, second, err := evalArrayPair(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]values.Datum, 0, len(first.Items())+len(second.Items()))
+	items = append(items, first.Items()...)
+	return values.NewArray(distinct(append(items, second.Items()...))), nil
+}
+
+func evalSetIntersection(ctx *Context, t *Term) (values.Top, *values.Error) {
+	first, second, err := evalArrayPair(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	var set []values.Datum
+	for _, item := range distinct(first.Items()) {
+		if containsDatum(second.Items(), item) {
+			set = append(set, item)
+		}
+	}
+	return values.NewArray(set), nil
+}
+
+func evalSetDifference(ctx *Context, t *Term) (values.Top, *values.Error) {
+	first, second, err := evalArrayPair(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	var set []values.Datum
+	for _, item := range distinct(first.Items()) {
+		if !containsDatum(second.Items(), item) {
+			set = append(set, item)
+		}
+	}
+	return values.NewArray(set), nil
+}
+
+// arrayIndex converts the given index into an offset from the start of an
+// array of the given size. Negative indexes count back from the end of the
+// array. When spaces is true the index refers to the positions between
+// elements, so there is one more valid index than there are elements.
+func arrayIndex(index int64, size int, spaces bool) (int, *values.Error) {
+	limit := int64(size)
+	if spaces {
+		limit++
+	}
+	canonical := index
+	if canonical < 0 {
+		canonical += limit
+	}
+	if canonical < 0 || canonical >= limit {
+		return 0, nonExistenceError("Index `%d` out of bounds for array of size: `%d`.", index, size)
+	}
+	return int(canonical), nil
+}
+
+// evalArrayIndex evaluates the first two arguments of a term which modifies an
+// array at an index.
+func evalArrayIndex(ctx *Context, t *Term, spaces bool) (values.Array, int, *values.Error) {
+	arr, err := evalArray(ctx, t.Args[0])
+	if err != nil {
+		return values.Array{}, 0, err
+	}
+	index, err := evalInteger(ctx, t.Args[1])
+	if err != nil {
+		return values.Array{}, 0, err
+	}
+	offset, err := arrayIndex(index, len(arr.Items()), spaces)
+	if err != nil {
+		return values.Array{}, 0, err
+	}
+	return arr, offset, nil
+}
+
+// spliceItems returns a new slice with the items in [start, end) of the given
+// items replaced by the given insert items.
+func spliceItems(items []values.Datum, start, end int, insert ...values.Datum) []values.Datum {
+	spliced := make([]values.Datum, 0, len(items)-(end-start)+len(insert))
+	spliced = append(spliced, items[:start]...)
+	spliced = append(spliced, insert...)
+	return append(spliced, items[end:]...)
+}
+
+func evalInsertAt(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(3, 3); err != nil {
+		return nil, err
+	}
+	arr, offset, err := evalArrayIndex(ctx, t, true)
+	if err != nil {
+		return nil, err
+	}
+	val, err := evalDatum(ctx, t.Args[2])
+	if err != nil {
+		return nil, err
+	}
+	return values.NewArray(spliceItems(arr.Items(), offset, offset, val)), nil
+}
+
+func evalSpliceAt(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(3, 3); err != nil {
+		return nil, err
+	}
+	arr, offset, err := evalArrayIndex(ctx, t, true)
+	if err != nil {
+		return nil, err
+	}
+	insert, err := evalArray(ctx, t.Args[2])
+	if err != nil {
+		return nil, err
+	}
+	return values.NewArray(spliceItems(arr.Items(), offset, offset, insert.Items()...)), nil
+}
+
+func evalChangeAt(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(3, 3); err != nil {
+		return nil, err
+	}
+	arr, offset, err := evalArrayIndex(ctx, t, false)
+	if err != nil {
+		return nil, err
+	}
+	val, err := evalDatum(ctx, t.Args[2])
+	if err != nil {
+		return nil, err
+	}
+	return values.NewArray(spliceItems(arr.Items(), offset, offset+1, val)), nil
+}
+
+// evalDeleteAt deletes either the element at a single index or the elements in
+// the range from the first index up to but not including the second.
+func evalDeleteAt(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 3); err != nil {
+		return nil, err
+	}
+	arr, start, err := evalArrayIndex(ctx, t, false)
+	if err != nil {
+		return nil, err
+	}
+
+	end := start + 1
+	if len(t.Args) == 3 {
+		endIndex, err := evalInteger(ctx, t.Args[2])
+		if err != nil {
+			return nil, err
+		}
+		if end, err = arrayIndex(endIndex, len(arr.Items()), true); err != nil {
+			return nil, err
+		}
+		if end < start {
+			return nil, queryLogicError("Start index `%d` is greater than end index `%d`.", start, end)
+		}
+	}
+
+	return values.NewArray(spliceItems(arr.Items(), start, end)), nil
+}
@@ -0,0 +1,33 @@
+package query
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_BINARY] = evalBinary
+}
+
+// evalBinary evaluates r.binary(data). A string is converted to the bytes of
+// its UTF-8 encoding and a binary value is returned unchanged. Drivers which
+// send binary data as a BINARY pseudo type object have it converted when the
+// object is evaluated.
+func evalBinary(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	val, err := evalDatum(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case val.IsBinary():
+		return val, nil
+	case val.IsString():
+		return values.NewBinary([]byte(val.AsString().Value())), nil
+	}
+	return nil, typeError(types.String, val)
+}
@@ -0,0 +1,62 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/jlhawn/reboltdb/json"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func TestBinaryTerms(t *testing.T) {
+	const hello = `{"$reql_type$": "BINARY", "data": "aGVsbG8="}`
+
+	binary := func(data string) map[string]interface{} {
+		return map[string]interface{}{"$reql_type$": "BINARY", "data": data}
+	}
+
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		{hello, binary("aGVsbG8=")},
+		{`[155, ["hello"]]`, binary("aGVsbG8=")},
+		{`[155, [` + hello + `]]`, binary("aGVsbG8=")},
+		{`[17, [[155, ["hello"]], ` + hello + `]]`, true},
+		{`[19, [[155, ["a"]], [155, ["b"]]]]`, true},
+		{`[30, [` + hello + `, 1, 3]]`, binary("ZWw=")},
+		{`[30, [` + hello + `, -2]]`, binary("bG8=")},
+		{`[43, [` + hello + `]]`, 5.0},
+		{`[43, ["héllo"]]`, 5.0},
+		{`[43, [[2, [1, 2, 1]], 1]]`, 2.0},
+		{`[51, [` + hello + `, "string"]]`, "hello"},
+		{`[51, ["hello", "binary"]]`, binary("aGVsbG8=")},
+		{`[51, [` + hello + `, "BINARY"]]`, binary("aGVsbG8=")},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+
+	for _, query := range []string{
+		`{"$reql_type$": "BINARY", "data": "not base64!"}`,
+		`[155, [1]]`,
+		`[51, [{"$reql_type$": "BINARY", "data": "/w=="}, "string"]]`,
+	} {
+		if _, err := evalQuery(t, query, nil); err == nil {
+			t.Errorf("expected an error evaluating %s", query)
+		}
+	}
+}
+
+func TestBinaryFromJSON(t *testing.T) {
+	// Binary values are stored in their pseudo type encoding and must be
+	// restored when they are read back.
+	val, err := json.Parse([]byte(`{"thumb": {"$reql_type$": "BINARY", "data": "AAEC/w=="}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumb := values.FromJSON(val).AsObject().Items()["thumb"]
+	if !thumb.IsBinary() || string(thumb.AsBinary().Data()) != "\x00\x01\x02\xff" {
+		t.Errorf("expected binary data but got %v", native(t, thumb))
+	}
+}
@@ -0,0 +1,137 @@
+package query
+
+import (
+	"math/bits"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_BIT_AND] = makeBitwiseFold(func(a, b int64) int64 { return a & b })
+	evalFuncs[ql2.Term_BIT_OR] = makeBitwiseFold(func(a, b int64) int64 { return a | b })
+	evalFuncs[ql2.Term_BIT_XOR] = makeBitwiseFold(func(a, b int64) int64 { return a ^ b })
+	evalFuncs[ql2.Term_BIT_NOT] = evalBitNot
+	evalFuncs[ql2.Term_BIT_SAL] = evalBitSal
+	evalFuncs[ql2.Term_BIT_SAR] = evalBitSar
+}
+
+// safeInteger returns the given number as an integer, requiring that it is
+// an integer which a number can represent exactly.
+func safeInteger(num values.Number) (int64, *values.Error) {
+	if !num.IsSafeInteger() {
+		if num.IsInteger() {
+			return 0, queryLogicError("Number not an integer (>2^53): %v", num.Float64())
+		}
+		return 0, queryLogicError("Number not an integer: %v", num.Float64())
+	}
+	return num.Int64(), nil
+}
+
+// safeIntegerResult returns the result of a bitwise operation as a number,
+// requiring that it is within the range of integers which a number can
+// represent exactly.
+func safeIntegerResult(result int64) (values.Top, *values.Error) {
+	if result > values.MaxSafeInteger || result < -values.MaxSafeInteger {
+		return nil, queryLogicError("Integer result of bitwise operation out of range (>2^53): %d", result)
+	}
+	return values.NewNumber(float64(result)), nil
+}
+
+func evalSafeIntegerArgs(ctx *Context, t *Term, min int) ([]int64, *values.Error) {
+	args, err := evalDatumArgs(ctx, t, min)
+	if err != nil {
+		return nil, err
+	}
+	ints := make([]int64, len(args))
+	for i, arg := range args {
+		if !arg.IsNumber() {
+			return nil, typeError(types.Number, arg)
+		}
+		if ints[i], err = safeInteger(arg.AsNumber()); err != nil {
+			return nil, err
+		}
+	}
+	return ints, nil
+}
+
+// makeBitwiseFold returns an evaluator for a term which combines two or more
+// integers using the given bitwise operation.
+func makeBitwiseFold(op func(a, b int64) int64) termEvaluator {
+	return func(ctx *Context, t *Term) (values.Top, *values.Error) {
+		ints, err := evalSafeIntegerArgs(ctx, t, 2)
+		if err != nil {
+			return nil, err
+		}
+		result := ints[0]
+		for _, i := range ints[1:] {
+			result = op(result, i)
+		}
+		return safeIntegerResult(result)
+	}
+}
+
+func evalBitNot(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	ints, err := evalSafeIntegerArgs(ctx, t, 1)
+	if err != nil {
+		return nil, err
+	}
+	return safeIntegerResult(^ints[0])
+}
+
+// evalShiftArgs evaluates the arguments of an arithmetic shift: an integer
+// and a non-negative number of bits.
+func evalShiftArgs(ctx *Context, t *Term) (int64, int64, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return 0, 0, err
+	}
+	ints, err := evalSafeIntegerArgs(ctx, t, 2)
+	if err != nil {
+		return 0, 0, err
+	}
+	if ints[1] < 0 {
+		return 0, 0, queryLogicError("Cannot shift by a negative number of bits: %d", ints[1])
+	}
+	return ints[0], ints[1], nil
+}
+
+// evalBitSal shifts an integer left, preserving its sign. The result must be
+// within the range of safe integers, which is checked before shifting so
+// that bits shifted out of an int64 are not silently lost.
+func evalBitSal(ctx *Context, t *Term) (values.Top, *values.Error) {
+	a, n, err := evalShiftArgs(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if a == 0 {
+		return values.NewNumber(0), nil
+	}
+	magnitude := uint64(a)
+	if a < 0 {
+		magnitude = uint64(-a)
+	}
+	// A result of more than 54 bits is out of range, while one of exactly
+	// 54 bits may be 2^53 itself.
+	if int64(bits.Len64(magnitude))+n > 54 {
+		return nil, queryLogicError("Integer result of bitwise operation out of range (>2^53): %d << %d", a, n)
+	}
+	return safeIntegerResult(a << uint(n))
+}
+
+// evalBitSar shifts an integer right, preserving its sign.
+func evalBitSar(ctx *Context, t *Term) (values.Top, *values.Error) {
+	a, n, err := evalShiftArgs(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	// Shifting by 63 or more bits leaves either zero or -1.
+	if n > 63 {
+		n = 63
+	}
+	return safeIntegerResult(a >> uint(n))
+}
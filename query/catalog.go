@@ -0,0 +1,288 @@
+package query
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+func init() {
+	evalFuncs[ql2.Term_DB] = evalDB
+	evalFuncs[ql2.Term_TABLE] = evalTableTerm
+	evalFuncs[ql2.Term_DB_CREATE] = evalDBCreate
+	evalFuncs[ql2.Term_DB_DROP] = evalDBDrop
+	evalFuncs[ql2.Term_DB_LIST] = evalDBList
+	evalFuncs[ql2.Term_TABLE_CREATE] = evalTableCreate
+	evalFuncs[ql2.Term_TABLE_DROP] = evalTableDrop
+	evalFuncs[ql2.Term_TABLE_LIST] = evalTableList
+}
+
+// systemDB is the database of system tables.
+const systemDB = "rethinkdb"
+
+// Catalog resolves the databases and tables named in queries, and creates
+// and drops them. Those which are created or dropped are described by their
+// rows of db_config or table_config.
+type Catalog interface {
+	Database(name string) (values.Database, *values.Error)
+	Table(db, name string) (values.Table, *values.Error)
+	DatabaseNames() ([]string, *values.Error)
+	TableNames(db string) ([]string, *values.Error)
+	CreateDatabase(name string) (values.Datum, *values.Error)
+	DropDatabase(name string) (config values.Datum, tablesDropped int, err *values.Error)
+	CreateTable(db, name, primaryKey, durability string) (values.Datum, *values.Error)
+	DropTable(db, name string) (values.Datum, *values.Error)
+}
+
+func (ctx *Context) getCatalog() (Catalog, *values.Error) {
+	if ctx.catalog == nil {
+		return nil, values.NewError(ql2.Response_OP_FAILED, "There are no databases.")
+	}
+	return ctx.catalog, nil
+}
+
+func evalDB(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	name, err := evalString(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := ctx.getCatalog()
+	if err != nil {
+		return nil, err
+	}
+	return catalog.Database(name)
+}
+
+// evalTableTerm returns the named table of the database given as the first
+// argument, or of the default database. The user running the query must be
+// permitted to read it, even to count its rows or to write to it.
+func evalTableTerm(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 2); err != nil {
+		return nil, err
+	}
+	dbName, args := ctx.defaultDB, t.Args
+	if len(args) == 2 {
+		db, err := evalDatabase(ctx, args[0])
+		if err != nil {
+			return nil, err
+		}
+		dbName, args = db.Name(), args[1:]
+	}
+	name, err := evalString(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := ctx.getCatalog()
+	if err != nil {
+		return nil, err
+	}
+	table, err := catalog.Table(dbName, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.authorize(users.Read, tableScope(table)); err != nil {
+		return nil, err
+	}
+	if ctx.job != nil {
+		table = table.WithInterrupt(ctx.interrupted)
+	}
+	return table, nil
+}
+
+func evalDatabase(ctx *Context, t *Term) (values.Database, *values.Error) {
+	val, err := t.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !val.IsDatabase() {
+		return nil, typeError(types.Database, val)
+	}
+	return val.(values.Database), nil
+}
+
+// configChanges returns the result of creating or dropping a database or
+// table, whose row of db_config or table_config changed from oldVal to
+// newVal.
+func configChanges(field string, oldVal, newVal values.Datum, fields map[string]values.Datum) values.Object {
+	if fields == nil {
+		fields = map[string]values.Datum{}
+	}
+	if oldVal == nil {
+		oldVal = values.Null{}
+	}
+	if newVal == nil {
+		newVal = values.Null{}
+	}
+	fields[field] = values.NewNumber(1)
+	fields["config_changes"] = values.NewArray([]values.Datum{
+		values.NewObject(map[string]values.Datum{"old_val": oldVal, "new_val": newVal}),
+	})
+	return values.NewObject(fields)
+}
+
+func evalDBCreate(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	name, err := evalString(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := ctx.getCatalog()
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.authorize(users.Config, users.Global); err != nil {
+		return nil, err
+	}
+	config, err := catalog.CreateDatabase(name)
+	if err != nil {
+		return nil, err
+	}
+	return configChanges("dbs_created", nil, config, nil), nil
+}
+
+func evalDBDrop(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	name, err := evalString(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := ctx.getCatalog()
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.authorize(users.Config, users.Global); err != nil {
+		return nil, err
+	}
+	config, tablesDropped, err := catalog.DropDatabase(name)
+	if err != nil {
+		return nil, err
+	}
+	return configChanges("dbs_dropped", config, nil, map[string]values.Datum{
+		"tables_dropped": values.NewNumber(float64(tablesDropped)),
+	}), nil
+}
+
+// namesArray returns the given names as an array of strings.
+func namesArray(names []string) values.Array {
+	items := make([]values.Datum, len(names))
+	for i, name := range names {
+		items[i] = values.NewString(name)
+	}
+	return values.NewArray(items)
+}
+
+func evalDBList(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(0, 0); err != nil {
+		return nil, err
+	}
+	catalog, err := ctx.getCatalog()
+	if err != nil {
+		return nil, err
+	}
+	names, err := catalog.DatabaseNames()
+	if err != nil {
+		return nil, err
+	}
+	return namesArray(names), nil
+}
+
+// evalTableDB evaluates the database of a term whose last `named` arguments
+// name a table, which is the first argument if there are more of them, or
+// else the default database. It returns the catalog, the database and the
+// arguments which name the table.
+func evalTableDB(ctx *Context, t *Term, named int) (Catalog, values.Database, []*Term, *values.Error) {
+	catalog, err := ctx.getCatalog()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(t.Args) == named {
+		db, err := catalog.Database(ctx.defaultDB)
+		return catalog, db, t.Args, err
+	}
+	db, err := evalDatabase(ctx, t.Args[0])
+	return catalog, db, t.Args[1:], err
+}
+
+// evalTableConfigDB evaluates the database of a TABLE_CREATE or TABLE_DROP
+// term, on which the user running the query must have the Config
+// permission, and the name of the table.
+func evalTableConfigDB(ctx *Context, t *Term) (Catalog, string, string, *values.Error) {
+	if err := t.checkArity(1, 2); err != nil {
+		return nil, "", "", err
+	}
+	catalog, db, args, err := evalTableDB(ctx, t, 1)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if err := ctx.authorize(users.Config, users.Scope{DB: db.ID()}); err != nil {
+		return nil, "", "", err
+	}
+	name, err := evalString(ctx, args[0])
+	if err != nil {
+		return nil, "", "", err
+	}
+	return catalog, db.Name(), name, nil
+}
+
+// evalTableCreate creates a table with the `primary_key` and `durability`
+// options, which default to "id" and "hard".
+func evalTableCreate(ctx *Context, t *Term) (values.Top, *values.Error) {
+	catalog, dbName, name, err := evalTableConfigDB(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	options := map[string]string{"primary_key": "id", "durability": "hard"}
+	for option := range options {
+		val, err := evalOptArg(ctx, t, option)
+		if err != nil {
+			return nil, err
+		}
+		if val != nil {
+			if !val.IsString() {
+				return nil, typeError(types.String, val)
+			}
+			options[option] = val.AsString().Value()
+		}
+	}
+	config, err := catalog.CreateTable(dbName, name, options["primary_key"], options["durability"])
+	if err != nil {
+		return nil, err
+	}
+	return configChanges("tables_created", nil, config, nil), nil
+}
+
+func evalTableDrop(ctx *Context, t *Term) (values.Top, *values.Error) {
+	catalog, dbName, name, err := evalTableConfigDB(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	config, err := catalog.DropTable(dbName, name)
+	if err != nil {
+		return nil, err
+	}
+	return configChanges("tables_dropped", config, nil, nil), nil
+}
+
+func evalTableList(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(0, 1); err != nil {
+		return nil, err
+	}
+	catalog, db, _, err := evalTableDB(ctx, t, 0)
+	if err != nil {
+		return nil, err
+	}
+	names, err := catalog.TableNames(db.Name())
+	if err != nil {
+		return nil, err
+	}
+	return namesArray(names), nil
+}
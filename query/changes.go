@@ -0,0 +1,206 @@
+package query
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/feed"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+func init() {
+	evalFuncs[ql2.Term_CHANGES] = evalChanges
+}
+
+// evalChanges returns a feed of the changes to the rows selected by its
+// argument: a table, a single row, a range of rows or the first rows in the
+// order of an index. FILTER and MAP terms between the selection and CHANGES
+// are applied to each change.
+func evalChanges(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	opts, err := evalOptArgs(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := feed.ParseOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return changes(ctx, t.Args[0], opts, parsed)
+}
+
+func changes(ctx *Context, src *Term, opts values.Object, parsed feed.Options) (values.Feed, *values.Error) {
+	switch {
+	case src.Type == ql2.Term_FILTER:
+		if err := src.checkArity(2, 2); err != nil {
+			return nil, err
+		}
+		keep, err := evalPredicate(ctx, src.Args[1])
+		if err != nil {
+			return nil, err
+		}
+		return transformChanges(ctx, src.Args[0], opts, parsed, func(row values.Datum) (values.Datum, *values.Error) {
+			if ok, err := keep(row); err != nil || !ok {
+				return values.Null{}, err
+			}
+			return row, nil
+		})
+	case src.Type == ql2.Term_MAP:
+		if err := src.checkArity(2, 2); err != nil {
+			return nil, err
+		}
+		fn, err := evalFunction(ctx, src.Args[1])
+		if err != nil {
+			return nil, err
+		}
+		return transformChanges(ctx, src.Args[0], opts, parsed, func(row values.Datum) (values.Datum, *values.Error) {
+			return callDatum(fn, row)
+		})
+	case src.Type == ql2.Term_GET:
+		if err := src.checkArity(2, 2); err != nil {
+			return nil, err
+		}
+		table, err := evalTable(ctx, src.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		key, err := evalDatum(ctx, src.Args[1])
+		if err != nil {
+			return nil, err
+		}
+		return table.GetChanges(key, opts)
+	case src.Type == ql2.Term_LIMIT && len(src.Args) == 2 && src.Args[0].Type == ql2.Term_ORDER_BY && src.Args[0].OptArgs["index"] != nil:
+		return orderedLimitChanges(ctx, src, parsed)
+	}
+
+	if parsed.IncludeOffsets {
+		return nil, queryLogicError("Cannot include offsets for range subs.")
+	}
+	val, err := src.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.authorizeTable(users.Read, val); err != nil {
+		return nil, err
+	}
+	if val.IsSequence() {
+		return val.(values.Sequence).AsStream().Changes(opts)
+	}
+	if sel, ok := val.(values.Selection); ok && sel.IsSelection() {
+		return sel.Changes(opts)
+	}
+	return nil, queryLogicError("Cannot call `changes` on a value of type %s.", typeOf(val))
+}
+
+// transformChanges returns a feed of the changes to the given source with
+// the given function applied to the old and new values of each. A change
+// which leaves both null is dropped.
+func transformChanges(ctx *Context, src *Term, opts values.Object, parsed feed.Options, fn func(row values.Datum) (values.Datum, *values.Error)) (values.Feed, *values.Error) {
+	if parsed.IncludeOffsets {
+		return nil, queryLogicError("Cannot include offsets for range subs.")
+	}
+	source, err := changes(ctx, src, opts, parsed)
+	if err != nil {
+		return nil, err
+	}
+	apply := func(row values.Datum) (values.Datum, *values.Error) {
+		if row == nil || row.IsNull() {
+			return values.Null{}, nil
+		}
+		return fn(row)
+	}
+
+	next := func() (values.Datum, *values.Error) {
+		for {
+			doc, err := source.NextItem()
+			if err != nil || doc == nil {
+				return nil, err
+			}
+			items := doc.AsObject().Items()
+			newVal, ok := items["new_val"]
+			if !ok {
+				// State and error documents are passed on as they are.
+				return doc, nil
+			}
+			oldVal, hasOldVal := items["old_val"]
+			if oldVal, err = apply(oldVal); err != nil {
+				return nil, err
+			}
+			if newVal, err = apply(newVal); err != nil {
+				return nil, err
+			}
+			if oldVal.IsNull() && newVal.IsNull() {
+				continue
+			}
+			return values.NewObject(feed.Document(oldVal, newVal, !hasOldVal, parsed)), nil
+		}
+	}
+	return values.NewFeed(next, source.Notes(), source.Close), nil
+}
+
+// orderedLimitChanges returns a feed on the first rows of a table in the
+// order of an index, as given by ORDER_BY followed by LIMIT.
+func orderedLimitChanges(ctx *Context, limit *Term, parsed feed.Options) (values.Feed, *values.Error) {
+	orderBy := limit.Args[0]
+	if err := orderBy.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	table, err := evalTable(ctx, orderBy.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	indexTerm, descending := orderBy.OptArgs["index"], false
+	if indexTerm.Type == ql2.Term_ASC || indexTerm.Type == ql2.Term_DESC {
+		if err := indexTerm.checkArity(1, 1); err != nil {
+			return nil, err
+		}
+		descending = indexTerm.Type == ql2.Term_DESC
+		indexTerm = indexTerm.Args[0]
+	}
+	index, err := evalString(ctx, indexTerm)
+	if err != nil {
+		return nil, err
+	}
+	n, err := evalInteger(ctx, limit.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, queryLogicError("LIMIT takes a non-negative argument (got %d)", n)
+	}
+
+	// The source feed delivers every change to the table, after which the
+	// window is read again.
+	sourceOpts := map[string]values.Datum{
+		"changefeed_queue_size": values.NewNumber(float64(parsed.QueueSize)),
+	}
+	if parsed.Squash {
+		sourceOpts["squash"] = values.NewNumber(parsed.SquashDelay.Seconds())
+	}
+	source, err := table.Changes(values.NewObject(sourceOpts))
+	if err != nil {
+		return nil, err
+	}
+
+	window := func() ([]values.Datum, *values.Error) {
+		ordered, err := table.OrderBy(index, descending, nil)
+		if err != nil {
+			return nil, err
+		}
+		var rows []values.Datum
+		for int64(len(rows)) < n {
+			row, err := ordered.NextItem()
+			if err != nil {
+				return nil, err
+			}
+			if row == nil {
+				break
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+	return feed.OrderedLimit(source, window, table.PrimaryKey(), parsed), nil
+}
@@ -0,0 +1,150 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jlhawn/reboltdb/catalog"
+	"github.com/jlhawn/reboltdb/feed"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// feedSelection is a fake selection of a whole table whose changes are
+// published to a broker.
+type feedSelection struct {
+	fakeSelection
+	broker *feed.Broker
+}
+
+func (fs feedSelection) IsSelection() bool             { return true }
+func (fs feedSelection) AsSelection() values.Selection { return fs }
+
+func (fs feedSelection) Changes(options values.Object) (values.Feed, *values.Error) {
+	opts, err := feed.ParseOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	return fs.broker.Subscribe(feed.Subscription{DB: fs.DB(), Table: fs.Table(), PrimaryKey: "id", Options: opts}), nil
+}
+
+func TestChanges(t *testing.T) {
+	broker := feed.NewBroker()
+	vars := map[int64]values.Datum{1: feedSelection{fakeSelection{values.NewObject(nil)}, broker}}
+
+	// r.changes() of the selection filtered by the `ok` field and mapped to
+	// the `n` field.
+	query := `[152, [[38, [[39, [[10, [1]], [69, [[2, [2]], [17, [[170, [[10, [2]], "ok"]], true]]]]]], [69, [[2, [3]], [170, [[10, [3]], "n"]]]]]]], {"include_types": true}]`
+	val, err := evalQuery(t, query, vars)
+	if err != nil {
+		t.Fatalf("unable to evaluate query %s: %s", query, err.Message)
+	}
+	f := val.(values.Feed)
+	defer f.Close()
+
+	publish := func(oldVal, newVal string) {
+		change := feed.Change{DB: "test", Table: "fake"}
+		if oldVal != "" {
+			change.OldVal = parseDatum(t, oldVal)
+		}
+		if newVal != "" {
+			change.NewVal = parseDatum(t, newVal)
+		}
+		broker.Publish(change)
+	}
+	publish("", `{"id": 1, "ok": true, "n": 1}`)
+	publish(`{"id": 1, "ok": true, "n": 1}`, `{"id": 1, "ok": false, "n": 2}`)
+	publish("", `{"id": 2, "ok": false, "n": 2}`)
+	publish("", `{"id": 3, "ok": true, "n": 3}`)
+
+	for _, expected := range []map[string]interface{}{
+		{"old_val": nil, "new_val": 1.0, "type": "add"},
+		{"old_val": 1.0, "new_val": nil, "type": "remove"},
+		{"old_val": nil, "new_val": 3.0, "type": "add"},
+	} {
+		doc, err := f.NextItem()
+		if err != nil {
+			t.Fatalf("unable to read feed: %s", err.Message)
+		}
+		if actual := native(t, doc); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expected %#v but got %#v", expected, actual)
+		}
+	}
+
+	for _, query := range []string{
+		`[152, [[2, [1]]]]`,
+		`[152, [[10, [1]]], {"bogus": true}]`,
+		`[152, [[39, [[10, [1]], true]]], {"include_offsets": true}]`,
+	} {
+		if _, err := evalQuery(t, query, vars); err == nil {
+			t.Errorf("expected query %s to fail", query)
+		}
+	}
+}
+
+func TestStoredTableChanges(t *testing.T) {
+	sys, c, ctx := newTestSystem(t)
+	if _, err := c.CreateTable(catalog.DefaultDB, "events", "id", "hard"); err != nil {
+		t.Fatal(err.Message)
+	}
+	events, err := sys.Table(catalog.DefaultDB, "events")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	insert := func(rows string, conflict string) {
+		t.Helper()
+		result := native(t, events.InsertSequence(parseDatum(t, rows).AsArray(), conflict, "hard", false)).(map[string]interface{})
+		if result["errors"] != 0.0 {
+			t.Fatalf("unable to insert rows: %v", result)
+		}
+	}
+	insert(`[{"id": 1, "n": 1}]`, "error")
+
+	expectChanges := func(name string, f values.Feed, expected ...map[string]interface{}) {
+		t.Helper()
+		for _, doc := range expected {
+			item, err := f.NextItem()
+			if err != nil {
+				t.Fatalf("unable to read the %s feed: %s", name, err.Message)
+			}
+			if actual := native(t, item); !reflect.DeepEqual(actual, doc) {
+				t.Errorf("expected the %s feed to have %v but got %v", name, doc, actual)
+			}
+		}
+	}
+	row := func(id, n float64) map[string]interface{} {
+		return map[string]interface{}{"id": id, "n": n}
+	}
+	subscribe := func(query string) values.Feed {
+		t.Helper()
+		f := mustEval(t, ctx, query).(values.Feed)
+		t.Cleanup(f.Close)
+		return f
+	}
+	// r.table("events").changes()
+	all := subscribe(`[152, [[15, ["events"]]]]`)
+	// r.table("events").get(1).changes({"include_initial": true})
+	one := subscribe(`[152, [[16, [[15, ["events"]], 1]]], {"include_initial": true}]`)
+	// r.table("events").between(2, 5).changes()
+	between := subscribe(`[152, [[182, [[15, ["events"]], 2, 5]]]]`)
+	expectChanges("row", one, map[string]interface{}{"new_val": row(1, 1)})
+
+	insert(`[{"id": 2, "n": 2}, {"id": 9, "n": 9}]`, "error")
+	insert(`[{"id": 1, "n": 10}, {"id": 2, "n": 2}]`, "update")
+	insert(`[{"id": 2, "n": 3}]`, "replace")
+
+	expectChanges("table", all,
+		map[string]interface{}{"old_val": nil, "new_val": row(2, 2)},
+		map[string]interface{}{"old_val": nil, "new_val": row(9, 9)},
+		map[string]interface{}{"old_val": row(1, 1), "new_val": row(1, 10)},
+		map[string]interface{}{"old_val": row(2, 2), "new_val": row(2, 3)},
+	)
+	expectChanges("row", one, map[string]interface{}{"old_val": row(1, 1), "new_val": row(1, 10)})
+	expectChanges("range", between,
+		map[string]interface{}{"old_val": nil, "new_val": row(2, 2)},
+		map[string]interface{}{"old_val": row(2, 2), "new_val": row(2, 3)},
+	)
+
+	// r.table("events").get(7).changes({"include_initial": true})
+	missing := subscribe(`[152, [[16, [[15, ["events"]], 7]]], {"include_initial": true}]`)
+	expectChanges("missing row", missing, map[string]interface{}{"new_val": nil})
+}
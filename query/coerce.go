@@ -0,0 +1,209 @@
+package query
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_COERCE_TO] = evalCoerceTo
+	evalFuncs[ql2.Term_TYPE_OF] = evalTypeOf
+	evalFuncs[ql2.Term_INFO] = evalInfo
+}
+
+// evalCoerceTo converts a value to the type with the given name, which is not
+// case sensitive. Coercing a value to its own type, or to any type it is a
+// subtype of, returns it unchanged.
+func evalCoerceTo(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	val, err := t.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	typeName, err := evalString(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	return coerceTo(val, strings.ToUpper(typeName))
+}
+
+func coerceTo(val values.Top, typeName string) (values.Top, *values.Error) {
+	// Pseudo types may also be named without the PTYPE<> wrapper.
+	to, ok := types.FromName(typeName)
+	if !ok {
+		to, ok = types.FromName("PTYPE<" + typeName + ">")
+	}
+	if !ok {
+		return nil, queryLogicError("Unknown Type: %s", typeName)
+	}
+
+	from := typeOf(val)
+	if from.IsSubTypeOf(to) {
+		return val, nil
+	}
+
+	if !val.IsDatum() {
+		// Only sequences may be coerced and only by draining them.
+		seq, ok := val.(values.Sequence)
+		if !ok || (to != types.Array && to != types.Object) {
+			return nil, queryLogicError("Cannot coerce %s to %s.", from, to)
+		}
+		arr, err := drainStream(seq.AsStream())
+		if err != nil {
+			return nil, err
+		}
+		if to == types.Array {
+			return arr, nil
+		}
+		return objectFromPairs(arr)
+	}
+
+	d := val.(values.Datum)
+	switch {
+	case to == types.String && d.IsBinary():
+		data := d.AsBinary().Data()
+		if !utf8.Valid(data) {
+			return nil, queryLogicError("Cannot coerce PTYPE<BINARY> to STRING: the data is not valid UTF-8.")
+		}
+		return values.NewString(string(data)), nil
+	case to == types.String:
+		encoded, err := values.ToJSON(d)
+		if err != nil {
+			return nil, err
+		}
+		return values.NewString(string(encoded)), nil
+	case to == types.Number && d.IsString():
+		s := d.AsString().Value()
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil, queryLogicError("Could not coerce `%s` to NUMBER.", s)
+		}
+		return values.NewNumber(n), nil
+	case to == types.Bool:
+		return values.NewBool(isTruthy(d)), nil
+	case to == types.Array && from.IsSubTypeOf(types.Object):
+		return pairsFromObject(d.AsObject()), nil
+	case to == types.Object && d.IsArray():
+		return objectFromPairs(d.AsArray())
+	case to == types.Binary && d.IsString():
+		return values.NewBinary([]byte(d.AsString().Value())), nil
+	}
+	return nil, queryLogicError("Cannot coerce %s to %s.", from, to)
+}
+
+// pairsFromObject returns an array of the [key, value] pairs of the given
+// object, ordered by key.
+func pairsFromObject(obj values.Object) values.Array {
+	items := obj.Items()
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]values.Datum, len(keys))
+	for i, key := range keys {
+		pairs[i] = values.NewArray([]values.Datum{values.NewString(key), items[key]})
+	}
+	return values.NewArray(pairs)
+}
+
+// objectFromPairs returns the object with the keys and values of the given
+// array of [key, value] pairs. Each key must be a string which appears only
+// once.
+func objectFromPairs(arr values.Array) (values.Datum, *values.Error) {
+	items := make(map[string]values.Datum, len(arr.Items()))
+	for _, pair := range arr.Items() {
+		if !pair.IsArray() {
+			return nil, typeError(types.Array, pair)
+		}
+		if n := len(pair.AsArray().Items()); n != 2 {
+			return nil, queryLogicError("Expected array of size 2, but got size %d.", n)
+		}
+		key, val := pair.AsArray().Items()[0], pair.AsArray().Items()[1]
+		if !key.IsString() {
+			return nil, typeError(types.String, key)
+		}
+		if _, ok := items[key.AsString().Value()]; ok {
+			return nil, queryLogicError("Duplicate key `%s` in coerced object.", key.AsString().Value())
+		}
+		items[key.AsString().Value()] = val
+	}
+	return values.FromPseudoType(values.NewObject(items))
+}
+
+func evalTypeOf(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	val, err := t.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return values.NewString(typeOf(val).String()), nil
+}
+
+// evalInfo describes a value. Tables and databases are described by their
+// names and configuration while datums are described by their type and value.
+func evalInfo(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	val, err := t.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return info(val)
+}
+
+func info(val values.Top) (values.Datum, *values.Error) {
+	items := map[string]values.Datum{
+		"type": values.NewString(typeOf(val).String()),
+	}
+
+	switch {
+	case val.IsDatum():
+		d := val.(values.Datum)
+		if d.IsBinary() {
+			items["count"] = values.NewNumber(float64(len(d.AsBinary().Data())))
+			break
+		}
+		if d.IsMinVal() || d.IsMaxVal() {
+			break
+		}
+		encoded, err := values.ToJSON(d)
+		if err != nil {
+			return nil, err
+		}
+		items["value"] = values.NewString(string(encoded))
+	case val.IsSequence():
+		stream := val.(values.Sequence).AsStream()
+		if !(stream.IsSelectionStream() && stream.AsSelectionStream().IsTable()) {
+			break
+		}
+		table := stream.AsSelectionStream().AsTable()
+		items["name"] = values.NewString(table.Name())
+		items["db"] = values.NewObject(map[string]values.Datum{
+			"type": values.NewString(types.Database.String()),
+			"name": values.NewString(table.DB()),
+		})
+		items["primary_key"] = values.NewString(table.PrimaryKey())
+		items["indexes"] = table.IndexList()
+		items["doc_count_estimates"] = values.NewArray([]values.Datum{
+			values.NewNumber(float64(table.DocCountEstimate())),
+		})
+	case val.IsDatabase():
+		items["name"] = values.NewString(val.(values.Database).Name())
+	}
+	return values.NewObject(items), nil
+}
@@ -0,0 +1,149 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func TestCoerceTo(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		{`[51, ["1.5", "number"]]`, 1.5},
+		{`[51, [" -20 ", "NUMBER"]]`, -20.0},
+		{`[51, [1.5, "string"]]`, "1.5"},
+		{`[51, [10, "string"]]`, "10"},
+		{`[51, [null, "string"]]`, "null"},
+		{`[51, [{"b": [2, [1, "x"]], "a": "q\"<"}, "string"]]`, `{"a":"q\"<","b":[1,"x"]}`},
+		{`[51, [{"b": 2, "a": 1}, "array"]]`, []interface{}{
+			[]interface{}{"a", 1.0}, []interface{}{"b", 2.0},
+		}},
+		{`[51, [[2, [[2, ["a", 1]], [2, ["b", 2]]]], "object"]]`, map[string]interface{}{"a": 1.0, "b": 2.0}},
+		{`[51, [[2, []], "object"]]`, map[string]interface{}{}},
+		{`[51, [0, "bool"]]`, true},
+		{`[51, [null, "bool"]]`, false},
+		{`[51, [[2, [1, 2]], "array"]]`, []interface{}{1.0, 2.0}},
+		{`[51, [[2, [1, 2]], "datum"]]`, []interface{}{1.0, 2.0}},
+		{`[51, [[2, [1, 2]], "sequence"]]`, []interface{}{1.0, 2.0}},
+		{`[51, ["a", "STRING"]]`, "a"},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+
+	for _, query := range []string{
+		`[51, ["abc", "number"]]`,
+		`[51, ["", "number"]]`,
+		`[51, [1, "array"]]`,
+		`[51, [[2, [1]], "object"]]`,
+		`[51, [[2, [[2, [1, 2]]]], "object"]]`,
+		`[51, [[2, [[2, ["a"]]]], "object"]]`,
+		`[51, [[2, [[2, ["a", 1]], [2, ["a", 2]]]], "object"]]`,
+		`[51, [[180, []], "string"]]`,
+		`[51, [1, "null"]]`,
+		`[51, [1, "not_a_type"]]`,
+	} {
+		if _, err := evalQuery(t, query, nil); err == nil {
+			t.Errorf("expected query %s to fail", query)
+		}
+	}
+}
+
+func TestCoerceStream(t *testing.T) {
+	stream := parseDatum(t, `[["a", 1], ["b", 2]]`).AsArray().AsStream()
+	result, err := coerceTo(stream, "OBJECT")
+	if err != nil {
+		t.Fatalf("unable to coerce stream: %s", err.Message)
+	}
+	expected := map[string]interface{}{"a": 1.0, "b": 2.0}
+	if actual := native(t, result); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v but got %#v", expected, actual)
+	}
+
+	stream = parseDatum(t, `[1, 2]`).AsArray().AsStream()
+	if _, err := coerceTo(stream, "STRING"); err == nil {
+		t.Errorf("expected coercing a stream to a string to fail")
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		{`[52, [null]]`, "NULL"},
+		{`[52, [1]]`, "NUMBER"},
+		{`[52, ["a"]]`, "STRING"},
+		{`[52, [{"a": 1}]]`, "OBJECT"},
+		{`[52, [[2, [1]]]]`, "ARRAY"},
+		{`[52, [[155, ["a"]]]]`, "PTYPE<BINARY>"},
+		{`[52, [[101, [0]]]]`, "PTYPE<TIME>"},
+		{`[52, [[69, [[2, [1]], 1]]]]`, "FUNCTION"},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+}
+
+// infoTable is a fake table which describes itself.
+type infoTable struct {
+	fakeTable
+}
+
+func (infoTable) IsDatum() bool              { return false }
+func (infoTable) Name() string               { return "users" }
+func (infoTable) DB() string                 { return "test" }
+func (infoTable) DBID() string               { return "test-id" }
+func (infoTable) ID() string                 { return "users-id" }
+func (infoTable) PrimaryKey() string         { return "email" }
+func (infoTable) DocCountEstimate() int64    { return 3 }
+func (infoTable) IndexList() values.Array    { return stringArray("name") }
+func (it infoTable) AsTable() values.Table   { return it }
+func (it infoTable) AsStream() values.Stream { return it }
+
+func (it infoTable) AsSelectionStream() values.SelectionStream { return it }
+
+func stringArray(items ...string) values.Array {
+	arr := make([]values.Datum, len(items))
+	for i, item := range items {
+		arr[i] = values.NewString(item)
+	}
+	return values.NewArray(arr)
+}
+
+func TestInfo(t *testing.T) {
+	testCases := []struct {
+		val      values.Top
+		expected interface{}
+	}{
+		{infoTable{}, map[string]interface{}{
+			"type":                "TABLE",
+			"name":                "users",
+			"db":                  map[string]interface{}{"type": "DATABASE", "name": "test"},
+			"primary_key":         "email",
+			"indexes":             []interface{}{"name"},
+			"doc_count_estimates": []interface{}{3.0},
+		}},
+		{values.NewDatabase("", "test"), map[string]interface{}{"type": "DATABASE", "name": "test"}},
+		{parseDatum(t, `{"b": 1, "a": [true]}`), map[string]interface{}{"type": "OBJECT", "value": `{"a":[true],"b":1}`}},
+		{parseDatum(t, `[1]`), map[string]interface{}{"type": "ARRAY", "value": "[1]"}},
+		{values.NewBinary([]byte("abc")), map[string]interface{}{"type": "PTYPE<BINARY>", "count": 3.0}},
+	}
+
+	for _, testCase := range testCases {
+		result, err := info(testCase.val)
+		if err != nil {
+			t.Fatalf("unable to describe %s: %s", typeOf(testCase.val), err.Message)
+		}
+		if actual := native(t, result); !reflect.DeepEqual(actual, testCase.expected) {
+			t.Errorf("expected %#v but got %#v", testCase.expected, actual)
+		}
+	}
+
+	expectResult(t, `[79, ["a"]]`, nil, map[string]interface{}{"type": "STRING", "value": `"a"`})
+}
@@ -0,0 +1,287 @@
+package query
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+func init() {
+	evalFuncs[ql2.Term_CONFIG] = evalConfig
+	evalFuncs[ql2.Term_STATUS] = evalStatus
+	evalFuncs[ql2.Term_WAIT] = evalWait
+	evalFuncs[ql2.Term_RECONFIGURE] = evalReconfigure
+	evalFuncs[ql2.Term_REBALANCE] = evalRebalance
+}
+
+// configScope is a table, a database, or every table if both are empty,
+// whose rows in the system tables are read by CONFIG and related terms.
+type configScope struct {
+	db, table string
+}
+
+// evalConfigScope evaluates the argument of a term as a table or database,
+// which must not be the system database, and checks that the user running
+// the query has the given permission on it.
+func evalConfigScope(ctx *Context, t *Term, perm users.Permission) (configScope, *values.Error) {
+	val, err := t.Eval(ctx)
+	if err != nil {
+		return configScope{}, err
+	}
+	var scope configScope
+	var permScope users.Scope
+	switch {
+	case val.IsDatabase():
+		scope.db = val.(values.Database).Name()
+		permScope.DB = val.(values.Database).ID()
+	case val.IsSequence() && val.(values.Sequence).AsStream().IsSelectionStream() && val.(values.Sequence).AsStream().AsSelectionStream().IsTable():
+		table := val.(values.Sequence).AsStream().AsSelectionStream().AsTable()
+		scope.db, scope.table = table.DB(), table.Name()
+		permScope = tableScope(table)
+	default:
+		return configScope{}, queryLogicError("Expected type TABLE or DATABASE but found %s.", typeOf(val))
+	}
+	if scope.db == systemDB {
+		return configScope{}, values.NewError(ql2.Response_OP_FAILED, "Database `%s` is special; you can't configure the tables in it.", systemDB)
+	}
+	return scope, ctx.authorize(perm, permScope)
+}
+
+// evalOptionalConfigScope evaluates the argument of a term, if it has one,
+// as a configScope. Without one, the scope is every table.
+func evalOptionalConfigScope(ctx *Context, t *Term, perm users.Permission) (configScope, *values.Error) {
+	if err := t.checkArity(0, 1); err != nil {
+		return configScope{}, err
+	}
+	if len(t.Args) == 0 {
+		return configScope{}, ctx.authorize(perm, users.Global)
+	}
+	return evalConfigScope(ctx, t.Args[0], perm)
+}
+
+// systemRows returns the rows of the named system table which describe the
+// databases or tables in the given scope.
+func systemRows(ctx *Context, tableName string, scope configScope) (values.Table, []values.Datum, *values.Error) {
+	catalog, err := ctx.getCatalog()
+	if err != nil {
+		return nil, nil, err
+	}
+	table, err := catalog.Table(systemDB, tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+	stream := table.AsStream()
+	var rows []values.Datum
+	for {
+		row, err := stream.NextItem()
+		if err != nil {
+			return nil, nil, err
+		}
+		if row == nil {
+			return table, rows, nil
+		}
+		fields := row.AsObject().Items()
+		db, name := fields["db"], fields["name"]
+		if tableName == "db_config" {
+			db, name = name, nil
+		}
+		if scope.db != "" && !values.Equal(db, values.NewString(scope.db)) {
+			continue
+		}
+		if scope.table != "" && !values.Equal(name, values.NewString(scope.table)) {
+			continue
+		}
+		rows = append(rows, row)
+	}
+}
+
+// systemSelection returns the single row of the named system table which
+// describes the given scope.
+func systemSelection(ctx *Context, tableName string, scope configScope) (values.Top, *values.Error) {
+	table, rows, err := systemRows(ctx, tableName, scope)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, values.NewError(ql2.Response_OP_FAILED, "`%s` has no row for `%s`.", tableName, scope.db)
+	}
+	sel := table.Get(rows[0].AsObject().Items()["id"])
+	if sel == nil {
+		return values.Null{}, nil
+	}
+	return sel, nil
+}
+
+// evalConfig returns the row of table_config or db_config of a table or
+// database, which may be updated to configure it.
+func evalConfig(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	scope, err := evalConfigScope(ctx, t.Args[0], users.Config)
+	if err != nil {
+		return nil, err
+	}
+	if scope.table == "" {
+		return systemSelection(ctx, "db_config", scope)
+	}
+	return systemSelection(ctx, "table_config", scope)
+}
+
+// evalStatus returns the row of table_status of a table.
+func evalStatus(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	scope, err := evalConfigScope(ctx, t.Args[0], users.Read)
+	if err != nil {
+		return nil, err
+	}
+	if scope.table == "" {
+		return nil, typeError(types.Table, values.NewDatabase("", scope.db))
+	}
+	return systemSelection(ctx, "table_status", scope)
+}
+
+// evalWait waits for the tables of a scope to be ready, which they always
+// are on a single server.
+func evalWait(ctx *Context, t *Term) (values.Top, *values.Error) {
+	scope, err := evalOptionalConfigScope(ctx, t, users.Read)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := evalWaitOptions(ctx, t); err != nil {
+		return nil, err
+	}
+	_, rows, err := systemRows(ctx, "table_status", scope)
+	if err != nil {
+		return nil, err
+	}
+	return values.NewObject(map[string]values.Datum{"ready": values.NewNumber(float64(len(rows)))}), nil
+}
+
+func evalWaitOptions(ctx *Context, t *Term) (string, *values.Error) {
+	waitFor := "all_replicas_ready"
+	if val, err := evalOptArg(ctx, t, "wait_for"); err != nil {
+		return "", err
+	} else if val != nil {
+		if !val.IsString() {
+			return "", typeError(types.String, val)
+		}
+		waitFor = val.AsString().Value()
+	}
+	switch waitFor {
+	case "ready_for_outdated_reads", "ready_for_reads", "ready_for_writes", "all_replicas_ready":
+		return waitFor, nil
+	}
+	return "", queryLogicError("Unknown table readiness state: '%s', must be one of 'ready_for_outdated_reads', 'ready_for_reads', 'ready_for_writes', or 'all_replicas_ready'.", waitFor)
+}
+
+// statusChanges returns the changes to the given table_status rows, which
+// are unchanged on a single server.
+func statusChanges(rows []values.Datum) values.Datum {
+	changes := make([]values.Datum, len(rows))
+	for i, row := range rows {
+		changes[i] = values.NewObject(map[string]values.Datum{"old_val": row, "new_val": row})
+	}
+	return values.NewArray(changes)
+}
+
+// evalRebalance rebalances the shards of the tables of a scope, which have
+// only one shard on a single server.
+func evalRebalance(ctx *Context, t *Term) (values.Top, *values.Error) {
+	scope, err := evalOptionalConfigScope(ctx, t, users.Config)
+	if err != nil {
+		return nil, err
+	}
+	_, rows, err := systemRows(ctx, "table_status", scope)
+	if err != nil {
+		return nil, err
+	}
+	return values.NewObject(map[string]values.Datum{
+		"rebalanced":     values.NewNumber(float64(len(rows))),
+		"status_changes": statusChanges(rows),
+	}), nil
+}
+
+// evalReconfigure changes the number of shards and replicas of the tables of
+// a scope. A single server holds one shard and one replica of each table.
+func evalReconfigure(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	scope, err := evalConfigScope(ctx, t.Args[0], users.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	shards, err := evalOptArg(ctx, t, "shards")
+	if err != nil {
+		return nil, err
+	}
+	if shards == nil {
+		return nil, queryLogicError("Missing required argument `shards`.")
+	}
+	if !shards.IsNumber() || !shards.AsNumber().IsSafeInteger() || shards.AsNumber().Int64() < 1 {
+		return nil, queryLogicError("Every table must have at least one shard.")
+	}
+	if shards.AsNumber().Int64() != 1 {
+		return nil, values.NewError(ql2.Response_OP_FAILED, "A single server can only hold one shard of each table.")
+	}
+
+	replicas, err := evalOptArg(ctx, t, "replicas")
+	if err != nil {
+		return nil, err
+	}
+	if replicas == nil {
+		return nil, queryLogicError("Missing required argument `replicas`.")
+	}
+	counts := map[string]values.Datum{"default": replicas}
+	if replicas.IsObject() {
+		counts = replicas.AsObject().Items()
+	}
+	for tag, count := range counts {
+		if !count.IsNumber() || !count.AsNumber().IsSafeInteger() || count.AsNumber().Int64() < 0 {
+			return nil, queryLogicError("Expected a non-negative integer number of replicas for tag `%s`.", tag)
+		}
+		n := count.AsNumber().Int64()
+		switch {
+		case tag != "default" && n > 0:
+			return nil, values.NewError(ql2.Response_OP_FAILED, "Can't use server tag `%s` for replicas because no servers have that tag.", tag)
+		case n > 1:
+			return nil, values.NewError(ql2.Response_OP_FAILED, "Can't put %d replicas on servers with the tag `default` because there are only 1 servers with the tag `default`. It's impossible to have more replicas of the data than there are servers.", n)
+		case tag == "default" && n == 0:
+			return nil, values.NewError(ql2.Response_OP_FAILED, "You must set `replicas` to at least one.")
+		}
+	}
+
+	dryRun := false
+	if val, err := evalOptArg(ctx, t, "dry_run"); err != nil {
+		return nil, err
+	} else if val != nil {
+		if !val.IsBool() {
+			return nil, typeError(types.Bool, val)
+		}
+		dryRun = val.AsBool().Value()
+	}
+
+	_, configs, err := systemRows(ctx, "table_config", scope)
+	if err != nil {
+		return nil, err
+	}
+	_, statuses, err := systemRows(ctx, "table_status", scope)
+	if err != nil {
+		return nil, err
+	}
+	reconfigured := len(configs)
+	if dryRun {
+		reconfigured = 0
+	}
+	return values.NewObject(map[string]values.Datum{
+		"reconfigured":   values.NewNumber(float64(reconfigured)),
+		"config_changes": statusChanges(configs),
+		"status_changes": statusChanges(statuses),
+	}), nil
+}
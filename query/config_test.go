@@ -0,0 +1,170 @@
+package query
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/catalog"
+	"github.com/jlhawn/reboltdb/jobs"
+	"github.com/jlhawn/reboltdb/stats"
+	"github.com/jlhawn/reboltdb/storage"
+	"github.com/jlhawn/reboltdb/system"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+func TestConfig(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	c, err := catalog.Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := users.Open(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := storage.Open(db, LoadFunction, RunWriteHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sys := system.New(c, data, store, jobs.NewRegistry(), stats.New(db), system.Server{ID: c.ServerID(), Name: "test_server", Started: time.Now()})
+	table, verr := c.CreateTable(catalog.DefaultDB, "users", "id", "hard")
+	if verr != nil {
+		t.Fatal(verr.Message)
+	}
+	ctx := NewContext().WithUser(store, users.Admin).WithCatalog(sys)
+
+	eval := func(query string) map[string]interface{} {
+		t.Helper()
+		result, err := makeTerm(t, query).Eval(ctx)
+		if err != nil {
+			t.Fatalf("unable to evaluate %s: %s", query, err.Message)
+		}
+		return native(t, result).(map[string]interface{})
+	}
+
+	// CONFIG of table "users" and of database "test".
+	config := eval(`[174, [[15, ["users"]]]]`)
+	if config["id"] != table.ID || config["db"] != "test" || config["primary_key"] != "id" {
+		t.Errorf("unexpected table config %v", config)
+	}
+	if config := eval(`[174, [[14, ["test"]]]]`); config["name"] != "test" {
+		t.Errorf("unexpected database config %v", config)
+	}
+	if status := eval(`[175, [[15, ["users"]]]]`); status["raft_leader"] != "test_server" {
+		t.Errorf("unexpected table status %v", status)
+	}
+
+	expected := map[string]interface{}{"ready": 1.0}
+	if actual := eval(`[177, [[14, ["test"]]]]`); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+	if actual := eval(`[179, [[15, ["users"]]]]`); actual["rebalanced"] != 1.0 {
+		t.Errorf("unexpected rebalance result %v", actual)
+	}
+	reconfigured := eval(`[176, [[15, ["users"]]], {"shards": 1, "replicas": 1, "dry_run": true}]`)
+	if reconfigured["reconfigured"] != 0.0 || len(reconfigured["config_changes"].([]interface{})) != 1 {
+		t.Errorf("unexpected reconfigure result %v", reconfigured)
+	}
+
+	for _, query := range []string{
+		`[176, [[15, ["users"]]], {"shards": 2, "replicas": 1}]`,
+		`[176, [[15, ["users"]]], {"shards": 1, "replicas": 3}]`,
+		`[176, [[15, ["users"]]], {"shards": 1, "replicas": {"ssd": 1}}]`,
+		`[174, [[14, ["rethinkdb"]]]]`,
+	} {
+		if _, err := makeTerm(t, query).Eval(ctx); err == nil || err.Type != ql2.Response_OP_FAILED {
+			t.Errorf("expected %s to fail but got %v", query, err)
+		}
+	}
+	if _, err := makeTerm(t, `[177, [[14, ["test"]]], {"wait_for": "soon"}]`).Eval(ctx); err == nil || err.Type != ql2.Response_QUERY_LOGIC {
+		t.Errorf("expected an unknown readiness state to fail but got %v", err)
+	}
+}
+
+func TestCreateAndDrop(t *testing.T) {
+	_, _, ctx := newTestSystem(t)
+
+	eval := func(query string) map[string]interface{} {
+		t.Helper()
+		return native(t, mustEval(t, ctx, query)).(map[string]interface{})
+	}
+	expectNames := func(query string, expected ...interface{}) {
+		t.Helper()
+		if expected == nil {
+			expected = []interface{}{}
+		}
+		if actual := native(t, mustEval(t, ctx, query)); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expected %s to be %v but got %v", query, expected, actual)
+		}
+	}
+	expectError := func(query string, errType ql2.Response_ErrorType) {
+		t.Helper()
+		if _, err := makeTerm(t, query).Eval(ctx); err == nil || err.Type != errType {
+			t.Errorf("expected %s to fail with %s but got %v", query, errType, err)
+		}
+	}
+	newVal := func(result map[string]interface{}) map[string]interface{} {
+		return result["config_changes"].([]interface{})[0].(map[string]interface{})["new_val"].(map[string]interface{})
+	}
+
+	// r.dbCreate("app")
+	created := eval(`[57, ["app"]]`)
+	if created["dbs_created"] != 1.0 || newVal(created)["name"] != "app" {
+		t.Errorf("unexpected dbCreate result %v", created)
+	}
+	expectError(`[57, ["app"]]`, ql2.Response_OP_FAILED)
+	expectNames(`[59, []]`, "app", "rethinkdb", "test")
+
+	// r.db("app").tableCreate("events", {"primary_key": "name"})
+	created = eval(`[60, [[14, ["app"]], "events"], {"primary_key": "name"}]`)
+	if created["tables_created"] != 1.0 || newVal(created)["primary_key"] != "name" || newVal(created)["db"] != "app" {
+		t.Errorf("unexpected tableCreate result %v", created)
+	}
+	expectError(`[60, [[14, ["app"]], "events"]]`, ql2.Response_OP_FAILED)
+	expectError(`[60, ["events"], {"durability": "eventual"}]`, ql2.Response_QUERY_LOGIC)
+	expectError(`[60, [[14, ["rethinkdb"]], "events"]]`, ql2.Response_OP_FAILED)
+	expectNames(`[62, [[14, ["app"]]]]`, "events")
+	expectNames(`[62, []]`)
+	eval(`[56, [[15, [[14, ["app"]], "events"]], {"name": "start"}]]`)
+
+	// Tables and databases are renamed by updating their config.
+	if result := eval(`[53, [[174, [[15, [[14, ["app"]], "events"]]]], {"name": "logs"}]]`); result["replaced"] != 1.0 {
+		t.Errorf("expected the table to be renamed but got %v", result)
+	}
+	expectNames(`[62, [[14, ["app"]]]]`, "logs")
+	if count := native(t, mustEval(t, ctx, `[43, [[15, [[14, ["app"]], "logs"]]]]`)); count != 1.0 {
+		t.Errorf("expected the renamed table to keep its row but got %v", count)
+	}
+	if result := eval(`[53, [[174, [[14, ["app"]]]], {"name": "archive"}]]`); result["replaced"] != 1.0 {
+		t.Errorf("expected the database to be renamed but got %v", result)
+	}
+	expectNames(`[59, []]`, "archive", "rethinkdb", "test")
+
+	// r.db("archive").tableDrop("logs")
+	if dropped := eval(`[61, [[14, ["archive"]], "logs"]]`); dropped["tables_dropped"] != 1.0 {
+		t.Errorf("unexpected tableDrop result %v", dropped)
+	}
+	expectNames(`[62, [[14, ["archive"]]]]`)
+	expectError(`[61, [[14, ["archive"]], "logs"]]`, ql2.Response_OP_FAILED)
+
+	eval(`[60, [[14, ["archive"]], "logs"]]`)
+	if count := native(t, mustEval(t, ctx, `[43, [[15, [[14, ["archive"]], "logs"]]]]`)); count != 0.0 {
+		t.Errorf("expected a recreated table to be empty but got %v rows", count)
+	}
+	dropped := eval(`[58, ["archive"]]`)
+	if dropped["dbs_dropped"] != 1.0 || dropped["tables_dropped"] != 1.0 {
+		t.Errorf("unexpected dbDrop result %v", dropped)
+	}
+	expectNames(`[59, []]`, "rethinkdb", "test")
+	expectError(`[58, ["rethinkdb"]]`, ql2.Response_OP_FAILED)
+	expectError(`[62, [[14, ["archive"]]]]`, ql2.Response_OP_FAILED)
+}
@@ -0,0 +1,113 @@
+package query
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_FUNCALL] = evalFuncall
+	evalFuncs[ql2.Term_FOR_EACH] = evalForEach
+	evalFuncs[ql2.Term_ARGS] = evalArgs
+}
+
+// evalFuncall calls the function given as the first argument with the rest of
+// the arguments, as r.do() does. Any value other than a function is returned
+// as is.
+func evalFuncall(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, -1); err != nil {
+		return nil, err
+	}
+	fn, err := evalFunction(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]values.Datum, len(t.Args)-1)
+	for i, arg := range t.Args[1:] {
+		if args[i], err = evalDatum(ctx, arg); err != nil {
+			return nil, err
+		}
+	}
+	if fn.Arity() >= 0 && fn.Arity() != len(args) {
+		return nil, queryLogicError("Expected function with %d argument(s) but found function with %d argument(s).", len(args), fn.Arity())
+	}
+	return fn.Call(args...)
+}
+
+// evalForEach calls a function, which must perform one or more writes, with
+// each item of a sequence. The result is the write results of every call
+// merged together.
+func evalForEach(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	seq, err := evalSequence(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	fn, err := evalFunction(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	stats := values.NewObject(map[string]values.Datum{})
+	stream := seq.AsStream()
+	for {
+		item, err := stream.NextItem()
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			return stats, nil
+		}
+		result, err := callDatum(fn, item)
+		if err != nil {
+			return nil, err
+		}
+
+		results := []values.Datum{result}
+		if result.IsArray() {
+			results = result.AsArray().Items()
+		}
+		for _, result := range results {
+			if !result.IsObject() || result.IsTime() || result.IsBinary() || result.IsGeometry() {
+				return nil, queryLogicError("FOR_EACH expects one or more basic write queries. Expected type OBJECT but found %s.", typeOf(result))
+			}
+			if stats, err = mergeWriteResults(stats, result.AsObject()); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// mergeWriteResults combines two write results: counts are summed and arrays,
+// such as generated_keys, are concatenated. Of two strings, such as
+// first_error, the first is kept.
+func mergeWriteResults(a, b values.Object) (values.Object, *values.Error) {
+	items := make(map[string]values.Datum, len(a.Items()))
+	for key, val := range a.Items() {
+		items[key] = val
+	}
+	for key, r := range b.Items() {
+		l, ok := items[key]
+		switch {
+		case !ok:
+			items[key] = r
+		case l.IsNumber() && r.IsNumber():
+			items[key] = values.NewNumber(l.AsNumber().Float64() + r.AsNumber().Float64())
+		case l.IsArray() && r.IsArray():
+			merged := append(append([]values.Datum(nil), l.AsArray().Items()...), r.AsArray().Items()...)
+			items[key] = values.NewArray(merged)
+		case !(l.IsString() && r.IsString()):
+			return nil, queryLogicError("Cannot merge statistics `%s` (type %s) and `%s` (type %s).", key, typeOf(l), key, typeOf(r))
+		}
+	}
+	return values.NewObject(items), nil
+}
+
+// evalArgs rejects r.args() anywhere other than among the arguments of a
+// term, where Eval splices it before the term is evaluated.
+func evalArgs(ctx *Context, t *Term) (values.Top, *values.Error) {
+	return nil, queryLogicError("r.args may only be used as an argument of another term.")
+}
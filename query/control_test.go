@@ -0,0 +1,45 @@
+package query
+
+import (
+	"testing"
+)
+
+func TestControlTerms(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		// r.do(1, 2, (a, b) => a + b)
+		{`[64, [[69, [[2, [1, 2]], [24, [[10, [1]], [10, [2]]]]]], 1, 2]]`, 3.0},
+		{`[64, [[69, [[2, []], 5]]]]`, 5.0},
+		{`[64, ["a", 1]]`, "a"},
+		// r.args splices an array into the arguments of a term.
+		{`[24, [[154, [[2, [1, 2, 3]]]]]]`, 6.0},
+		{`[2, [0, [154, [[2, [1, 2]]]], 3]]`, []interface{}{0.0, 1.0, 2.0, 3.0}},
+		{`[2, [[154, [[2, []]]]]]`, []interface{}{}},
+		{`[64, [[69, [[2, [1, 2]], [25, [[10, [1]], [10, [2]]]]]], [154, [[2, [5, 2]]]]]]`, 3.0},
+		{`[2, [[154, [[2, [{"a": [2, [1]]}]]]]]]`, []interface{}{map[string]interface{}{"a": []interface{}{1.0}}}},
+		{`[68, [[2, [1, 2, 3]], [69, [[2, [1]], {"inserted": 1, "generated_keys": [2, [[10, [1]]]], "first_error": "e"}]]]]`,
+			map[string]interface{}{"inserted": 3.0, "generated_keys": []interface{}{1.0, 2.0, 3.0}, "first_error": "e"}},
+		{`[68, [[2, [1, 2]], [69, [[2, [1]], [2, [{"inserted": 1}, {"deleted": 1}]]]]]]`,
+			map[string]interface{}{"inserted": 2.0, "deleted": 2.0}},
+		{`[68, [[2, []], [69, [[2, [1]], {"inserted": 1}]]]]`, map[string]interface{}{}},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+
+	for _, query := range []string{
+		`[64, [[69, [[2, [1, 2]], 1]], 1]]`,
+		`[24, [[154, [1]]]]`,
+		`[24, [[154, []]]]`,
+		`[154, [[2, [1]]]]`,
+		`[68, [[2, [1]], [69, [[2, [1]], 1]]]]`,
+		`[68, [[2, [1, 2]], [69, [[2, [1]], {"inserted": [65, [[17, [[10, [1]], 1]], 1, "x"]]}]]]]`,
+	} {
+		if _, err := evalQuery(t, query, nil); err == nil {
+			t.Errorf("expected query %s to fail", query)
+		}
+	}
+}
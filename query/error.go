@@ -0,0 +1,58 @@
+package query
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_ERROR] = evalError
+	evalFuncs[ql2.Term_DEFAULT] = evalDefault
+}
+
+// evalError raises a USER error with the given message. With no message, it
+// raises again the error caught by the enclosing DEFAULT term.
+func evalError(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(0, 1); err != nil {
+		return nil, err
+	}
+	if len(t.Args) == 0 {
+		if ctx.defaultError == nil {
+			return nil, queryLogicError("Empty ERROR term outside a default block.")
+		}
+		return nil, ctx.defaultError
+	}
+	msg, err := evalString(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	return nil, values.NewError(ql2.Response_USER, "%s", msg)
+}
+
+// evalDefault evaluates its first argument and replaces it with the second if
+// it is null or raises a NON_EXISTENCE error. Any other error is raised. If
+// the replacement is a function, it is called with the error message, or with
+// null if there was no error, and its result is used instead.
+func evalDefault(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	val, err := t.Args[0].Eval(ctx)
+	switch {
+	case err != nil && err.Type != ql2.Response_NON_EXISTENCE:
+		return nil, err
+	case err == nil && !(val.IsDatum() && val.(values.Datum).IsNull()):
+		return val, nil
+	}
+
+	replacement, replacementErr := t.Args[1].Eval(ctx.withDefaultError(err))
+	if replacementErr != nil || !replacement.IsFunction() {
+		return replacement, replacementErr
+	}
+	var arg values.Datum = values.Null{}
+	if err != nil {
+		arg = values.NewString(err.Message)
+	}
+	return replacement.(values.Function).Call(arg)
+}
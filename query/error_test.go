@@ -0,0 +1,60 @@
+package query
+
+import (
+	"testing"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+)
+
+func TestError(t *testing.T) {
+	testCases := []struct {
+		query   string
+		errType ql2.Response_ErrorType
+		message string
+	}{
+		{`[12, ["boom"]]`, ql2.Response_USER, "boom"},
+		{`[12, ["100%"]]`, ql2.Response_USER, "100%"},
+		{`[12, []]`, ql2.Response_QUERY_LOGIC, "Empty ERROR term outside a default block."},
+		{`[31, [{"a": 1}, "b"]]`, ql2.Response_NON_EXISTENCE, "No attribute `b` in object."},
+		{`[31, [null, "b"]]`, ql2.Response_NON_EXISTENCE, "Cannot perform get_field on a non-object non-sequence `NULL`."},
+		{`[31, [1, "b"]]`, ql2.Response_QUERY_LOGIC, "Cannot perform get_field on a non-object non-sequence `NUMBER`."},
+		// DEFAULT catches only non-existence errors.
+		{`[92, [[12, ["boom"]], 1]]`, ql2.Response_USER, "boom"},
+		{`[92, [[24, [1, "a"]], 1]]`, ql2.Response_QUERY_LOGIC, "Expected type NUMBER but found STRING."},
+		// An empty ERROR in the handler raises the caught error again.
+		{`[92, [[31, [{"a": 1}, "b"]], [69, [[2, [1]], [12, []]]]]]`, ql2.Response_NON_EXISTENCE, "No attribute `b` in object."},
+	}
+
+	for _, testCase := range testCases {
+		_, err := evalQuery(t, testCase.query, nil)
+		if err == nil {
+			t.Errorf("expected query %s to fail", testCase.query)
+			continue
+		}
+		if err.Type != testCase.errType || err.Message != testCase.message {
+			t.Errorf("query %s: expected %s error %q but got %s error %q", testCase.query, testCase.errType, testCase.message, err.Type, err.Message)
+		}
+	}
+}
+
+func TestDefault(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		{`[92, [1, 2]]`, 1.0},
+		{`[92, [false, 2]]`, false},
+		{`[92, [null, 2]]`, 2.0},
+		{`[92, [[31, [{"a": 1}, "b"]], 2]]`, 2.0},
+		{`[92, [[31, [null, "b"]], 2]]`, 2.0},
+		{`[92, [[170, [null, "b"]], 2]]`, 2.0},
+		{`[92, [[31, [[31, [{"a": 1}, "b"]], "c"]], 2]]`, 2.0},
+		{`[92, [[31, [{"a": 1}, "b"]], [69, [[2, [1]], [10, [1]]]]]]`, "No attribute `b` in object."},
+		{`[92, [null, [69, [[2, [1]], [10, [1]]]]]]`, nil},
+		{`[92, [[31, [{"a": 1}, "b"]], [92, [null, 3]]]]`, 3.0},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+}
@@ -0,0 +1,623 @@
+package query
+
+import (
+	"time"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/jobs"
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+// Context holds the state used while evaluating the term tree of a query.
+type Context struct {
+	// vars holds the values bound to the variables of any enclosing
+	// functions, keyed by variable ID.
+	vars map[int64]values.Datum
+	// implicitVar is the argument of the innermost enclosing function of one
+	// argument, used by IMPLICIT_VAR (r.row).
+	implicitVar values.Datum
+	// literalOK is set while evaluating an argument which may contain
+	// r.literal(), such as the objects passed to MERGE.
+	literalOK bool
+	// now is the time at which the query started, returned by every NOW
+	// term in the query.
+	now time.Time
+	// defaultError is the error caught by the innermost enclosing DEFAULT
+	// term, which an ERROR term with no message raises again.
+	defaultError *values.Error
+	// users holds the permissions of user, who runs the query. Every
+	// permission is granted if it is nil.
+	users *users.Store
+	user  string
+	// catalog resolves the databases and tables named in the query, in
+	// which defaultDB is the database of tables named without one.
+	catalog   Catalog
+	defaultDB string
+	// job is the job of the query. No more terms are evaluated once it is
+	// interrupted.
+	job *jobs.Job
+}
+
+// InterruptedError returns the error of a query which is interrupted for the
+// given reason while it runs.
+func InterruptedError(reason error) *values.Error {
+	return values.NewError(ql2.Response_OP_INDETERMINATE, "The query was interrupted because %s.", reason)
+}
+
+// interrupted returns an error once the job of the query, if it has one, has
+// been interrupted. Besides each term, loops which may run for a long time
+// within a term, such as the reading of a stream, check it.
+func (ctx *Context) interrupted() *values.Error {
+	if ctx.job != nil {
+		if reason := ctx.job.Err(); reason != nil {
+			return InterruptedError(reason)
+		}
+	}
+	return nil
+}
+
+func NewContext() *Context {
+	return &Context{
+		vars:      map[int64]values.Datum{},
+		now:       time.Now(),
+		defaultDB: "test",
+	}
+}
+
+// WithCatalog returns a copy of this context in which databases and tables
+// are resolved by the given catalog.
+func (ctx *Context) WithCatalog(catalog Catalog) *Context {
+	copied := *ctx
+	copied.catalog = catalog
+	return &copied
+}
+
+// WithDefaultDB returns a copy of this context in which tables named without
+// a database are in the named database.
+func (ctx *Context) WithDefaultDB(name string) *Context {
+	copied := *ctx
+	copied.defaultDB = name
+	return &copied
+}
+
+// WithJob returns a copy of this context whose query runs as the given job,
+// which interrupts it.
+func (ctx *Context) WithJob(job *jobs.Job) *Context {
+	copied := *ctx
+	copied.job = job
+	return &copied
+}
+
+// WithUser returns a copy of this context in which the query runs as the
+// named user, whose permissions are held by the given store.
+func (ctx *Context) WithUser(store *users.Store, name string) *Context {
+	copied := *ctx
+	copied.users = store
+	copied.user = name
+	return &copied
+}
+
+// authorize checks that the user running the query has the given permission
+// in a scope.
+func (ctx *Context) authorize(perm users.Permission, scope users.Scope) *values.Error {
+	if ctx.users == nil {
+		return nil
+	}
+	allowed, err := ctx.users.Allowed(ctx.user, perm, scope)
+	if err != nil {
+		return values.NewError(ql2.Response_OP_FAILED, "Unable to read permissions: %s", err)
+	}
+	if !allowed {
+		return values.NewError(ql2.Response_PERMISSION_ERROR, "User `%s` does not have the required `%s` permissions.", ctx.user, perm)
+	}
+	return nil
+}
+
+// authorizeTable checks that the user running the query has the given
+// permission on the given value if it is a table.
+func (ctx *Context) authorizeTable(perm users.Permission, val values.Top) *values.Error {
+	if !val.IsSequence() {
+		return nil
+	}
+	stream := val.(values.Sequence).AsStream()
+	if !(stream.IsSelectionStream() && stream.AsSelectionStream().IsTable()) {
+		return nil
+	}
+	return ctx.authorize(perm, tableScope(stream.AsSelectionStream().AsTable()))
+}
+
+// tableScope returns the scope of the permissions granted on a table.
+func tableScope(table values.Table) users.Scope {
+	return users.Scope{DB: table.DBID(), Table: table.ID()}
+}
+
+// bind returns a copy of this context with the given variables bound to the
+// given arguments.
+func (ctx *Context) bind(params []int64, args []values.Datum) *Context {
+	vars := make(map[int64]values.Datum, len(ctx.vars)+len(params))
+	for id, val := range ctx.vars {
+		vars[id] = val
+	}
+	for i, id := range params {
+		vars[id] = args[i]
+	}
+
+	bound := *ctx
+	bound.vars = vars
+	if len(params) == 1 {
+		bound.implicitVar = args[0]
+	}
+	return &bound
+}
+
+// withDefaultError returns a copy of this context in which the given error
+// has been caught by a DEFAULT term.
+func (ctx *Context) withDefaultError(err *values.Error) *Context {
+	copied := *ctx
+	copied.defaultError = err
+	return &copied
+}
+
+// withLiterals returns a copy of this context in which r.literal() is or is
+// not allowed.
+func (ctx *Context) withLiterals(ok bool) *Context {
+	copied := *ctx
+	copied.literalOK = ok
+	return &copied
+}
+
+type termEvaluator func(ctx *Context, t *Term) (values.Top, *values.Error)
+
+// evalFuncs maps each implemented term type to the function which evaluates
+// it. Entries are registered by the init function of the file which
+// implements the term.
+var evalFuncs = map[ql2.Term_TermType]termEvaluator{}
+
+func init() {
+	evalFuncs[ql2.Term_MAKE_ARRAY] = evalMakeArray
+	evalFuncs[ql2.Term_MAKE_OBJ] = evalMakeObj
+	evalFuncs[ql2.Term_VAR] = evalVar
+	evalFuncs[ql2.Term_IMPLICIT_VAR] = evalImplicitVar
+	evalFuncs[ql2.Term_FUNC] = evalFunc
+}
+
+// literalPassthroughTerms are the terms whose arguments may contain
+// r.literal() if the term itself may.
+var literalPassthroughTerms = map[ql2.Term_TermType]bool{
+	ql2.Term_MAKE_OBJ: true,
+	ql2.Term_LITERAL:  true,
+	ql2.Term_FUNC:     true,
+}
+
+// Eval evaluates this term in the given context.
+func (t *Term) Eval(ctx *Context) (values.Top, *values.Error) {
+	if t.value != nil {
+		return t.value, nil
+	}
+	if t.IsDatum() {
+		return values.FromJSON(t.Datum), nil
+	}
+
+	if err := ctx.interrupted(); err != nil {
+		return nil, err
+	}
+
+	if ctx.literalOK && !literalPassthroughTerms[t.Type] {
+		ctx = ctx.withLiterals(false)
+	}
+
+	t, err := t.spliceArgs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	eval, ok := evalFuncs[t.Type]
+	if !ok {
+		return nil, queryLogicError("Term %s is not yet implemented.", t.name())
+	}
+	return eval(ctx, t)
+}
+
+// spliceArgs returns this term with each r.args() argument replaced by the
+// items of the array it evaluates to. Since the number of arguments is only
+// known once they are spliced, each term's evaluator checks its arity after.
+func (t *Term) spliceArgs(ctx *Context) (*Term, *values.Error) {
+	hasArgs := false
+	for _, arg := range t.Args {
+		hasArgs = hasArgs || arg.Type == ql2.Term_ARGS
+	}
+	if !hasArgs {
+		return t, nil
+	}
+
+	args := make([]*Term, 0, len(t.Args))
+	for _, arg := range t.Args {
+		if arg.Type != ql2.Term_ARGS {
+			args = append(args, arg)
+			continue
+		}
+		if err := arg.checkArity(1, 1); err != nil {
+			return nil, err
+		}
+		arr, err := evalArray(ctx, arg.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range arr.Items() {
+			args = append(args, &Term{Type: ql2.Term_DATUM, value: item})
+		}
+	}
+
+	spliced := *t
+	spliced.Args = args
+	return &spliced, nil
+}
+
+func (t *Term) name() string {
+	return ql2.Term_TermType_name[int32(t.Type)]
+}
+
+func queryLogicError(format string, args ...interface{}) *values.Error {
+	return values.NewError(ql2.Response_QUERY_LOGIC, format, args...)
+}
+
+func nonExistenceError(format string, args ...interface{}) *values.Error {
+	return values.NewError(ql2.Response_NON_EXISTENCE, format, args...)
+}
+
+func typeError(expected types.TypeFlag, val values.Top) *values.Error {
+	return queryLogicError("Expected type %s but found %s.", expected, typeOf(val))
+}
+
+// typeOf returns the most specific type of the given value.
+func typeOf(val values.Top) types.TypeFlag {
+	switch {
+	case val.IsDatum():
+		datum := val.(values.Datum)
+		switch {
+		case datum.IsNull():
+			return types.Null
+		case datum.IsMinVal():
+			return types.MinVal
+		case datum.IsMaxVal():
+			return types.MaxVal
+		case datum.IsBool():
+			return types.Bool
+		case datum.IsNumber():
+			return types.Number
+		case datum.IsString():
+			return types.String
+		case datum.IsTime():
+			return types.Time
+		case datum.IsBinary():
+			return types.Binary
+		case datum.IsGeometry():
+			return types.Geometry
+		case datum.IsArray():
+			return types.Array
+		case datum.IsObject():
+			if datum.AsObject().IsSelection() {
+				return types.Selection
+			}
+			return types.Object
+		}
+		return types.Datum
+	case val.IsSequence():
+		stream := val.(values.Sequence).AsStream()
+		switch {
+		case !stream.IsSelectionStream():
+			return types.Stream
+		case stream.AsSelectionStream().IsTable():
+			return types.Table
+		}
+		return types.SelectionStream
+	case val.IsDatabase():
+		return types.Database
+	case val.IsFunction():
+		return types.Function
+	case val.IsOrdering():
+		return types.Ordering
+	}
+	return 0
+}
+
+// isTruthy reports whether the given datum is considered true when used as a
+// condition: every value other than false and null.
+func isTruthy(d values.Datum) bool {
+	if d.IsBool() {
+		return d.AsBool().Value()
+	}
+	return !d.IsNull()
+}
+
+func (t *Term) checkArity(min, max int) *values.Error {
+	n := len(t.Args)
+	switch {
+	case min == max && n != min:
+		return queryLogicError("Expected %d argument(s) but found %d.", min, n)
+	case max < 0 && n < min:
+		return queryLogicError("Expected %d or more argument(s) but found %d.", min, n)
+	case max >= 0 && (n < min || n > max):
+		return queryLogicError("Expected between %d and %d arguments but found %d.", min, max, n)
+	}
+	return nil
+}
+
+func evalDatum(ctx *Context, t *Term) (values.Datum, *values.Error) {
+	val, err := t.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !val.IsDatum() {
+		return nil, typeError(types.Datum, val)
+	}
+	return val.(values.Datum), nil
+}
+
+func evalString(ctx *Context, t *Term) (string, *values.Error) {
+	val, err := evalDatum(ctx, t)
+	if err != nil {
+		return "", err
+	}
+	if !val.IsString() {
+		return "", typeError(types.String, val)
+	}
+	return val.AsString().Value(), nil
+}
+
+func evalNumber(ctx *Context, t *Term) (values.Number, *values.Error) {
+	val, err := evalDatum(ctx, t)
+	if err != nil {
+		return values.Number{}, err
+	}
+	if !val.IsNumber() {
+		return values.Number{}, typeError(types.Number, val)
+	}
+	return val.AsNumber(), nil
+}
+
+func evalInteger(ctx *Context, t *Term) (int64, *values.Error) {
+	num, err := evalNumber(ctx, t)
+	if err != nil {
+		return 0, err
+	}
+	return safeInteger(num)
+}
+
+func evalTime(ctx *Context, t *Term) (values.Time, *values.Error) {
+	val, err := evalDatum(ctx, t)
+	if err != nil {
+		return values.Time{}, err
+	}
+	if !val.IsTime() {
+		return values.Time{}, typeError(types.Time, val)
+	}
+	return val.AsTime(), nil
+}
+
+func evalGeometry(ctx *Context, t *Term) (values.Geometry, *values.Error) {
+	val, err := evalDatum(ctx, t)
+	if err != nil {
+		return values.Geometry{}, err
+	}
+	if !val.IsGeometry() {
+		return values.Geometry{}, typeError(types.Geometry, val)
+	}
+	return val.AsGeometry(), nil
+}
+
+func evalArray(ctx *Context, t *Term) (values.Array, *values.Error) {
+	val, err := evalDatum(ctx, t)
+	if err != nil {
+		return values.Array{}, err
+	}
+	if !val.IsArray() {
+		return values.Array{}, typeError(types.Array, val)
+	}
+	return val.AsArray(), nil
+}
+
+func evalBool(ctx *Context, t *Term) (bool, *values.Error) {
+	val, err := evalDatum(ctx, t)
+	if err != nil {
+		return false, err
+	}
+	if !val.IsBool() {
+		return false, typeError(types.Bool, val)
+	}
+	return val.AsBool().Value(), nil
+}
+
+func evalSequence(ctx *Context, t *Term) (values.Sequence, *values.Error) {
+	val, err := t.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !val.IsSequence() {
+		return nil, typeError(types.Sequence, val)
+	}
+	if err := ctx.authorizeTable(users.Read, val); err != nil {
+		return nil, err
+	}
+	return val.(values.Sequence), nil
+}
+
+// evalTable evaluates the given term as a table whose rows are read.
+func evalTable(ctx *Context, t *Term) (values.Table, *values.Error) {
+	return evalTableFor(ctx, t, users.Read)
+}
+
+// evalTableFor evaluates the given term as a table on which the user running
+// the query must have the given permission.
+func evalTableFor(ctx *Context, t *Term, perm users.Permission) (values.Table, *values.Error) {
+	val, err := t.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !val.IsSequence() {
+		return nil, typeError(types.Table, val)
+	}
+	stream := val.(values.Sequence).AsStream()
+	if !(stream.IsSelectionStream() && stream.AsSelectionStream().IsTable()) {
+		return nil, typeError(types.Table, val)
+	}
+	if err := ctx.authorizeTable(perm, val); err != nil {
+		return nil, err
+	}
+	return stream.AsSelectionStream().AsTable(), nil
+}
+
+// evalFunction evaluates the given term as a function. Any value other than a
+// function is treated as a function which ignores its arguments and always
+// returns that value.
+func evalFunction(ctx *Context, t *Term) (values.Function, *values.Error) {
+	val, err := t.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if val.IsFunction() {
+		return val.(values.Function), nil
+	}
+	return values.NewFunction(-1, func(args ...values.Datum) (values.Top, *values.Error) {
+		return val, nil
+	}), nil
+}
+
+// evalOptArg evaluates the named optional argument of this term as a datum.
+// The returned datum is nil if the optional argument was not given.
+func evalOptArg(ctx *Context, t *Term, name string) (values.Datum, *values.Error) {
+	optArg, ok := t.OptArgs[name]
+	if !ok {
+		return nil, nil
+	}
+	return evalDatum(ctx, optArg)
+}
+
+// evalOptArgs evaluates every optional argument of this term as a datum,
+// returning them as an object.
+func evalOptArgs(ctx *Context, t *Term) (values.Object, *values.Error) {
+	items := make(map[string]values.Datum, len(t.OptArgs))
+	for name, optArg := range t.OptArgs {
+		var err *values.Error
+		if items[name], err = evalDatum(ctx, optArg); err != nil {
+			return nil, err
+		}
+	}
+	return values.NewObject(items), nil
+}
+
+// callDatum calls the given function and ensures that its result is a datum.
+func callDatum(fn values.Function, args ...values.Datum) (values.Datum, *values.Error) {
+	val, err := fn.Call(args...)
+	if err != nil {
+		return nil, err
+	}
+	if !val.IsDatum() {
+		return nil, typeError(types.Datum, val)
+	}
+	return val.(values.Datum), nil
+}
+
+// sequenceResult returns the given stream as the result of an operation on the
+// given input sequence: operations on arrays produce arrays while operations
+// on streams produce lazy streams.
+func sequenceResult(input values.Sequence, result values.Stream) (values.Top, *values.Error) {
+	if !input.IsArray() {
+		return result, nil
+	}
+	return drainStream(result)
+}
+
+func drainStream(stream values.Stream) (values.Array, *values.Error) {
+	var items []values.Datum
+	for {
+		item, err := stream.NextItem()
+		if err != nil {
+			return values.Array{}, err
+		}
+		if item == nil {
+			return values.NewArray(items), nil
+		}
+		items = append(items, item)
+	}
+}
+
+func evalMakeArray(ctx *Context, t *Term) (values.Top, *values.Error) {
+	items := make([]values.Datum, len(t.Args))
+	for i, arg := range t.Args {
+		var err *values.Error
+		if items[i], err = evalDatum(ctx, arg); err != nil {
+			return nil, err
+		}
+	}
+	return values.NewArray(items), nil
+}
+
+// evalMakeObj evaluates an object. An object which encodes a pseudo type,
+// such as a TIME, is converted into a value of that type.
+func evalMakeObj(ctx *Context, t *Term) (values.Top, *values.Error) {
+	items := make(map[string]values.Datum, len(t.OptArgs))
+	for key, optArg := range t.OptArgs {
+		var err *values.Error
+		if items[key], err = evalDatum(ctx, optArg); err != nil {
+			return nil, err
+		}
+	}
+	return values.FromPseudoType(values.NewObject(items))
+}
+
+func evalVar(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	if !(t.Args[0].IsDatum() && t.Args[0].Datum.IsNumber()) {
+		return nil, queryLogicError("Expected variable ID to be a number.")
+	}
+	id := t.Args[0].Datum.AsInt64()
+	val, ok := ctx.vars[id]
+	if !ok {
+		return nil, queryLogicError("Variable %d is not in scope.", id)
+	}
+	return val, nil
+}
+
+func evalImplicitVar(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if ctx.implicitVar == nil {
+		return nil, queryLogicError("r.row is not in scope.")
+	}
+	return ctx.implicitVar, nil
+}
+
+// evalFunc evaluates a FUNC term. Its first argument is an array of variable
+// IDs and its second is the body which is evaluated on each call.
+func evalFunc(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	paramsVal, err := evalDatum(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	if !paramsVal.IsArray() {
+		return nil, typeError(types.Array, paramsVal)
+	}
+	paramItems := paramsVal.AsArray().Items()
+	params := make([]int64, len(paramItems))
+	for i, item := range paramItems {
+		if !item.IsNumber() {
+			return nil, typeError(types.Number, item)
+		}
+		params[i] = item.AsNumber().Int64()
+	}
+
+	body := t.Args[1]
+	return values.NewFunction(len(params), func(args ...values.Datum) (values.Top, *values.Error) {
+		if len(args) != len(params) {
+			return nil, queryLogicError("Expected %d argument(s) but found %d.", len(params), len(args))
+		}
+		return body.Eval(ctx.bind(params, args))
+	}), nil
+}
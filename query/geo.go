@@ -0,0 +1,420 @@
+package query
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/geo"
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_POINT] = evalPoint
+	evalFuncs[ql2.Term_LINE] = evalLine
+	evalFuncs[ql2.Term_POLYGON] = evalPolygon
+	evalFuncs[ql2.Term_CIRCLE] = evalCircle
+	evalFuncs[ql2.Term_GEOJSON] = evalGeoJSON
+	evalFuncs[ql2.Term_TO_GEOJSON] = evalToGeoJSON
+	evalFuncs[ql2.Term_DISTANCE] = evalDistance
+	evalFuncs[ql2.Term_INTERSECTS] = makeGeoPredicate(func(g1, g2 geo.Geometry) (bool, *values.Error) {
+		return geo.Intersects(g1, g2), nil
+	})
+	evalFuncs[ql2.Term_INCLUDES] = makeGeoPredicate(func(g1, g2 geo.Geometry) (bool, *values.Error) {
+		if g1.Kind != geo.PolygonKind {
+			return false, queryLogicError("Expected geometry of type `Polygon` but found `%s`.", g1.Kind)
+		}
+		return geo.Includes(g1, g2), nil
+	})
+	evalFuncs[ql2.Term_FILL] = evalFill
+	evalFuncs[ql2.Term_POLYGON_SUB] = evalPolygonSub
+	evalFuncs[ql2.Term_GET_INTERSECTING] = evalGetIntersecting
+	evalFuncs[ql2.Term_GET_NEAREST] = evalGetNearest
+}
+
+// distanceUnits are the units in which distances may be given, in meters.
+var distanceUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"mi": 1609.344,
+	"nm": 1852,
+	"ft": 0.3048,
+}
+
+var geoSystems = map[string]geo.Ellipsoid{
+	"WGS84":       geo.WGS84,
+	"unit_sphere": geo.UnitSphere,
+}
+
+func geoError(err error) *values.Error {
+	return queryLogicError("%s", err)
+}
+
+// evalDistanceOptions evaluates the `geo_system` and `unit` options of a term
+// which measures distances. It returns the ellipsoid on which to measure and
+// the size of the unit in the units of the ellipsoid.
+func evalDistanceOptions(ctx *Context, t *Term) (geo.Ellipsoid, float64, *values.Error) {
+	system, unit := geo.WGS84, 1.0
+	val, err := evalOptArg(ctx, t, "geo_system")
+	if err != nil {
+		return system, unit, err
+	}
+	if val != nil {
+		if !val.IsString() {
+			return system, unit, typeError(types.String, val)
+		}
+		var ok bool
+		if system, ok = geoSystems[val.AsString().Value()]; !ok {
+			return system, unit, queryLogicError("Unrecognized geo system `%s` (valid options: \"WGS84\", \"unit_sphere\").", val.AsString().Value())
+		}
+	}
+
+	if val, err = evalOptArg(ctx, t, "unit"); err != nil {
+		return system, unit, err
+	}
+	if val != nil {
+		if !val.IsString() {
+			return system, unit, typeError(types.String, val)
+		}
+		var ok bool
+		if unit, ok = distanceUnits[val.AsString().Value()]; !ok {
+			return system, unit, queryLogicError("Unrecognized distance unit `%s` (valid units: \"m\", \"km\", \"mi\", \"nm\", \"ft\").", val.AsString().Value())
+		}
+	}
+	// The unit sphere has no units, so distances on it are always in terms
+	// of its radius.
+	if system == geo.UnitSphere {
+		unit = 1
+	}
+	return system, unit, nil
+}
+
+// evalGeoPoint evaluates a term which is either a point or an array of a
+// longitude and latitude.
+func evalGeoPoint(ctx *Context, t *Term) (geo.Point, *values.Error) {
+	val, err := evalDatum(ctx, t)
+	if err != nil {
+		return geo.Point{}, err
+	}
+	switch {
+	case val.IsGeometry() && val.AsGeometry().Geo().Kind == geo.PointKind:
+		return val.AsGeometry().Geo().Point(), nil
+	case val.IsArray():
+		items := val.AsArray().Items()
+		if len(items) != 2 || !items[0].IsNumber() || !items[1].IsNumber() {
+			return geo.Point{}, queryLogicError("Expected an array of 2 numbers for a point but found %d items.", len(items))
+		}
+		return geo.Point{Lon: items[0].AsNumber().Float64(), Lat: items[1].AsNumber().Float64()}, nil
+	}
+	return geo.Point{}, queryLogicError("Expected a point or an array of 2 numbers but found %s.", typeOf(val))
+}
+
+func evalGeoPoints(ctx *Context, t *Term, min int) ([]geo.Point, *values.Error) {
+	if err := t.checkArity(min, -1); err != nil {
+		return nil, err
+	}
+	points := make([]geo.Point, len(t.Args))
+	for i, arg := range t.Args {
+		var err *values.Error
+		if points[i], err = evalGeoPoint(ctx, arg); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+// geometryResult returns a geometry built by one of the constructors of the
+// geo package as the result of a term.
+func geometryResult(g geo.Geometry, err error) (values.Top, *values.Error) {
+	if err != nil {
+		return nil, geoError(err)
+	}
+	return values.NewGeometry(g), nil
+}
+
+func evalPoint(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	lon, err := evalNumber(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	lat, err := evalNumber(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	return geometryResult(geo.NewPoint(geo.Point{Lon: lon.Float64(), Lat: lat.Float64()}))
+}
+
+func evalLine(ctx *Context, t *Term) (values.Top, *values.Error) {
+	points, err := evalGeoPoints(ctx, t, 2)
+	if err != nil {
+		return nil, err
+	}
+	return geometryResult(geo.NewLine(points))
+}
+
+func evalPolygon(ctx *Context, t *Term) (values.Top, *values.Error) {
+	points, err := evalGeoPoints(ctx, t, 3)
+	if err != nil {
+		return nil, err
+	}
+	return geometryResult(geo.NewPolygon(points))
+}
+
+// evalCircle approximates the circle of the given radius around a point by a
+// polygon with `num_vertices` vertices, or by a line if `fill` is false.
+func evalCircle(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	center, err := evalGeoPoint(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := center.Validate(); err != nil {
+		return nil, geoError(err)
+	}
+	radius, err := evalNumber(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	if radius.Float64() <= 0 {
+		return nil, queryLogicError("Radius must be positive but found %v.", radius.Float64())
+	}
+	system, unit, err := evalDistanceOptions(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	numVertices := int64(32)
+	if optArg, ok := t.OptArgs["num_vertices"]; ok {
+		if numVertices, err = evalInteger(ctx, optArg); err != nil {
+			return nil, err
+		}
+		if numVertices < 3 {
+			return nil, queryLogicError("`num_vertices` must be at least 3 but found %d.", numVertices)
+		}
+	}
+	fill := true
+	if optArg, ok := t.OptArgs["fill"]; ok {
+		if fill, err = evalBool(ctx, optArg); err != nil {
+			return nil, err
+		}
+	}
+
+	points := system.Circle(center, radius.Float64()*unit, int(numVertices))
+	if !fill {
+		return geometryResult(geo.NewLine(append(points, points[0])))
+	}
+	return geometryResult(geo.NewPolygon(points))
+}
+
+func evalGeoJSON(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	obj, err := evalObjectArg(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	return values.GeometryFromGeoJSON(obj)
+}
+
+func evalToGeoJSON(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	g, err := evalGeometry(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	return g.GeoJSON(), nil
+}
+
+// evalDistance returns the distance between a point and another geometry,
+// measured on the geodesic of the `geo_system` ellipsoid.
+func evalDistance(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	g1, err := evalGeometry(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	g2, err := evalGeometry(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	system, unit, err := evalDistanceOptions(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	dist, geoErr := system.GeometryDistance(g1.Geo(), g2.Geo())
+	if geoErr != nil {
+		return nil, geoError(geoErr)
+	}
+	return values.NewNumber(dist / unit), nil
+}
+
+// makeGeoPredicate returns an evaluator for a term which tests a geometry
+// against another. If the first argument is a sequence of geometries then
+// the result is those which pass the test.
+func makeGeoPredicate(test func(g1, g2 geo.Geometry) (bool, *values.Error)) termEvaluator {
+	return func(ctx *Context, t *Term) (values.Top, *values.Error) {
+		if err := t.checkArity(2, 2); err != nil {
+			return nil, err
+		}
+		val, err := t.Args[0].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		g2, err := evalGeometry(ctx, t.Args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if val.IsSequence() {
+			seq := val.(values.Sequence)
+			return sequenceResult(seq, filterStream(seq.AsStream(), func(item values.Datum) (bool, *values.Error) {
+				if !item.IsGeometry() {
+					return false, typeError(types.Geometry, item)
+				}
+				return test(item.AsGeometry().Geo(), g2.Geo())
+			}))
+		}
+		if !(val.IsDatum() && val.(values.Datum).IsGeometry()) {
+			return nil, typeError(types.Geometry, val)
+		}
+		result, err := test(val.(values.Datum).AsGeometry().Geo(), g2.Geo())
+		if err != nil {
+			return nil, err
+		}
+		return values.NewBool(result), nil
+	}
+}
+
+func evalFill(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	g, err := evalGeometry(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	return geometryResult(g.Geo().Fill())
+}
+
+func evalPolygonSub(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	outer, err := evalGeometry(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	inner, err := evalGeometry(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	return geometryResult(outer.Geo().Subtract(inner.Geo()))
+}
+
+// evalGeoIndex evaluates the `index` option of a term which requires a geo
+// index.
+func evalGeoIndex(ctx *Context, t *Term) (string, *values.Error) {
+	optArg, ok := t.OptArgs["index"]
+	if !ok {
+		return "", queryLogicError("%s requires an index argument.", t.name())
+	}
+	return evalString(ctx, optArg)
+}
+
+func evalGetIntersecting(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	table, err := evalTable(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	g, err := evalGeometry(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	index, err := evalGeoIndex(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	return table.GetIntersecting(g, index)
+}
+
+// evalGetNearest returns the rows of a table nearest to a point as objects
+// with the distance as `dist` and the row as `doc`, ordered by distance.
+func evalGetNearest(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	table, err := evalTable(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	center, err := evalGeometry(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	if center.Geo().Kind != geo.PointKind {
+		return nil, queryLogicError("Expected geometry of type `Point` but found `%s`.", center.Geo().Kind)
+	}
+	index, err := evalGeoIndex(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	system, unit, err := evalDistanceOptions(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	maxResults := int64(100)
+	if optArg, ok := t.OptArgs["max_results"]; ok {
+		if maxResults, err = evalInteger(ctx, optArg); err != nil {
+			return nil, err
+		}
+		if maxResults <= 0 {
+			return nil, queryLogicError("`max_results` must be positive but found %d.", maxResults)
+		}
+	}
+	maxDist := 100000.0
+	if optArg, ok := t.OptArgs["max_dist"]; ok {
+		num, err := evalNumber(ctx, optArg)
+		if err != nil {
+			return nil, err
+		}
+		if maxDist = num.Float64(); maxDist <= 0 {
+			return nil, queryLogicError("`max_dist` must be positive but found %v.", maxDist)
+		}
+	}
+
+	return getNearest(table, center, index, system, unit, maxDist, int(maxResults))
+}
+
+// getNearest returns the rows of a table nearest to a point, with distances
+// measured in the given unit.
+func getNearest(table values.Table, center values.Geometry, index string, system geo.Ellipsoid, unit, maxDist float64, maxResults int) (values.Top, *values.Error) {
+	nearest, err := table.GetNearest(center, index, system, maxDist*unit, maxResults)
+	if err != nil {
+		return nil, err
+	}
+	if unit == 1 {
+		return nearest, nil
+	}
+	results := make([]values.Datum, len(nearest.Items()))
+	for i, result := range nearest.Items() {
+		items := result.AsObject().Items()
+		results[i] = values.NewObject(map[string]values.Datum{
+			"dist": values.NewNumber(items["dist"].AsNumber().Float64() / unit),
+			"doc":  items["doc"],
+		})
+	}
+	return values.NewArray(results), nil
+}
@@ -0,0 +1,189 @@
+package query
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/jlhawn/reboltdb/catalog"
+	"github.com/jlhawn/reboltdb/geo"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// GetNearest finds the rows nearest to a point by their `location` field.
+func (ft fakeTable) GetNearest(point values.Geometry, index string, e geo.Ellipsoid, maxDist float64, maxResults int) (values.Array, *values.Error) {
+	var results []values.Datum
+	for _, row := range ft.rows {
+		location := row.AsObject().Items()[index].AsGeometry().Geo()
+		dist, err := e.GeometryDistance(point.Geo(), location)
+		if err != nil {
+			return values.Array{}, geoError(err)
+		}
+		if dist <= maxDist && len(results) < maxResults {
+			results = append(results, values.NewObject(map[string]values.Datum{
+				"dist": values.NewNumber(dist),
+				"doc":  row,
+			}))
+		}
+	}
+	return values.NewArray(results), nil
+}
+
+func TestGeoTerms(t *testing.T) {
+	const (
+		square = `[161, [[2, [0, 0]], [2, [10, 0]], [2, [10, 10]], [2, [0, 10]]]]`
+		inner  = `[161, [[2, [2, 2]], [2, [4, 2]], [2, [4, 4]], [2, [2, 4]]]]`
+	)
+	point := func(lon, lat float64) map[string]interface{} {
+		return map[string]interface{}{
+			"$reql_type$": "GEOMETRY", "type": "Point", "coordinates": []interface{}{lon, lat},
+		}
+	}
+
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		{`[159, [-122.4, 37.7]]`, point(-122.4, 37.7)},
+		{`[157, [{"type": "Point", "coordinates": [2, [-122.4, 37.7]]}]]`, point(-122.4, 37.7)},
+		{`{"$reql_type$": "GEOMETRY", "type": "Point", "coordinates": [2, [1, 2]]}`, point(1, 2)},
+		{`[158, [[160, [[2, [0, 0]], [159, [1, 1]]]]]]`, map[string]interface{}{
+			"type": "LineString", "coordinates": []interface{}{[]interface{}{0.0, 0.0}, []interface{}{1.0, 1.0}},
+		}},
+		{`[158, [[167, [[160, [[2, [0, 0]], [2, [1, 0]], [2, [1, 1]]]]]]]]`, map[string]interface{}{
+			"type": "Polygon", "coordinates": []interface{}{[]interface{}{
+				[]interface{}{0.0, 0.0}, []interface{}{1.0, 0.0}, []interface{}{1.0, 1.0}, []interface{}{0.0, 0.0},
+			}},
+		}},
+		{`[163, [` + square + `, [159, [5, 5]]]]`, true},
+		{`[163, [` + square + `, [159, [15, 5]]]]`, false},
+		{`[163, [[2, [[159, [5, 5]], [159, [15, 5]]]], ` + square + `]]`, []interface{}{point(5, 5)}},
+		{`[164, [` + square + `, ` + inner + `]]`, true},
+		{`[164, [[171, [` + square + `, ` + inner + `]], [159, [3, 3]]]]`, false},
+		{`[164, [[165, [[159, [0, 0]], 1000]], [159, [0, 0.005]]]]`, true},
+		{`[164, [[165, [[2, [0, 0]], 1], {"unit": "km"}], [159, [0, 0.01]]]]`, false},
+		{`[158, [[165, [[159, [0, 0]], 1], {"num_vertices": 3, "fill": false, "unit": "km"}]]]`, map[string]interface{}{
+			"type": "LineString", "coordinates": native(t, circleVertices()),
+		}},
+		{`[162, [[159, [0, 0]], [159, [90, 0]]], {"geo_system": "unit_sphere"}]`, math.Pi / 2},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+
+	val, err := evalQuery(t, `[162, [[159, [-122.423246, 37.779388]], [159, [-117.220406, 32.719464]]], {"unit": "km"}]`, nil)
+	if err != nil {
+		t.Fatalf("unable to evaluate distance: %s", err.Message)
+	}
+	if dist := val.(values.Datum).AsNumber().Float64(); math.Abs(dist-734.1252496021841) > 1e-6 {
+		t.Errorf("expected a distance of 734.125km but got %v", dist)
+	}
+
+	for _, query := range []string{
+		`[159, [181, 0]]`,
+		`[160, [[2, [0, 0]]]]`,
+		`[157, [{"type": "MultiPoint", "coordinates": [2, [[2, [0, 0]]]]}]]`,
+		`[164, [[159, [0, 0]], [159, [0, 0]]]]`,
+		`[162, [` + square + `, ` + inner + `]]`,
+		`[162, [[159, [0, 0]], [159, [1, 1]]], {"unit": "furlong"}]`,
+		`[171, [` + inner + `, ` + square + `]]`,
+	} {
+		if _, err := evalQuery(t, query, nil); err == nil {
+			t.Errorf("expected an error evaluating %s", query)
+		}
+	}
+}
+
+// circleVertices returns the closed ring of a triangle approximating the
+// circle of radius 1km around the origin.
+func circleVertices() values.Datum {
+	vertices := geo.WGS84.Circle(geo.Point{}, 1000, 3)
+	items := make([]values.Datum, 0, len(vertices)+1)
+	for _, p := range append(vertices, vertices[0]) {
+		items = append(items, values.NewArray([]values.Datum{values.NewNumber(p.Lon), values.NewNumber(p.Lat)}))
+	}
+	return values.NewArray(items)
+}
+
+func TestGetNearest(t *testing.T) {
+	stores := fakeTable{rows: []values.Datum{
+		parseDatum(t, `{"id": "mission", "location": {"$reql_type$": "GEOMETRY", "type": "Point", "coordinates": [-122.4194, 37.7599]}}`),
+		parseDatum(t, `{"id": "sydney", "location": {"$reql_type$": "GEOMETRY", "type": "Point", "coordinates": [151.2093, -33.8688]}}`),
+	}}
+	center := parseDatum(t, `{"$reql_type$": "GEOMETRY", "type": "Point", "coordinates": [-122.4194, 37.77]}`).AsGeometry()
+	val, err := getNearest(stores, center, "location", geo.WGS84, 1000, 5, 100)
+	if err != nil {
+		t.Fatalf("unable to get nearest rows: %s", err.Message)
+	}
+	results := val.(values.Datum).AsArray().Items()
+	if len(results) != 1 {
+		t.Fatalf("expected one store within 5km but got %d", len(results))
+	}
+	if dist := results[0].AsObject().Items()["dist"].AsNumber().Float64(); math.Abs(dist-1.121) > 0.001 {
+		t.Errorf("expected the store to be about 1.12km away but got %vkm", dist)
+	}
+}
+
+func TestStoredGeoIndex(t *testing.T) {
+	sys, c, ctx := newTestSystem(t)
+	if _, err := c.CreateTable(catalog.DefaultDB, "stores", "id", "hard"); err != nil {
+		t.Fatal(err.Message)
+	}
+	stores, err := sys.Table(catalog.DefaultDB, "stores")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	insert := func(query string, conflict string) {
+		t.Helper()
+		rows := mustEval(t, ctx, query).(values.Datum).AsArray()
+		result := native(t, stores.InsertSequence(rows, conflict, "hard", false)).(map[string]interface{})
+		if result["errors"] != 0.0 {
+			t.Fatalf("unable to insert rows: %v", result)
+		}
+	}
+	insert(`[2, [{"id": "mission", "location": [159, [-122.4194, 37.7599]]}, {"id": "sydney", "location": [159, [151.2093, -33.8688]]}]]`, "error")
+	// r.table("stores").indexCreate("location", {"geo": true})
+	mustEval(t, ctx, `[75, [[15, ["stores"]], "location"], {"geo": true}]`)
+	insert(`[2, [{"id": "sunset", "location": [159, [-122.4942, 37.7534]]}, {"id": "oakland", "location": [159, [-122.2711, 37.8044]]}]]`, "error")
+
+	ids := func(query string, field string) []string {
+		t.Helper()
+		var ids []string
+		for _, item := range native(t, mustEval(t, ctx, query)).([]interface{}) {
+			row := item.(map[string]interface{})
+			if field != "" {
+				row = row[field].(map[string]interface{})
+			}
+			ids = append(ids, row["id"].(string))
+		}
+		return ids
+	}
+
+	// r.table("stores").getIntersecting(r.circle(r.point(-122.45, 37.76), 5000), {"index": "location"})
+	intersecting := `[166, [[15, ["stores"]], [165, [[159, [-122.45, 37.76]], 5000]]], {"index": "location"}]`
+	if actual := ids(intersecting, ""); !reflect.DeepEqual(actual, []string{"mission", "sunset"}) {
+		t.Errorf("expected the stores within 5km but got %v", actual)
+	}
+	// r.table("stores").getNearest(r.point(-122.4194, 37.77), {"index": "location", "max_dist": 20000, "max_results": 2})
+	nearest := `[168, [[15, ["stores"]], [159, [-122.4194, 37.77]]], {"index": "location", "max_dist": 20000, "max_results": 2}]`
+	if actual := ids(nearest, "doc"); !reflect.DeepEqual(actual, []string{"mission", "sunset"}) {
+		t.Errorf("expected the nearest two stores but got %v", actual)
+	}
+
+	insert(`[2, [{"id": "mission", "location": [159, [-73.9857, 40.7484]]}]]`, "replace")
+	if actual := ids(intersecting, ""); !reflect.DeepEqual(actual, []string{"sunset"}) {
+		t.Errorf("expected the moved store to be removed from the index but got %v", actual)
+	}
+
+	mustEval(t, ctx, `[75, [[15, ["stores"]], "name"]]`)
+	for _, query := range []string{
+		`[166, [[15, ["stores"]], [159, [-122.45, 37.76]]], {"index": "name"}]`,
+		`[168, [[15, ["stores"]], [159, [-122.45, 37.76]]], {"index": "missing"}]`,
+		`[182, [[15, ["stores"]], 1, 2], {"index": "location"}]`,
+	} {
+		if _, err := drainTerm(t, ctx, query); err == nil {
+			t.Errorf("expected %s to fail", query)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package query
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+func init() {
+	evalFuncs[ql2.Term_GRANT] = evalGrant
+}
+
+// evalGrant grants permissions to a user globally, or in the database or
+// table given as the first argument.
+func evalGrant(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 3); err != nil {
+		return nil, err
+	}
+	args := t.Args
+	scope := users.Global
+	if len(args) == 3 {
+		val, err := args[0].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if scope, err = grantScope(val); err != nil {
+			return nil, err
+		}
+		args = args[1:]
+	}
+	name, err := evalString(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	perms, err := evalDatum(ctx, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if !perms.IsObject() {
+		return nil, typeError(types.Object, perms)
+	}
+
+	// Only a user who may configure everything may grant permissions.
+	if err := ctx.authorize(users.Config, users.Global); err != nil {
+		return nil, err
+	}
+	if ctx.users == nil {
+		return nil, values.NewError(ql2.Response_OP_FAILED, "There are no users to grant permissions to.")
+	}
+	return ctx.users.Grant(name, scope, perms.AsObject())
+}
+
+// grantScope returns the scope of the given database or table.
+func grantScope(val values.Top) (users.Scope, *values.Error) {
+	if val.IsDatabase() {
+		return users.Scope{DB: val.(values.Database).ID()}, nil
+	}
+	if val.IsSequence() {
+		stream := val.(values.Sequence).AsStream()
+		if stream.IsSelectionStream() && stream.AsSelectionStream().IsTable() {
+			return tableScope(stream.AsSelectionStream().AsTable()), nil
+		}
+	}
+	return users.Scope{}, queryLogicError("Expected a DATABASE or TABLE to grant permissions on but found %s.", typeOf(val))
+}
@@ -0,0 +1,153 @@
+package query
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/catalog"
+	"github.com/jlhawn/reboltdb/jobs"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/stats"
+	"github.com/jlhawn/reboltdb/storage"
+	"github.com/jlhawn/reboltdb/system"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+func TestGrant(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store, err := users.Open(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Write(values.NewString("analytics"), parseDatum(t, `{"id": "analytics", "password": false}`)); err != nil {
+		t.Fatal(err.Message)
+	}
+
+	admin := NewContext().WithUser(store, users.Admin)
+	result, verr := makeTerm(t, `[188, ["analytics", {"read": true}]]`).Eval(admin)
+	if verr != nil {
+		t.Fatalf("unable to grant permissions: %s", verr.Message)
+	}
+	expected := map[string]interface{}{
+		"granted": 1.0,
+		"permissions_changes": []interface{}{
+			map[string]interface{}{"old_val": nil, "new_val": map[string]interface{}{"read": true}},
+		},
+	}
+	if actual := native(t, result); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v but got %#v", expected, actual)
+	}
+
+	analytics := NewContext().WithUser(store, "analytics")
+	if err := analytics.authorizeTable(users.Read, infoTable{}); err != nil {
+		t.Errorf("expected analytics to read the table: %s", err.Message)
+	}
+	if err := analytics.authorizeTable(users.Write, infoTable{}); err == nil || err.Type != ql2.Response_PERMISSION_ERROR {
+		t.Errorf("expected analytics not to write the table but got %v", err)
+	}
+	if _, err := makeTerm(t, `[188, ["analytics", {"write": true}]]`).Eval(analytics); err == nil || err.Type != ql2.Response_PERMISSION_ERROR {
+		t.Errorf("expected analytics not to grant permissions but got %v", err)
+	}
+}
+
+// newAnalyticsSystem returns the catalog and users of a new database, and a
+// context which queries it as the user analytics, who has no permissions.
+func newAnalyticsSystem(t *testing.T) (*catalog.Catalog, *users.Store, *Context) {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	c, err := catalog.Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := users.Open(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Write(values.NewString("analytics"), parseDatum(t, `{"id": "analytics", "password": false}`)); err != nil {
+		t.Fatal(err.Message)
+	}
+	data, err := storage.Open(db, LoadFunction, RunWriteHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sys := system.New(c, data, store, jobs.NewRegistry(), stats.New(db), system.Server{ID: c.ServerID(), Name: "test_server", Started: time.Now()})
+	return c, store, NewContext().WithUser(store, "analytics").WithCatalog(sys)
+}
+
+func TestTableRequiresRead(t *testing.T) {
+	c, store, analytics := newAnalyticsSystem(t)
+
+	// r.db("rethinkdb").table("users").count()
+	count := makeTerm(t, `[43, [[15, [[14, ["rethinkdb"]], "users"]]]]`)
+	if _, err := count.Eval(analytics); err == nil || err.Type != ql2.Response_PERMISSION_ERROR {
+		t.Errorf("expected analytics not to count the users but got %v", err)
+	}
+
+	// Grants are made on the table, not its name, so a table which is
+	// created again does not inherit them.
+	table, verr := c.CreateTable("test", "events", "id", "hard")
+	if verr != nil {
+		t.Fatal(verr.Message)
+	}
+	if _, err := store.Grant("analytics", users.Scope{DB: table.DB, Table: table.ID}, parseDatum(t, `{"read": true}`).AsObject()); err != nil {
+		t.Fatal(err.Message)
+	}
+	events := makeTerm(t, `[15, ["events"]]`)
+	if _, err := events.Eval(analytics); err != nil {
+		t.Errorf("expected analytics to read the table: %s", err.Message)
+	}
+	if err := c.DropTable(table.ID); err != nil {
+		t.Fatal(err.Message)
+	}
+	if _, err := c.CreateTable("test", "events", "id", "hard"); err != nil {
+		t.Fatal(err.Message)
+	}
+	if _, err := events.Eval(analytics); err == nil || err.Type != ql2.Response_PERMISSION_ERROR {
+		t.Errorf("expected analytics not to read the new table but got %v", err)
+	}
+}
+
+func TestSystemTablesIgnoreGlobalGrants(t *testing.T) {
+	c, store, analytics := newAnalyticsSystem(t)
+	if _, err := c.CreateTable("test", "events", "id", "hard"); err != nil {
+		t.Fatal(err.Message)
+	}
+	if _, err := store.Grant("analytics", users.Global, parseDatum(t, `{"read": true, "write": true}`).AsObject()); err != nil {
+		t.Fatal(err.Message)
+	}
+
+	// r.table("events").count()
+	if _, err := makeTerm(t, `[43, [[15, ["events"]]]]`).Eval(analytics); err != nil {
+		t.Errorf("expected analytics to count the events: %s", err.Message)
+	}
+	// r.db("rethinkdb").table("users").count()
+	count := makeTerm(t, `[43, [[15, [[14, ["rethinkdb"]], "users"]]]]`)
+	if _, err := count.Eval(analytics); err == nil || err.Type != ql2.Response_PERMISSION_ERROR {
+		t.Errorf("expected a global grant not to reach the users table but got %v", err)
+	}
+	// r.db("rethinkdb").table("users").insert({"id": "mallory", "password": false})
+	insert := makeTerm(t, `[56, [[15, [[14, ["rethinkdb"]], "users"]], {"id": "mallory", "password": false}]]`)
+	if _, err := insert.Eval(analytics); err == nil || err.Type != ql2.Response_PERMISSION_ERROR {
+		t.Errorf("expected a global grant not to permit writing users but got %v", err)
+	}
+
+	if _, err := store.Grant("analytics", users.Scope{DB: catalog.SystemDB}, parseDatum(t, `{"read": true}`).AsObject()); err != nil {
+		t.Fatal(err.Message)
+	}
+	if _, err := count.Eval(analytics); err != nil {
+		t.Errorf("expected a grant on the system database to reach the users table: %s", err.Message)
+	}
+}
@@ -0,0 +1,158 @@
+package query
+
+import (
+	"time"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/json"
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+func init() {
+	evalFuncs[ql2.Term_SET_WRITE_HOOK] = evalSetWriteHook
+	evalFuncs[ql2.Term_GET_WRITE_HOOK] = evalGetWriteHook
+}
+
+// evalSetWriteHook sets the write hook of a table to the given function, or
+// to the function returned by getWriteHook as binary, or removes it if given
+// null.
+func evalSetWriteHook(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	table, err := evalTableFor(ctx, t.Args[0], users.Config)
+	if err != nil {
+		return nil, err
+	}
+	return setWriteHook(ctx, table, t.Args[1])
+}
+
+func setWriteHook(ctx *Context, table values.Table, hookTerm *Term) (values.Top, *values.Error) {
+	if hookTerm.Type == ql2.Term_FUNC {
+		hook, err := compileWriteHook(ctx, hookTerm)
+		if err != nil {
+			return nil, err
+		}
+		return table.SetWriteHook(hook)
+	}
+
+	val, err := evalDatum(ctx, hookTerm)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case val.IsNull():
+		return table.SetWriteHook(nil)
+	case val.IsBinary():
+		hook, err := LoadWriteHook(val.AsBinary().Data())
+		if err != nil {
+			return nil, err
+		}
+		return table.SetWriteHook(hook)
+	}
+	return nil, typeError(types.Function, val)
+}
+
+// LoadWriteHook compiles the source of a write hook, as stored in a table's
+// catalog entry.
+func LoadWriteHook(source []byte) (*values.WriteHook, *values.Error) {
+	val, err := json.Parse(source)
+	if err != nil {
+		return nil, queryLogicError("Unable to parse write hook function: %s", err)
+	}
+	term, err := MakeTermTree(val)
+	if err != nil {
+		return nil, queryLogicError("Unable to parse write hook function: %s", err)
+	}
+	if term.Type != ql2.Term_FUNC {
+		return nil, queryLogicError("Write hook binary does not hold a function.")
+	}
+	return compileWriteHook(NewContext(), term)
+}
+
+func compileWriteHook(ctx *Context, t *Term) (*values.WriteHook, *values.Error) {
+	if !isDeterministic(t) {
+		return nil, queryLogicError("Could not prove function deterministic.  Write hook functions must be deterministic.")
+	}
+	fn, err := evalFunction(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if fn.Arity() != 3 {
+		return nil, queryLogicError("Write hook functions must expect 3 arguments.")
+	}
+	source, err := t.encode()
+	if err != nil {
+		return nil, err
+	}
+	return &values.WriteHook{
+		Function: fn,
+		Source:   source,
+		Query:    "setWriteHook(" + t.String() + ")",
+	}, nil
+}
+
+// evalGetWriteHook returns the write hook of a table as the binary encoding
+// of its function and its readable form, or null if it has none.
+func evalGetWriteHook(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	table, err := evalTable(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	return writeHookInfo(table.WriteHook()), nil
+}
+
+func writeHookInfo(hook *values.WriteHook) values.Datum {
+	if hook == nil {
+		return values.Null{}
+	}
+	return values.NewObject(map[string]values.Datum{
+		"function": values.NewBinary(hook.Source),
+		"query":    values.NewString(hook.Query),
+	})
+}
+
+// RunWriteHook calls the given write hook with a write of a row, at the given
+// time, to a table with the given primary key. Either value is nil if the
+// row is inserted or deleted. It returns the document to write instead of
+// the new value, which is null to delete the row.
+func RunWriteHook(hook *values.WriteHook, primaryKey string, timestamp time.Time, oldVal, newVal values.Datum) (values.Datum, *values.Error) {
+	if oldVal == nil {
+		oldVal = values.Null{}
+	}
+	if newVal == nil {
+		newVal = values.Null{}
+	}
+	context := values.NewObject(map[string]values.Datum{
+		"primary_key": values.NewString(primaryKey),
+		"timestamp":   values.TimeFromGo(timestamp.UTC()),
+	})
+
+	result, err := callDatum(hook.Function, context, oldVal, newVal)
+	if err != nil {
+		return nil, values.NewError(err.Type, "Error in write hook: %s", err.Message)
+	}
+	if result.IsNull() {
+		return result, nil
+	}
+	if !result.IsObject() || result.IsTime() || result.IsBinary() || result.IsGeometry() {
+		return nil, queryLogicError("A write hook function must return an OBJECT or NULL but returned %s.", typeOf(result))
+	}
+
+	// The hook may not move the row to another primary key.
+	row := newVal
+	if row.IsNull() {
+		row = oldVal
+	}
+	key, ok := row.AsObject().Items()[primaryKey]
+	if resultKey, hasKey := result.AsObject().Items()[primaryKey]; ok && (!hasKey || !values.Equal(key, resultKey)) {
+		return nil, queryLogicError("A write hook function may not change the primary key of a row.")
+	}
+	return result, nil
+}
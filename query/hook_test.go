@@ -0,0 +1,152 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlhawn/reboltdb/catalog"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// hookTable is a fake table which holds a write hook.
+type hookTable struct {
+	fakeTable
+	hook **values.WriteHook
+}
+
+func (ht hookTable) WriteHook() *values.WriteHook { return *ht.hook }
+
+func (ht hookTable) SetWriteHook(hook *values.WriteHook) (values.Object, *values.Error) {
+	result := "replaced"
+	switch {
+	case *ht.hook == nil:
+		result = "created"
+	case hook == nil:
+		result = "deleted"
+	}
+	*ht.hook = hook
+	return values.NewObject(map[string]values.Datum{result: values.NewNumber(1)}), nil
+}
+
+func TestWriteHook(t *testing.T) {
+	table := hookTable{hook: new(*values.WriteHook)}
+
+	// function(context, oldVal, newVal) { return newVal.merge({updated_at: context("timestamp")}) }
+	stamp := `[69, [[2, [1, 2, 3]], [35, [[10, [3]], {"updated_at": [170, [[10, [1]], "timestamp"]]}]]]]`
+	result, err := setWriteHook(NewContext(), table, makeTerm(t, stamp))
+	if err != nil {
+		t.Fatalf("unable to set write hook: %s", err.Message)
+	}
+	if actual := native(t, result); !reflect.DeepEqual(actual, map[string]interface{}{"created": 1.0}) {
+		t.Errorf("unexpected result %#v", actual)
+	}
+
+	info := writeHookInfo(table.WriteHook()).AsObject().Items()
+	if query := info["query"].AsString().Value(); !strings.HasPrefix(query, "setWriteHook((FUNC") {
+		t.Errorf("unexpected query %q", query)
+	}
+
+	// The hook may be set again from the binary returned by getWriteHook.
+	ctx := NewContext()
+	ctx.vars[1] = info["function"]
+	if _, err := setWriteHook(ctx, table, makeTerm(t, `[10, [1]]`)); err != nil {
+		t.Fatalf("unable to set write hook from binary: %s", err.Message)
+	}
+
+	now := time.Unix(1500000000, 0)
+	row, err := RunWriteHook(table.WriteHook(), "id", now, nil, parseDatum(t, `{"id": 1}`))
+	if err != nil {
+		t.Fatalf("unable to run write hook: %s", err.Message)
+	}
+	if updatedAt := row.AsObject().Items()["updated_at"]; !updatedAt.IsTime() || updatedAt.AsTime().EpochTime() != 1500000000 {
+		t.Errorf("expected the row to be stamped but got %#v", native(t, row))
+	}
+
+	for _, hook := range []string{
+		// r.now() is not deterministic.
+		`[69, [[2, [1, 2, 3]], [35, [[10, [3]], {"updated_at": [103, []]}]]]]`,
+		`[69, [[2, [1, 2]], [10, [2]]]]`,
+		`"hook"`,
+	} {
+		if _, err := setWriteHook(NewContext(), table, makeTerm(t, hook)); err == nil {
+			t.Errorf("expected write hook %s to be rejected", hook)
+		}
+	}
+
+	moved, err := LoadWriteHook([]byte(`[69, [[2, [1, 2, 3]], {"id": 2}]]`))
+	if err != nil {
+		t.Fatalf("unable to load write hook: %s", err.Message)
+	}
+	if _, err := RunWriteHook(moved, "id", now, nil, parseDatum(t, `{"id": 1}`)); err == nil {
+		t.Errorf("expected a write hook which changes the primary key to fail")
+	}
+
+	result, err = setWriteHook(NewContext(), table, makeTerm(t, `null`))
+	if err != nil {
+		t.Fatalf("unable to remove write hook: %s", err.Message)
+	}
+	if actual := native(t, result); !reflect.DeepEqual(actual, map[string]interface{}{"deleted": 1.0}) {
+		t.Errorf("unexpected result %#v", actual)
+	}
+}
+
+func TestStoredWriteHook(t *testing.T) {
+	sys, c, ctx := newTestSystem(t)
+	if _, err := c.CreateTable(catalog.DefaultDB, "events", "id", "hard"); err != nil {
+		t.Fatal(err.Message)
+	}
+	insert := func(row string) map[string]interface{} {
+		t.Helper()
+		events, err := sys.Table(catalog.DefaultDB, "events")
+		if err != nil {
+			t.Fatal(err.Message)
+		}
+		return native(t, events.InsertObject(parseDatum(t, row).AsObject(), "replace", "hard", true)).(map[string]interface{})
+	}
+	get := func() map[string]interface{} {
+		t.Helper()
+		row, _ := native(t, mustEval(t, ctx, `[16, [[15, ["events"]], 1]]`)).(map[string]interface{})
+		return row
+	}
+
+	// r.table("events").setWriteHook(function(context, oldVal, newVal) {
+	//   return r.branch(newVal.eq(null), null, newVal.merge({updated_at: context("timestamp")}))
+	// })
+	stamp := `[189, [[15, ["events"]], [69, [[2, [1, 2, 3]], [65, [[17, [[10, [3]], null]], null, [35, [[10, [3]], {"updated_at": [170, [[10, [1]], "timestamp"]]}]]]]]]]]`
+	if result := native(t, mustEval(t, ctx, stamp)); !reflect.DeepEqual(result, map[string]interface{}{"created": 1.0}) {
+		t.Errorf("unexpected result %#v", result)
+	}
+	info := native(t, mustEval(t, ctx, `[190, [[15, ["events"]]]]`)).(map[string]interface{})
+	if query, _ := info["query"].(string); !strings.HasPrefix(query, "setWriteHook((FUNC") {
+		t.Errorf("expected the hook to be stored in the catalog but got %#v", info)
+	}
+
+	result := insert(`{"id": 1}`)
+	if _, ok := get()["updated_at"]; !ok || result["inserted"] != 1.0 {
+		t.Errorf("expected the inserted row to be stamped but got %#v", get())
+	}
+	changes := result["changes"].([]interface{})
+	if _, ok := changes[0].(map[string]interface{})["new_val"].(map[string]interface{})["updated_at"]; !ok {
+		t.Errorf("expected the changes to hold the row as written but got %#v", changes)
+	}
+
+	// Rows are deleted by a hook which returns null.
+	drop := `[189, [[15, ["events"]], [69, [[2, [1, 2, 3]], null]]]]`
+	if result := native(t, mustEval(t, ctx, drop)); !reflect.DeepEqual(result, map[string]interface{}{"replaced": 1.0}) {
+		t.Errorf("unexpected result %#v", result)
+	}
+	result = insert(`{"id": 1, "n": 2}`)
+	if result["deleted"] != 1.0 || get() != nil {
+		t.Errorf("expected the row to be deleted by the hook but got %#v and %#v", result, get())
+	}
+
+	if result := native(t, mustEval(t, ctx, `[189, [[15, ["events"]], null]]`)); !reflect.DeepEqual(result, map[string]interface{}{"deleted": 1.0}) {
+		t.Errorf("unexpected result %#v", result)
+	}
+	insert(`{"id": 1}`)
+	if row := get(); !reflect.DeepEqual(row, map[string]interface{}{"id": 1.0}) {
+		t.Errorf("expected the row to be written without a hook but got %#v", row)
+	}
+}
@@ -0,0 +1,247 @@
+package query
+
+import (
+	"strconv"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/json"
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+func init() {
+	evalFuncs[ql2.Term_INDEX_CREATE] = evalIndexCreate
+	evalFuncs[ql2.Term_INDEX_DROP] = evalIndexDrop
+	evalFuncs[ql2.Term_INDEX_LIST] = evalIndexList
+	evalFuncs[ql2.Term_INDEX_STATUS] = evalIndexStatus
+	evalFuncs[ql2.Term_INDEX_WAIT] = evalIndexWait
+}
+
+// nonDeterministicTerms are the terms which may return a different result
+// each time they are evaluated, which an index function or a write hook
+// may not use.
+var nonDeterministicTerms = map[ql2.Term_TermType]bool{
+	ql2.Term_NOW:        true,
+	ql2.Term_RANDOM:     true,
+	ql2.Term_SAMPLE:     true,
+	ql2.Term_JAVASCRIPT: true,
+	ql2.Term_HTTP:       true,
+	ql2.Term_DB:         true,
+	ql2.Term_TABLE:      true,
+	ql2.Term_GET:        true,
+	ql2.Term_GET_ALL:    true,
+	ql2.Term_BETWEEN:    true,
+}
+
+// isDeterministic reports whether the given term returns the same result
+// each time it is evaluated with the same variables.
+func isDeterministic(t *Term) bool {
+	// A UUID is derived from its argument, if it has one.
+	if nonDeterministicTerms[t.Type] || (t.Type == ql2.Term_UUID && len(t.Args) == 0) {
+		return false
+	}
+	for _, arg := range t.Args {
+		if !isDeterministic(arg) {
+			return false
+		}
+	}
+	for _, optArg := range t.OptArgs {
+		if !isDeterministic(optArg) {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadFunction compiles the source of a function, as stored with a secondary
+// index.
+func LoadFunction(source []byte) (values.Function, *values.Error) {
+	val, err := json.Parse(source)
+	if err != nil {
+		return nil, queryLogicError("Unable to parse function: %s", err)
+	}
+	term, err := MakeTermTree(val)
+	if err != nil {
+		return nil, queryLogicError("Unable to parse function: %s", err)
+	}
+	if term.Type != ql2.Term_FUNC {
+		return nil, queryLogicError("Binary does not hold a function.")
+	}
+	return evalFunction(NewContext(), term)
+}
+
+// fieldFunction returns the FUNC term of an index on the named field, which
+// is the function of an index created without one.
+func fieldFunction(name string) (*Term, *values.Error) {
+	encoded, verr := values.ToJSON(values.NewString(name))
+	if verr != nil {
+		return nil, verr
+	}
+	val, err := json.Parse([]byte(`[69, [[2, [1]], [31, [[10, [1]], ` + string(encoded) + `]]]]`))
+	if err != nil {
+		return nil, queryLogicError("Unable to parse function: %s", err)
+	}
+	term, err := MakeTermTree(val)
+	if err != nil {
+		return nil, queryLogicError("Unable to parse function: %s", err)
+	}
+	return term, nil
+}
+
+// evalIndexCreate creates a secondary index of a table by the values of the
+// given function, or of the field with the name of the index. The `multi`
+// option indexes each row by the elements of the array the function returns.
+func evalIndexCreate(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 3); err != nil {
+		return nil, err
+	}
+	table, err := evalTableFor(ctx, t.Args[0], users.Config)
+	if err != nil {
+		return nil, err
+	}
+	name, err := evalString(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	var options [2]bool
+	for i, option := range []string{"multi", "geo"} {
+		val, err := evalOptArg(ctx, t, option)
+		if err != nil {
+			return nil, err
+		}
+		if val != nil {
+			if !val.IsBool() {
+				return nil, typeError(types.Bool, val)
+			}
+			options[i] = val.AsBool().Value()
+		}
+	}
+
+	var fnTerm *Term
+	if len(t.Args) == 3 {
+		fnTerm = t.Args[2]
+	} else if fnTerm, err = fieldFunction(name); err != nil {
+		return nil, err
+	}
+	indexFunc, err := compileIndexFunction(ctx, name, fnTerm)
+	if err != nil {
+		return nil, err
+	}
+	return table.IndexCreate(name, indexFunc, options[0], options[1])
+}
+
+// compileIndexFunction compiles the function of an index, which is a FUNC
+// term or the binary function returned by indexStatus.
+func compileIndexFunction(ctx *Context, name string, t *Term) (*values.IndexFunction, *values.Error) {
+	if t.Type != ql2.Term_FUNC {
+		val, err := evalDatum(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		if !val.IsBinary() {
+			return nil, typeError(types.Function, val)
+		}
+		parsed, perr := json.Parse(val.AsBinary().Data())
+		if perr != nil {
+			return nil, queryLogicError("Unable to parse index function: %s", perr)
+		}
+		if t, perr = MakeTermTree(parsed); perr != nil {
+			return nil, queryLogicError("Unable to parse index function: %s", perr)
+		}
+		if t.Type != ql2.Term_FUNC {
+			return nil, queryLogicError("Index binary does not hold a function.")
+		}
+	}
+	if !isDeterministic(t) {
+		return nil, queryLogicError("Could not prove function deterministic.  Index functions must be deterministic.")
+	}
+	fn, err := evalFunction(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if fn.Arity() != 1 {
+		return nil, queryLogicError("Index functions must expect 1 argument.")
+	}
+	source, err := t.encode()
+	if err != nil {
+		return nil, err
+	}
+	return &values.IndexFunction{
+		Function: fn,
+		Source:   source,
+		Query:    "indexCreate(" + strconv.Quote(name) + ", " + t.String() + ")",
+	}, nil
+}
+
+func evalIndexDrop(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	table, err := evalTableFor(ctx, t.Args[0], users.Config)
+	if err != nil {
+		return nil, err
+	}
+	name, err := evalString(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	return table.IndexDrop(name)
+}
+
+func evalIndexList(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	table, err := evalTable(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	return table.IndexList(), nil
+}
+
+// evalIndexNames evaluates the arguments of an INDEX_STATUS or INDEX_WAIT
+// term: a table and the names of some of its indexes, each of which must
+// exist.
+func evalIndexNames(ctx *Context, t *Term) (values.Table, []string, *values.Error) {
+	if err := t.checkArity(1, -1); err != nil {
+		return nil, nil, err
+	}
+	table, err := evalTable(ctx, t.Args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	existing := map[string]bool{}
+	for _, name := range table.IndexList().Items() {
+		existing[name.AsString().Value()] = true
+	}
+	var names []string
+	for _, arg := range t.Args[1:] {
+		name, err := evalString(ctx, arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !existing[name] {
+			return nil, nil, values.NewError(ql2.Response_OP_FAILED, "Index `%s` was not found on table `%s.%s`.", name, table.DB(), table.Name())
+		}
+		names = append(names, name)
+	}
+	return table, names, nil
+}
+
+func evalIndexStatus(ctx *Context, t *Term) (values.Top, *values.Error) {
+	table, names, err := evalIndexNames(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	return table.IndexStatus(names...), nil
+}
+
+func evalIndexWait(ctx *Context, t *Term) (values.Top, *values.Error) {
+	table, names, err := evalIndexNames(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	return table.IndexWait(names...), nil
+}
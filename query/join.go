@@ -0,0 +1,257 @@
+package query
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_EQ_JOIN] = evalEqJoin
+	evalFuncs[ql2.Term_INNER_JOIN] = evalInnerJoin
+	evalFuncs[ql2.Term_OUTER_JOIN] = evalOuterJoin
+	evalFuncs[ql2.Term_ZIP] = evalZip
+}
+
+func joinedPair(left, right values.Datum) values.Object {
+	items := map[string]values.Datum{"left": left}
+	if right != nil {
+		items["right"] = right
+	}
+	return values.NewObject(items)
+}
+
+// evalEqJoin evaluates an EQ_JOIN term. For each row of the left sequence, the
+// join key is looked up in the primary key or the given secondary index of the
+// right table. Rows of the left sequence which do not have a join key are
+// skipped.
+//
+// Lookups are done one left row at a time, so the output is always in the
+// order of the left sequence and the `ordered` option only needs validating.
+func evalEqJoin(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(3, 3); err != nil {
+		return nil, err
+	}
+
+	left, err := evalSequence(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	keyFunc, err := evalJoinKey(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := evalTable(ctx, t.Args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	var index string
+	if indexVal, err := evalOptArg(ctx, t, "index"); err != nil {
+		return nil, err
+	} else if indexVal != nil {
+		if !indexVal.IsString() {
+			return nil, typeError(types.String, indexVal)
+		}
+		index = indexVal.AsString().Value()
+	}
+
+	if orderedVal, err := evalOptArg(ctx, t, "ordered"); err != nil {
+		return nil, err
+	} else if orderedVal != nil && !orderedVal.IsBool() {
+		return nil, typeError(types.Bool, orderedVal)
+	}
+
+	return eqJoin(left, keyFunc, right, index)
+}
+
+// eqJoin joins each row of the left sequence with the rows of the right table
+// whose value in the given index matches the key of the left row.
+func eqJoin(left values.Sequence, keyFunc func(row values.Datum) (values.Datum, *values.Error), right values.Table, index string) (values.Top, *values.Error) {
+	leftRows := left.AsStream()
+	var (
+		leftRow   values.Datum
+		rightRows values.SelectionStream
+	)
+	return sequenceResult(left, values.NewStream(func() (values.Datum, *values.Error) {
+		for {
+			if rightRows == nil {
+				var err *values.Error
+				if leftRow, err = leftRows.NextItem(); err != nil || leftRow == nil {
+					return nil, err
+				}
+
+				key, err := keyFunc(leftRow)
+				if err != nil {
+					return nil, err
+				}
+				if key == nil || key.IsNull() {
+					continue
+				}
+
+				rightRows = right.GetAll([]values.Datum{key}, index)
+			}
+
+			rightRow, err := rightRows.Next()
+			if err != nil {
+				return nil, err
+			}
+			if rightRow == nil {
+				rightRows = nil
+				continue
+			}
+
+			return joinedPair(leftRow, rightRow), nil
+		}
+	}))
+}
+
+// evalJoinKey evaluates the join key argument of an EQ_JOIN term which is
+// either the name of a field or a function of the left row. The returned func
+// returns a nil datum if a named field does not exist on a row.
+func evalJoinKey(ctx *Context, t *Term) (func(row values.Datum) (values.Datum, *values.Error), *values.Error) {
+	keyVal, err := t.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyVal.IsFunction() {
+		keyFunc := keyVal.(values.Function)
+		return func(row values.Datum) (values.Datum, *values.Error) {
+			return callDatum(keyFunc, row)
+		}, nil
+	}
+
+	if !(keyVal.IsDatum() && keyVal.(values.Datum).IsString()) {
+		return nil, typeError(types.String, keyVal)
+	}
+	field := keyVal.(values.Datum).AsString().Value()
+
+	return func(row values.Datum) (values.Datum, *values.Error) {
+		if !row.IsObject() {
+			return nil, typeError(types.Object, row)
+		}
+		return row.AsObject().Items()[field], nil
+	}, nil
+}
+
+func evalInnerJoin(ctx *Context, t *Term) (values.Top, *values.Error) {
+	return evalNestedLoopJoin(ctx, t, false)
+}
+
+func evalOuterJoin(ctx *Context, t *Term) (values.Top, *values.Error) {
+	return evalNestedLoopJoin(ctx, t, true)
+}
+
+// evalNestedLoopJoin evaluates an INNER_JOIN or OUTER_JOIN term by calling the
+// predicate function with every pair of rows from the left and right
+// sequences. The right sequence term is evaluated again for each left row so
+// that streams need not be buffered. For an outer join, left rows which match
+// no right row are included without a right value.
+func evalNestedLoopJoin(ctx *Context, t *Term, outer bool) (values.Top, *values.Error) {
+	if err := t.checkArity(3, 3); err != nil {
+		return nil, err
+	}
+
+	left, err := evalSequence(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure that the right side is a sequence before streaming any rows.
+	if _, err := evalSequence(ctx, t.Args[1]); err != nil {
+		return nil, err
+	}
+
+	predicate, err := evalFunction(ctx, t.Args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	leftRows := left.AsStream()
+	var (
+		leftRow   values.Datum
+		rightRows values.Stream
+		matched   bool
+	)
+	return sequenceResult(left, values.NewStream(func() (values.Datum, *values.Error) {
+		for {
+			if rightRows == nil {
+				var err *values.Error
+				if leftRow, err = leftRows.NextItem(); err != nil || leftRow == nil {
+					return nil, err
+				}
+
+				right, err := evalSequence(ctx, t.Args[1])
+				if err != nil {
+					return nil, err
+				}
+				rightRows = right.AsStream()
+				matched = false
+			}
+
+			rightRow, err := rightRows.NextItem()
+			if err != nil {
+				return nil, err
+			}
+			if rightRow == nil {
+				rightRows = nil
+				if outer && !matched {
+					return joinedPair(leftRow, nil), nil
+				}
+				continue
+			}
+
+			isMatch, err := callDatum(predicate, leftRow, rightRow)
+			if err != nil {
+				return nil, err
+			}
+			if isTruthy(isMatch) {
+				matched = true
+				return joinedPair(leftRow, rightRow), nil
+			}
+		}
+	}))
+}
+
+// evalZip evaluates a ZIP term which merges the right value of each row of a
+// join result into its left value, as MERGE does.
+func evalZip(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+
+	seq, err := evalSequence(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	rows := seq.AsStream()
+	return sequenceResult(seq, values.NewStream(func() (values.Datum, *values.Error) {
+		row, err := rows.NextItem()
+		if err != nil || row == nil {
+			return nil, err
+		}
+
+		if !row.IsObject() {
+			return nil, typeError(types.Object, row)
+		}
+		pair := row.AsObject().Items()
+		left, hasLeft := pair["left"]
+		if !hasLeft {
+			return nil, queryLogicError("ZIP can only be called on the result of a join.")
+		}
+		right, hasRight := pair["right"]
+		if !hasRight {
+			return left, nil
+		}
+
+		if !(left.IsObject() && right.IsObject()) {
+			return nil, queryLogicError("ZIP can only be called on the result of a join of objects.")
+		}
+		return mergeDatums(left, right), nil
+	}))
+}
@@ -0,0 +1,357 @@
+package query
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/catalog"
+	"github.com/jlhawn/reboltdb/jobs"
+	"github.com/jlhawn/reboltdb/json"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/stats"
+	"github.com/jlhawn/reboltdb/storage"
+	"github.com/jlhawn/reboltdb/system"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+// evalQuery parses the given JSON-encoded term and evaluates it with the
+// given variables bound.
+func evalQuery(t *testing.T, query string, vars map[int64]values.Datum) (values.Top, *values.Error) {
+	t.Helper()
+
+	val, err := json.Parse([]byte(query))
+	if err != nil {
+		t.Fatalf("unable to parse query %s: %s", query, err)
+	}
+	term, err := MakeTermTree(val)
+	if err != nil {
+		t.Fatalf("unable to make term tree for query %s: %s", query, err)
+	}
+
+	ctx := NewContext()
+	for id, val := range vars {
+		ctx.vars[id] = val
+	}
+	return term.Eval(ctx)
+}
+
+// native converts the given value into plain Go values for comparison,
+// draining any streams.
+func native(t *testing.T, val values.Top) interface{} {
+	t.Helper()
+
+	if !val.IsDatum() {
+		seq, ok := val.(values.Sequence)
+		if !ok {
+			t.Fatalf("unable to convert %s to a native value", typeOf(val))
+		}
+		arr, err := drainStream(seq.AsStream())
+		if err != nil {
+			t.Fatalf("unable to drain stream: %s", err.Message)
+		}
+		val = arr
+	}
+
+	d := val.(values.Datum)
+	switch {
+	case d.IsNull():
+		return nil
+	case d.IsBool():
+		return d.AsBool().Value()
+	case d.IsNumber():
+		return d.AsNumber().Float64()
+	case d.IsString():
+		return d.AsString().Value()
+	case d.IsArray():
+		items := []interface{}{}
+		for _, item := range d.AsArray().Items() {
+			items = append(items, native(t, item))
+		}
+		return items
+	case d.IsTime():
+		return native(t, d.AsTime().PseudoObject())
+	case d.IsBinary():
+		return native(t, d.AsBinary().PseudoObject())
+	case d.IsGeometry():
+		return native(t, d.AsGeometry().PseudoObject())
+	case d.IsObject():
+		items := map[string]interface{}{}
+		for key, item := range d.AsObject().Items() {
+			items[key] = native(t, item)
+		}
+		return items
+	}
+	t.Fatalf("unable to convert %s to a native value", typeOf(d))
+	return nil
+}
+
+func expectResult(t *testing.T, query string, vars map[int64]values.Datum, expected interface{}) {
+	t.Helper()
+
+	val, err := evalQuery(t, query, vars)
+	if err != nil {
+		t.Fatalf("unable to evaluate query %s: %s", query, err.Message)
+	}
+	if actual := native(t, val); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("query %s: expected %#v but got %#v", query, expected, actual)
+	}
+}
+
+func parseDatum(t *testing.T, data string) values.Datum {
+	t.Helper()
+
+	val, err := json.Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("unable to parse datum %s: %s", data, err)
+	}
+	return values.FromJSON(val)
+}
+
+// These aliases allow the fakes below to embed the interfaces they implement
+// without the field names clashing with interface methods.
+type (
+	tableInterface           = values.Table
+	selectionStreamInterface = values.SelectionStream
+)
+
+// fakeTable is an in-memory table which supports only the methods needed to
+// look up rows by the value of a field.
+type fakeTable struct {
+	tableInterface
+	rows []values.Datum
+}
+
+func (ft fakeTable) IsSequence() bool                          { return true }
+func (ft fakeTable) AsStream() values.Stream                   { return ft }
+func (ft fakeTable) IsSelectionStream() bool                   { return true }
+func (ft fakeTable) AsSelectionStream() values.SelectionStream { return ft }
+func (ft fakeTable) IsTable() bool                             { return true }
+func (ft fakeTable) AsTable() values.Table                     { return ft }
+
+func (ft fakeTable) GetAll(keys []values.Datum, index string) values.SelectionStream {
+	if index == "" {
+		index = "id"
+	}
+	var matches []values.Datum
+	for _, row := range ft.rows {
+		for _, key := range keys {
+			if reflect.DeepEqual(row.AsObject().Items()[index], key) {
+				matches = append(matches, row)
+			}
+		}
+	}
+	return fakeSelectionStream{rows: values.NewArray(matches).AsStream()}
+}
+
+type fakeSelectionStream struct {
+	selectionStreamInterface
+	rows values.Stream
+}
+
+func (fs fakeSelectionStream) NextItem() (values.Datum, *values.Error) {
+	return fs.rows.NextItem()
+}
+
+func (fs fakeSelectionStream) Next() (values.Selection, *values.Error) {
+	row, err := fs.rows.NextItem()
+	if err != nil || row == nil {
+		return nil, err
+	}
+	return fakeSelection{row.AsObject()}, nil
+}
+
+type fakeSelection struct {
+	values.Object
+}
+
+func (fakeSelection) DB() string    { return "test" }
+func (fakeSelection) Table() string { return "fake" }
+
+func (fakeSelection) Changes(options values.Object) (values.Feed, *values.Error) { return nil, nil }
+
+func TestEqJoin(t *testing.T) {
+	orders := parseDatum(t, `[{"id": 1, "customer": "a"}, {"id": 2, "customer": "b"}, {"id": 3}]`).AsArray()
+	customers := fakeTable{rows: []values.Datum{
+		parseDatum(t, `{"id": "a", "name": "Alice", "region": "west"}`),
+		parseDatum(t, `{"id": "b", "name": "Bob", "region": "west"}`),
+	}}
+	byField := func(field string) func(row values.Datum) (values.Datum, *values.Error) {
+		return func(row values.Datum) (values.Datum, *values.Error) {
+			return row.AsObject().Items()[field], nil
+		}
+	}
+
+	// The third order has no customer so it is skipped.
+	result, err := eqJoin(orders, byField("customer"), customers, "")
+	if err != nil {
+		t.Fatalf("unable to evaluate eqJoin: %s", err.Message)
+	}
+	expected := []interface{}{
+		map[string]interface{}{"left": native(t, orders.Items()[0]), "right": native(t, customers.rows[0])},
+		map[string]interface{}{"left": native(t, orders.Items()[1]), "right": native(t, customers.rows[1])},
+	}
+	if actual := native(t, result); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v but got %#v", expected, actual)
+	}
+
+	regions := parseDatum(t, `[{"region": "west"}, {"region": "east"}]`).AsArray()
+	result, err = eqJoin(regions, byField("region"), customers, "region")
+	if err != nil {
+		t.Fatalf("unable to evaluate eqJoin with index: %s", err.Message)
+	}
+	if actual := native(t, result).([]interface{}); len(actual) != 2 {
+		t.Errorf("expected 2 rows joined on the region index but got %d", len(actual))
+	}
+}
+
+func TestNestedLoopJoins(t *testing.T) {
+	vars := map[int64]values.Datum{
+		1: parseDatum(t, `[{"id": 1}, {"id": 2}]`),
+		2: parseDatum(t, `[true, false]`),
+	}
+	// The predicate matches a pair when the right row is truthy.
+	predicate := `[69, [[2, [3, 4]], [10, [4]]]]`
+
+	expectResult(t, `[48, [[10, [1]], [10, [2]], `+predicate+`]]`, vars, []interface{}{
+		map[string]interface{}{"left": map[string]interface{}{"id": 1.0}, "right": true},
+		map[string]interface{}{"left": map[string]interface{}{"id": 2.0}, "right": true},
+	})
+
+	vars[2] = parseDatum(t, `[false, null]`)
+	expectResult(t, `[48, [[10, [1]], [10, [2]], `+predicate+`]]`, vars, []interface{}{})
+	expectResult(t, `[49, [[10, [1]], [10, [2]], `+predicate+`]]`, vars, []interface{}{
+		map[string]interface{}{"left": map[string]interface{}{"id": 1.0}},
+		map[string]interface{}{"left": map[string]interface{}{"id": 2.0}},
+	})
+}
+
+func TestZip(t *testing.T) {
+	vars := map[int64]values.Datum{
+		1: parseDatum(t, `[{"left": {"a": 1, "b": 1, "c": {"x": 1}}, "right": {"b": 2, "c": {"y": 2}}}, {"left": {"a": 3}}]`),
+	}
+	expectResult(t, `[72, [[10, [1]]]]`, vars, []interface{}{
+		map[string]interface{}{"a": 1.0, "b": 2.0, "c": map[string]interface{}{"x": 1.0, "y": 2.0}},
+		map[string]interface{}{"a": 3.0},
+	})
+
+	if _, err := evalQuery(t, `[72, [[2, [1]]]]`, nil); err == nil {
+		t.Errorf("expected an error when zipping a sequence which is not a join result")
+	}
+}
+
+func TestEqJoinStoredTable(t *testing.T) {
+	sys, c, ctx := newTestSystem(t)
+	if _, err := c.CreateTable(catalog.DefaultDB, "customers", "id", "hard"); err != nil {
+		t.Fatal(err.Message)
+	}
+	customers, err := sys.Table(catalog.DefaultDB, "customers")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	result := customers.InsertSequence(parseDatum(t, `[
+		{"id": "a", "name": "Alice", "region": "west"},
+		{"id": "b", "name": "Bob", "region": "west"},
+		{"id": "c", "name": "Carol", "region": "east"}
+	]`).AsArray(), "error", "hard", false)
+	if inserted := native(t, result).(map[string]interface{})["inserted"]; inserted != 3.0 {
+		t.Fatalf("expected 3 rows to be inserted but got %v", native(t, result))
+	}
+
+	// r.table("customers").indexCreate("region")
+	if _, err := makeTerm(t, `[75, [[15, ["customers"]], "region"]]`).Eval(ctx); err != nil {
+		t.Fatalf("unable to create index: %s", err.Message)
+	}
+	// r.table("customers").indexList()
+	if actual := native(t, mustEval(t, ctx, `[77, [[15, ["customers"]]]]`)); !reflect.DeepEqual(actual, []interface{}{"region"}) {
+		t.Errorf("expected the region index to be listed but got %v", actual)
+	}
+
+	// r.expr([...]).eqJoin("customer", r.table("customers"))
+	orders := `[50, [[2, [{"id": 1, "customer": "b"}, {"id": 2, "customer": "z"}, {"id": 3}]], "customer", [15, ["customers"]]]]`
+	expected := []interface{}{
+		map[string]interface{}{
+			"left":  map[string]interface{}{"id": 1.0, "customer": "b"},
+			"right": map[string]interface{}{"id": "b", "name": "Bob", "region": "west"},
+		},
+	}
+	if actual := native(t, mustEval(t, ctx, orders)); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v but got %#v", expected, actual)
+	}
+
+	// r.expr([{"region": "west"}, {"region": "north"}]).eqJoin("region", r.table("customers"), {index: "region"})
+	regions := `[50, [[2, [{"region": "west"}, {"region": "north"}]], "region", [15, ["customers"]]], {"index": "region"}]`
+	var names []interface{}
+	for _, row := range native(t, mustEval(t, ctx, regions)).([]interface{}) {
+		names = append(names, row.(map[string]interface{})["right"].(map[string]interface{})["name"])
+	}
+	if !reflect.DeepEqual(names, []interface{}{"Alice", "Bob"}) {
+		t.Errorf("expected Alice and Bob to be joined on the region index but got %v", names)
+	}
+
+	missing := `[50, [[2, [{"region": "west"}]], "region", [15, ["customers"]]], {"index": "missing"}]`
+	if _, err := drainTerm(t, ctx, missing); err == nil || err.Type != ql2.Response_OP_FAILED {
+		t.Errorf("expected joining on a missing index to fail but got %v", err)
+	}
+}
+
+// newTestSystem returns the system of a new database, which is queried by
+// the returned context.
+func newTestSystem(t *testing.T) (*system.System, *catalog.Catalog, *Context) {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	c, err := catalog.Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := users.Open(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := storage.Open(db, LoadFunction, RunWriteHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sys := system.New(c, data, store, jobs.NewRegistry(), stats.New(db), system.Server{ID: c.ServerID(), Name: "test_server", Started: time.Now()})
+	return sys, c, NewContext().WithUser(store, users.Admin).WithCatalog(sys)
+}
+
+func makeTerm(t *testing.T, query string) *Term {
+	t.Helper()
+	val, err := json.Parse([]byte(query))
+	if err != nil {
+		t.Fatalf("unable to parse query %s: %s", query, err)
+	}
+	term, err := MakeTermTree(val)
+	if err != nil {
+		t.Fatalf("unable to make term tree for query %s: %s", query, err)
+	}
+	return term
+}
+
+func mustEval(t *testing.T, ctx *Context, query string) values.Top {
+	t.Helper()
+	val, err := makeTerm(t, query).Eval(ctx)
+	if err != nil {
+		t.Fatalf("unable to evaluate %s: %s", query, err.Message)
+	}
+	return val
+}
+
+// drainTerm evaluates a term and reads every item of the stream it returns.
+func drainTerm(t *testing.T, ctx *Context, query string) (values.Top, *values.Error) {
+	t.Helper()
+	val, err := makeTerm(t, query).Eval(ctx)
+	if err != nil || !val.IsSequence() {
+		return val, err
+	}
+	return drainStream(val.(values.Sequence).AsStream())
+}
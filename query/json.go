@@ -0,0 +1,47 @@
+package query
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/json"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_JSON] = evalJSON
+	evalFuncs[ql2.Term_TO_JSON_STRING] = evalToJSONString
+}
+
+// evalJSON parses a string of JSON. Objects which encode pseudo types, such as
+// TIME, are converted into values of those types.
+func evalJSON(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	s, err := evalString(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	val, parseErr := json.Parse([]byte(s))
+	if parseErr != nil {
+		return nil, queryLogicError("Failed to parse \"%s\" as JSON: %s", s, parseErr)
+	}
+	return values.FromJSON(val), nil
+}
+
+// evalToJSONString encodes a datum as a string of JSON, with pseudo types
+// encoded as the objects which represent them.
+func evalToJSONString(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	val, err := evalDatum(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := values.ToJSON(val)
+	if err != nil {
+		return nil, err
+	}
+	return values.NewString(string(encoded)), nil
+}
@@ -0,0 +1,33 @@
+package query
+
+import (
+	"testing"
+)
+
+func TestJSONTerms(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		{`[98, ["[1, {\"a\": null}]"]]`, []interface{}{1.0, map[string]interface{}{"a": nil}}},
+		{`[98, ["{\"$reql_type$\": \"BINARY\", \"data\": \"aGk=\"}"]]`, map[string]interface{}{"$reql_type$": "BINARY", "data": "aGk="}},
+		{`[52, [[98, ["{\"$reql_type$\": \"BINARY\", \"data\": \"aGk=\"}"]]]]`, "PTYPE<BINARY>"},
+		{`[172, [{"b": [2, [1, 2.5]], "a": "<é>"}]]`, `{"a":"<é>","b":[1,2.5]}`},
+		{`[172, [[155, ["hi"]]]]`, `{"$reql_type$":"BINARY","data":"aGk="}`},
+		{`[172, [[101, [0]]]]`, `{"$reql_type$":"TIME","epoch_time":0,"timezone":"+00:00"}`},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+
+	for _, query := range []string{
+		`[98, ["{"]]`,
+		`[98, [1]]`,
+		`[172, [[180, []]]]`,
+	} {
+		if _, err := evalQuery(t, query, nil); err == nil {
+			t.Errorf("expected query %s to fail", query)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package query
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_EQ] = makeComparison(func(cmp int) bool { return cmp == 0 })
+	evalFuncs[ql2.Term_NE] = evalNe
+	evalFuncs[ql2.Term_LT] = makeComparison(func(cmp int) bool { return cmp < 0 })
+	evalFuncs[ql2.Term_LE] = makeComparison(func(cmp int) bool { return cmp <= 0 })
+	evalFuncs[ql2.Term_GT] = makeComparison(func(cmp int) bool { return cmp > 0 })
+	evalFuncs[ql2.Term_GE] = makeComparison(func(cmp int) bool { return cmp >= 0 })
+	evalFuncs[ql2.Term_NOT] = evalNot
+	evalFuncs[ql2.Term_AND] = evalAnd
+	evalFuncs[ql2.Term_OR] = evalOr
+	evalFuncs[ql2.Term_BRANCH] = evalBranch
+}
+
+// makeComparison returns an evaluator for a comparison term which is true if
+// the given check holds for every pair of adjacent arguments, e.g.
+// r.lt(1, 2, 3) is true because 1 < 2 and 2 < 3.
+func makeComparison(check func(cmp int) bool) termEvaluator {
+	return func(ctx *Context, t *Term) (values.Top, *values.Error) {
+		result, err := compareAdjacent(ctx, t, check)
+		if err != nil {
+			return nil, err
+		}
+		return values.NewBool(result), nil
+	}
+}
+
+func compareAdjacent(ctx *Context, t *Term, check func(cmp int) bool) (bool, *values.Error) {
+	args, err := evalDatumArgs(ctx, t, 2)
+	if err != nil {
+		return false, err
+	}
+	for i := 1; i < len(args); i++ {
+		if !check(values.Compare(args[i-1], args[i])) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// evalNe is the negation of EQ: it is true unless every argument is equal.
+func evalNe(ctx *Context, t *Term) (values.Top, *values.Error) {
+	allEqual, err := compareAdjacent(ctx, t, func(cmp int) bool { return cmp == 0 })
+	if err != nil {
+		return nil, err
+	}
+	return values.NewBool(!allEqual), nil
+}
+
+func evalNot(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	val, err := evalDatum(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	return values.NewBool(!isTruthy(val)), nil
+}
+
+// evalAnd returns the first argument which is false or null, or the last
+// argument if there is none. Arguments after the first false value are not
+// evaluated.
+func evalAnd(ctx *Context, t *Term) (values.Top, *values.Error) {
+	var result values.Datum = values.NewBool(true)
+	for _, arg := range t.Args {
+		var err *values.Error
+		if result, err = evalDatum(ctx, arg); err != nil {
+			return nil, err
+		}
+		if !isTruthy(result) {
+			break
+		}
+	}
+	return result, nil
+}
+
+// evalOr returns the first argument which is neither false nor null, or the
+// last argument if there is none. Arguments after the first true value are
+// not evaluated.
+func evalOr(ctx *Context, t *Term) (values.Top, *values.Error) {
+	var result values.Datum = values.NewBool(false)
+	for _, arg := range t.Args {
+		var err *values.Error
+		if result, err = evalDatum(ctx, arg); err != nil {
+			return nil, err
+		}
+		if isTruthy(result) {
+			break
+		}
+	}
+	return result, nil
+}
+
+// evalBranch evaluates r.branch(test, trueBranch, [test2, trueBranch2, ...]
+// falseBranch). Only the chosen branch is evaluated.
+func evalBranch(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if len(t.Args) < 3 || len(t.Args)%2 == 0 {
+		return nil, queryLogicError("Expected an odd number of arguments of at least 3 but found %d.", len(t.Args))
+	}
+	for i := 0; i+1 < len(t.Args); i += 2 {
+		test, err := evalDatum(ctx, t.Args[i])
+		if err != nil {
+			return nil, err
+		}
+		if isTruthy(test) {
+			return t.Args[i+1].Eval(ctx)
+		}
+	}
+	return t.Args[len(t.Args)-1].Eval(ctx)
+}
@@ -0,0 +1,279 @@
+package query
+
+import (
+	"math"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// arraySizeLimit is the largest array which may be created by repeating an
+// array, matching the default `array_limit` of RethinkDB.
+const arraySizeLimit = 100000
+
+func init() {
+	evalFuncs[ql2.Term_ADD] = evalAdd
+	evalFuncs[ql2.Term_SUB] = evalSub
+	evalFuncs[ql2.Term_MUL] = evalMul
+	evalFuncs[ql2.Term_DIV] = evalDiv
+	evalFuncs[ql2.Term_MOD] = evalMod
+	evalFuncs[ql2.Term_FLOOR] = evalFloor
+	evalFuncs[ql2.Term_CEIL] = evalCeil
+	evalFuncs[ql2.Term_ROUND] = evalRound
+}
+
+// newNumber returns the given float as a Number, ensuring that the result of
+// an arithmetic operation is finite.
+func newNumber(f float64) (values.Number, *values.Error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return values.Number{}, queryLogicError("Non-finite number: %v", f)
+	}
+	return values.NewNumber(f), nil
+}
+
+// evalDatumArgs evaluates every argument of this term as a datum, ensuring
+// that there are at least min arguments.
+func evalDatumArgs(ctx *Context, t *Term, min int) ([]values.Datum, *values.Error) {
+	if err := t.checkArity(min, -1); err != nil {
+		return nil, err
+	}
+	args := make([]values.Datum, len(t.Args))
+	for i, arg := range t.Args {
+		var err *values.Error
+		if args[i], err = evalDatum(ctx, arg); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// evalNumberArgs evaluates every argument of this term as a number, ensuring
+// that there are at least min arguments.
+func evalNumberArgs(ctx *Context, t *Term, min int) ([]float64, *values.Error) {
+	args, err := evalDatumArgs(ctx, t, min)
+	if err != nil {
+		return nil, err
+	}
+	nums := make([]float64, len(args))
+	for i, arg := range args {
+		if !arg.IsNumber() {
+			return nil, typeError(types.Number, arg)
+		}
+		nums[i] = arg.AsNumber().Float64()
+	}
+	return nums, nil
+}
+
+// evalAdd sums numbers or concatenates strings or arrays. The type of the
+// first argument determines the type of every other argument.
+func evalAdd(ctx *Context, t *Term) (values.Top, *values.Error) {
+	args, err := evalDatumArgs(ctx, t, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	first := args[0]
+	switch {
+	case first.IsNumber():
+		sum, err := sumNumbers(args)
+		if err != nil {
+			return nil, err
+		}
+		return newNumber(sum)
+	case first.IsTime():
+		seconds, err := sumNumbers(args[1:])
+		if err != nil {
+			return nil, err
+		}
+		epoch := first.AsTime().EpochTime() + seconds
+		if err := values.CheckEpochTime(epoch); err != nil {
+			return nil, err
+		}
+		return values.NewTime(epoch, first.AsTime().Offset()), nil
+	case first.IsString():
+		concat := first.AsString().Value()
+		for _, arg := range args[1:] {
+			if !arg.IsString() {
+				return nil, typeError(types.String, arg)
+			}
+			concat += arg.AsString().Value()
+		}
+		return values.NewString(concat), nil
+	case first.IsArray():
+		var items []values.Datum
+		for _, arg := range args {
+			if !arg.IsArray() {
+				return nil, typeError(types.Array, arg)
+			}
+			items = append(items, arg.AsArray().Items()...)
+		}
+		return values.NewArray(items), nil
+	}
+	return nil, queryLogicError("Expected type NUMBER, STRING, TIME, or ARRAY but found %s.", typeOf(first))
+}
+
+func sumNumbers(args []values.Datum) (float64, *values.Error) {
+	var sum float64
+	for _, arg := range args {
+		if !arg.IsNumber() {
+			return 0, typeError(types.Number, arg)
+		}
+		sum += arg.AsNumber().Float64()
+	}
+	return sum, nil
+}
+
+// evalSub subtracts numbers. A number of seconds may be subtracted from a time
+// to give an earlier time, and subtracting one time from another gives the
+// number of seconds between them.
+func evalSub(ctx *Context, t *Term) (values.Top, *values.Error) {
+	args, err := evalDatumArgs(ctx, t, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := args[0]
+	if !(diff.IsNumber() || diff.IsTime()) {
+		return nil, typeError(types.Number, diff)
+	}
+	for _, arg := range args[1:] {
+		switch {
+		case diff.IsNumber() && arg.IsNumber():
+			if diff, err = newNumber(diff.AsNumber().Float64() - arg.AsNumber().Float64()); err != nil {
+				return nil, err
+			}
+		case diff.IsTime() && arg.IsNumber():
+			epoch := diff.AsTime().EpochTime() - arg.AsNumber().Float64()
+			if err := values.CheckEpochTime(epoch); err != nil {
+				return nil, err
+			}
+			diff = values.NewTime(epoch, diff.AsTime().Offset())
+		case diff.IsTime() && arg.IsTime():
+			diff = values.NewNumber(diff.AsTime().EpochTime() - arg.AsTime().EpochTime())
+		case diff.IsTime():
+			return nil, queryLogicError("Expected type NUMBER or TIME but found %s.", typeOf(arg))
+		default:
+			return nil, typeError(types.Number, arg)
+		}
+	}
+	return diff, nil
+}
+
+// repeatArray returns the items of the given array repeated the given number
+// of times.
+func repeatArray(arr values.Array, times values.Number) (values.Array, *values.Error) {
+	if !times.IsInteger() {
+		return values.Array{}, queryLogicError("Number not an integer: %v", times.Float64())
+	}
+	if times.Float64() < 0 {
+		return values.Array{}, queryLogicError("Cannot multiply an ARRAY by a negative number (%v).", times.Float64())
+	}
+	n := len(arr.Items())
+	if n == 0 {
+		return arr, nil
+	}
+	// The limit is checked before multiplying, which may overflow.
+	if times.Float64() > float64(arraySizeLimit/n) {
+		return values.Array{}, values.NewError(ql2.Response_RESOURCE_LIMIT, "Array over size limit `%d`.", arraySizeLimit)
+	}
+	items := make([]values.Datum, 0, n*int(times.Int64()))
+	for i := int64(0); i < times.Int64(); i++ {
+		items = append(items, arr.Items()...)
+	}
+	return values.NewArray(items), nil
+}
+
+// evalMul multiplies numbers or, if one of the operands is an array, repeats
+// that array.
+func evalMul(ctx *Context, t *Term) (values.Top, *values.Error) {
+	args, err := evalDatumArgs(ctx, t, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	product := args[0]
+	if !(product.IsNumber() || product.IsArray()) {
+		return nil, typeError(types.Number, product)
+	}
+	for _, arg := range args[1:] {
+		switch {
+		case product.IsNumber() && arg.IsNumber():
+			if product, err = newNumber(product.AsNumber().Float64() * arg.AsNumber().Float64()); err != nil {
+				return nil, err
+			}
+		case product.IsArray() && arg.IsNumber():
+			if product, err = repeatArray(product.AsArray(), arg.AsNumber()); err != nil {
+				return nil, err
+			}
+		case product.IsNumber() && arg.IsArray():
+			if product, err = repeatArray(arg.AsArray(), product.AsNumber()); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, typeError(types.Number, arg)
+		}
+	}
+	return product, nil
+}
+
+func evalDiv(ctx *Context, t *Term) (values.Top, *values.Error) {
+	nums, err := evalNumberArgs(ctx, t, 1)
+	if err != nil {
+		return nil, err
+	}
+	quotient := nums[0]
+	for _, num := range nums[1:] {
+		if num == 0 {
+			return nil, queryLogicError("Cannot divide by zero.")
+		}
+		quotient /= num
+	}
+	return newNumber(quotient)
+}
+
+// evalMod returns the remainder of dividing two integers. The result has the
+// same sign as the dividend.
+func evalMod(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	dividend, err := evalInteger(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	divisor, err := evalInteger(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	if divisor == 0 {
+		return nil, queryLogicError("Cannot take a number modulo 0.")
+	}
+	return values.NewNumber(float64(dividend % divisor)), nil
+}
+
+func evalRounding(ctx *Context, t *Term, round func(float64) float64) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	num, err := evalNumber(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	return values.NewNumber(round(num.Float64())), nil
+}
+
+func evalFloor(ctx *Context, t *Term) (values.Top, *values.Error) {
+	return evalRounding(ctx, t, math.Floor)
+}
+
+func evalCeil(ctx *Context, t *Term) (values.Top, *values.Error) {
+	return evalRounding(ctx, t, math.Ceil)
+}
+
+// evalRound rounds to the nearest integer, rounding halfway values away from
+// zero.
+func evalRound(ctx *Context, t *Term) (values.Top, *values.Error) {
+	return evalRounding(ctx, t, math.Round)
+}
@@ -0,0 +1,135 @@
+package query
+
+import (
+	"testing"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+)
+
+func TestArithmeticTerms(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		{`[24, [1, 2, 3]]`, 6.0},
+		{`[24, ["a", "b", "c"]]`, "abc"},
+		{`[24, [[2, [1]], [2, [2, 3]]]]`, []interface{}{1.0, 2.0, 3.0}},
+		{`[25, [10, 2, 3]]`, 5.0},
+		{`[26, [2, 3, 4]]`, 24.0},
+		{`[26, [[2, [1, 2]], 2]]`, []interface{}{1.0, 2.0, 1.0, 2.0}},
+		{`[26, [2, [2, [1]]]]`, []interface{}{1.0, 1.0}},
+		{`[26, [[2, []], 4611686018427387904]]`, []interface{}{}},
+		{`[27, [12, 3, 2]]`, 2.0},
+		{`[28, [-7, 3]]`, -1.0},
+		{`[183, [-1.5]]`, -2.0},
+		{`[184, [1.2]]`, 2.0},
+		{`[185, [-2.5]]`, -3.0},
+		{`[185, [2.4]]`, 2.0},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+
+	for _, query := range []string{
+		`[24, [1, "a"]]`,
+		`[27, [1, 0]]`,
+		`[28, [1.5, 1]]`,
+		`[28, [1, 0]]`,
+		`[26, [[2, [1]], -1]]`,
+		`[26, [1e300, 1e300]]`,
+	} {
+		if _, err := evalQuery(t, query, nil); err == nil {
+			t.Errorf("expected an error evaluating %s", query)
+		}
+	}
+
+	// Repeating an array a huge number of times must hit the size limit
+	// rather than overflow the size of the result.
+	for _, query := range []string{
+		`[26, [[2, [1, 2, 3]], 4611686018427387904]]`,
+		`[26, [[2, [1, 2, 3, 4]], 4611686018427387904]]`,
+		`[26, [[2, [1]], 1e300]]`,
+		`[26, [[2, [1, 2]], 50001]]`,
+	} {
+		if _, err := evalQuery(t, query, nil); err == nil || err.Type != ql2.Response_RESOURCE_LIMIT {
+			t.Errorf("expected %s to exceed the array size limit but got %v", query, err)
+		}
+	}
+}
+
+func TestComparisonAndLogicTerms(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		{`[17, [1, 1, 1]]`, true},
+		{`[17, [{"a": [2, [1, 2]]}, {"a": [2, [1, 2]]}]]`, true},
+		{`[18, [1, 1, 2]]`, true},
+		{`[19, [1, 2, 3]]`, true},
+		{`[19, [1, 3, 2]]`, false},
+		{`[20, [1, 1, 2]]`, true},
+		{`[21, ["b", "a"]]`, true},
+		{`[22, [2, 2]]`, true},
+		// Arrays < bools < null < numbers < objects < strings.
+		{`[19, [[2, []], false, null, 0, {}, ""]]`, true},
+		{`[19, [[2, [1, 2]], [2, [1, 3]], [2, [2]]]]`, true},
+		{`[23, [null]]`, true},
+		{`[23, [0]]`, false},
+		{`[67, []]`, true},
+		{`[67, [1, 2]]`, 2.0},
+		{`[67, [1, false, [12, ["not evaluated"]]]]`, false},
+		{`[66, []]`, false},
+		{`[66, [null, 2, [12, ["not evaluated"]]]]`, 2.0},
+		{`[65, [true, 1, [12, ["not evaluated"]]]]`, 1.0},
+		{`[65, [false, 1, null, 2, 3]]`, 3.0},
+		{`[65, [false, 1, 0, 2, 3]]`, 2.0},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+}
+
+func TestBitwiseTerms(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		{`[191, [7, 14, 6]]`, 6.0},
+		{`[192, [1, 2, 4]]`, 7.0},
+		{`[193, [5, 3]]`, 6.0},
+		{`[194, [5]]`, -6.0},
+		{`[195, [5, 4]]`, 80.0},
+		{`[195, [-5, 4]]`, -80.0},
+		{`[196, [80, 4]]`, 5.0},
+		{`[196, [-80, 70]]`, -1.0},
+		{`[192, [9007199254740992, 0]]`, 9007199254740992.0},
+		{`[195, [1, 53]]`, 9007199254740992.0},
+		{`[195, [-1, 53]]`, -9007199254740992.0},
+		{`[195, [0, 1000]]`, 0.0},
+		{`[196, [5, 1000]]`, 0.0},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+
+	for _, query := range []string{
+		`[191, [1.5, 1]]`,
+		`[191, [1e20, 1]]`,
+		`[191, ["a", 1]]`,
+		`[191, [1]]`,
+		`[195, [1, -1]]`,
+		`[195, [1, 60]]`,
+		`[195, [1024, 60]]`,
+		`[195, [1024, 54]]`,
+		`[195, [1024, 44]]`,
+		`[195, [3, 52]]`,
+		`[195, [-3, 52]]`,
+	} {
+		if _, err := evalQuery(t, query, nil); err == nil {
+			t.Errorf("expected an error evaluating %s", query)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+package query
+
+import (
+	"sort"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_MERGE] = evalMerge
+	evalFuncs[ql2.Term_LITERAL] = evalLiteral
+	evalFuncs[ql2.Term_KEYS] = evalKeys
+	evalFuncs[ql2.Term_VALUES] = evalValues
+	evalFuncs[ql2.Term_OBJECT] = evalObject
+	evalFuncs[ql2.Term_GET_FIELD] = evalGetField
+	evalFuncs[ql2.Term_HAS_FIELDS] = evalHasFields
+}
+
+const (
+	literalType     = "LITERAL"
+	literalValueKey = "value"
+)
+
+// isLiteral reports whether the given datum was produced by r.literal().
+func isLiteral(d values.Datum) bool {
+	if !d.IsObject() {
+		return false
+	}
+	reqlType, ok := d.AsObject().Items()[values.PseudoTypeKey]
+	return ok && reqlType.IsString() && reqlType.AsString().Value() == literalType
+}
+
+// literalValue returns the value wrapped by the given literal. The returned
+// datum is nil for an empty literal, r.literal(), which removes a field.
+func literalValue(literal values.Datum) values.Datum {
+	return literal.AsObject().Items()[literalValueKey]
+}
+
+// dropLiterals replaces any literals nested within the given datum with their
+// values. Fields and items holding an empty literal are removed. The
+// returned datum is nil if the given datum is itself an empty literal.
+func dropLiterals(d values.Datum) values.Datum {
+	switch {
+	case isLiteral(d):
+		if val := literalValue(d); val != nil {
+			return dropLiterals(val)
+		}
+		return nil
+	case d.IsArray():
+		items := make([]values.Datum, 0, len(d.AsArray().Items()))
+		for _, item := range d.AsArray().Items() {
+			if item = dropLiterals(item); item != nil {
+				items = append(items, item)
+			}
+		}
+		return values.NewArray(items)
+	case d.IsObject():
+		items := make(map[string]values.Datum, len(d.AsObject().Items()))
+		for key, val := range d.AsObject().Items() {
+			if val = dropLiterals(val); val != nil {
+				items[key] = val
+			}
+		}
+		return values.NewObject(items)
+	}
+	return d
+}
+
+// mergeDatums deeply merges the right datum into the left datum. Fields of
+// the right object replace those of the left object unless both values are
+// objects, in which case they are merged recursively. A literal on the right
+// always replaces the left value wholesale, and an empty literal removes the
+// field. If either datum is not an object the result is the right datum.
+func mergeDatums(left, right values.Datum) values.Datum {
+	if isLiteral(right) {
+		if val := literalValue(right); val != nil {
+			return dropLiterals(val)
+		}
+		return left
+	}
+	if !(left.IsObject() && right.IsObject()) {
+		return dropLiterals(right)
+	}
+
+	merged := make(map[string]values.Datum, len(left.AsObject().Items())+len(right.AsObject().Items()))
+	for key, val := range left.AsObject().Items() {
+		merged[key] = val
+	}
+	for key, val := range right.AsObject().Items() {
+		leftVal, exists := merged[key]
+		switch {
+		case isLiteral(val):
+			if val = literalValue(val); val != nil {
+				merged[key] = dropLiterals(val)
+			} else {
+				delete(merged, key)
+			}
+		case exists && val.IsObject():
+			merged[key] = mergeDatums(leftVal, val)
+		default:
+			merged[key] = dropLiterals(val)
+		}
+	}
+	return values.NewObject(merged)
+}
+
+// evalMerge merges each of its arguments into the first argument in turn. An
+// argument may be a function, in which case it is called with the result of
+// the merge so far. If the first argument is a sequence then each of its
+// items is merged.
+func evalMerge(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, -1); err != nil {
+		return nil, err
+	}
+	target, err := t.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	literalCtx := ctx.withLiterals(true)
+	mergers := make([]values.Top, len(t.Args)-1)
+	for i, arg := range t.Args[1:] {
+		if mergers[i], err = arg.Eval(literalCtx); err != nil {
+			return nil, err
+		}
+		if !(mergers[i].IsFunction() || mergers[i].IsDatum()) {
+			return nil, typeError(types.Datum, mergers[i])
+		}
+	}
+
+	// merge merges the arguments into an object, each of which must be an
+	// object or a function which returns one.
+	merge := func(d values.Datum) (values.Datum, *values.Error) {
+		if !d.IsObject() {
+			return nil, typeError(types.Object, d)
+		}
+		for _, merger := range mergers {
+			var src values.Datum
+			if merger.IsFunction() {
+				var err *values.Error
+				if src, err = callDatum(merger.(values.Function), d); err != nil {
+					return nil, err
+				}
+			} else {
+				src = merger.(values.Datum)
+			}
+			if !src.IsObject() {
+				return nil, typeError(types.Object, src)
+			}
+			d = mergeDatums(d, src)
+		}
+		return d, nil
+	}
+
+	if target.IsSequence() {
+		seq := target.(values.Sequence)
+		stream := seq.AsStream()
+		return sequenceResult(seq, values.NewStream(func() (values.Datum, *values.Error) {
+			item, err := stream.NextItem()
+			if err != nil || item == nil {
+				return nil, err
+			}
+			return merge(item)
+		}))
+	}
+	if !target.IsDatum() {
+		return nil, typeError(types.Object, target)
+	}
+	return merge(target.(values.Datum))
+}
+
+// evalLiteral evaluates r.literal() which is only allowed within the
+// arguments of MERGE or UPDATE.
+func evalLiteral(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if !ctx.literalOK {
+		return nil, queryLogicError("Stray literal keyword found: literal is only legal inside of the object passed to merge or update and cannot nest inside other literals.")
+	}
+	if err := t.checkArity(0, 1); err != nil {
+		return nil, err
+	}
+
+	items := map[string]values.Datum{
+		values.PseudoTypeKey: values.NewString(literalType),
+	}
+	if len(t.Args) == 1 {
+		val, err := evalDatum(ctx.withLiterals(false), t.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		items[literalValueKey] = val
+	}
+	return values.NewObject(items), nil
+}
+
+func evalObjectArg(ctx *Context, t *Term) (values.Object, *values.Error) {
+	val, err := evalDatum(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if !val.IsObject() {
+		return nil, typeError(types.Object, val)
+	}
+	return val.AsObject(), nil
+}
+
+func sortedKeys(obj values.Object) []string {
+	keys := make([]string, 0, len(obj.Items()))
+	for key := range obj.Items() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func evalKeys(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	obj, err := evalObjectArg(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	keys := sortedKeys(obj)
+	items := make([]values.Datum, len(keys))
+	for i, key := range keys {
+		items[i] = values.NewString(key)
+	}
+	return values.NewArray(items), nil
+}
+
+// evalValues returns the values of an object in the order of their keys.
+func evalValues(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	obj, err := evalObjectArg(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	keys := sortedKeys(obj)
+	items := make([]values.Datum, len(keys))
+	for i, key := range keys {
+		items[i] = obj.Items()[key]
+	}
+	return values.NewArray(items), nil
+}
+
+// evalObject evaluates r.object(key, value, ...) which makes an object from
+// alternating keys and values.
+func evalObject(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if len(t.Args)%2 != 0 {
+		return nil, queryLogicError("OBJECT expects an even number of arguments (but found %d).", len(t.Args))
+	}
+	items := make(map[string]values.Datum, len(t.Args)/2)
+	for i := 0; i < len(t.Args); i += 2 {
+		key, err := evalString(ctx, t.Args[i])
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := items[key]; exists {
+			return nil, queryLogicError("Duplicate key `%s` in object.", key)
+		}
+		if items[key], err = evalDatum(ctx, t.Args[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return values.NewObject(items), nil
+}
+
+// getField returns the named field of the given object. Getting a field of
+// null is a non-existence error, so it may be caught by DEFAULT.
+func getField(obj values.Datum, field string) (values.Datum, *values.Error) {
+	if obj.IsNull() {
+		return nil, nonExistenceError("Cannot perform get_field on a non-object non-sequence `%s`.", typeOf(obj))
+	}
+	if !obj.IsObject() {
+		return nil, queryLogicError("Cannot perform get_field on a non-object non-sequence `%s`.", typeOf(obj))
+	}
+	val, ok := obj.AsObject().Items()[field]
+	if !ok {
+		return nil, nonExistenceError("No attribute `%s` in object.", field)
+	}
+	return val, nil
+}
+
+// pluckField returns a sequence of the named field of each object in the
+// given sequence. Objects without the field are skipped.
+func pluckField(seq values.Sequence, field string) (values.Top, *values.Error) {
+	stream := seq.AsStream()
+	return sequenceResult(seq, values.NewStream(func() (values.Datum, *values.Error) {
+		for {
+			item, err := stream.NextItem()
+			if err != nil || item == nil {
+				return nil, err
+			}
+			if val, err := getField(item, field); err == nil {
+				return val, nil
+			} else if err.Type != ql2.Response_NON_EXISTENCE {
+				return nil, err
+			}
+		}
+	}))
+}
+
+func evalGetField(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	val, err := t.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	field, err := evalString(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if val.IsSequence() {
+		return pluckField(val.(values.Sequence), field)
+	}
+	if val.IsDatum() {
+		return getField(val.(values.Datum), field)
+	}
+	return nil, queryLogicError("Cannot perform get_field on a non-object non-sequence `%s`.", typeOf(val))
+}
+
+// hasPath reports whether the given datum has every field described by the
+// given path spec. A path spec is a field name, an array of path specs, or an
+// object mapping field names to `true` or to path specs of nested fields. A
+// field which is null is treated as missing.
+func hasPath(d values.Datum, path values.Datum) (bool, *values.Error) {
+	switch {
+	case path.IsString():
+		if !d.IsObject() {
+			return false, nil
+		}
+		val, ok := d.AsObject().Items()[path.AsString().Value()]
+		return ok && !val.IsNull(), nil
+	case path.IsArray():
+		for _, subPath := range path.AsArray().Items() {
+			if ok, err := hasPath(d, subPath); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case path.IsObject():
+		if !d.IsObject() {
+			return false, nil
+		}
+		for key, subPath := range path.AsObject().Items() {
+			val, ok := d.AsObject().Items()[key]
+			if !ok || val.IsNull() {
+				return false, nil
+			}
+			if subPath.IsBool() && subPath.AsBool().Value() {
+				continue
+			}
+			if ok, err := hasPath(val, subPath); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return false, queryLogicError("Invalid path argument `%s`.", typeOf(path))
+}
+
+// evalHasFields tests whether an object has all of the given fields or, for a
+// sequence, filters it to the objects which do.
+func evalHasFields(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, -1); err != nil {
+		return nil, err
+	}
+	val, err := t.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]values.Datum, len(t.Args)-1)
+	for i, arg := range t.Args[1:] {
+		if paths[i], err = evalDatum(ctx, arg); err != nil {
+			return nil, err
+		}
+	}
+	pathSpec := values.NewArray(paths)
+
+	if val.IsSequence() {
+		seq := val.(values.Sequence)
+		stream := seq.AsStream()
+		return sequenceResult(seq, values.NewStream(func() (values.Datum, *values.Error) {
+			for {
+				item, err := stream.NextItem()
+				if err != nil || item == nil {
+					return nil, err
+				}
+				if ok, err := hasPath(item, pathSpec); err != nil {
+					return nil, err
+				} else if ok {
+					return item, nil
+				}
+			}
+		}))
+	}
+
+	if !(val.IsDatum() && val.(values.Datum).IsObject()) {
+		return nil, typeError(types.Object, val)
+	}
+	ok, err := hasPath(val.(values.Datum), pathSpec)
+	if err != nil {
+		return nil, err
+	}
+	return values.NewBool(ok), nil
+}
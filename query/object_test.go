@@ -0,0 +1,62 @@
+package query
+
+import (
+	"testing"
+)
+
+func TestObjectTerms(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		{`[35, [{"a": 1, "b": {"c": 1, "d": 1}}, {"b": {"c": 2}}]]`, map[string]interface{}{
+			"a": 1.0, "b": map[string]interface{}{"c": 2.0, "d": 1.0},
+		}},
+		{`[35, [{"a": 1, "b": {"c": 1, "d": 1}}, {"b": [137, [{"c": 2}]]}]]`, map[string]interface{}{
+			"a": 1.0, "b": map[string]interface{}{"c": 2.0},
+		}},
+		{`[35, [{"a": 1, "b": 2}, {"b": [137, []]}]]`, map[string]interface{}{"a": 1.0}},
+		{`[35, [{"a": 1}, [69, [[2, [1]], {"b": [31, [[10, [1]], "a"]]}]]]]`, map[string]interface{}{
+			"a": 1.0, "b": 1.0,
+		}},
+		{`[35, [[2, [{"a": 1}, {"a": 2}]], {"b": 3}]]`, []interface{}{
+			map[string]interface{}{"a": 1.0, "b": 3.0},
+			map[string]interface{}{"a": 2.0, "b": 3.0},
+		}},
+		{`[94, [{"b": 1, "a": 2}]]`, []interface{}{"a", "b"}},
+		{`[186, [{"b": 1, "a": 2}]]`, []interface{}{2.0, 1.0}},
+		{`[143, ["a", 1, "b", 2]]`, map[string]interface{}{"a": 1.0, "b": 2.0}},
+		{`[31, [{"a": 1}, "a"]]`, 1.0},
+		{`[32, [{"a": 1, "b": null}, "a"]]`, true},
+		{`[32, [{"a": 1, "b": null}, "b"]]`, false},
+		{`[32, [{"a": {"b": 1}}, {"a": {"b": true}}]]`, true},
+		{`[32, [{"a": {"b": 1}}, {"a": "c"}]]`, false},
+		{`[32, [[2, [{"a": 1}, {"b": 1}]], "a"]]`, []interface{}{map[string]interface{}{"a": 1.0}}},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+
+	for _, query := range []string{
+		`[137, [1]]`,                      // Stray literal.
+		`[35, [{}, [137, [[137, [1]]]]]]`, // Nested literal.
+		`[31, [{"a": 1}, "b"]]`,
+		`[143, ["a", 1, "a", 2]]`,
+	} {
+		if _, err := evalQuery(t, query, nil); err == nil {
+			t.Errorf("expected an error evaluating %s", query)
+		}
+	}
+	for _, query := range []string{
+		`[35, [1, {"a": 1}]]`,
+		`[35, [{"a": 1}, 1]]`,
+		`[35, [{"a": 1}, [69, [[2, [1]], 1]]]]`,
+		`[35, [[2, [{"a": 1}, 2]], {"b": 3}]]`,
+	} {
+		_, err := drainTerm(t, NewContext(), query)
+		if err == nil || err.Message != "Expected type OBJECT but found NUMBER." {
+			t.Errorf("expected %s to fail with a type error but got %v", query, err)
+		}
+	}
+}
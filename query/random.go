@@ -0,0 +1,105 @@
+package query
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+	mathrand "math/rand"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_UUID] = evalUUID
+	evalFuncs[ql2.Term_RANDOM] = evalRandom
+}
+
+// uuidNamespace is the namespace of the version 5 UUIDs which RethinkDB
+// derives from strings.
+var uuidNamespace = [16]byte{
+	0x91, 0x46, 0x1c, 0x99, 0xf8, 0x9d, 0x49, 0xd2,
+	0xaf, 0x96, 0xd8, 0xe2, 0xe1, 0x4e, 0x9b, 0x58,
+}
+
+// evalUUID returns a random version 4 UUID or, given a string, the version 5
+// UUID of that string in RethinkDB's namespace.
+func evalUUID(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(0, 1); err != nil {
+		return nil, err
+	}
+
+	var uuid [16]byte
+	if len(t.Args) == 0 {
+		if _, err := rand.Read(uuid[:]); err != nil {
+			return nil, values.NewError(ql2.Response_INTERNAL, "Unable to generate a random UUID: %s", err)
+		}
+		uuid[6] = uuid[6]&0x0f | 0x40
+	} else {
+		name, err := evalString(ctx, t.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		hash := sha1.New()
+		hash.Write(uuidNamespace[:])
+		hash.Write([]byte(name))
+		copy(uuid[:], hash.Sum(nil))
+		uuid[6] = uuid[6]&0x0f | 0x50
+	}
+	uuid[8] = uuid[8]&0x3f | 0x80 // The RFC 4122 variant.
+
+	return values.NewString(fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])), nil
+}
+
+// evalRandom returns a random number. With no arguments it is a float in the
+// range [0, 1). Otherwise it is in the range [0, upper) or [lower, upper) and
+// the bounds must be integers unless the `float` option is true.
+func evalRandom(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(0, 2); err != nil {
+		return nil, err
+	}
+	bounds := make([]values.Number, len(t.Args))
+	for i, arg := range t.Args {
+		var err *values.Error
+		if bounds[i], err = evalNumber(ctx, arg); err != nil {
+			return nil, err
+		}
+	}
+	useFloat := false
+	if optArg, ok := t.OptArgs["float"]; ok {
+		var err *values.Error
+		if useFloat, err = evalBool(ctx, optArg); err != nil {
+			return nil, err
+		}
+	}
+
+	lower, upper := values.NewNumber(0), values.NewNumber(1)
+	switch len(bounds) {
+	case 0:
+		useFloat = true
+	case 1:
+		upper = bounds[0]
+	case 2:
+		lower, upper = bounds[0], bounds[1]
+	}
+
+	if useFloat {
+		l, u := lower.Float64(), upper.Float64()
+		if l > u {
+			l, u = u, l
+		}
+		return values.NewNumber(l + mathrand.Float64()*(u-l)), nil
+	}
+
+	if !lower.IsSafeInteger() {
+		return nil, queryLogicError("Lower bound (%v) is not an integer.", lower.Float64())
+	}
+	if !upper.IsSafeInteger() {
+		return nil, queryLogicError("Upper bound (%v) is not an integer.", upper.Float64())
+	}
+	if lower.Int64() >= upper.Int64() {
+		return nil, queryLogicError("Lower bound (%d) is not less than upper bound (%d).", lower.Int64(), upper.Int64())
+	}
+	return values.NewNumber(float64(lower.Int64() + mathrand.Int63n(upper.Int64()-lower.Int64()))), nil
+}
@@ -0,0 +1,64 @@
+package query
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestUUID(t *testing.T) {
+	expectResult(t, `[169, ["slava@rethinkdb.com"]]`, nil, "ae7e9cf3-11f5-5326-8a43-744b3fa7a2a3")
+
+	v4 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	first, err := evalQuery(t, `[169, []]`, nil)
+	if err != nil {
+		t.Fatalf("unable to generate a UUID: %s", err.Message)
+	}
+	second, err := evalQuery(t, `[169, []]`, nil)
+	if err != nil {
+		t.Fatalf("unable to generate a UUID: %s", err.Message)
+	}
+	if uuid := native(t, first).(string); !v4.MatchString(uuid) {
+		t.Errorf("expected a version 4 UUID but got %q", uuid)
+	}
+	if native(t, first) == native(t, second) {
+		t.Errorf("expected random UUIDs to differ")
+	}
+}
+
+func TestRandom(t *testing.T) {
+	testCases := []struct {
+		query        string
+		lower, upper float64
+		integer      bool
+	}{
+		{`[151, []]`, 0, 1, false},
+		{`[151, [10]]`, 0, 10, true},
+		{`[151, [-5, 5]]`, -5, 5, true},
+		{`[151, [1.5, 2.5], {"float": true}]`, 1.5, 2.5, false},
+		{`[151, [3, 1], {"float": true}]`, 1, 3, false},
+	}
+
+	for _, testCase := range testCases {
+		for i := 0; i < 20; i++ {
+			val, err := evalQuery(t, testCase.query, nil)
+			if err != nil {
+				t.Fatalf("unable to evaluate query %s: %s", testCase.query, err.Message)
+			}
+			n := native(t, val).(float64)
+			if n < testCase.lower || n >= testCase.upper || (testCase.integer && n != float64(int64(n))) {
+				t.Errorf("query %s: got %v out of range", testCase.query, n)
+			}
+		}
+	}
+
+	for _, query := range []string{
+		`[151, [1.5]]`,
+		`[151, [2, 2]]`,
+		`[151, [3, 1]]`,
+		`[151, ["a"]]`,
+	} {
+		if _, err := evalQuery(t, query, nil); err == nil {
+			t.Errorf("expected query %s to fail", query)
+		}
+	}
+}
@@ -0,0 +1,699 @@
+package query
+
+import (
+	"math"
+	"math/rand"
+	"unicode/utf8"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_SLICE] = evalSlice
+	evalFuncs[ql2.Term_SKIP] = evalSkip
+	evalFuncs[ql2.Term_LIMIT] = evalLimit
+	evalFuncs[ql2.Term_NTH] = evalNth
+	evalFuncs[ql2.Term_BRACKET] = evalBracket
+	evalFuncs[ql2.Term_OFFSETS_OF] = evalOffsetsOf
+	evalFuncs[ql2.Term_CONTAINS] = evalContains
+	evalFuncs[ql2.Term_IS_EMPTY] = evalIsEmpty
+	evalFuncs[ql2.Term_COUNT] = evalCount
+	evalFuncs[ql2.Term_UNION] = evalUnion
+	evalFuncs[ql2.Term_SAMPLE] = evalSample
+	evalFuncs[ql2.Term_RANGE] = evalRange
+}
+
+// sliceBounds holds the canonical bounds of a slice. A negative end means
+// that the slice continues to the end of its input.
+type sliceBounds struct {
+	start, end int64
+	// fromEnd is set if the start was given as a negative index, counting
+	// back from the end of the input, even if it is no longer negative
+	// once an open bound is applied.
+	fromEnd bool
+}
+
+// resolve converts the given slice bounds, which may be negative to count
+// back from the end, into offsets within an input of the given size.
+func (b sliceBounds) resolve(size int) (int, int) {
+	clamp := func(index int64) int {
+		if index < 0 {
+			index += int64(size)
+		}
+		return int(math.Max(0, math.Min(float64(index), float64(size))))
+	}
+
+	start, end := clamp(b.start), size
+	if b.end != math.MaxInt64 {
+		end = clamp(b.end)
+	}
+	if end < start {
+		end = start
+	}
+	return start, end
+}
+
+// evalSliceBounds evaluates the index arguments and the `left_bound` and
+// `right_bound` options of a SLICE term into a half-open range.
+func evalSliceBounds(ctx *Context, t *Term) (sliceBounds, *values.Error) {
+	bounds := sliceBounds{end: math.MaxInt64}
+
+	var err *values.Error
+	if bounds.start, err = evalInteger(ctx, t.Args[1]); err != nil {
+		return bounds, err
+	}
+	bounds.fromEnd = bounds.start < 0
+	if len(t.Args) == 3 {
+		if bounds.end, err = evalInteger(ctx, t.Args[2]); err != nil {
+			return bounds, err
+		}
+	}
+
+	leftClosed, err := evalBoundOption(ctx, t, "left_bound", true)
+	if err != nil {
+		return bounds, err
+	}
+	rightClosed, err := evalBoundOption(ctx, t, "right_bound", false)
+	if err != nil {
+		return bounds, err
+	}
+
+	if !leftClosed {
+		bounds.start++
+		if bounds.start == 0 {
+			// An open bound just before the end leaves nothing.
+			bounds.start = math.MaxInt64
+		}
+	}
+	if rightClosed && bounds.end != math.MaxInt64 {
+		bounds.end++
+		if bounds.end == 0 {
+			// A closed bound at the last element includes everything.
+			bounds.end = math.MaxInt64
+		}
+	}
+	return bounds, nil
+}
+
+// evalBoundOption evaluates the named bound option, which is either "closed"
+// or "open", and reports whether the bound is closed.
+func evalBoundOption(ctx *Context, t *Term, name string, defaultClosed bool) (bool, *values.Error) {
+	val, err := evalOptArg(ctx, t, name)
+	if err != nil || val == nil {
+		return defaultClosed, err
+	}
+	if !val.IsString() {
+		return false, typeError(types.String, val)
+	}
+	switch val.AsString().Value() {
+	case "closed":
+		return true, nil
+	case "open":
+		return false, nil
+	}
+	return false, queryLogicError("Expected `open` or `closed` for optarg `%s` (got `%s`).", name, val.AsString().Value())
+}
+
+func evalSlice(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 3); err != nil {
+		return nil, err
+	}
+
+	val, err := t.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bounds, err := evalSliceBounds(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if val.IsDatum() && val.(values.Datum).IsString() {
+		runes := []rune(val.(values.Datum).AsString().Value())
+		start, end := bounds.resolve(len(runes))
+		return values.NewString(string(runes[start:end])), nil
+	}
+	if val.IsDatum() && val.(values.Datum).IsBinary() {
+		data := val.(values.Datum).AsBinary().Data()
+		start, end := bounds.resolve(len(data))
+		return values.NewBinary(data[start:end]), nil
+	}
+	if !val.IsSequence() {
+		return nil, typeError(types.Sequence, val)
+	}
+	return sliceSequence(val.(values.Sequence), bounds)
+}
+
+// sliceSequence returns the items of the given sequence within the given
+// bounds. Arrays may be sliced with negative indexes but streams, whose
+// length is not known, may not.
+func sliceSequence(seq values.Sequence, bounds sliceBounds) (values.Top, *values.Error) {
+	if seq.IsArray() {
+		items := seq.AsArray().Items()
+		start, end := bounds.resolve(len(items))
+		return values.NewArray(items[start:end]), nil
+	}
+
+	if bounds.start < 0 || bounds.fromEnd {
+		return nil, queryLogicError("Cannot use a negative left index on a stream.")
+	}
+	if bounds.end < 0 {
+		return nil, queryLogicError("Cannot use a right index < -1 on a stream.")
+	}
+
+	stream := seq.AsStream()
+	var index int64
+	return values.NewStream(func() (values.Datum, *values.Error) {
+		for ; index < bounds.start; index++ {
+			if item, err := stream.NextItem(); err != nil || item == nil {
+				return nil, err
+			}
+		}
+		if index >= bounds.end {
+			return nil, nil
+		}
+		index++
+		return stream.NextItem()
+	}), nil
+}
+
+func evalSkip(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	seq, err := evalSequence(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	n, err := evalInteger(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	return sliceSequence(seq, sliceBounds{start: n, end: math.MaxInt64})
+}
+
+func evalLimit(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	seq, err := evalSequence(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	n, err := evalInteger(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, queryLogicError("LIMIT takes a non-negative argument (got %d)", n)
+	}
+	return sliceSequence(seq, sliceBounds{start: 0, end: n})
+}
+
+// nth returns the item at the given index of the given sequence. A negative
+// index counts back from the end of the sequence.
+func nth(seq values.Sequence, index int64) (values.Datum, *values.Error) {
+	if seq.IsArray() {
+		items := seq.AsArray().Items()
+		offset := index
+		if offset < 0 {
+			offset += int64(len(items))
+		}
+		if offset < 0 || offset >= int64(len(items)) {
+			return nil, nonExistenceError("Index out of bounds: %d", index)
+		}
+		return items[offset], nil
+	}
+
+	// For a negative index, keep a window of the last items in the stream.
+	stream := seq.AsStream()
+	var window []values.Datum
+	for i := int64(0); ; i++ {
+		item, err := stream.NextItem()
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			break
+		}
+		if i == index {
+			return item, nil
+		}
+		if index < 0 {
+			window = append(window, item)
+			if int64(len(window)) > -index {
+				window = window[1:]
+			}
+		}
+	}
+	if index < 0 && int64(len(window)) == -index {
+		return window[0], nil
+	}
+	return nil, nonExistenceError("Index out of bounds: %d", index)
+}
+
+func evalNth(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	seq, err := evalSequence(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	index, err := evalInteger(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	return nth(seq, index)
+}
+
+// evalBracket evaluates a BRACKET term which is either NTH given a number or
+// GET_FIELD given a string.
+func evalBracket(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	val, err := t.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := evalDatum(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case key.IsNumber():
+		if !val.IsSequence() {
+			return nil, queryLogicError("Cannot perform nth on a non-sequence `%s`.", typeOf(val))
+		}
+		index, err := safeInteger(key.AsNumber())
+		if err != nil {
+			return nil, err
+		}
+		return nth(val.(values.Sequence), index)
+	case key.IsString():
+		if val.IsDatum() && val.(values.Datum).IsObject() {
+			return getField(val.(values.Datum), key.AsString().Value())
+		}
+		if val.IsSequence() {
+			return pluckField(val.(values.Sequence), key.AsString().Value())
+		}
+		if val.IsDatum() && val.(values.Datum).IsNull() {
+			return nil, nonExistenceError("Cannot perform bracket on a non-object non-sequence `%s`.", typeOf(val))
+		}
+		return nil, queryLogicError("Cannot perform bracket on a non-object non-sequence `%s`.", typeOf(val))
+	}
+	return nil, queryLogicError("Expected NUMBER or STRING as second argument to `bracket` but found %s.", typeOf(key))
+}
+
+// evalPredicate evaluates the given term as a predicate on sequence items. A
+// function is called with each item while any other value is compared with
+// each item for equality.
+func evalPredicate(ctx *Context, t *Term) (func(item values.Datum) (bool, *values.Error), *values.Error) {
+	val, err := t.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if val.IsFunction() {
+		fn := val.(values.Function)
+		return func(item values.Datum) (bool, *values.Error) {
+			result, err := callDatum(fn, item)
+			if err != nil {
+				return false, err
+			}
+			return isTruthy(result), nil
+		}, nil
+	}
+	if !val.IsDatum() {
+		return nil, typeError(types.Datum, val)
+	}
+	return func(item values.Datum) (bool, *values.Error) {
+		return values.Equal(item, val.(values.Datum)), nil
+	}, nil
+}
+
+func evalOffsetsOf(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	seq, err := evalSequence(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	predicate, err := evalPredicate(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	stream := seq.AsStream()
+	var offsets []values.Datum
+	for i := 0; ; i++ {
+		item, err := stream.NextItem()
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			return values.NewArray(offsets), nil
+		}
+		if ok, err := predicate(item); err != nil {
+			return nil, err
+		} else if ok {
+			offsets = append(offsets, values.NewNumber(float64(i)))
+		}
+	}
+}
+
+// evalContains reports whether every one of the given values or predicates is
+// matched by some item in the sequence.
+func evalContains(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, -1); err != nil {
+		return nil, err
+	}
+	seq, err := evalSequence(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	remaining := make([]func(values.Datum) (bool, *values.Error), len(t.Args)-1)
+	for i, arg := range t.Args[1:] {
+		if remaining[i], err = evalPredicate(ctx, arg); err != nil {
+			return nil, err
+		}
+	}
+
+	stream := seq.AsStream()
+	for len(remaining) > 0 {
+		item, err := stream.NextItem()
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			return values.NewBool(false), nil
+		}
+
+		unmatched := remaining[:0]
+		for _, predicate := range remaining {
+			ok, err := predicate(item)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				unmatched = append(unmatched, predicate)
+			}
+		}
+		remaining = unmatched
+	}
+	return values.NewBool(true), nil
+}
+
+func evalIsEmpty(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	seq, err := evalSequence(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	if seq.IsArray() {
+		return values.NewBool(len(seq.AsArray().Items()) == 0), nil
+	}
+	item, err := seq.AsStream().NextItem()
+	if err != nil {
+		return nil, err
+	}
+	return values.NewBool(item == nil), nil
+}
+
+// filterStream returns a stream of the items of the given stream for which
+// keep returns true.
+func filterStream(stream values.Stream, keep func(item values.Datum) (bool, *values.Error)) values.Stream {
+	return values.NewStream(func() (values.Datum, *values.Error) {
+		for {
+			item, err := stream.NextItem()
+			if err != nil || item == nil {
+				return nil, err
+			}
+			ok, err := keep(item)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return item, nil
+			}
+		}
+	})
+}
+
+// evalCount counts the items of a sequence, optionally only those which match
+// a predicate. It also counts the characters of a string, the bytes of a
+// binary value, and the fields of an object.
+func evalCount(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 2); err != nil {
+		return nil, err
+	}
+	val, err := t.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if val.IsDatum() && len(t.Args) == 1 {
+		d := val.(values.Datum)
+		switch {
+		case d.IsString():
+			return values.NewNumber(float64(utf8.RuneCountInString(d.AsString().Value()))), nil
+		case d.IsBinary():
+			return values.NewNumber(float64(len(d.AsBinary().Data()))), nil
+		case d.IsObject():
+			return values.NewNumber(float64(len(d.AsObject().Items()))), nil
+		}
+	}
+	if !val.IsSequence() {
+		return nil, typeError(types.Sequence, val)
+	}
+	seq := val.(values.Sequence)
+	if seq.IsArray() && len(t.Args) == 1 {
+		return values.NewNumber(float64(len(seq.AsArray().Items()))), nil
+	}
+
+	matches := func(item values.Datum) (bool, *values.Error) { return true, nil }
+	if len(t.Args) == 2 {
+		if matches, err = evalPredicate(ctx, t.Args[1]); err != nil {
+			return nil, err
+		}
+	}
+	stream := seq.AsStream()
+	var count int
+	for {
+		item, err := stream.NextItem()
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			return values.NewNumber(float64(count)), nil
+		}
+		match, err := matches(item)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			count++
+		}
+	}
+}
+
+// evalUnion concatenates its sequences. The `interleave` option may be false
+// to keep the order of the inputs, true (the default) to allow any order, or
+// a field name or function to merge inputs which are already ordered by that
+// key. The result is an array if every input is an array.
+func evalUnion(ctx *Context, t *Term) (values.Top, *values.Error) {
+	seqs := make([]values.Sequence, len(t.Args))
+	allArrays := true
+	for i, arg := range t.Args {
+		var err *values.Error
+		if seqs[i], err = evalSequence(ctx, arg); err != nil {
+			return nil, err
+		}
+		allArrays = allArrays && seqs[i].IsArray()
+	}
+
+	var key func(item values.Datum) (values.Datum, *values.Error)
+	if optArg, ok := t.OptArgs["interleave"]; ok {
+		interleave, err := optArg.Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case interleave.IsFunction():
+			fn := interleave.(values.Function)
+			key = func(item values.Datum) (values.Datum, *values.Error) {
+				return callDatum(fn, item)
+			}
+		case interleave.IsDatum() && interleave.(values.Datum).IsString():
+			field := interleave.(values.Datum).AsString().Value()
+			key = func(item values.Datum) (values.Datum, *values.Error) {
+				return getField(item, field)
+			}
+		case !(interleave.IsDatum() && interleave.(values.Datum).IsBool()):
+			return nil, queryLogicError("Expected BOOL, STRING, or FUNCTION for optarg `interleave` but found %s.", typeOf(interleave))
+		}
+	}
+
+	streams := make([]values.Stream, len(seqs))
+	for i, seq := range seqs {
+		streams[i] = seq.AsStream()
+	}
+
+	var result values.Stream
+	if key == nil {
+		result = concatStreams(streams)
+	} else {
+		result = mergeStreams(streams, key)
+	}
+
+	if allArrays {
+		return drainStream(result)
+	}
+	return result, nil
+}
+
+func concatStreams(streams []values.Stream) values.Stream {
+	return values.NewStream(func() (values.Datum, *values.Error) {
+		for len(streams) > 0 {
+			item, err := streams[0].NextItem()
+			if err != nil || item != nil {
+				return item, err
+			}
+			streams = streams[1:]
+		}
+		return nil, nil
+	})
+}
+
+// mergeStreams merges streams which are each ordered by the given key into a
+// single stream ordered by that key. Ties are taken from the earlier stream.
+func mergeStreams(streams []values.Stream, key func(item values.Datum) (values.Datum, *values.Error)) values.Stream {
+	type head struct {
+		item, key values.Datum
+	}
+	heads := make([]*head, len(streams))
+	fill := func(i int) *values.Error {
+		item, err := streams[i].NextItem()
+		if err != nil || item == nil {
+			heads[i] = nil
+			return err
+		}
+		itemKey, err := key(item)
+		if err != nil {
+			return err
+		}
+		heads[i] = &head{item: item, key: itemKey}
+		return nil
+	}
+
+	started := false
+	return values.NewStream(func() (values.Datum, *values.Error) {
+		if !started {
+			for i := range streams {
+				if err := fill(i); err != nil {
+					return nil, err
+				}
+			}
+			started = true
+		}
+
+		min := -1
+		for i, h := range heads {
+			if h != nil && (min < 0 || values.Compare(h.key, heads[min].key) < 0) {
+				min = i
+			}
+		}
+		if min < 0 {
+			return nil, nil
+		}
+
+		item := heads[min].item
+		if err := fill(min); err != nil {
+			return nil, err
+		}
+		return item, nil
+	})
+}
+
+// evalSample returns an array of the given number of items chosen uniformly
+// at random from the sequence.
+func evalSample(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	seq, err := evalSequence(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	n, err := evalInteger(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, queryLogicError("Number of items to sample must be non-negative, got `%d`.", n)
+	}
+
+	// Reservoir sampling keeps the first n items then replaces a random one
+	// with each later item with decreasing probability.
+	stream := seq.AsStream()
+	var sample []values.Datum
+	for seen := int64(0); ; seen++ {
+		item, err := stream.NextItem()
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			break
+		}
+		if seen < n {
+			sample = append(sample, item)
+		} else if i := rand.Int63n(seen + 1); i < n {
+			sample[i] = item
+		}
+	}
+	rand.Shuffle(len(sample), func(i, j int) {
+		sample[i], sample[j] = sample[j], sample[i]
+	})
+	return values.NewArray(sample), nil
+}
+
+// evalRange returns a lazy stream of consecutive integers. With no arguments
+// the stream is infinite, starting at 0. Otherwise it covers the range
+// [0, end) or [start, end).
+func evalRange(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(0, 2); err != nil {
+		return nil, err
+	}
+	bounds := make([]int64, len(t.Args))
+	for i, arg := range t.Args {
+		var err *values.Error
+		if bounds[i], err = evalInteger(ctx, arg); err != nil {
+			return nil, err
+		}
+	}
+
+	next, end := int64(0), int64(math.MaxInt64)
+	switch len(bounds) {
+	case 1:
+		end = bounds[0]
+	case 2:
+		next, end = bounds[0], bounds[1]
+	}
+	return values.NewStream(func() (values.Datum, *values.Error) {
+		if next >= end {
+			return nil, nil
+		}
+		if err := ctx.interrupted(); err != nil {
+			return nil, err
+		}
+		next++
+		return values.NewNumber(float64(next - 1)), nil
+	}), nil
+}
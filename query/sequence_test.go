@@ -0,0 +1,147 @@
+package query
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func TestArrayAndSequenceTerms(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		{`[29, [[2, [1, 2]], 3]]`, []interface{}{1.0, 2.0, 3.0}},
+		{`[80, [[2, [1, 2]], 0]]`, []interface{}{0.0, 1.0, 2.0}},
+		{`[95, [[2, [1, 2, 1, 3]], [2, [1]]]]`, []interface{}{2.0, 3.0}},
+		{`[88, [[2, [1, 1, 2]], 2]]`, []interface{}{1.0, 2.0}},
+		{`[88, [[2, [{"a": [2, [1]]}]], {"a": [2, [1]]}]]`, []interface{}{map[string]interface{}{"a": []interface{}{1.0}}}},
+		{`[89, [[2, [1, 2, 2, 3]], [2, [2, 3, 4]]]]`, []interface{}{2.0, 3.0}},
+		{`[90, [[2, [1, 2]], [2, [2, 3]]]]`, []interface{}{1.0, 2.0, 3.0}},
+		{`[91, [[2, [1, 2, 2, 3]], [2, [3]]]]`, []interface{}{1.0, 2.0}},
+		{`[82, [[2, [1, 3]], 1, 2]]`, []interface{}{1.0, 2.0, 3.0}},
+		{`[82, [[2, [1, 2]], -1, 3]]`, []interface{}{1.0, 2.0, 3.0}},
+		{`[83, [[2, [1, 2, 3]], -1]]`, []interface{}{1.0, 2.0}},
+		{`[83, [[2, [1, 2, 3, 4]], 1, 3]]`, []interface{}{1.0, 4.0}},
+		{`[84, [[2, [1, 2, 3]], 1, 5]]`, []interface{}{1.0, 5.0, 3.0}},
+		{`[85, [[2, [1, 4]], 1, [2, [2, 3]]]]`, []interface{}{1.0, 2.0, 3.0, 4.0}},
+		{`[45, [[2, [1, 2, 3]], -1]]`, 3.0},
+		{`[170, [[2, [1, 2, 3]], 0]]`, 1.0},
+		{`[170, [{"a": 1}, "a"]]`, 1.0},
+		{`[170, [[2, [{"a": 1}, {"b": 2}, {"a": 3}]], "a"]]`, []interface{}{1.0, 3.0}},
+		{`[30, [[2, [0, 1, 2, 3, 4]], 1, 3]]`, []interface{}{1.0, 2.0}},
+		{`[30, [[2, [0, 1, 2, 3, 4]], -2]]`, []interface{}{3.0, 4.0}},
+		{`[30, [[2, [0, 1, 2, 3, 4]], 1, -1], {"left_bound": "open", "right_bound": "closed"}]`, []interface{}{2.0, 3.0, 4.0}},
+		{`[30, ["héllo", 1, 3]]`, "él"},
+		{`[70, [[2, [1, 2, 3]], 2]]`, []interface{}{3.0}},
+		{`[71, [[2, [1, 2, 3]], 2]]`, []interface{}{1.0, 2.0}},
+		{`[87, [[2, [1, 2, 1]], 1]]`, []interface{}{0.0, 2.0}},
+		{`[93, [[2, [1, 2, 3]], 3, 1]]`, true},
+		{`[93, [[2, [1, 2, 3]], 3, 4]]`, false},
+		{`[86, [[2, []]]]`, true},
+		{`[44, [[2, [1, 2]], [2, [3]]]]`, []interface{}{1.0, 2.0, 3.0}},
+		{`[44, [[2, [{"t": 1}, {"t": 4}]], [2, [{"t": 2}, {"t": 3}]]], {"interleave": "t"}]`, []interface{}{
+			map[string]interface{}{"t": 1.0},
+			map[string]interface{}{"t": 2.0},
+			map[string]interface{}{"t": 3.0},
+			map[string]interface{}{"t": 4.0},
+		}},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+}
+
+func TestSequenceTermsOnStreams(t *testing.T) {
+	stream := func() values.Stream {
+		return parseDatum(t, `[0, 1, 2, 3, 4]`).AsArray().AsStream()
+	}
+
+	result, err := sliceSequence(stream(), sliceBounds{start: 1, end: 3})
+	if err != nil {
+		t.Fatalf("unable to slice stream: %s", err.Message)
+	}
+	if _, isStream := result.(values.Stream); !isStream {
+		t.Errorf("expected slice of a stream to be a stream")
+	}
+	if actual := native(t, result); len(actual.([]interface{})) != 2 {
+		t.Errorf("expected 2 items in slice of stream but got %v", actual)
+	}
+
+	if _, err := sliceSequence(stream(), sliceBounds{start: -1, end: 3}); err == nil {
+		t.Errorf("expected an error slicing a stream with a negative index")
+	}
+
+	// r.range().slice(-1, {left_bound: "open"}) must fail rather than skip
+	// the never-ending stream, while the same slice of an array is empty.
+	if _, err := evalQuery(t, `[30, [[173, []], -1], {"left_bound": "open"}]`, nil); err == nil {
+		t.Errorf("expected an error slicing an infinite stream from an open negative index")
+	}
+	expectResult(t, `[30, [[2, [1, 2, 3]], -1], {"left_bound": "open"}]`, nil, []interface{}{})
+
+	item, err := nth(stream(), -2)
+	if err != nil || item.AsNumber().Float64() != 3 {
+		t.Errorf("expected nth(-2) of stream to be 3 but got %v, %v", item, err)
+	}
+
+	if _, err := nth(stream(), 5); err == nil || err.Type != ql2.Response_NON_EXISTENCE {
+		t.Errorf("expected a non-existence error for an out of bounds index but got %v", err)
+	}
+}
+
+func TestSample(t *testing.T) {
+	val, err := evalQuery(t, `[81, [[2, [1, 2, 3, 4, 5]], 3]]`, nil)
+	if err != nil {
+		t.Fatalf("unable to sample: %s", err.Message)
+	}
+	sample := val.(values.Datum).AsArray().Items()
+	if len(sample) != 3 {
+		t.Fatalf("expected 3 sampled items but got %d", len(sample))
+	}
+	if len(distinct(sample)) != 3 {
+		t.Errorf("expected sampled items to be distinct but got %v", native(t, val))
+	}
+}
+
+func TestRange(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		{`[173, [4]]`, []interface{}{0.0, 1.0, 2.0, 3.0}},
+		{`[173, [-2, 1]]`, []interface{}{-2.0, -1.0, 0.0}},
+		{`[173, [3, 1]]`, []interface{}{}},
+		{`[173, [0]]`, []interface{}{}},
+		// The infinite range is lazy, so it can be limited.
+		{`[71, [[173, []], 3]]`, []interface{}{0.0, 1.0, 2.0}},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+
+	if _, err := evalQuery(t, `[173, [1.5]]`, nil); err == nil {
+		t.Errorf("expected a range with a non-integer bound to fail")
+	}
+}
+
+func TestUnsafeIntegerArguments(t *testing.T) {
+	for _, query := range []string{
+		`[70, [[2, [1, 2, 3]], 1e300]]`,
+		`[30, [[2, [1, 2, 3]], 1e300]]`,
+		`[173, [1e300]]`,
+		`[173, [-1e300, 2]]`,
+		`[170, [[2, [1, 2, 3]], 1e300]]`,
+		`[170, [[2, [1, 2, 3]], -1e300]]`,
+		`[149, ["a,b,c", ",", 1e300]]`,
+	} {
+		_, err := evalQuery(t, query, nil)
+		if err == nil || err.Type != ql2.Response_QUERY_LOGIC || !strings.HasPrefix(err.Message, "Number not an integer (>2^53)") {
+			t.Errorf("expected %s to fail with an unsafe integer error but got %v", query, err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package query
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_MATCH] = evalMatch
+	evalFuncs[ql2.Term_SPLIT] = evalSplit
+	evalFuncs[ql2.Term_UPCASE] = makeStringMapping(strings.ToUpper)
+	evalFuncs[ql2.Term_DOWNCASE] = makeStringMapping(strings.ToLower)
+}
+
+// matchGroup returns the object describing a matched portion of a string,
+// where start and end are byte offsets into the string.
+func matchGroup(str string, start, end int) values.Object {
+	return values.NewObject(map[string]values.Datum{
+		"str":   values.NewString(str[start:end]),
+		"start": values.NewNumber(float64(start)),
+		"end":   values.NewNumber(float64(end)),
+	})
+}
+
+// evalMatch matches a string against a regular expression using RE2 syntax,
+// the same dialect as RethinkDB. The result is null if there is no match.
+// Otherwise it is an object describing the match with a `groups` array which
+// holds a group object, or null if it did not participate in the match, for
+// each capture group. Named capture groups appear in `groups` at the position
+// of their opening parenthesis like any other group.
+func evalMatch(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	str, err := evalString(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := evalString(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	re, compileErr := regexp.Compile(pattern)
+	if compileErr != nil {
+		return nil, queryLogicError("Error in regexp `%s`: %s", pattern, compileErr)
+	}
+
+	loc := re.FindStringSubmatchIndex(str)
+	if loc == nil {
+		return values.Null{}, nil
+	}
+
+	groups := make([]values.Datum, 0, re.NumSubexp())
+	for i := 2; i < len(loc); i += 2 {
+		if loc[i] < 0 {
+			groups = append(groups, values.Null{})
+			continue
+		}
+		groups = append(groups, matchGroup(str, loc[i], loc[i+1]))
+	}
+
+	match := matchGroup(str, loc[0], loc[1]).Items()
+	match["groups"] = values.NewArray(groups)
+	return values.NewObject(match), nil
+}
+
+// evalSplitLimit evaluates the optional max splits argument of a SPLIT term.
+// A negative result means that there is no limit.
+func evalSplitLimit(ctx *Context, t *Term) (int, *values.Error) {
+	if len(t.Args) < 3 {
+		return -1, nil
+	}
+	maxSplits, err := evalDatum(ctx, t.Args[2])
+	if err != nil {
+		return 0, err
+	}
+	if maxSplits.IsNull() {
+		return -1, nil
+	}
+	if !maxSplits.IsNumber() {
+		return 0, typeError(types.Number, maxSplits)
+	}
+	limit, err := safeInteger(maxSplits.AsNumber())
+	if err != nil {
+		return 0, err
+	}
+	if limit < 0 {
+		return -1, nil
+	}
+	return int(limit), nil
+}
+
+// splitWhitespace splits the given string on runs of Unicode whitespace,
+// discarding empty strings. If limit is not negative then at most that many
+// splits are made and the remainder of the string, beginning with its next
+// non-whitespace character, is the last item.
+func splitWhitespace(str string, limit int) []string {
+	var parts []string
+	for {
+		str = strings.TrimLeftFunc(str, unicode.IsSpace)
+		if str == "" {
+			return parts
+		}
+		if limit >= 0 && len(parts) == limit {
+			return append(parts, str)
+		}
+		end := strings.IndexFunc(str, unicode.IsSpace)
+		if end < 0 {
+			return append(parts, str)
+		}
+		parts = append(parts, str[:end])
+		str = str[end:]
+	}
+}
+
+// splitCharacters splits the given string into its characters. If limit is
+// not negative then at most that many splits are made and the remainder of
+// the string is the last item.
+func splitCharacters(str string, limit int) []string {
+	var parts []string
+	for str != "" {
+		if limit >= 0 && len(parts) == limit {
+			return append(parts, str)
+		}
+		_, size := utf8.DecodeRuneInString(str)
+		parts = append(parts, str[:size])
+		str = str[size:]
+	}
+	return parts
+}
+
+// evalSplit splits a string on whitespace, if the separator is omitted or
+// null, or on every occurrence of the separator. An empty separator splits
+// the string into characters. The optional third argument limits the number
+// of splits.
+func evalSplit(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 3); err != nil {
+		return nil, err
+	}
+	str, err := evalString(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var separator values.Datum = values.Null{}
+	if len(t.Args) > 1 {
+		if separator, err = evalDatum(ctx, t.Args[1]); err != nil {
+			return nil, err
+		}
+		if !(separator.IsNull() || separator.IsString()) {
+			return nil, typeError(types.String, separator)
+		}
+	}
+
+	limit, err := evalSplitLimit(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []string
+	switch {
+	case separator.IsNull():
+		parts = splitWhitespace(str, limit)
+	case separator.AsString().Value() == "":
+		parts = splitCharacters(str, limit)
+	default:
+		n := -1
+		if limit >= 0 {
+			n = limit + 1
+		}
+		parts = strings.SplitN(str, separator.AsString().Value(), n)
+	}
+
+	items := make([]values.Datum, len(parts))
+	for i, part := range parts {
+		items[i] = values.NewString(part)
+	}
+	return values.NewArray(items), nil
+}
+
+// makeStringMapping returns an evaluator for a term which transforms a
+// string. Case mappings apply to all Unicode letters, not only ASCII.
+func makeStringMapping(mapping func(string) string) termEvaluator {
+	return func(ctx *Context, t *Term) (values.Top, *values.Error) {
+		if err := t.checkArity(1, 1); err != nil {
+			return nil, err
+		}
+		str, err := evalString(ctx, t.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		return values.NewString(mapping(str)), nil
+	}
+}
@@ -0,0 +1,47 @@
+package query
+
+import (
+	"testing"
+)
+
+func TestStringTerms(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		{`[97, ["id: 0xDEADBEEF", "0x([0-9A-F]+)"]]`, map[string]interface{}{
+			"str": "0xDEADBEEF", "start": 4.0, "end": 14.0,
+			"groups": []interface{}{
+				map[string]interface{}{"str": "DEADBEEF", "start": 6.0, "end": 14.0},
+			},
+		}},
+		{`[97, ["2019-03", "(?P<year>\\d+)-(?P<month>\\d+)(-(?P<day>\\d+))?"]]`, map[string]interface{}{
+			"str": "2019-03", "start": 0.0, "end": 7.0,
+			"groups": []interface{}{
+				map[string]interface{}{"str": "2019", "start": 0.0, "end": 4.0},
+				map[string]interface{}{"str": "03", "start": 5.0, "end": 7.0},
+				nil,
+				nil,
+			},
+		}},
+		{`[97, ["Hello", "(?i)^h"]]`, map[string]interface{}{
+			"str": "H", "start": 0.0, "end": 1.0, "groups": []interface{}{},
+		}},
+		{`[97, ["abc", "x"]]`, nil},
+		{`[149, [" foo\u00a0bar\u3000 baz\t"]]`, []interface{}{"foo", "bar", "baz"}},
+		{`[149, ["  foo  bar baz", null, 1]]`, []interface{}{"foo", "bar baz"}},
+		{`[149, ["a,,b", ","]]`, []interface{}{"a", "", "b"}},
+		{`[149, ["a,b,c", ",", 1]]`, []interface{}{"a", "b,c"}},
+		{`[149, ["héllo", ""]]`, []interface{}{"h", "é", "l", "l", "o"}},
+		{`[141, ["grüße"]]`, "GRÜßE"},
+		{`[142, ["ÀB"]]`, "àb"},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+
+	if _, err := evalQuery(t, `[97, ["abc", "("]]`, nil); err == nil {
+		t.Errorf("expected an error matching an invalid regular expression")
+	}
+}
@@ -0,0 +1,361 @@
+package query
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+func init() {
+	evalFuncs[ql2.Term_GET] = evalGet
+	evalFuncs[ql2.Term_BETWEEN] = evalBetween
+	evalFuncs[ql2.Term_DELETE] = evalDelete
+	evalFuncs[ql2.Term_INSERT] = evalInsert
+	evalFuncs[ql2.Term_UPDATE] = evalUpdate
+	evalFuncs[ql2.Term_REPLACE] = evalReplace
+}
+
+// evalGet returns the row of a table with the given primary key, or null if
+// there is no such row.
+func evalGet(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	table, err := evalTable(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	key, err := evalDatum(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	if sel := table.Get(key); sel != nil {
+		return sel, nil
+	}
+	return values.Null{}, nil
+}
+
+// evalBetween returns the rows of a table with keys in the named index, or
+// the primary key, between the given bounds. The lower bound is included and
+// the upper bound is not unless the `left_bound` or `right_bound` options
+// say otherwise.
+func evalBetween(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(3, 3); err != nil {
+		return nil, err
+	}
+	table, err := evalTable(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	lower, err := evalDatum(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	upper, err := evalDatum(ctx, t.Args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	var index string
+	if indexVal, err := evalOptArg(ctx, t, "index"); err != nil {
+		return nil, err
+	} else if indexVal != nil {
+		if !indexVal.IsString() {
+			return nil, typeError(types.String, indexVal)
+		}
+		index = indexVal.AsString().Value()
+	}
+	bounds := map[string]values.Datum{}
+	for name, defaultClosed := range map[string]bool{"left_bound": true, "right_bound": false} {
+		closed, err := evalBoundOption(ctx, t, name, defaultClosed)
+		if err != nil {
+			return nil, err
+		}
+		bounds[name] = values.NewString("open")
+		if closed {
+			bounds[name] = values.NewString("closed")
+		}
+	}
+	return table.Between(lower, upper, index, values.NewObject(bounds)), nil
+}
+
+// evalWriteOptions evaluates the `durability` and `return_changes` options of
+// a write.
+func evalWriteOptions(ctx *Context, t *Term) (durability string, returnChanges bool, err *values.Error) {
+	durability = "hard"
+	if val, err := evalOptArg(ctx, t, "durability"); err != nil {
+		return "", false, err
+	} else if val != nil {
+		if !val.IsString() {
+			return "", false, typeError(types.String, val)
+		}
+		durability = val.AsString().Value()
+		if durability != "hard" && durability != "soft" {
+			return "", false, queryLogicError("Durability option `%s` unrecognized (options are \"hard\" and \"soft\").", durability)
+		}
+	}
+	if val, err := evalOptArg(ctx, t, "return_changes"); err != nil {
+		return "", false, err
+	} else if val != nil {
+		if !val.IsBool() {
+			return "", false, typeError(types.Bool, val)
+		}
+		returnChanges = val.AsBool().Value()
+	}
+	return durability, returnChanges, nil
+}
+
+// skippedResult is the result of writing to a single row which did not
+// exist.
+func skippedResult() values.Object {
+	result := map[string]values.Datum{"skipped": values.NewNumber(1)}
+	for _, field := range []string{"deleted", "errors", "inserted", "replaced", "unchanged"} {
+		result[field] = values.NewNumber(0)
+	}
+	return values.NewObject(result)
+}
+
+// evalSelectionKeys evaluates a selection to write to: a single row, null if
+// the row did not exist, or a stream of rows of one table. It returns the
+// table, which the user running the query must be permitted to write to, and
+// the primary keys of the rows. The table is nil for a null selection. A GET
+// term selects its key whether or not the row exists, so that a replace may
+// insert it.
+func evalSelectionKeys(ctx *Context, t *Term) (values.Table, []values.Datum, *values.Error) {
+	if t.Type == ql2.Term_GET {
+		if err := t.checkArity(2, 2); err != nil {
+			return nil, nil, err
+		}
+		table, err := evalTableFor(ctx, t.Args[0], users.Write)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := evalDatum(ctx, t.Args[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		return table, []values.Datum{key}, nil
+	}
+
+	val, err := t.Eval(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows []values.Datum
+	var desc values.TableDescriptor
+	sel, isSel := val.(values.Selection)
+	switch {
+	case val.IsDatum() && val.(values.Datum).IsNull():
+		return nil, nil, nil
+	case isSel && sel.IsSelection():
+		rows, desc = []values.Datum{sel}, sel
+	case val.IsSequence() && val.(values.Sequence).AsStream().IsSelectionStream():
+		stream := val.(values.Sequence).AsStream().AsSelectionStream()
+		desc = stream
+		for {
+			row, err := stream.NextItem()
+			if err != nil {
+				return nil, nil, err
+			}
+			if row == nil {
+				break
+			}
+			rows = append(rows, row)
+		}
+	default:
+		return nil, nil, typeError(types.Selection, val)
+	}
+
+	catalog, err := ctx.getCatalog()
+	if err != nil {
+		return nil, nil, err
+	}
+	table, err := catalog.Table(desc.DB(), desc.Table())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ctx.authorize(users.Write, tableScope(table)); err != nil {
+		return nil, nil, err
+	}
+	keys := make([]values.Datum, len(rows))
+	for i, row := range rows {
+		keys[i] = row.AsObject().Items()[table.PrimaryKey()]
+	}
+	return table, keys, nil
+}
+
+// evalDelete deletes the rows of a selection.
+func evalDelete(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	durability, returnChanges, err := evalWriteOptions(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	table, keys, err := evalSelectionKeys(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	if table == nil {
+		return skippedResult(), nil
+	}
+	return table.Delete(keys, durability, returnChanges), nil
+}
+
+// evalInsert inserts an object or a sequence of objects into a table. The
+// `conflict` option says whether a row with the primary key of an existing
+// row is an `error`, `replace`s the row or `update`s it.
+func evalInsert(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	table, err := evalTableFor(ctx, t.Args[0], users.Write)
+	if err != nil {
+		return nil, err
+	}
+	durability, returnChanges, err := evalWriteOptions(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	conflict := "error"
+	if val, err := evalOptArg(ctx, t, "conflict"); err != nil {
+		return nil, err
+	} else if val != nil {
+		if !val.IsString() {
+			return nil, typeError(types.String, val)
+		}
+		conflict = val.AsString().Value()
+		if conflict != "error" && conflict != "replace" && conflict != "update" {
+			return nil, queryLogicError("Conflict option `%s` unrecognized (options are \"error\", \"replace\" and \"update\").", conflict)
+		}
+	}
+
+	val, err := t.Args[1].Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case val.IsSequence():
+		return table.InsertSequence(val.(values.Sequence), conflict, durability, returnChanges), nil
+	case val.IsDatum() && val.(values.Datum).IsObject():
+		return table.InsertObject(val.(values.Datum).AsObject(), conflict, durability, returnChanges), nil
+	}
+	return nil, typeError(types.Object, val)
+}
+
+// evalUpdate merges an object, or the object returned by a function of each
+// row, into the rows of a selection. Rows which do not exist are skipped.
+func evalUpdate(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	durability, returnChanges, err := evalWriteOptions(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	table, keys, err := evalSelectionKeys(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	if table == nil {
+		return skippedResult(), nil
+	}
+	nonAtomic, err := evalNonAtomic(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	updater, err := evalRowFunction(ctx.withLiterals(true), t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	return table.Replace(keys, func(oldVal values.Datum) (values.Datum, *values.Error) {
+		if oldVal.IsNull() {
+			return oldVal, nil
+		}
+		changes, err := updater(oldVal)
+		if err != nil {
+			return nil, err
+		}
+		if changes.IsNull() {
+			return oldVal, nil
+		}
+		if !changes.IsObject() {
+			return nil, typeError(types.Object, changes)
+		}
+		return mergeDatums(oldVal, changes), nil
+	}, nonAtomic, durability, returnChanges), nil
+}
+
+// evalReplace replaces the rows of a selection with an object, or with the
+// value returned by a function of each row, which deletes the row if it is
+// null. A row which does not exist is inserted if it is replaced with one.
+func evalReplace(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	durability, returnChanges, err := evalWriteOptions(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	table, keys, err := evalSelectionKeys(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	if table == nil {
+		return skippedResult(), nil
+	}
+	nonAtomic, err := evalNonAtomic(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	replacer, err := evalRowFunction(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	return table.Replace(keys, replacer, nonAtomic, durability, returnChanges), nil
+}
+
+// evalNonAtomic evaluates the `non_atomic` option of UPDATE or REPLACE. A
+// row is read and written in one transaction, which its new value must be
+// computed in, unless the option is set, so the new value must be
+// deterministic unless it is.
+func evalNonAtomic(ctx *Context, t *Term) (bool, *values.Error) {
+	nonAtomic := false
+	if val, err := evalOptArg(ctx, t, "non_atomic"); err != nil {
+		return false, err
+	} else if val != nil {
+		if !val.IsBool() {
+			return false, typeError(types.Bool, val)
+		}
+		nonAtomic = val.AsBool().Value()
+	}
+	if !nonAtomic && !isDeterministic(t.Args[1]) {
+		return false, queryLogicError("Could not prove argument deterministic.  Maybe you want to use the non_atomic flag?")
+	}
+	return nonAtomic, nil
+}
+
+// evalRowFunction evaluates the argument of a write which is a datum or a
+// function of the row being written.
+func evalRowFunction(ctx *Context, t *Term) (func(row values.Datum) (values.Datum, *values.Error), *values.Error) {
+	val, err := t.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if val.IsFunction() {
+		fn := val.(values.Function)
+		return func(row values.Datum) (values.Datum, *values.Error) {
+			return callDatum(fn, row)
+		}, nil
+	}
+	if !val.IsDatum() {
+		return nil, typeError(types.Datum, val)
+	}
+	return func(values.Datum) (values.Datum, *values.Error) {
+		return val.(values.Datum), nil
+	}, nil
+}
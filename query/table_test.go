@@ -0,0 +1,234 @@
+package query
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/catalog"
+	"github.com/jlhawn/reboltdb/jobs"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/stats"
+	"github.com/jlhawn/reboltdb/storage"
+	"github.com/jlhawn/reboltdb/system"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+func TestDeleteJob(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	c, err := catalog.Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := users.Open(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := jobs.NewRegistry()
+	data, err := storage.Open(db, LoadFunction, RunWriteHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sys := system.New(c, data, store, registry, stats.New(db), system.Server{ID: c.ServerID(), Name: "test_server", Started: time.Now()})
+	ctx := NewContext().WithUser(store, users.Admin).WithCatalog(sys)
+
+	job := registry.Start(&jobs.Job{Token: 1, Query: "r.range()", User: users.Admin})
+	running := NewContext().WithJob(job)
+	if _, err := makeTerm(t, `[24, [1, 2]]`).Eval(running); err != nil {
+		t.Fatalf("expected the running query to be evaluated: %s", err.Message)
+	}
+
+	// r.db("rethinkdb").table("jobs").get(["query", id]).delete()
+	query := `[54, [[16, [[15, [[14, ["rethinkdb"]], "jobs"]], [2, ["query", "` + job.ID + `"]]]]]]`
+	result, verr := makeTerm(t, query).Eval(ctx)
+	if verr != nil {
+		t.Fatalf("unable to delete the job: %s", verr.Message)
+	}
+	if deleted := native(t, result).(map[string]interface{})["deleted"]; deleted != 1.0 {
+		t.Errorf("expected the job to be deleted but got %v", native(t, result))
+	}
+
+	if _, err := makeTerm(t, `[24, [1, 2]]`).Eval(running); err == nil || err.Type != ql2.Response_OP_INDETERMINATE {
+		t.Errorf("expected the interrupted query to fail but got %v", err)
+	}
+	result, verr = makeTerm(t, query).Eval(ctx)
+	if verr != nil {
+		t.Fatal(verr.Message)
+	}
+	if skipped := native(t, result).(map[string]interface{})["skipped"]; skipped != 1.0 {
+		t.Errorf("expected deleting a finished job to skip it but got %v", native(t, result))
+	}
+}
+
+func TestWriteTerms(t *testing.T) {
+	_, c, ctx := newTestSystem(t)
+	if _, err := c.CreateTable(catalog.DefaultDB, "events", "id", "hard"); err != nil {
+		t.Fatal(err.Message)
+	}
+
+	counts := func(query string) map[string]interface{} {
+		t.Helper()
+		return native(t, mustEval(t, ctx, query)).(map[string]interface{})
+	}
+	expectCount := func(query, field string, expected float64) {
+		t.Helper()
+		if result := counts(query); result[field] != expected {
+			t.Errorf("expected %s to be %v for %s but got %v", field, expected, query, result)
+		}
+	}
+	expectRow := func(query string, expected interface{}) {
+		t.Helper()
+		if actual := native(t, mustEval(t, ctx, query)); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expected %s to be %#v but got %#v", query, expected, actual)
+		}
+	}
+
+	// r.table("events").insert([{"id": 1, "n": 1}, {"n": 2}])
+	result := counts(`[56, [[15, ["events"]], [2, [{"id": 1, "n": 1}, {"n": 2}]]]]`)
+	if result["inserted"] != 2.0 || len(result["generated_keys"].([]interface{})) != 1 {
+		t.Errorf("expected 2 rows to be inserted and a key to be generated but got %v", result)
+	}
+	expectCount(`[56, [[15, ["events"]], {"id": 1}]]`, "errors", 1)
+	expectCount(`[56, [[15, ["events"]], {"id": 1, "n": 3}], {"conflict": "update"}]`, "replaced", 1)
+
+	// r.table("events").get(1).update({"tags": ["a"]})
+	expectCount(`[53, [[16, [[15, ["events"]], 1]], {"tags": [2, ["a"]]}]]`, "replaced", 1)
+	expectRow(`[16, [[15, ["events"]], 1]]`, map[string]interface{}{"id": 1.0, "n": 3.0, "tags": []interface{}{"a"}})
+	expectCount(`[53, [[16, [[15, ["events"]], 1]], {"n": 3}]]`, "unchanged", 1)
+	expectCount(`[53, [[16, [[15, ["events"]], 99]], {"n": 3}]]`, "skipped", 1)
+	// r.table("events").update({"seen": true})
+	expectCount(`[53, [[15, ["events"]], {"seen": true}]]`, "replaced", 2)
+
+	// r.table("events").get(7).replace({"id": 7})
+	expectCount(`[55, [[16, [[15, ["events"]], 7]], {"id": 7}]]`, "inserted", 1)
+	expectCount(`[55, [[16, [[15, ["events"]], 7]], {"id": 8}]]`, "errors", 1)
+	expectCount(`[55, [[16, [[15, ["events"]], 1]], {"id": 1}]]`, "replaced", 1)
+	expectRow(`[16, [[15, ["events"]], 1]]`, map[string]interface{}{"id": 1.0})
+	expectCount(`[55, [[16, [[15, ["events"]], 7]], null]]`, "deleted", 1)
+	expectRow(`[16, [[15, ["events"]], 7]]`, nil)
+
+	// Users are created and changed through the rethinkdb.users table.
+	users := `[15, [[14, ["rethinkdb"]], "users"]]`
+	expectCount(`[56, [`+users+`, {"id": "bob", "password": "secret"}]]`, "inserted", 1)
+	expectRow(`[16, [`+users+`, "bob"]]`, map[string]interface{}{"id": "bob", "password": true})
+	expectCount(`[53, [[16, [`+users+`, "bob"]], {"password": false}]]`, "replaced", 1)
+	expectRow(`[16, [`+users+`, "bob"]]`, map[string]interface{}{"id": "bob", "password": false})
+	expectCount(`[56, [[15, [[14, ["rethinkdb"]], "jobs"]], {"id": 1}]]`, "errors", 1)
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	_, c, ctx := newTestSystem(t)
+	if _, err := c.CreateTable(catalog.DefaultDB, "counters", "id", "hard"); err != nil {
+		t.Fatal(err.Message)
+	}
+	mustEval(t, ctx, `[56, [[15, ["counters"]], {"id": 1, "n": 0}]]`)
+
+	// r.table("counters").get(1).update({"n": r.row("n").add(1)})
+	update := makeTerm(t, `[53, [[16, [[15, ["counters"]], 1]], [69, [[2, [1]], {"n": [24, [[170, [[10, [1]], "n"]], 1]]}]]]]`)
+	// r.table("counters").insert({"id": 2})
+	insert := makeTerm(t, `[56, [[15, ["counters"]], {"id": 2}]]`)
+	const writers, updates = 8, 50
+	var wg sync.WaitGroup
+	var inserted int64
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < updates; j++ {
+				if _, err := update.Eval(ctx); err != nil {
+					t.Errorf("unable to update the counter: %s", err.Message)
+					return
+				}
+			}
+			result, err := insert.Eval(ctx)
+			if err != nil {
+				t.Errorf("unable to insert a row: %s", err.Message)
+				return
+			}
+			if n := result.(values.Object).Items()["inserted"].AsNumber().Float64(); n == 1 {
+				atomic.AddInt64(&inserted, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	expected := map[string]interface{}{"id": 1.0, "n": float64(writers * updates)}
+	if actual := native(t, mustEval(t, ctx, `[16, [[15, ["counters"]], 1]]`)); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected every update to be applied but got %v", actual)
+	}
+	if inserted != 1 {
+		t.Errorf("expected one insert of the same key to succeed but %d did", inserted)
+	}
+}
+
+func TestNonAtomicWrites(t *testing.T) {
+	_, c, ctx := newTestSystem(t)
+	if _, err := c.CreateTable(catalog.DefaultDB, "counters", "id", "hard"); err != nil {
+		t.Fatal(err.Message)
+	}
+	mustEval(t, ctx, `[56, [[15, ["counters"]], [2, [{"id": 1, "n": 0}, {"id": 2, "n": 5}]]]]`)
+
+	// r.table("counters").get(1).update({"n": r.table("counters").get(2)("n")})
+	query := `[53, [[16, [[15, ["counters"]], 1]], {"n": [170, [[16, [[15, ["counters"]], 2]], "n"]]}]`
+	if _, err := makeTerm(t, query+`]`).Eval(ctx); err == nil || err.Message != "Could not prove argument deterministic.  Maybe you want to use the non_atomic flag?" {
+		t.Errorf("expected a non-deterministic update to fail but got %v", err)
+	}
+	result := native(t, mustEval(t, ctx, query+`, {"non_atomic": true}]`))
+	if result.(map[string]interface{})["replaced"] != 1.0 {
+		t.Errorf("expected a non-atomic update to replace the row but got %v", result)
+	}
+	expected := map[string]interface{}{"id": 1.0, "n": 5.0}
+	if actual := native(t, mustEval(t, ctx, `[16, [[15, ["counters"]], 1]]`)); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestInterruptWithinTerms(t *testing.T) {
+	_, c, ctx := newTestSystem(t)
+	if _, err := c.CreateTable(catalog.DefaultDB, "events", "id", "hard"); err != nil {
+		t.Fatal(err.Message)
+	}
+	mustEval(t, ctx, `[56, [[15, ["events"]], [2, [{"id": 1}, {"id": 2}]]]]`)
+
+	registry := jobs.NewRegistry()
+	job := registry.Start(&jobs.Job{Token: 1, Query: "r.range(1e9).count()", User: users.Admin})
+	running := ctx.WithJob(job)
+	done := make(chan *values.Error)
+	go func() {
+		// r.range(1e9).count()
+		_, err := makeTerm(t, `[43, [[173, [1e9]]]]`).Eval(running)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	registry.Interrupt(job.ID, errors.New("the job was deleted"))
+	select {
+	case err := <-done:
+		if err == nil || err.Type != ql2.Response_OP_INDETERMINATE {
+			t.Errorf("expected the count to be interrupted but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the count to stop once it was interrupted")
+	}
+
+	// The rows of a table are not read once the query is interrupted.
+	job = registry.Start(&jobs.Job{Token: 2, Query: "r.table(\"events\")", User: users.Admin})
+	table, err := makeTerm(t, `[15, ["events"]]`).Eval(ctx.WithJob(job))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	registry.Interrupt(job.ID, errors.New("the job was deleted"))
+	if _, err := drainStream(table.(values.Sequence).AsStream()); err == nil || err.Type != ql2.Response_OP_INDETERMINATE {
+		t.Errorf("expected reading the table to be interrupted but got %v", err)
+	}
+}
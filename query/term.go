@@ -8,6 +8,7 @@ import (
 
 	"github.com/jlhawn/reboltdb/json"
 	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
 )
 
 type Term struct {
@@ -17,6 +18,10 @@ type Term struct {
 	OptArgs map[string]*Term
 
 	Datum json.Value // This is nil unless Type is DATUM.
+
+	// value is the evaluated datum of a DATUM term spliced into the
+	// arguments of another term by r.args(). Its Datum is nil.
+	value values.Datum
 }
 
 // TODO: This should return a compile error type with frames
@@ -44,6 +49,10 @@ func MakeTermTree(value json.Value) (*Term, error) {
 		return nil, fmt.Errorf("expected term type to be number, but got %s", termArray[0].ValueType())
 	}
 	termType := ql2.Term_TermType(termArray[0].AsInt64())
+	// A datum is sent as its value, so a DATUM term array has none.
+	if termType == ql2.Term_DATUM {
+		return nil, fmt.Errorf("expected DATUM term to be sent as its value, but got a term array")
+	}
 
 	var termArgs []*Term
 	if len(termArray) > 1 {
@@ -98,6 +107,49 @@ func makeObjectTerm(object json.Object) (*Term, error) {
 	}, nil
 }
 
+// encode returns the JSON encoding of this term as a client sends it.
+func (t *Term) encode() ([]byte, *values.Error) {
+	return values.ToJSON(t.datum())
+}
+
+// datum returns this term as the datum a client sends. A datum spliced in by
+// r.args() becomes a JSON term, since it may hold arrays and objects.
+func (t *Term) datum() values.Datum {
+	switch {
+	case t.value != nil:
+		encoded, _ := values.ToJSON(t.value)
+		return values.NewArray([]values.Datum{
+			values.NewNumber(float64(ql2.Term_JSON)),
+			values.NewArray([]values.Datum{values.NewString(string(encoded))}),
+		})
+	case t.IsDatum():
+		return values.FromJSON(t.Datum)
+	case t.Type == ql2.Term_MAKE_OBJ && len(t.Args) == 0:
+		return optArgsDatum(t.OptArgs)
+	}
+
+	args := make([]values.Datum, len(t.Args))
+	for i, arg := range t.Args {
+		args[i] = arg.datum()
+	}
+	items := []values.Datum{values.NewNumber(float64(t.Type)), values.NewArray(args)}
+	if len(t.OptArgs) > 0 {
+		items = append(items, optArgsDatum(t.OptArgs))
+	}
+	return values.NewArray(items)
+}
+
+func optArgsDatum(optArgs map[string]*Term) values.Datum {
+	items := make(map[string]values.Datum, len(optArgs))
+	for key, optArg := range optArgs {
+		items[key] = optArg.datum()
+	}
+	return values.NewObject(items)
+}
+
+// String returns a readable form of the term, as logged and listed in the
+// jobs table, in which the value of every `password` field of an object is
+// redacted.
 func (t *Term) String() string {
 	var b strings.Builder
 	t.format(&b, 0)
@@ -105,6 +157,11 @@ func (t *Term) String() string {
 }
 
 func (t *Term) format(b *strings.Builder, i int) {
+	if t.value != nil {
+		encoded, _ := values.ToJSON(t.value)
+		fmt.Fprintf(b, "%s", encoded)
+		return
+	}
 	if t.IsDatum() {
 		switch {
 		case t.Datum.IsNull():
@@ -169,6 +226,10 @@ func (t *Term) formatOptArgs(b *strings.Builder, i int) {
 			fmt.Fprintf(b, "\n%s  ", indent)
 		}
 		fmt.Fprintf(b, "%q: ", key)
+		if t.Type == ql2.Term_MAKE_OBJ && key == "password" {
+			fmt.Fprint(b, `"<redacted>"`)
+			continue
+		}
 		arg.format(b, i)
 	}
 	if multiArg {
@@ -239,153 +300,157 @@ var returnTypeMap = map[ql2.Term_TermType]types.TypeFlag{
 	ql2.Term_LIMIT:            types.Stream | types.Array,
 	ql2.Term_OFFSETS_OF:       types.Array,
 	ql2.Term_CONTAINS:         types.Bool,
-	ql2.Term_GET_FIELD:        0,
-	ql2.Term_KEYS:             0,
-	ql2.Term_VALUES:           0,
-	ql2.Term_OBJECT:           0,
-	ql2.Term_HAS_FIELDS:       0,
+	ql2.Term_GET_FIELD:        types.Datum,
+	ql2.Term_KEYS:             types.Array,
+	ql2.Term_VALUES:           types.Array,
+	ql2.Term_OBJECT:           types.Object,
+	ql2.Term_HAS_FIELDS:       types.Bool | types.Sequence,
 	ql2.Term_WITH_FIELDS:      0,
 	ql2.Term_PLUCK:            0,
 	ql2.Term_WITHOUT:          0,
-	ql2.Term_MERGE:            0,
-	ql2.Term_BETWEEN:          0,
+	ql2.Term_MERGE:            types.Object | types.Sequence,
+	ql2.Term_BETWEEN:          types.SelectionStream,
 	ql2.Term_REDUCE:           0,
-	ql2.Term_MAP:              0,
+	ql2.Term_MAP:              types.Stream | types.Array,
 	ql2.Term_FOLD:             0,
-	ql2.Term_FILTER:           0,
+	ql2.Term_FILTER:           types.Stream | types.Array | types.SelectionStream,
 	ql2.Term_CONCAT_MAP:       0,
-	ql2.Term_ORDER_BY:         0,
+	ql2.Term_ORDER_BY:         types.Array | types.SelectionStream,
 	ql2.Term_DISTINCT:         0,
-	ql2.Term_COUNT:            0,
-	ql2.Term_IS_EMPTY:         0,
-	ql2.Term_UNION:            0,
-	ql2.Term_NTH:              0,
-	ql2.Term_BRACKET:          0,
-	ql2.Term_INNER_JOIN:       0,
-	ql2.Term_OUTER_JOIN:       0,
-	ql2.Term_EQ_JOIN:          0,
-	ql2.Term_ZIP:              0,
-	ql2.Term_RANGE:            0,
-	ql2.Term_INSERT_AT:        0,
-	ql2.Term_DELETE_AT:        0,
-	ql2.Term_CHANGE_AT:        0,
-	ql2.Term_SPLICE_AT:        0,
-	ql2.Term_COERCE_TO:        0,
-	ql2.Term_TYPE_OF:          0,
-	ql2.Term_UPDATE:           0,
-	ql2.Term_DELETE:           0,
-	ql2.Term_REPLACE:          0,
-	ql2.Term_INSERT:           0,
-	ql2.Term_DB_CREATE:        0,
-	ql2.Term_DB_DROP:          0,
-	ql2.Term_DB_LIST:          0,
-	ql2.Term_TABLE_CREATE:     0,
-	ql2.Term_TABLE_DROP:       0,
-	ql2.Term_TABLE_LIST:       0,
-	ql2.Term_CONFIG:           0,
-	ql2.Term_STATUS:           0,
-	ql2.Term_WAIT:             0,
-	ql2.Term_RECONFIGURE:      0,
-	ql2.Term_REBALANCE:        0,
+	ql2.Term_COUNT:            types.Number,
+	ql2.Term_IS_EMPTY:         types.Bool,
+	ql2.Term_UNION:            types.Stream | types.Array,
+	ql2.Term_NTH:              types.Datum,
+	ql2.Term_BRACKET:          types.Datum,
+	ql2.Term_INNER_JOIN:       types.Stream | types.Array,
+	ql2.Term_OUTER_JOIN:       types.Stream | types.Array,
+	ql2.Term_EQ_JOIN:          types.Stream | types.Array,
+	ql2.Term_ZIP:              types.Stream | types.Array,
+	ql2.Term_RANGE:            types.Stream,
+	ql2.Term_INSERT_AT:        types.Array,
+	ql2.Term_DELETE_AT:        types.Array,
+	ql2.Term_CHANGE_AT:        types.Array,
+	ql2.Term_SPLICE_AT:        types.Array,
+	ql2.Term_COERCE_TO:        types.Datum,
+	ql2.Term_TYPE_OF:          types.String,
+	ql2.Term_UPDATE:           types.Object,
+	ql2.Term_DELETE:           types.Object,
+	ql2.Term_REPLACE:          types.Object,
+	ql2.Term_INSERT:           types.Object,
+	ql2.Term_DB_CREATE:        types.Object,
+	ql2.Term_DB_DROP:          types.Object,
+	ql2.Term_DB_LIST:          types.Array,
+	ql2.Term_TABLE_CREATE:     types.Object,
+	ql2.Term_TABLE_DROP:       types.Object,
+	ql2.Term_TABLE_LIST:       types.Array,
+	ql2.Term_CONFIG:           types.Selection,
+	ql2.Term_STATUS:           types.Selection,
+	ql2.Term_WAIT:             types.Object,
+	ql2.Term_RECONFIGURE:      types.Object,
+	ql2.Term_REBALANCE:        types.Object,
 	ql2.Term_SYNC:             0,
-	ql2.Term_GRANT:            0,
-	ql2.Term_INDEX_CREATE:     0,
-	ql2.Term_INDEX_DROP:       0,
-	ql2.Term_INDEX_STATUS:     0,
-	ql2.Term_INDEX_WAIT:       0,
+	ql2.Term_GRANT:            types.Object,
+	ql2.Term_INDEX_CREATE:     types.Object,
+	ql2.Term_INDEX_DROP:       types.Object,
+	ql2.Term_INDEX_LIST:       types.Array,
+	ql2.Term_INDEX_STATUS:     types.Array,
+	ql2.Term_INDEX_WAIT:       types.Array,
 	ql2.Term_INDEX_RENAME:     0,
-	ql2.Term_SET_WRITE_HOOK:   0,
-	ql2.Term_GET_WRITE_HOOK:   0,
+	ql2.Term_SET_WRITE_HOOK:   types.Object,
+	ql2.Term_GET_WRITE_HOOK:   types.Datum,
 	ql2.Term_FUNCALL:          0,
 	ql2.Term_BRANCH:           0,
-	ql2.Term_OR:               0,
-	ql2.Term_AND:              0,
-	ql2.Term_FOR_EACH:         0,
-	ql2.Term_FUNC:             0,
+	ql2.Term_OR:               types.Datum,
+	ql2.Term_AND:              types.Datum,
+	ql2.Term_FOR_EACH:         types.Object,
+	ql2.Term_FUNC:             types.Function,
 	ql2.Term_ASC:              0,
 	ql2.Term_DESC:             0,
-	ql2.Term_INFO:             0,
-	ql2.Term_MATCH:            0,
-	ql2.Term_UPCASE:           0,
-	ql2.Term_DOWNCASE:         0,
-	ql2.Term_SAMPLE:           0,
-	ql2.Term_DEFAULT:          0,
-	ql2.Term_JSON:             0,
-	ql2.Term_ISO8601:          0,
-	ql2.Term_TO_ISO8601:       0,
-	ql2.Term_EPOCH_TIME:       0,
-	ql2.Term_TO_EPOCH_TIME:    0,
-	ql2.Term_NOW:              0,
-	ql2.Term_IN_TIMEZONE:      0,
-	ql2.Term_DURING:           0,
-	ql2.Term_DATE:             0,
-	ql2.Term_TIME_OF_DAY:      0,
-	ql2.Term_TIMEZONE:         0,
-	ql2.Term_YEAR:             0,
-	ql2.Term_MONTH:            0,
-	ql2.Term_DAY:              0,
-	ql2.Term_DAY_OF_WEEK:      0,
-	ql2.Term_DAY_OF_YEAR:      0,
-	ql2.Term_HOURS:            0,
-	ql2.Term_MINUTES:          0,
-	ql2.Term_SECONDS:          0,
-	ql2.Term_TIME:             0,
-	ql2.Term_MONDAY:           0,
-	ql2.Term_TUESDAY:          0,
-	ql2.Term_WEDNESDAY:        0,
-	ql2.Term_THURSDAY:         0,
-	ql2.Term_FRIDAY:           0,
-	ql2.Term_SATURDAY:         0,
-	ql2.Term_SUNDAY:           0,
-	ql2.Term_JANUARY:          0,
-	ql2.Term_FEBRUARY:         0,
-	ql2.Term_MARCH:            0,
-	ql2.Term_APRIL:            0,
-	ql2.Term_MAY:              0,
-	ql2.Term_JUNE:             0,
-	ql2.Term_JULY:             0,
-	ql2.Term_AUGUST:           0,
-	ql2.Term_SEPTEMBER:        0,
-	ql2.Term_OCTOBER:          0,
-	ql2.Term_NOVEMBER:         0,
-	ql2.Term_DECEMBER:         0,
+	ql2.Term_INFO:             types.Object,
+	ql2.Term_MATCH:            types.Object | types.Null,
+	ql2.Term_UPCASE:           types.String,
+	ql2.Term_DOWNCASE:         types.String,
+	ql2.Term_SAMPLE:           types.Array,
+	ql2.Term_DEFAULT:          types.Datum,
+	ql2.Term_JSON:             types.Datum,
+	ql2.Term_ISO8601:          types.Time,
+	ql2.Term_TO_ISO8601:       types.String,
+	ql2.Term_EPOCH_TIME:       types.Time,
+	ql2.Term_TO_EPOCH_TIME:    types.Number,
+	ql2.Term_NOW:              types.Time,
+	ql2.Term_IN_TIMEZONE:      types.Time,
+	ql2.Term_DURING:           types.Bool,
+	ql2.Term_DATE:             types.Time,
+	ql2.Term_TIME_OF_DAY:      types.Number,
+	ql2.Term_TIMEZONE:         types.String,
+	ql2.Term_YEAR:             types.Number,
+	ql2.Term_MONTH:            types.Number,
+	ql2.Term_DAY:              types.Number,
+	ql2.Term_DAY_OF_WEEK:      types.Number,
+	ql2.Term_DAY_OF_YEAR:      types.Number,
+	ql2.Term_HOURS:            types.Number,
+	ql2.Term_MINUTES:          types.Number,
+	ql2.Term_SECONDS:          types.Number,
+	ql2.Term_TIME:             types.Time,
+	ql2.Term_MONDAY:           types.Number,
+	ql2.Term_TUESDAY:          types.Number,
+	ql2.Term_WEDNESDAY:        types.Number,
+	ql2.Term_THURSDAY:         types.Number,
+	ql2.Term_FRIDAY:           types.Number,
+	ql2.Term_SATURDAY:         types.Number,
+	ql2.Term_SUNDAY:           types.Number,
+	ql2.Term_JANUARY:          types.Number,
+	ql2.Term_FEBRUARY:         types.Number,
+	ql2.Term_MARCH:            types.Number,
+	ql2.Term_APRIL:            types.Number,
+	ql2.Term_MAY:              types.Number,
+	ql2.Term_JUNE:             types.Number,
+	ql2.Term_JULY:             types.Number,
+	ql2.Term_AUGUST:           types.Number,
+	ql2.Term_SEPTEMBER:        types.Number,
+	ql2.Term_OCTOBER:          types.Number,
+	ql2.Term_NOVEMBER:         types.Number,
+	ql2.Term_DECEMBER:         types.Number,
 	ql2.Term_LITERAL:          0,
 	ql2.Term_GROUP:            0,
 	ql2.Term_SUM:              0,
 	ql2.Term_AVG:              0,
 	ql2.Term_MIN:              0,
 	ql2.Term_MAX:              0,
-	ql2.Term_SPLIT:            0,
+	ql2.Term_SPLIT:            types.Array,
 	ql2.Term_UNGROUP:          0,
-	ql2.Term_RANDOM:           0,
-	ql2.Term_CHANGES:          0,
+	ql2.Term_RANDOM:           types.Number,
+	ql2.Term_CHANGES:          types.Stream,
 	ql2.Term_ARGS:             0,
-	ql2.Term_BINARY:           0,
-	ql2.Term_GEOJSON:          0,
-	ql2.Term_TO_GEOJSON:       0,
-	ql2.Term_POINT:            0,
-	ql2.Term_LINE:             0,
-	ql2.Term_POLYGON:          0,
-	ql2.Term_DISTANCE:         0,
-	ql2.Term_INTERSECTS:       0,
-	ql2.Term_INCLUDES:         0,
-	ql2.Term_CIRCLE:           0,
-	ql2.Term_GET_INTERSECTING: 0,
-	ql2.Term_FILL:             0,
-	ql2.Term_GET_NEAREST:      0,
-	ql2.Term_POLYGON_SUB:      0,
-	ql2.Term_TO_JSON_STRING:   0,
+	ql2.Term_BINARY:           types.Binary,
+	ql2.Term_GEOJSON:          types.Geometry,
+	ql2.Term_TO_GEOJSON:       types.Object,
+	ql2.Term_POINT:            types.Geometry,
+	ql2.Term_LINE:             types.Geometry,
+	ql2.Term_POLYGON:          types.Geometry,
+	ql2.Term_DISTANCE:         types.Number,
+	ql2.Term_INTERSECTS:       types.Bool | types.Array | types.Stream,
+	ql2.Term_INCLUDES:         types.Bool | types.Array | types.Stream,
+	ql2.Term_CIRCLE:           types.Geometry,
+	ql2.Term_GET_INTERSECTING: types.SelectionStream,
+	ql2.Term_FILL:             types.Geometry,
+	ql2.Term_GET_NEAREST:      types.Array,
+	ql2.Term_POLYGON_SUB:      types.Geometry,
+	ql2.Term_TO_JSON_STRING:   types.String,
 	ql2.Term_MINVAL:           0,
 	ql2.Term_MAXVAL:           0,
-	ql2.Term_BIT_AND:          0,
-	ql2.Term_BIT_OR:           0,
-	ql2.Term_BIT_XOR:          0,
-	ql2.Term_BIT_NOT:          0,
-	ql2.Term_BIT_SAL:          0,
-	ql2.Term_BIT_SAR:          0,
+	ql2.Term_BIT_AND:          types.Number,
+	ql2.Term_BIT_OR:           types.Number,
+	ql2.Term_BIT_XOR:          types.Number,
+	ql2.Term_BIT_NOT:          types.Number,
+	ql2.Term_BIT_SAL:          types.Number,
+	ql2.Term_BIT_SAR:          types.Number,
 }
 
 func (t *Term) returnType() types.TypeFlag {
+	if t.value != nil {
+		return typeOf(t.value)
+	}
 	if t.IsDatum() {
 		return valueType(t.Datum)
 	}
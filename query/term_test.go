@@ -0,0 +1,35 @@
+package query
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jlhawn/reboltdb/json"
+)
+
+func TestMakeTermTreeErrors(t *testing.T) {
+	for _, query := range []string{
+		`[]`,
+		`["1"]`,
+		`[1]`,
+		`[1, [5]]`,
+		`[24, [1, 2], {}, 4]`,
+		`[24, [[1]]]`,
+	} {
+		val, err := json.Parse([]byte(query))
+		if err != nil {
+			t.Fatalf("unable to parse query %s: %s", query, err)
+		}
+		if term, err := MakeTermTree(val); err == nil {
+			t.Errorf("expected %s to fail to compile but got %s", query, term)
+		}
+	}
+}
+
+func TestTermStringRedactsPasswords(t *testing.T) {
+	// r.db("rethinkdb").table("users").insert({"id": "bob", "password": "secret"})
+	s := makeTerm(t, `[56, [[15, [[14, ["rethinkdb"]], "users"]], {"id": "bob", "password": "secret"}]]`).String()
+	if strings.Contains(s, "secret") || !strings.Contains(s, `"bob"`) {
+		t.Errorf("expected only the password to be redacted but got %s", s)
+	}
+}
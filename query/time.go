@@ -0,0 +1,310 @@
+package query
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_NOW] = evalNow
+	evalFuncs[ql2.Term_TIME] = evalTimeTerm
+	evalFuncs[ql2.Term_EPOCH_TIME] = evalEpochTime
+	evalFuncs[ql2.Term_TO_EPOCH_TIME] = makeTimeAccessor(func(t values.Time) values.Datum {
+		return values.NewNumber(t.EpochTime())
+	})
+	evalFuncs[ql2.Term_ISO8601] = evalISO8601
+	evalFuncs[ql2.Term_TO_ISO8601] = makeTimeAccessor(func(t values.Time) values.Datum {
+		return values.NewString(t.Go().Format(iso8601Layout))
+	})
+	evalFuncs[ql2.Term_IN_TIMEZONE] = evalInTimezone
+	evalFuncs[ql2.Term_TIMEZONE] = makeTimeAccessor(func(t values.Time) values.Datum {
+		return values.NewString(t.Timezone())
+	})
+	evalFuncs[ql2.Term_DURING] = evalDuring
+	evalFuncs[ql2.Term_DATE] = makeTimeAccessor(func(t values.Time) values.Datum {
+		return startOfDay(t)
+	})
+	evalFuncs[ql2.Term_TIME_OF_DAY] = makeTimeAccessor(func(t values.Time) values.Datum {
+		return values.NewNumber(t.EpochTime() - startOfDay(t).EpochTime())
+	})
+	evalFuncs[ql2.Term_YEAR] = makeTimeField(func(t time.Time) int { return t.Year() })
+	evalFuncs[ql2.Term_MONTH] = makeTimeField(func(t time.Time) int { return int(t.Month()) })
+	evalFuncs[ql2.Term_DAY] = makeTimeField(func(t time.Time) int { return t.Day() })
+	evalFuncs[ql2.Term_DAY_OF_WEEK] = makeTimeField(isoWeekday)
+	evalFuncs[ql2.Term_DAY_OF_YEAR] = makeTimeField(func(t time.Time) int { return t.YearDay() })
+	evalFuncs[ql2.Term_HOURS] = makeTimeField(func(t time.Time) int { return t.Hour() })
+	evalFuncs[ql2.Term_MINUTES] = makeTimeField(func(t time.Time) int { return t.Minute() })
+	evalFuncs[ql2.Term_SECONDS] = makeTimeAccessor(func(t values.Time) values.Datum {
+		g := t.Go()
+		return values.NewNumber(float64(g.Second()) + float64(g.Nanosecond())/1e9)
+	})
+
+	for i, day := range []ql2.Term_TermType{
+		ql2.Term_MONDAY, ql2.Term_TUESDAY, ql2.Term_WEDNESDAY, ql2.Term_THURSDAY,
+		ql2.Term_FRIDAY, ql2.Term_SATURDAY, ql2.Term_SUNDAY,
+	} {
+		evalFuncs[day] = makeConstant(values.NewNumber(float64(i + 1)))
+	}
+	for i, month := range []ql2.Term_TermType{
+		ql2.Term_JANUARY, ql2.Term_FEBRUARY, ql2.Term_MARCH, ql2.Term_APRIL,
+		ql2.Term_MAY, ql2.Term_JUNE, ql2.Term_JULY, ql2.Term_AUGUST,
+		ql2.Term_SEPTEMBER, ql2.Term_OCTOBER, ql2.Term_NOVEMBER, ql2.Term_DECEMBER,
+	} {
+		evalFuncs[month] = makeConstant(values.NewNumber(float64(i + 1)))
+	}
+}
+
+// iso8601Layout is the layout used to format times as ISO 8601 strings, which
+// always include milliseconds and the timezone offset.
+const iso8601Layout = "2006-01-02T15:04:05.000-07:00"
+
+// makeConstant returns an evaluator for a term which takes no arguments and
+// always evaluates to the given value.
+func makeConstant(val values.Datum) termEvaluator {
+	return func(ctx *Context, t *Term) (values.Top, *values.Error) {
+		if err := t.checkArity(0, 0); err != nil {
+			return nil, err
+		}
+		return val, nil
+	}
+}
+
+// makeTimeAccessor returns an evaluator for a term which takes a single time
+// and returns some property of it.
+func makeTimeAccessor(access func(t values.Time) values.Datum) termEvaluator {
+	return func(ctx *Context, t *Term) (values.Top, *values.Error) {
+		if err := t.checkArity(1, 1); err != nil {
+			return nil, err
+		}
+		tm, err := evalTime(ctx, t.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		return access(tm), nil
+	}
+}
+
+// makeTimeField returns an evaluator for a term which returns an integer field
+// of a time as it is expressed in the timezone of that time.
+func makeTimeField(field func(t time.Time) int) termEvaluator {
+	return makeTimeAccessor(func(t values.Time) values.Datum {
+		return values.NewNumber(float64(field(t.Go())))
+	})
+}
+
+// isoWeekday returns the day of the week of the given time from 1 for Monday
+// to 7 for Sunday.
+func isoWeekday(t time.Time) int {
+	return (int(t.Weekday())+6)%7 + 1
+}
+
+// startOfDay returns midnight at the start of the day of the given time in
+// its timezone.
+func startOfDay(t values.Time) values.Time {
+	g := t.Go()
+	return values.TimeFromGo(time.Date(g.Year(), g.Month(), g.Day(), 0, 0, 0, 0, g.Location()))
+}
+
+// evalNow returns the time at which the query started so that every NOW term
+// in a query returns the same time.
+func evalNow(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(0, 0); err != nil {
+		return nil, err
+	}
+	return values.TimeFromGo(ctx.now.UTC()), nil
+}
+
+func evalTimezone(ctx *Context, t *Term) (int, *values.Error) {
+	tz, err := evalString(ctx, t)
+	if err != nil {
+		return 0, err
+	}
+	offset, ok := values.ParseTimezone(tz)
+	if !ok {
+		return 0, queryLogicError("Timezone `%s` does not match the pattern `[+-]HH:MM`.", tz)
+	}
+	return offset, nil
+}
+
+// makeTime returns the time with the given date and time of day in the
+// timezone with the given offset, ensuring that each component is in range.
+func makeTime(year, month, day, hour, minute int, seconds float64, offset int) (values.Time, *values.Error) {
+	if seconds < 0 || seconds >= 60 {
+		return values.Time{}, queryLogicError("Seconds out of range: %v", seconds)
+	}
+	whole, frac := math.Modf(seconds)
+	zone := time.FixedZone(values.FormatTimezone(offset), offset)
+	g := time.Date(year, time.Month(month), day, hour, minute, int(whole), 0, zone)
+	// Go normalizes out of range components, e.g. February 30th becomes
+	// March 2nd, so a valid time is one which is unchanged.
+	if g.Year() != year || int(g.Month()) != month || g.Day() != day || g.Hour() != hour || g.Minute() != minute {
+		// The fraction of a second, if any, follows the whole seconds.
+		fraction := strings.TrimPrefix(strconv.FormatFloat(frac, 'f', -1, 64), "0")
+		return values.Time{}, queryLogicError("Invalid date or time: %04d-%02d-%02dT%02d:%02d:%02d%s", year, month, day, hour, minute, int(whole), fraction)
+	}
+	if err := values.CheckEpochTime(float64(g.Unix()) + frac); err != nil {
+		return values.Time{}, err
+	}
+	return values.NewTime(float64(g.Unix())+frac, offset), nil
+}
+
+// evalTimeTerm evaluates r.time(year, month, day, [hour, minute, second,]
+// timezone).
+func evalTimeTerm(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if n := len(t.Args); n != 4 && n != 7 {
+		return nil, queryLogicError("Expected 4 or 7 argument(s) but found %d.", n)
+	}
+
+	// The year, month, and day, followed by the hour and minute if given,
+	// are integers.
+	numFields := 3
+	if len(t.Args) == 7 {
+		numFields = 5
+	}
+	var fields [5]int
+	for i := 0; i < numFields; i++ {
+		val, err := evalInteger(ctx, t.Args[i])
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = int(val)
+	}
+	var seconds float64
+	if len(t.Args) == 7 {
+		num, err := evalNumber(ctx, t.Args[5])
+		if err != nil {
+			return nil, err
+		}
+		seconds = num.Float64()
+	}
+	offset, err := evalTimezone(ctx, t.Args[len(t.Args)-1])
+	if err != nil {
+		return nil, err
+	}
+	return makeTime(fields[0], fields[1], fields[2], fields[3], fields[4], seconds, offset)
+}
+
+func evalEpochTime(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	epoch, err := evalNumber(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := values.CheckEpochTime(epoch.Float64()); err != nil {
+		return nil, err
+	}
+	return values.NewTime(epoch.Float64(), 0), nil
+}
+
+// iso8601Pattern matches the date, optional time, and optional timezone of an
+// ISO 8601 string in either the basic or extended format.
+var iso8601Pattern = regexp.MustCompile(`^(\d{4})-?(\d{2})-?(\d{2})` +
+	`(?:T(\d{2})(?::?(\d{2})(?::?(\d{2}(?:\.\d+)?))?)?)?` +
+	`(Z|[+-]\d{2}(?::?\d{2})?)?$`)
+
+// parseISO8601 parses the given ISO 8601 string. The given default offset is
+// used if the string has no timezone, unless it is nil.
+func parseISO8601(str string, defaultOffset *int) (values.Time, *values.Error) {
+	match := iso8601Pattern.FindStringSubmatch(str)
+	if match == nil {
+		return values.Time{}, queryLogicError("Invalid ISO 8601 date `%s`.", str)
+	}
+
+	var fields [5]int
+	for i := range fields {
+		if match[i+1] != "" {
+			fields[i], _ = strconv.Atoi(match[i+1])
+		}
+	}
+	var seconds float64
+	if match[6] != "" {
+		seconds, _ = strconv.ParseFloat(match[6], 64)
+	}
+
+	var offset int
+	switch {
+	case match[7] != "":
+		var ok bool
+		if offset, ok = values.ParseTimezone(match[7]); !ok {
+			return values.Time{}, queryLogicError("Invalid ISO 8601 date `%s`.", str)
+		}
+	case defaultOffset != nil:
+		offset = *defaultOffset
+	default:
+		return values.Time{}, queryLogicError("ISO 8601 string has no time zone, and no default time zone was provided.")
+	}
+	return makeTime(fields[0], fields[1], fields[2], fields[3], fields[4], seconds, offset)
+}
+
+func evalISO8601(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, 1); err != nil {
+		return nil, err
+	}
+	str, err := evalString(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var defaultOffset *int
+	if optArg, ok := t.OptArgs["default_timezone"]; ok {
+		offset, err := evalTimezone(ctx, optArg)
+		if err != nil {
+			return nil, err
+		}
+		defaultOffset = &offset
+	}
+	return parseISO8601(str, defaultOffset)
+}
+
+func evalInTimezone(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	tm, err := evalTime(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	offset, err := evalTimezone(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	return tm.InTimezone(offset), nil
+}
+
+// evalDuring reports whether a time is within the range given by a start and
+// end time. The `left_bound` and `right_bound` options choose whether each
+// end of the range is "closed" or "open" and default to a half-open range.
+func evalDuring(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(3, 3); err != nil {
+		return nil, err
+	}
+	var times [3]values.Time
+	for i := range times {
+		var err *values.Error
+		if times[i], err = evalTime(ctx, t.Args[i]); err != nil {
+			return nil, err
+		}
+	}
+	leftClosed, err := evalBoundOption(ctx, t, "left_bound", true)
+	if err != nil {
+		return nil, err
+	}
+	rightClosed, err := evalBoundOption(ctx, t, "right_bound", false)
+	if err != nil {
+		return nil, err
+	}
+
+	tm, start, end := times[0].EpochTime(), times[1].EpochTime(), times[2].EpochTime()
+	afterStart := tm > start || (leftClosed && tm == start)
+	beforeEnd := tm < end || (rightClosed && tm == end)
+	return values.NewBool(afterStart && beforeEnd), nil
+}
@@ -0,0 +1,91 @@
+package query
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+)
+
+func TestTimeTerms(t *testing.T) {
+	// 2015-03-15T10:20:30.250-07:00, a Sunday.
+	const tm = `[99, ["2015-03-15T10:20:30.25-07:00"]]`
+
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		{tm, map[string]interface{}{
+			"$reql_type$": "TIME", "epoch_time": 1426440030.25, "timezone": "-07:00",
+		}},
+		{`[136, [2015, 3, 15, 10, 20, 30.25, "-07:00"]]`, map[string]interface{}{
+			"$reql_type$": "TIME", "epoch_time": 1426440030.25, "timezone": "-07:00",
+		}},
+		{`[17, [` + tm + `, [101, [1426440030.25]]]]`, true},
+		{`[17, [` + tm + `, {"$reql_type$": "TIME", "epoch_time": 1426440030.25, "timezone": "Z"}]]`, true},
+		{`[102, [[136, [2015, 3, 15, "-07:00"]]]]`, 1426402800.0},
+		{`[100, [` + tm + `]]`, "2015-03-15T10:20:30.250-07:00"},
+		{`[100, [[104, [` + tm + `, "+01:00"]]]]`, "2015-03-15T18:20:30.250+01:00"},
+		{`[100, [[99, ["20150315T1020"], {"default_timezone": "Z"}]]]`, "2015-03-15T10:20:00.000+00:00"},
+		{`[127, [` + tm + `]]`, "-07:00"},
+		{`[102, [[106, [` + tm + `]]]]`, 1426402800.0},
+		{`[126, [` + tm + `]]`, 37230.25},
+		{`[2, [[128, [` + tm + `]], [129, [` + tm + `]], [130, [` + tm + `]], [131, [` + tm + `]], [132, [` + tm + `]]]]`,
+			[]interface{}{2015.0, 3.0, 15.0, 7.0, 74.0}},
+		{`[2, [[133, [` + tm + `]], [134, [` + tm + `]], [135, [` + tm + `]]]]`, []interface{}{10.0, 20.0, 30.25}},
+		{`[17, [[131, [` + tm + `]], [113, []]]]`, true},
+		{`[2, [[107, []], [114, []], [125, []]]]`, []interface{}{1.0, 1.0, 12.0}},
+		{`[105, [` + tm + `, [101, [1426440030.25]], [101, [1426440031]]]]`, true},
+		{`[105, [` + tm + `, [101, [1426440030.25]], [101, [1426440031]]], {"left_bound": "open"}]`, false},
+		{`[105, [` + tm + `, [101, [0]], [101, [1426440030.25]]]]`, false},
+		{`[102, [[24, [` + tm + `, 60]]]]`, 1426440090.25},
+		{`[102, [[25, [` + tm + `, 0.25]]]]`, 1426440030.0},
+		{`[25, [` + tm + `, [101, [1426440000]]]]`, 30.25},
+		{`[17, [[103, []], [103, []]]]`, true},
+	}
+
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+
+	for _, query := range []string{
+		`[99, ["2015-03-15T10:20:30"]]`,
+		`[99, ["2015-02-30T00:00:00Z"]]`,
+		`[136, [2015, 13, 1, "Z"]]`,
+		`[136, [2015, 1, 1, "PST"]]`,
+		`[136, [2015, 1, 1, 0, 0, "Z"]]`,
+		`[24, [[103, []], [103, []]]]`,
+		`[25, [1, [103, []]]]`,
+	} {
+		if _, err := evalQuery(t, query, nil); err == nil {
+			t.Errorf("expected an error evaluating %s", query)
+		}
+	}
+	for _, query := range []string{
+		`{"$reql_type$": "FOO"}`,
+		`[51, [[2, [[2, ["$reql_type$", "FOO"]]]], "object"]]`,
+	} {
+		if _, err := evalQuery(t, query, nil); err == nil || err.Type != ql2.Response_QUERY_LOGIC || err.Message != "Unknown $reql_type$ `FOO`." {
+			t.Errorf("expected %s to fail with an unknown pseudo type error but got %v", query, err)
+		}
+	}
+	for query, message := range map[string]string{
+		`[136, [2021, 2, 29, "Z"]]`:            "Invalid date or time: 2021-02-29T00:00:00",
+		`[136, [2021, 2, 29, 1, 2, 3.5, "Z"]]`: "Invalid date or time: 2021-02-29T01:02:03.5",
+	} {
+		if _, err := evalQuery(t, query, nil); err == nil || err.Message != message {
+			t.Errorf("expected %s to fail with %q but got %v", query, message, err)
+		}
+	}
+	for _, query := range []string{
+		`[101, [1e300]]`,
+		`[101, [-1e300]]`,
+		`{"$reql_type$": "TIME", "epoch_time": 1e300, "timezone": "+00:00"}`,
+		`[136, [10001, 1, 1, "Z"]]`,
+		`[24, [[101, [0]], 1e300]]`,
+	} {
+		if _, err := evalQuery(t, query, nil); err == nil || err.Type != ql2.Response_QUERY_LOGIC || !strings.Contains(err.Message, "Year is out of valid range") {
+			t.Errorf("expected %s to fail with an out of range time error but got %v", query, err)
+		}
+	}
+}
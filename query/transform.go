@@ -0,0 +1,286 @@
+package query
+
+import (
+	"sort"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/types"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func init() {
+	evalFuncs[ql2.Term_FILTER] = evalFilter
+	evalFuncs[ql2.Term_MAP] = evalMap
+	evalFuncs[ql2.Term_ORDER_BY] = evalOrderBy
+}
+
+// evalFilter returns the items of a sequence which match a predicate. A
+// function matches the items for which it returns a truthy value, an object
+// matches the objects whose fields have the values it gives, and any other
+// value matches every item if it is truthy. An item for which the predicate
+// fails because a field or row does not exist matches only if the `default`
+// option is truthy. Filtering a selection returns a selection.
+func evalFilter(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, 2); err != nil {
+		return nil, err
+	}
+	seq, err := evalSequence(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	predicate, err := evalFilterPredicate(ctx, t.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	defaultTerm := t.OptArgs["default"]
+	keep := func(item values.Datum) (bool, *values.Error) {
+		ok, err := predicate(item)
+		if err == nil || err.Type != ql2.Response_NON_EXISTENCE {
+			return ok, err
+		}
+		if defaultTerm == nil {
+			return false, nil
+		}
+		val, err := evalDatum(ctx, defaultTerm)
+		if err != nil {
+			return false, err
+		}
+		return isTruthy(val), nil
+	}
+
+	stream := seq.AsStream()
+	if stream.IsSelectionStream() {
+		sel := stream.AsSelectionStream()
+		return values.NewSelectionStream(filterStream(stream, keep).NextItem, sel.DB(), sel.Table()), nil
+	}
+	return sequenceResult(seq, filterStream(stream, keep))
+}
+
+// evalFilterPredicate evaluates the predicate of a FILTER term.
+func evalFilterPredicate(ctx *Context, t *Term) (func(item values.Datum) (bool, *values.Error), *values.Error) {
+	val, err := t.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if val.IsFunction() {
+		fn := val.(values.Function)
+		return func(item values.Datum) (bool, *values.Error) {
+			result, err := callDatum(fn, item)
+			if err != nil {
+				return false, err
+			}
+			return isTruthy(result), nil
+		}, nil
+	}
+	if !val.IsDatum() {
+		return nil, typeError(types.Datum, val)
+	}
+	d := val.(values.Datum)
+	if d.IsObject() && !d.IsTime() && !d.IsBinary() && !d.IsGeometry() {
+		return func(item values.Datum) (bool, *values.Error) {
+			return matchesObject(item, d.AsObject())
+		}, nil
+	}
+	return func(values.Datum) (bool, *values.Error) {
+		return isTruthy(d), nil
+	}, nil
+}
+
+// matchesObject reports whether the given item has every field of the given
+// object with an equal value, matching nested objects in the same way.
+func matchesObject(item values.Datum, pattern values.Object) (bool, *values.Error) {
+	for field, want := range pattern.Items() {
+		got, err := getField(item, field)
+		if err != nil {
+			return false, err
+		}
+		if want.IsObject() && got.IsObject() && !want.IsTime() && !want.IsBinary() && !want.IsGeometry() {
+			if ok, err := matchesObject(got, want.AsObject()); err != nil || !ok {
+				return false, err
+			}
+			continue
+		}
+		if !values.Equal(got, want) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// evalMap calls a function with the items of one or more sequences, in turn,
+// and returns the sequence of its results, which is as long as the shortest
+// of them. The result is an array if every sequence is.
+func evalMap(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(2, -1); err != nil {
+		return nil, err
+	}
+	seqs := make([]values.Sequence, len(t.Args)-1)
+	streams := make([]values.Stream, len(seqs))
+	allArrays := true
+	for i, arg := range t.Args[:len(seqs)] {
+		var err *values.Error
+		if seqs[i], err = evalSequence(ctx, arg); err != nil {
+			return nil, err
+		}
+		streams[i] = seqs[i].AsStream()
+		allArrays = allArrays && seqs[i].IsArray()
+	}
+	fn, err := evalFunction(ctx, t.Args[len(t.Args)-1])
+	if err != nil {
+		return nil, err
+	}
+	if arity := fn.Arity(); arity >= 0 && arity != len(seqs) {
+		return nil, queryLogicError("Expected function with %d argument(s) but found function with %d argument(s).", len(seqs), arity)
+	}
+
+	result := values.NewStream(func() (values.Datum, *values.Error) {
+		args := make([]values.Datum, len(streams))
+		for i, stream := range streams {
+			item, err := stream.NextItem()
+			if err != nil || item == nil {
+				return nil, err
+			}
+			args[i] = item
+		}
+		return callDatum(fn, args...)
+	})
+	if allArrays {
+		return drainStream(result)
+	}
+	return result, nil
+}
+
+// orderKey is a key by which ORDER_BY orders a sequence.
+type orderKey struct {
+	fn         values.Function
+	descending bool
+}
+
+// evalOrderBy orders a sequence by one or more keys, each a field name or a
+// function of an item which is wrapped by ASC or DESC to order it in that
+// direction, and returns the ordered items as an array. A table may instead
+// be ordered by the primary key or a secondary index given as the `index`
+// option, which returns a lazy selection.
+func evalOrderBy(ctx *Context, t *Term) (values.Top, *values.Error) {
+	if err := t.checkArity(1, -1); err != nil {
+		return nil, err
+	}
+	if indexTerm, ok := t.OptArgs["index"]; ok {
+		if len(t.Args) > 1 {
+			return nil, queryLogicError("ORDER_BY with both an index and other keys is not yet implemented.")
+		}
+		table, err := evalTable(ctx, t.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		descending := false
+		if indexTerm.Type == ql2.Term_ASC || indexTerm.Type == ql2.Term_DESC {
+			if err := indexTerm.checkArity(1, 1); err != nil {
+				return nil, err
+			}
+			descending = indexTerm.Type == ql2.Term_DESC
+			indexTerm = indexTerm.Args[0]
+		}
+		index, err := evalString(ctx, indexTerm)
+		if err != nil {
+			return nil, err
+		}
+		return table.OrderBy(index, descending, nil)
+	}
+	if len(t.Args) == 1 {
+		return nil, queryLogicError("Must specify something to order by.")
+	}
+
+	seq, err := evalSequence(ctx, t.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]orderKey, len(t.Args)-1)
+	for i, arg := range t.Args[1:] {
+		if arg.Type == ql2.Term_ASC || arg.Type == ql2.Term_DESC {
+			if err := arg.checkArity(1, 1); err != nil {
+				return nil, err
+			}
+			keys[i].descending = arg.Type == ql2.Term_DESC
+			arg = arg.Args[0]
+		}
+		if keys[i].fn, err = evalOrderKey(ctx, arg); err != nil {
+			return nil, err
+		}
+	}
+
+	// The keys of each item are found before sorting, so that sorting
+	// cannot fail. A key which does not exist sorts before any other.
+	type keyed struct {
+		item values.Datum
+		keys []values.Datum
+	}
+	var items []keyed
+	stream := seq.AsStream()
+	for {
+		item, err := stream.NextItem()
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			break
+		}
+		if len(items) == arraySizeLimit {
+			return nil, values.NewError(ql2.Response_RESOURCE_LIMIT, "Array over size limit `%d`.", arraySizeLimit)
+		}
+		k := keyed{item: item, keys: make([]values.Datum, len(keys))}
+		for i, key := range keys {
+			val, err := callDatum(key.fn, item)
+			if err != nil && err.Type != ql2.Response_NON_EXISTENCE {
+				return nil, err
+			}
+			k.keys[i] = val
+		}
+		items = append(items, k)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		for n, key := range keys {
+			l, r := items[i].keys[n], items[j].keys[n]
+			var c int
+			switch {
+			case l == nil && r == nil:
+				continue
+			case l == nil:
+				c = -1
+			case r == nil:
+				c = 1
+			default:
+				c = values.Compare(l, r)
+			}
+			if c != 0 {
+				return (c < 0) != key.descending
+			}
+		}
+		return false
+	})
+	sorted := make([]values.Datum, len(items))
+	for i, item := range items {
+		sorted[i] = item.item
+	}
+	return values.NewArray(sorted), nil
+}
+
+// evalOrderKey evaluates a key of ORDER_BY, which is a function or the name
+// of a field, as a function of an item.
+func evalOrderKey(ctx *Context, t *Term) (values.Function, *values.Error) {
+	val, err := t.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if val.IsFunction() {
+		return val.(values.Function), nil
+	}
+	if !val.IsDatum() || !val.(values.Datum).IsString() {
+		return nil, queryLogicError("Expected type STRING or FUNCTION but found %s.", typeOf(val))
+	}
+	field := val.(values.Datum).AsString().Value()
+	return values.NewFunction(1, func(args ...values.Datum) (values.Top, *values.Error) {
+		return getField(args[0], field)
+	}), nil
+}
@@ -0,0 +1,70 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jlhawn/reboltdb/catalog"
+)
+
+func TestTransformationTerms(t *testing.T) {
+	rows := `[2, [{"id": 1, "n": 3, "p": {"x": 1, "y": 2}}, {"id": 2, "n": 1}, {"id": 3, "n": 2, "p": {"x": 2}}]]`
+	testCases := []struct {
+		query    string
+		expected interface{}
+	}{
+		// r.expr(rows).filter(r.row("n").gt(1))("id")
+		{`[170, [[39, [` + rows + `, [69, [[2, [1]], [21, [[170, [[10, [1]], "n"]], 1]]]]]], "id"]]`, []interface{}{1.0, 3.0}},
+		{`[170, [[39, [` + rows + `, {"p": {"x": 1}}]], "id"]]`, []interface{}{1.0}},
+		{`[170, [[39, [` + rows + `, [69, [[2, [1]], [21, [[170, [[170, [[10, [1]], "p"]], "x"]], 1]]]]], {"default": true}], "id"]]`, []interface{}{2.0, 3.0}},
+		{`[39, [[2, [1, 2]], false]]`, []interface{}{}},
+		// r.map([1, 2, 3], [10, 20], (a, b) => a.add(b))
+		{`[38, [[2, [1, 2, 3]], [2, [10, 20]], [69, [[2, [1, 2]], [24, [[10, [1]], [10, [2]]]]]]]]`, []interface{}{11.0, 22.0}},
+		// r.expr(rows).orderBy(r.desc("n"))("id")
+		{`[170, [[41, [` + rows + `, [74, ["n"]]]], "id"]]`, []interface{}{1.0, 3.0, 2.0}},
+		{`[170, [[41, [` + rows + `, [69, [[2, [1]], [170, [[170, [[10, [1]], "p"]], "x"]]]]]], "id"]]`, []interface{}{2.0, 1.0, 3.0}},
+		{`[170, [[41, [` + rows + `, [74, [[69, [[2, [1]], [170, [[170, [[10, [1]], "p"]], "x"]]]]]]]], "id"]]`, []interface{}{3.0, 1.0, 2.0}},
+	}
+	for _, testCase := range testCases {
+		expectResult(t, testCase.query, nil, testCase.expected)
+	}
+
+	for _, query := range []string{
+		`[41, [[2, [1, 2]]]]`,
+		`[38, [[2, [1, 2]], [69, [[2, [1, 2]], [10, [1]]]]]]`,
+		`[39, [[2, [{"a": 1}]], [69, [[2, [1]], [170, [[10, [1]], "b"]]]]], {"default": [12, ["missing"]]}]`,
+	} {
+		if _, err := drainTerm(t, NewContext(), query); err == nil {
+			t.Errorf("expected an error evaluating %s", query)
+		}
+	}
+}
+
+func TestTransformationTermsOnTables(t *testing.T) {
+	_, c, ctx := newTestSystem(t)
+	if _, err := c.CreateTable(catalog.DefaultDB, "events", "id", "hard"); err != nil {
+		t.Fatal(err.Message)
+	}
+	mustEval(t, ctx, `[56, [[15, ["events"]], [2, [{"id": 1, "n": 3}, {"id": 2, "n": 1}, {"id": 3, "n": 2}]]]]`)
+
+	expectRows := func(query string, expected interface{}) {
+		t.Helper()
+		if actual := native(t, mustEval(t, ctx, query)); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expected %s to be %#v but got %#v", query, expected, actual)
+		}
+	}
+	// r.table("events").orderBy({index: r.desc("id")}).limit(2)("id")
+	expectRows(`[170, [[71, [[41, [[15, ["events"]]], {"index": [74, ["id"]]}], 2]], "id"]]`, []interface{}{3.0, 2.0})
+	// r.table("events").orderBy("n")("id")
+	expectRows(`[170, [[41, [[15, ["events"]], "n"]], "id"]]`, []interface{}{2.0, 3.0, 1.0})
+	// r.table("events").map(r.row("n"))
+	expectRows(`[38, [[15, ["events"]], [69, [[2, [1]], [170, [[10, [1]], "n"]]]]]]`, []interface{}{3.0, 1.0, 2.0})
+
+	// A filtered table is a selection which may be updated.
+	// r.table("events").filter(r.row("n").gt(1)).update({"big": true})
+	result := native(t, mustEval(t, ctx, `[53, [[39, [[15, ["events"]], [69, [[2, [1]], [21, [[170, [[10, [1]], "n"]], 1]]]]]], {"big": true}]]`))
+	if replaced := result.(map[string]interface{})["replaced"]; replaced != 2.0 {
+		t.Errorf("expected the 2 filtered rows to be updated but got %v", result)
+	}
+	expectRows(`[170, [[39, [[15, ["events"]], {"big": true}]], "id"]]`, []interface{}{1.0, 3.0})
+}
@@ -60,3 +60,13 @@ func (t TypeFlag) String() string {
 func (t TypeFlag) IsSubTypeOf(other TypeFlag) bool {
 	return t&other == other
 }
+
+// FromName returns the type with the given name, as returned by String.
+func FromName(name string) (TypeFlag, bool) {
+	for t, tName := range allFlags {
+		if tName == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
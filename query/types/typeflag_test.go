@@ -73,3 +73,14 @@ func TestTypeFlagIsSubTypeOf(t *testing.T) {
 		}
 	}
 }
+
+func TestTypeFlagFromName(t *testing.T) {
+	for flag, name := range allFlags {
+		if parsed, ok := FromName(name); !ok || parsed != flag {
+			t.Errorf("expected FromName(%q) to return %s", name, flag)
+		}
+	}
+	if _, ok := FromName("NOT_A_TYPE"); ok {
+		t.Errorf("expected FromName to reject an unknown name")
+	}
+}
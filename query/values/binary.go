@@ -0,0 +1,48 @@
+package values
+
+import (
+	"encoding/base64"
+)
+
+// BinaryPseudoType is the PseudoTypeKey value of an object which encodes a
+// Binary.
+const BinaryPseudoType = "BINARY"
+
+// Binary is an arbitrary sequence of bytes. It is encoded as a BINARY pseudo
+// type object with the data in base64.
+type Binary struct {
+	datum
+	data []byte
+}
+
+func NewBinary(data []byte) Binary { return Binary{data: data} }
+
+func (Binary) IsBinary() bool     { return true }
+func (b Binary) AsBinary() Binary { return b }
+
+func (b Binary) Data() []byte { return b.data }
+
+// PseudoObject returns the object which encodes this binary value.
+func (b Binary) PseudoObject() Object {
+	return NewObject(map[string]Datum{
+		PseudoTypeKey: NewString(BinaryPseudoType),
+		"data":        NewString(base64.StdEncoding.EncodeToString(b.data)),
+	})
+}
+
+func binaryFromPseudoType(items map[string]Datum) (Datum, *Error) {
+	encoded, ok := items["data"]
+	if !ok || !encoded.IsString() {
+		return nil, pseudoTypeError("BINARY pseudo-type object must have a STRING field `data`.")
+	}
+	for key := range items {
+		if key != PseudoTypeKey && key != "data" {
+			return nil, pseudoTypeError("Unrecognized field `%s` in BINARY pseudo-type object.", key)
+		}
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded.AsString().Value())
+	if err != nil {
+		return nil, pseudoTypeError("Invalid base64 format for BINARY pseudo-type object: %s", err)
+	}
+	return NewBinary(data), nil
+}
@@ -0,0 +1,124 @@
+package values
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// typeRank returns the position of the type of the given datum in the total
+// ordering of datum types. Values of different types are ordered by the name
+// of their type, with MINVAL and MAXVAL at either end.
+func typeRank(d Datum) int {
+	switch {
+	case d.IsMinVal():
+		return 0
+	case d.IsArray():
+		return 1
+	case d.IsBool():
+		return 2
+	case d.IsNull():
+		return 3
+	case d.IsNumber():
+		return 4
+	case d.IsBinary():
+		return 6
+	case d.IsGeometry():
+		return 7
+	case d.IsTime():
+		return 8
+	case d.IsObject():
+		return 5
+	case d.IsString():
+		return 9
+	}
+	return 10 // MAXVAL
+}
+
+// Compare returns an integer comparing two datums using the ordering defined
+// by ReQL. The result is 0 if a == b, negative if a < b, and positive if
+// a > b.
+func Compare(a, b Datum) int {
+	if rankA, rankB := typeRank(a), typeRank(b); rankA != rankB {
+		return rankA - rankB
+	}
+
+	switch {
+	case a.IsArray():
+		return compareArrays(a.AsArray().Items(), b.AsArray().Items())
+	case a.IsBool():
+		return compareBools(a.AsBool().Value(), b.AsBool().Value())
+	case a.IsNumber():
+		return compareNumbers(a.AsNumber().Float64(), b.AsNumber().Float64())
+	case a.IsString():
+		return strings.Compare(a.AsString().Value(), b.AsString().Value())
+	case a.IsObject():
+		return compareObjects(a.AsObject().Items(), b.AsObject().Items())
+	case a.IsBinary():
+		return bytes.Compare(a.AsBinary().Data(), b.AsBinary().Data())
+	case a.IsGeometry():
+		return compareObjects(a.AsGeometry().PseudoObject().Items(), b.AsGeometry().PseudoObject().Items())
+	case a.IsTime():
+		// Times are compared by epoch time regardless of timezone.
+		return compareNumbers(a.AsTime().EpochTime(), b.AsTime().EpochTime())
+	}
+	return 0
+}
+
+// Equal reports whether two datums are equal according to ReQL.
+func Equal(a, b Datum) bool {
+	return Compare(a, b) == 0
+}
+
+func compareBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case b:
+		return -1
+	}
+	return 1
+}
+
+func compareNumbers(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareArrays(a, b []Datum) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if cmp := Compare(a[i], b[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return len(a) - len(b)
+}
+
+// compareObjects compares objects as if they were arrays of key-value pairs
+// sorted by key.
+func compareObjects(a, b map[string]Datum) int {
+	keysA, keysB := sortedKeys(a), sortedKeys(b)
+	for i := 0; i < len(keysA) && i < len(keysB); i++ {
+		if cmp := strings.Compare(keysA[i], keysB[i]); cmp != 0 {
+			return cmp
+		}
+		if cmp := Compare(a[keysA[i]], b[keysB[i]]); cmp != 0 {
+			return cmp
+		}
+	}
+	return len(keysA) - len(keysB)
+}
+
+func sortedKeys(items map[string]Datum) []string {
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,90 @@
+package values
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+)
+
+// ToJSON encodes the given datum as JSON. Pseudo types are encoded as the
+// objects which represent them and the keys of objects are sorted. MINVAL and
+// MAXVAL cannot be encoded.
+func ToJSON(d Datum) ([]byte, *Error) {
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, d); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeJSON(buf *bytes.Buffer, d Datum) *Error {
+	switch {
+	case d.IsNull():
+		buf.WriteString("null")
+	case d.IsBool():
+		if d.AsBool().Value() {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case d.IsNumber():
+		// Numbers are always finite so they can always be marshaled.
+		encoded, _ := json.Marshal(d.AsNumber().Float64())
+		buf.Write(encoded)
+	case d.IsString():
+		encodeJSONString(buf, d.AsString().Value())
+	case d.IsArray():
+		buf.WriteByte('[')
+		for i, item := range d.AsArray().Items() {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case d.IsTime():
+		return encodeJSON(buf, d.AsTime().PseudoObject())
+	case d.IsBinary():
+		return encodeJSON(buf, d.AsBinary().PseudoObject())
+	case d.IsGeometry():
+		return encodeJSON(buf, d.AsGeometry().PseudoObject())
+	case d.IsObject():
+		items := d.AsObject().Items()
+		keys := make([]string, 0, len(items))
+		for key := range items {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			encodeJSONString(buf, key)
+			buf.WriteByte(':')
+			if err := encodeJSON(buf, items[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case d.IsMinVal():
+		return NewError(ql2.Response_QUERY_LOGIC, "Cannot convert `r.minval` to JSON.")
+	case d.IsMaxVal():
+		return NewError(ql2.Response_QUERY_LOGIC, "Cannot convert `r.maxval` to JSON.")
+	}
+	return nil
+}
+
+func encodeJSONString(buf *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	// Encoding a string never fails. The encoder appends a newline which is
+	// trimmed.
+	encoder.Encode(s)
+	buf.Truncate(buf.Len() - 1)
+}
@@ -0,0 +1,34 @@
+package values
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+)
+
+var errChangesUnsupported = NewError(ql2.Response_QUERY_LOGIC, "Cannot call `changes` on this type.")
+
+// Feed is a Stream of the changes to some rows of a table. It never ends
+// unless it is closed, so NextItem blocks until there is a change.
+type Feed interface {
+	Stream
+	// Notes returns the notes which describe the feed in responses.
+	Notes() []ql2.Response_ResponseNote
+	// Close stops the feed. A blocked call to NextItem returns the end of
+	// the stream.
+	Close()
+}
+
+type feed struct {
+	stream
+	notes []ql2.Response_ResponseNote
+	close func()
+}
+
+// NewFeed returns a Feed which produces each item by calling next, which
+// blocks until there is an item or close is called.
+func NewFeed(next func() (Datum, *Error), notes []ql2.Response_ResponseNote, close func()) Feed {
+	return feed{stream: stream{next: next}, notes: notes, close: close}
+}
+
+func (f feed) AsStream() Stream                   { return f }
+func (f feed) Notes() []ql2.Response_ResponseNote { return f.notes }
+func (f feed) Close()                             { f.close() }
@@ -0,0 +1,150 @@
+package values
+
+import (
+	"github.com/jlhawn/reboltdb/geo"
+)
+
+// GeometryPseudoType is the PseudoTypeKey value of an object which encodes a
+// Geometry.
+const GeometryPseudoType = "GEOMETRY"
+
+// Geometry is a point, line, or polygon. It is encoded as a GeoJSON object
+// with a GEOMETRY pseudo type.
+type Geometry struct {
+	datum
+	g geo.Geometry
+}
+
+func NewGeometry(g geo.Geometry) Geometry { return Geometry{g: g} }
+
+func (Geometry) IsGeometry() bool       { return true }
+func (g Geometry) AsGeometry() Geometry { return g }
+
+func (g Geometry) Geo() geo.Geometry { return g.g }
+
+func pointCoordinates(p geo.Point) Datum {
+	return NewArray([]Datum{NewNumber(p.Lon), NewNumber(p.Lat)})
+}
+
+func ringCoordinates(ring []geo.Point) Datum {
+	points := make([]Datum, len(ring))
+	for i, p := range ring {
+		points[i] = pointCoordinates(p)
+	}
+	return NewArray(points)
+}
+
+// GeoJSON returns the GeoJSON object which describes this geometry.
+func (g Geometry) GeoJSON() Object {
+	var coordinates Datum
+	switch g.g.Kind {
+	case geo.PointKind:
+		coordinates = pointCoordinates(g.g.Point())
+	case geo.LineKind:
+		coordinates = ringCoordinates(g.g.Rings[0])
+	default:
+		rings := make([]Datum, len(g.g.Rings))
+		for i, ring := range g.g.Rings {
+			rings[i] = ringCoordinates(ring)
+		}
+		coordinates = NewArray(rings)
+	}
+	return NewObject(map[string]Datum{
+		"type":        NewString(string(g.g.Kind)),
+		"coordinates": coordinates,
+	})
+}
+
+// PseudoObject returns the object which encodes this geometry.
+func (g Geometry) PseudoObject() Object {
+	items := g.GeoJSON().Items()
+	items[PseudoTypeKey] = NewString(GeometryPseudoType)
+	return NewObject(items)
+}
+
+// geoPoint converts the GeoJSON coordinates of a position into a point.
+func geoPoint(d Datum) (geo.Point, *Error) {
+	if !d.IsArray() {
+		return geo.Point{}, pseudoTypeError("Expected a GeoJSON position to be an ARRAY.")
+	}
+	coordinates := d.AsArray().Items()
+	if len(coordinates) == 3 {
+		return geo.Point{}, pseudoTypeError("GeoJSON positions with an altitude are not supported.")
+	}
+	if len(coordinates) != 2 || !coordinates[0].IsNumber() || !coordinates[1].IsNumber() {
+		return geo.Point{}, pseudoTypeError("Expected a GeoJSON position to be an ARRAY of 2 NUMBERs.")
+	}
+	return geo.Point{Lon: coordinates[0].AsNumber().Float64(), Lat: coordinates[1].AsNumber().Float64()}, nil
+}
+
+func geoRing(d Datum) ([]geo.Point, *Error) {
+	if !d.IsArray() {
+		return nil, pseudoTypeError("Expected GeoJSON coordinates to be an ARRAY of positions.")
+	}
+	ring := make([]geo.Point, len(d.AsArray().Items()))
+	for i, item := range d.AsArray().Items() {
+		var err *Error
+		if ring[i], err = geoPoint(item); err != nil {
+			return nil, err
+		}
+	}
+	return ring, nil
+}
+
+// GeometryFromGeoJSON converts a GeoJSON object of type Point, LineString, or
+// Polygon into a Geometry. The object may also be a GEOMETRY pseudo type.
+func GeometryFromGeoJSON(obj Object) (Datum, *Error) {
+	items := obj.Items()
+	kind, ok := items["type"]
+	if !ok || !kind.IsString() {
+		return nil, pseudoTypeError("GeoJSON object must have a STRING field `type`.")
+	}
+	coordinates, ok := items["coordinates"]
+	if !ok {
+		return nil, pseudoTypeError("GeoJSON object must have a field `coordinates`.")
+	}
+	for key := range items {
+		switch key {
+		case PseudoTypeKey, "type", "coordinates":
+		case "bbox", "crs":
+			return nil, pseudoTypeError("GeoJSON field `%s` is not supported.", key)
+		default:
+			return nil, pseudoTypeError("Unrecognized field `%s` in GeoJSON object.", key)
+		}
+	}
+
+	var g geo.Geometry
+	var geoErr error
+	switch geo.Kind(kind.AsString().Value()) {
+	case geo.PointKind:
+		p, err := geoPoint(coordinates)
+		if err != nil {
+			return nil, err
+		}
+		g, geoErr = geo.NewPoint(p)
+	case geo.LineKind:
+		ring, err := geoRing(coordinates)
+		if err != nil {
+			return nil, err
+		}
+		g, geoErr = geo.NewLine(ring)
+	case geo.PolygonKind:
+		if !coordinates.IsArray() || len(coordinates.AsArray().Items()) == 0 {
+			return nil, pseudoTypeError("Expected GeoJSON Polygon coordinates to be a non-empty ARRAY of rings.")
+		}
+		rings := make([][]geo.Point, len(coordinates.AsArray().Items()))
+		for i, item := range coordinates.AsArray().Items() {
+			var err *Error
+			if rings[i], err = geoRing(item); err != nil {
+				return nil, err
+			}
+		}
+		g, geoErr = geo.NewPolygon(rings...)
+	default:
+		return nil, pseudoTypeError("Unrecognized GeoJSON type `%s`.", kind.AsString().Value())
+	}
+	if geoErr != nil {
+		return nil, pseudoTypeError("%s", geoErr)
+	}
+	return NewGeometry(g), nil
+}
@@ -0,0 +1,14 @@
+package values
+
+// WriteHook is a function which is called with every write to a table, with
+// the context of the write and the old and new values of the row. The row is
+// written as the document it returns instead, or deleted if it returns null.
+type WriteHook struct {
+	Function Function
+	// Source is the JSON encoding of the FUNC term of the hook, which is
+	// stored in the table's catalog entry and compiled again when it is
+	// loaded.
+	Source []byte
+	// Query is the readable form of the hook, returned by getWriteHook.
+	Query string
+}
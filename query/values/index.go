@@ -0,0 +1,12 @@
+package values
+
+// IndexFunction is the function of a secondary index, which returns the
+// value by which each row is indexed.
+type IndexFunction struct {
+	Function Function
+	// Source is the JSON encoding of the FUNC term of the index, which is
+	// stored with the index and compiled again when it is loaded.
+	Source []byte
+	// Query is the readable form of the index, returned by indexStatus.
+	Query string
+}
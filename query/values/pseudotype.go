@@ -0,0 +1,29 @@
+package values
+
+import (
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+)
+
+// FromPseudoType converts an object which encodes a pseudo type into the
+// datum it represents. Objects which do not encode a pseudo type are returned
+// unchanged, and those which encode an unknown one are an error.
+func FromPseudoType(obj Object) (Datum, *Error) {
+	reqlType, ok := obj.Items()[PseudoTypeKey]
+	if !ok || !reqlType.IsString() {
+		return obj, nil
+	}
+
+	switch reqlType.AsString().Value() {
+	case TimePseudoType:
+		return timeFromPseudoType(obj.Items())
+	case BinaryPseudoType:
+		return binaryFromPseudoType(obj.Items())
+	case GeometryPseudoType:
+		return GeometryFromGeoJSON(obj)
+	}
+	return nil, pseudoTypeError("Unknown $reql_type$ `%s`.", reqlType.AsString().Value())
+}
+
+func pseudoTypeError(format string, args ...interface{}) *Error {
+	return NewError(ql2.Response_QUERY_LOGIC, format, args...)
+}
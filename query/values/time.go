@@ -0,0 +1,144 @@
+package values
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// TimePseudoType is the PseudoTypeKey value of an object which encodes a
+// Time.
+const TimePseudoType = "TIME"
+
+// Time is a point in time with millisecond precision along with the timezone
+// in which it is expressed. The timezone is a fixed offset from UTC.
+type Time struct {
+	datum
+	epoch  float64
+	offset int
+}
+
+// NewTime returns the Time at the given number of seconds since the Unix
+// epoch, expressed in the timezone with the given offset in seconds east of
+// UTC. The epoch time is rounded to the nearest millisecond.
+func NewTime(epoch float64, offset int) Time {
+	return Time{epoch: math.Round(epoch*1000) / 1000, offset: offset}
+}
+
+// Times must fall within the years 1400 to 10000, as in RethinkDB.
+var (
+	minEpochTime = float64(time.Date(1400, time.January, 1, 0, 0, 0, 0, time.UTC).Unix())
+	maxEpochTime = float64(time.Date(10001, time.January, 1, 0, 0, 0, 0, time.UTC).Unix())
+)
+
+// CheckEpochTime returns a QUERY_LOGIC error if the given number of seconds
+// since the Unix epoch is not within the supported range of times.
+func CheckEpochTime(epoch float64) *Error {
+	if !(epoch >= minEpochTime && epoch < maxEpochTime) {
+		return pseudoTypeError("Error in time logic: Year is out of valid range: 1400..10000.")
+	}
+	return nil
+}
+
+// TimeFromGo returns the given Go time as a Time in the same timezone.
+func TimeFromGo(t time.Time) Time {
+	_, offset := t.Zone()
+	return NewTime(float64(t.Unix())+float64(t.Nanosecond())/1e9, offset)
+}
+
+func (Time) IsTime() bool   { return true }
+func (t Time) AsTime() Time { return t }
+
+// EpochTime returns the number of seconds since the Unix epoch.
+func (t Time) EpochTime() float64 { return t.epoch }
+
+// Offset returns the offset of the timezone of this time in seconds east of
+// UTC.
+func (t Time) Offset() int { return t.offset }
+
+// Timezone returns the timezone of this time formatted as "[+-]HH:MM".
+func (t Time) Timezone() string { return FormatTimezone(t.offset) }
+
+// InTimezone returns the same point in time expressed in the timezone with
+// the given offset.
+func (t Time) InTimezone(offset int) Time { return Time{epoch: t.epoch, offset: offset} }
+
+// Go returns this time as a Go time in a fixed zone with the same offset.
+func (t Time) Go() time.Time {
+	sec, frac := math.Modf(t.epoch)
+	nsec := int64(math.Round(frac*1000)) * int64(time.Millisecond)
+	return time.Unix(int64(sec), nsec).In(time.FixedZone(t.Timezone(), t.offset))
+}
+
+// PseudoObject returns the object which encodes this time.
+func (t Time) PseudoObject() Object {
+	return NewObject(map[string]Datum{
+		PseudoTypeKey: NewString(TimePseudoType),
+		"epoch_time":  NewNumber(t.epoch),
+		"timezone":    NewString(t.Timezone()),
+	})
+}
+
+// FormatTimezone formats the given offset in seconds east of UTC as
+// "[+-]HH:MM".
+func FormatTimezone(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	return fmt.Sprintf("%c%02d:%02d", sign, offset/3600, offset/60%60)
+}
+
+var timezonePattern = regexp.MustCompile(`^(?:Z|([+-])(\d{2})(?::?(\d{2}))?)$`)
+
+// ParseTimezone parses a timezone of the form "Z", "[+-]HH", "[+-]HHMM", or
+// "[+-]HH:MM" and returns its offset in seconds east of UTC. It reports false
+// if the timezone is not valid.
+func ParseTimezone(tz string) (int, bool) {
+	match := timezonePattern.FindStringSubmatch(tz)
+	if match == nil {
+		return 0, false
+	}
+	if tz == "Z" {
+		return 0, true
+	}
+	hours, _ := strconv.Atoi(match[2])
+	minutes := 0
+	if match[3] != "" {
+		minutes, _ = strconv.Atoi(match[3])
+	}
+	if hours > 23 || minutes > 59 {
+		return 0, false
+	}
+	offset := hours*3600 + minutes*60
+	if match[1] == "-" {
+		offset = -offset
+	}
+	return offset, true
+}
+
+func timeFromPseudoType(items map[string]Datum) (Datum, *Error) {
+	epoch, ok := items["epoch_time"]
+	if !ok || !epoch.IsNumber() {
+		return nil, pseudoTypeError("TIME pseudo-type object must have a NUMBER field `epoch_time`.")
+	}
+	tz, ok := items["timezone"]
+	if !ok || !tz.IsString() {
+		return nil, pseudoTypeError("TIME pseudo-type object must have a STRING field `timezone`.")
+	}
+	offset, ok := ParseTimezone(tz.AsString().Value())
+	if !ok {
+		return nil, pseudoTypeError("Invalid timezone string `%s`.", tz.AsString().Value())
+	}
+	for key := range items {
+		if key != PseudoTypeKey && key != "epoch_time" && key != "timezone" {
+			return nil, pseudoTypeError("Unrecognized field `%s` in TIME pseudo-type object.", key)
+		}
+	}
+	if err := CheckEpochTime(epoch.AsNumber().Float64()); err != nil {
+		return nil, err
+	}
+	return NewTime(epoch.AsNumber().Float64(), offset), nil
+}
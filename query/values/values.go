@@ -1,16 +1,30 @@
 package values
 
 import (
+	"fmt"
 	"math"
 
 	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/geo"
+	"github.com/jlhawn/reboltdb/json"
 )
 
+// Error is a ReQL runtime error. Its type determines how it is reported to
+// the client and whether it may be caught by DEFAULT, which catches only
+// NON_EXISTENCE errors.
 type Error struct {
 	Type    ql2.Response_ErrorType
 	Message string
 }
 
+// NewError returns an error of the given type with a formatted message.
+func NewError(errType ql2.Response_ErrorType, format string, args ...interface{}) *Error {
+	return &Error{Type: errType, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string { return e.Message }
+
 type Top interface {
 	IsDatum() bool
 	IsSequence() bool
@@ -76,6 +90,42 @@ func (datum) AsTime() Time         { return Time{} }
 func (datum) AsBinary() Binary     { return Binary{} }
 func (datum) AsGeometry() Geometry { return Geometry{} }
 
+// PseudoTypeKey is the key of the field which identifies the type of an
+// object which encodes a pseudo type.
+const PseudoTypeKey = "$reql_type$"
+
+// FromJSON converts a parsed JSON value into the equivalent Datum.
+func FromJSON(val json.Value) Datum {
+	switch {
+	case val.IsBool():
+		return NewBool(val.AsBool())
+	case val.IsNumber():
+		return NewNumber(val.AsFloat64())
+	case val.IsString():
+		return NewString(val.AsString())
+	case val.IsArray():
+		jsonItems := val.AsArray()
+		items := make([]Datum, len(jsonItems))
+		for i, item := range jsonItems {
+			items[i] = FromJSON(item)
+		}
+		return NewArray(items)
+	case val.IsObject():
+		jsonItems := val.AsObject()
+		items := make(map[string]Datum, len(jsonItems))
+		for key, item := range jsonItems {
+			items[key] = FromJSON(item)
+		}
+		// A stored object which encodes a pseudo type is always valid since
+		// it was converted from a value of that type.
+		if d, err := FromPseudoType(NewObject(items)); err == nil {
+			return d
+		}
+		return NewObject(items)
+	}
+	return Null{}
+}
+
 type Null struct{ datum }
 
 func (Null) IsNull() bool { return true }
@@ -93,6 +143,8 @@ type Bool struct {
 	val bool
 }
 
+func NewBool(b bool) Bool { return Bool{val: b} }
+
 func (Bool) IsBool() bool   { return true }
 func (b Bool) AsBool() Bool { return b }
 
@@ -103,18 +155,32 @@ type Number struct {
 	val float64
 }
 
+func NewNumber(n float64) Number { return Number{val: n} }
+
 func (Number) IsNumber() bool     { return true }
 func (n Number) AsNumber() Number { return n }
 
+// MaxSafeInteger is the largest integer magnitude which a Number can
+// represent exactly.
+const MaxSafeInteger = 1 << 53
+
 func (n Number) IsInteger() bool  { return n.val == math.Trunc(n.val) }
 func (n Number) Int64() int64     { return int64(n.val) }
 func (n Number) Float64() float64 { return n.val }
 
+// IsSafeInteger reports whether this number is an integer which can be
+// represented exactly, i.e. one within [-2^53, 2^53].
+func (n Number) IsSafeInteger() bool {
+	return n.IsInteger() && math.Abs(n.val) <= MaxSafeInteger
+}
+
 type String struct {
 	datum
 	val string
 }
 
+func NewString(s string) String { return String{val: s} }
+
 func (String) IsString() bool     { return true }
 func (s String) AsString() String { return s }
 
@@ -132,6 +198,8 @@ type object struct {
 	items map[string]Datum
 }
 
+func NewObject(items map[string]Datum) Object { return object{items: items} }
+
 func (object) IsObject() bool     { return true }
 func (o object) AsObject() Object { return o }
 
@@ -145,30 +213,31 @@ type Array struct {
 	items []Datum
 }
 
+func NewArray(items []Datum) Array { return Array{items: items} }
+
 func (Array) IsArray() bool    { return true }
 func (a Array) AsArray() Array { return a }
 
-func (a Array) Items() []Datum { return a.items }
-
-type Time struct{ datum }
-
-func (Time) IsTime() bool   { return true }
-func (t Time) AsTime() Time { return t }
-
-type Binary struct{ datum }
-
-func (Binary) IsBinary() bool     { return true }
-func (b Binary) AsBinary() Binary { return b }
-
-type Geometry struct{ datum }
+// AsStream returns a Stream which yields the items of this array in order.
+func (a Array) AsStream() Stream {
+	i := 0
+	return NewStream(func() (Datum, *Error) {
+		if i >= len(a.items) {
+			return nil, nil
+		}
+		i++
+		return a.items[i-1], nil
+	})
+}
 
-func (Geometry) IsGeometry() bool       { return true }
-func (g Geometry) AsGeometry() Geometry { return g }
+func (a Array) Items() []Datum { return a.items }
 
 type Selection interface {
 	Object
 	TableDescriptor
-	Changes(options Object) Stream
+	// Changes returns a Feed of the changes to the selected row. The
+	// options are the optional arguments of CHANGES.
+	Changes(options Object) (Feed, *Error)
 }
 
 type TableDescriptor interface {
@@ -188,9 +257,9 @@ type selection struct {
 	tableDescriptor
 }
 
-func (selection) IsSelection() bool             { return true }
-func (s selection) AsSelection() Selection      { return s }
-func (selection) Changes(options Object) Stream { return stream{} }
+func (selection) IsSelection() bool                     { return true }
+func (s selection) AsSelection() Selection              { return s }
+func (selection) Changes(options Object) (Feed, *Error) { return nil, errChangesUnsupported }
 
 type Sequence interface {
 	Top
@@ -200,8 +269,11 @@ type Sequence interface {
 	AsStream() Stream
 }
 
-type sequence struct{ top }
+// sequence does not embed top so that Array may embed both sequence and datum
+// without making the Top methods ambiguous.
+type sequence struct{}
 
+func (sequence) IsSequence() bool { return true }
 func (sequence) IsArray() bool    { return false }
 func (sequence) IsStream() bool   { return false }
 func (sequence) AsArray() Array   { return Array{} }
@@ -211,18 +283,39 @@ type Stream interface {
 	Sequence
 	IsSelectionStream() bool
 	AsSelectionStream() SelectionStream
+	// NextItem returns the next item in the stream or a nil Datum once the
+	// stream has been exhausted.
 	NextItem() (Datum, *Error)
-	Changes(options Object) Stream
+	// Changes returns a Feed of the changes to the rows of this stream,
+	// which must be a selection. The options are the optional arguments of
+	// CHANGES.
+	Changes(options Object) (Feed, *Error)
 }
 
 type stream struct {
+	top
 	sequence
+	next func() (Datum, *Error)
 }
 
+// NewStream returns a lazy Stream which produces each item by calling next.
+// The next function must return a nil Datum once there are no more items.
+func NewStream(next func() (Datum, *Error)) Stream { return stream{next: next} }
+
+func (stream) IsSequence() bool                   { return true }
+func (stream) IsStream() bool                     { return true }
+func (s stream) AsStream() Stream                 { return s }
 func (stream) IsSelectionStream() bool            { return false }
 func (stream) AsSelectionStream() SelectionStream { return selectionStream{} }
-func (stream) NextItem() (Datum, *Error)          { return nil, nil }
-func (s stream) Changes(options Object) Stream    { return s }
+
+func (stream) Changes(options Object) (Feed, *Error) { return nil, errChangesUnsupported }
+
+func (s stream) NextItem() (Datum, *Error) {
+	if s.next == nil {
+		return nil, nil
+	}
+	return s.next()
+}
 
 type SelectionStream interface {
 	Stream
@@ -237,12 +330,26 @@ type selectionStream struct {
 	tableDescriptor
 }
 
+func (s selectionStream) AsStream() Stream                   { return s }
 func (selectionStream) IsSelectionStream() bool              { return true }
 func (s selectionStream) AsSelectionStream() SelectionStream { return s }
 
-func (selectionStream) IsTable() bool               { return false }
-func (selectionStream) AsTable() Table              { return nil }
-func (s selectionStream) Next() (Selection, *Error) { return nil, nil }
+// NewSelectionStream returns a lazy SelectionStream of rows of the named
+// table which produces each by calling next, as NewStream does.
+func NewSelectionStream(next func() (Datum, *Error), db, table string) SelectionStream {
+	return selectionStream{stream: stream{next: next}, tableDescriptor: tableDescriptor{db: db, table: table}}
+}
+
+func (selectionStream) IsTable() bool  { return false }
+func (selectionStream) AsTable() Table { return nil }
+
+func (s selectionStream) Next() (Selection, *Error) {
+	row, err := s.NextItem()
+	if err != nil || row == nil || !row.IsObject() {
+		return nil, err
+	}
+	return selection{object: object{items: row.AsObject().Items()}, tableDescriptor: s.tableDescriptor}, nil
+}
 
 type IndexOrderedSelectionStream interface {
 	SelectionStream
@@ -252,40 +359,109 @@ type IndexOrderedSelectionStream interface {
 type Table interface {
 	SelectionStream
 	Name() string
+	// ID returns the ID of the table and DBID that of its database, which,
+	// unlike their names, are never reused.
+	ID() string
+	DBID() string
+	// PrimaryKey returns the name of the field which holds the primary key
+	// of each row.
+	PrimaryKey() string
+	// DocCountEstimate returns the approximate number of rows in the table.
+	DocCountEstimate() int64
+	// Get returns the row with the given primary key or nil if there is no
+	// such row.
 	Get(key Datum) Selection
+	// GetChanges returns a Feed of the changes to the row with the given
+	// primary key, which need not exist.
+	GetChanges(key Datum, options Object) (Feed, *Error)
+	// GetAll returns the rows with any of the given keys in the named index.
+	// An empty index name selects the primary key.
 	GetAll(keys []Datum, index string) SelectionStream
 	Between(lowerKey, upperKey Datum, index string, options Object) SelectionStream
 	OrderBy(index string, descending bool, nextOrdering Ordering) (IndexOrderedSelectionStream, *Error)
 	Distinct(index string) (Stream, *Error)
 	InsertObject(obj Object, conflict, durability string, returnChanges bool) Object
 	InsertSequence(seq Sequence, conflict, durability string, returnChanges bool) Object
+	// Delete deletes the rows with the given primary keys. The result counts
+	// the rows `deleted` and those `skipped` because they did not exist.
+	Delete(keys []Datum, durability string, returnChanges bool) Object
+	// Replace writes each row with one of the given primary keys as the
+	// given function returns it, or deletes it if the function returns null.
+	// The function is given the current row, or null if there is none, and
+	// is called in the same transaction as the write unless nonAtomic is set.
+	// The result counts the rows as INSERT and DELETE do.
+	Replace(keys []Datum, fn func(oldVal Datum) (Datum, *Error), nonAtomic bool, durability string, returnChanges bool) Object
 	Wait() Object
 	Sync() Object
-	IndexCreate(name string, indexFunc Function, multi bool) (Object, *Error)
+	// IndexCreate creates a secondary index of the values returned by the
+	// given function. A geo index holds geometries, which it indexes by the
+	// cells of the Earth which cover them.
+	IndexCreate(name string, indexFunc *IndexFunction, multi, geo bool) (Object, *Error)
+	// GetIntersecting returns the rows with a geometry in the named geo index
+	// which intersects the given geometry.
+	GetIntersecting(geometry Geometry, index string) (SelectionStream, *Error)
+	// GetNearest returns up to maxResults rows with a geometry in the named
+	// geo index within maxDist of the given point, ordered by distance. Each
+	// result is an object with the distance as `dist` and the row as `doc`.
+	// Distances are measured on the given ellipsoid in its units.
+	GetNearest(point Geometry, index string, e geo.Ellipsoid, maxDist float64, maxResults int) (Array, *Error)
 	IndexDrop(name string) (Object, *Error)
 	IndexList() Array
 	IndexStatus(names ...string) Array
 	IndexWait(names ...string) Array
 	IndexRename(oldName, newName string, overwrite bool) (Object, *Error)
+	// WithInterrupt returns a copy of the table whose streams fail with the
+	// error which interrupted returns, once it returns one, as they are read.
+	WithInterrupt(interrupted func() *Error) Table
+	// WriteHook returns the write hook of the table or nil if it has none.
+	WriteHook() *WriteHook
+	// SetWriteHook stores the given write hook in the table's catalog entry
+	// in place of any it has, or removes it if the hook is nil. The result
+	// counts the hooks `created`, `replaced` or `deleted`.
+	SetWriteHook(hook *WriteHook) (Object, *Error)
 }
 
 type Database interface {
 	Top
-	Name()
+	ID() string
+	Name() string
 }
 
 type database struct {
 	top
-	name string
+	id, name string
 }
 
+func NewDatabase(id, name string) Database { return database{id: id, name: name} }
+
 func (database) IsDatabase() bool { return true }
+func (d database) ID() string     { return d.id }
+func (d database) Name() string   { return d.name }
 
 type Function interface {
-	Args() []int64
-	Eval(env map[int64]Datum) Datum
+	Top
+	// Arity returns the number of arguments the function expects or -1 if
+	// it accepts any number of arguments.
+	Arity() int
+	Call(args ...Datum) (Top, *Error)
+}
+
+type function struct {
+	top
+	arity int
+	call  func(args ...Datum) (Top, *Error)
 }
 
+// NewFunction returns a Function which evaluates calls using the given call
+// func. The call func is responsible for validating its arguments.
+func NewFunction(arity int, call func(args ...Datum) (Top, *Error)) Function {
+	return function{arity: arity, call: call}
+}
+
+func (function) IsFunction() bool                   { return true }
+func (f function) Arity() int                       { return f.arity }
+func (f function) Call(args ...Datum) (Top, *Error) { return f.call(args...) }
+
 type Ordering interface {
 	Key(d Datum) string
 	Descending() bool
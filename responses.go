@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/jobs"
+	"github.com/jlhawn/reboltdb/query"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// batchSize is the largest number of items sent in a single response to a
+// query which returns a sequence.
+const batchSize = 1000
+
+// cursor holds the remaining results of a query which returns a sequence,
+// which are sent in batches as the client continues the query.
+type cursor struct {
+	stream values.Stream
+	// feed is set if the sequence is a changefeed, in which case its items
+	// are read into the items channel as they become available.
+	feed  values.Feed
+	items chan feedItem
+	// stopped is closed when the cursor is closed, so that the feed is no
+	// longer read.
+	stopped chan struct{}
+	once    sync.Once
+	// job is the job of the query. The sequence ends with an error if it
+	// is interrupted.
+	job *jobs.Job
+	// finish is called when the cursor is closed.
+	finish func()
+}
+
+type feedItem struct {
+	item values.Datum
+	err  *values.Error
+}
+
+func newCursor(stream values.Stream, job *jobs.Job, finish func()) *cursor {
+	c := &cursor{stream: stream, job: job, finish: finish}
+	if feed, ok := stream.(values.Feed); ok {
+		c.feed = feed
+		c.items = make(chan feedItem, batchSize)
+		c.stopped = make(chan struct{})
+		go c.readFeed()
+	}
+	return c
+}
+
+func (c *cursor) readFeed() {
+	defer close(c.items)
+	for {
+		item, err := c.nextFeedItem()
+		select {
+		case c.items <- feedItem{item: item, err: err}:
+		case <-c.stopped:
+			return
+		}
+		if item == nil || err != nil {
+			return
+		}
+	}
+}
+
+// nextFeedItem returns the next item of the feed, or an error if reading it
+// panics.
+func (c *cursor) nextFeedItem() (item values.Datum, err *values.Error) {
+	defer func() {
+		if p := recover(); p != nil {
+			item, err = nil, panicError(p)
+		}
+	}()
+	return c.feed.NextItem()
+}
+
+// nextBatch returns the next batch of items and whether the sequence has
+// ended. A batch of a changefeed waits for at least one change and then takes
+// those which have already arrived.
+func (c *cursor) nextBatch() ([]values.Datum, bool, *values.Error) {
+	var batch []values.Datum
+	if c.feed == nil {
+		for len(batch) < batchSize {
+			if reason := c.job.Err(); reason != nil {
+				return nil, false, query.InterruptedError(reason)
+			}
+			item, err := c.stream.NextItem()
+			if err != nil {
+				return nil, false, err
+			}
+			if item == nil {
+				return batch, true, nil
+			}
+			batch = append(batch, item)
+		}
+		return batch, false, nil
+	}
+
+	var fi feedItem
+	ok := true
+	select {
+	case fi, ok = <-c.items:
+	case <-c.job.Interrupted():
+		return nil, false, query.InterruptedError(c.job.Err())
+	}
+	for ; ok; fi, ok = <-c.items {
+		if fi.err != nil {
+			return nil, false, fi.err
+		}
+		if fi.item == nil {
+			return batch, true, nil
+		}
+		batch = append(batch, fi.item)
+		if len(batch) == batchSize || len(c.items) == 0 {
+			return batch, false, nil
+		}
+	}
+	return batch, true, nil
+}
+
+func (c *cursor) close() {
+	c.once.Do(func() {
+		if c.feed != nil {
+			close(c.stopped)
+			c.feed.Close()
+		}
+		c.finish()
+	})
+}
+
+// response is a response to a query, which is sent as a JSON object.
+type response struct {
+	Type      ql2.Response_ResponseType
+	Results   []values.Datum
+	Notes     []ql2.Response_ResponseNote
+	ErrorType ql2.Response_ErrorType
+}
+
+func errorResponse(responseType ql2.Response_ResponseType, err *values.Error) response {
+	return response{
+		Type:      responseType,
+		Results:   []values.Datum{values.NewString(err.Message)},
+		ErrorType: err.Type,
+	}
+}
+
+func (r response) encode() ([]byte, error) {
+	items := map[string]values.Datum{
+		"t": values.NewNumber(float64(r.Type)),
+		"r": values.NewArray(r.Results),
+	}
+	if r.Results == nil {
+		items["r"] = values.NewArray([]values.Datum{})
+	}
+	if len(r.Notes) > 0 {
+		notes := make([]values.Datum, len(r.Notes))
+		for i, note := range r.Notes {
+			notes[i] = values.NewNumber(float64(note))
+		}
+		items["n"] = values.NewArray(notes)
+	}
+	if r.ErrorType != 0 {
+		items["e"] = values.NewNumber(float64(r.ErrorType))
+		items["b"] = values.NewArray([]values.Datum{})
+	}
+	encoded, err := values.ToJSON(values.NewObject(items))
+	if err != nil {
+		return nil, err
+	}
+	return encoded, nil
+}
+
+// writeResponse sends a response to the query with the given token: the
+// token as a 64-bit integer, the size of the response as a 32-bit integer
+// and the response itself.
+func (qs *queryServer) writeResponse(token uint64, r response) error {
+	encoded, err := r.encode()
+	if err != nil {
+		// A result which cannot be encoded is an error of the query.
+		encoded, err = errorResponse(ql2.Response_RUNTIME_ERROR, values.NewError(ql2.Response_QUERY_LOGIC, "%s", err)).encode()
+		if err != nil {
+			return fmt.Errorf("unable to encode response: %s", err)
+		}
+	}
+
+	buf := make([]byte, 12+len(encoded))
+	binary.LittleEndian.PutUint64(buf[0:8], token)
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(len(encoded)))
+	copy(buf[12:], encoded)
+
+	qs.writeMu.Lock()
+	defer qs.writeMu.Unlock()
+
+	if _, err := qs.conn.Write(buf); err != nil {
+		return fmt.Errorf("unable to write response: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// failureBaseDelay is how long a client waits to be told that its
+	// second failed authentication in a row failed. The delay doubles with
+	// each failure after, up to failureMaxDelay.
+	failureBaseDelay = 200 * time.Millisecond
+	failureMaxDelay  = 5 * time.Second
+	// failureWindow is how long failures from an address are remembered.
+	failureWindow = 10 * time.Minute
+)
+
+// AuthFailures counts the recent failed authentications from each client
+// host, so that a client which keeps failing is made to wait longer each
+// time before it is told so.
+type AuthFailures struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	byHost map[string]*authFailure
+}
+
+type authFailure struct {
+	count int
+	last  time.Time
+}
+
+func NewAuthFailures() *AuthFailures {
+	return &AuthFailures{now: time.Now, byHost: map[string]*authFailure{}}
+}
+
+// hostOf returns the host of a client address, which identifies the client
+// across connections.
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// Fail counts a failed authentication from the given address and returns how
+// long to wait before reporting it to the client. A nil AuthFailures never
+// waits.
+func (f *AuthFailures) Fail(addr net.Addr) time.Duration {
+	if f == nil {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	for host, failure := range f.byHost {
+		if now.Sub(failure.last) > failureWindow {
+			delete(f.byHost, host)
+		}
+	}
+	host := hostOf(addr)
+	failure, ok := f.byHost[host]
+	if !ok {
+		failure = &authFailure{}
+		f.byHost[host] = failure
+	}
+	failure.count++
+	failure.last = now
+
+	if failure.count == 1 {
+		return 0
+	}
+	delay := failureBaseDelay
+	for i := 2; i < failure.count && delay < failureMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > failureMaxDelay {
+		delay = failureMaxDelay
+	}
+	return delay
+}
+
+// Succeed forgets the failed authentications from the given address.
+func (f *AuthFailures) Succeed(addr net.Addr) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.byHost, hostOf(addr))
+}
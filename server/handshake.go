@@ -2,9 +2,7 @@ package server
 
 import (
 	"bufio"
-	"crypto/hmac"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
@@ -12,18 +10,18 @@ import (
 	"io"
 	"net"
 	"strings"
+	"time"
 
 	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
-)
 
-const (
-	adminUsername      = "admin"
-	adminPasswordSalt  = "6VRzcOVKuS8WWbOKM5Vurw=="
-	adminPasswordHash  = "NsWJkSBxXNSiI1Bh0UWM7UXAE3fId5RR1ZnA7Cldtws="
-	passwordIterations = 4096
+	"github.com/jlhawn/reboltdb/users"
 )
 
-func DoHandshake(conn net.Conn, reader *bufio.Reader) error {
+// DoHandshake performs the handshake which begins a connection, in which the
+// client authenticates as one of the given users. It returns the name of the
+// authenticated user. A client which fails to authenticate is sent an error,
+// after a delay which grows with its recent failures.
+func DoHandshake(conn net.Conn, reader *bufio.Reader, userStore *users.Store, failures *AuthFailures) (string, error) {
 	// When we first get a connection, read the magic number for the version of
 	// the protobuf targeted by the client (in the [Version] enum). This should
 	// **NOT** be sent as a protobuf; it is just sent as a little-endian 32-bit
@@ -31,38 +29,96 @@ func DoHandshake(conn net.Conn, reader *bufio.Reader) error {
 	// connection.
 	var versionBuf [4]byte
 	if _, err := io.ReadFull(reader, versionBuf[:]); err != nil {
-		return fmt.Errorf("unable to read version magic number into buffer: %s", err)
+		return "", fmt.Errorf("unable to read version magic number into buffer: %s", err)
 	}
 
-	// We only support "V1_0".
+	// We support "V1_0" and, for older drivers, "V0_3" and "V0_4", whose
+	// clients authenticate as the admin user with an auth key.
 	version := ql2.VersionDummy_Version(binary.LittleEndian.Uint32(versionBuf[:]))
-	if version != ql2.VersionDummy_V1_0 {
-		return fmt.Errorf("unrecognized version magic number: %d", version)
+	switch version {
+	case ql2.VersionDummy_V1_0:
+	case ql2.VersionDummy_V0_3, ql2.VersionDummy_V0_4:
+		return doLegacyHandshake(conn, reader, userStore, failures)
+	default:
+		conn.Write([]byte("ERROR: Received an unsupported protocol version. This port is for RethinkDB queries. Does your client driver version not match the server?\n\x00"))
+		return "", fmt.Errorf("unrecognized version magic number: %d", version)
 	}
 
 	// Reply with a version message.
 	if err := writeVersionMessage(conn); err != nil {
-		return fmt.Errorf("unable to write version message: %s", err)
+		return "", fmt.Errorf("unable to write version message: %s", err)
 	}
 
-	authenticator := &scramAuthenticator{}
+	authenticator := &scramAuthenticator{users: userStore}
 	if err := authenticator.readClientAuthenticationMessage(reader); err != nil {
-		return fmt.Errorf("unable to read client authentication message: %s", err)
+		reportAuthError(conn, failures, err)
+		return "", fmt.Errorf("unable to read client authentication message: %s", err)
 	}
 
 	if err := authenticator.writeServerAuthenticationMessage(conn); err != nil {
-		return fmt.Errorf("unable to write server authentication message: %s", err)
+		return "", fmt.Errorf("unable to write server authentication message: %s", err)
 	}
 
 	if err := authenticator.readClientAuthenticationProof(reader); err != nil {
-		return fmt.Errorf("unable to read client authentication proof: %s", err)
+		reportAuthError(conn, failures, err)
+		return "", fmt.Errorf("unable to read client authentication proof: %s", err)
 	}
+	failures.Succeed(conn.RemoteAddr())
 
 	if err := authenticator.writeServerAuthenticationSignatureMessage(conn); err != nil {
-		return fmt.Errorf("unable to write server authentication signature: %s", err)
+		return "", fmt.Errorf("unable to write server authentication signature: %s", err)
 	}
 
-	return nil
+	return authenticator.user.Name, nil
+}
+
+// The codes of the errors sent to clients which fail to authenticate. Drivers
+// report codes from 10 to 20 as authentication errors.
+const (
+	errorCodeInvalidMessage     = 10
+	errorCodeUnsupportedVersion = 11
+	errorCodeWrongPassword      = 12
+	errorCodeUnsupportedMethod  = 13
+	errorCodeInvalidNonce       = 14
+	errorCodeUnknownUser        = 17
+	errorCodeInternal           = 20
+)
+
+// authError is a failure to authenticate, which is reported to the client.
+type authError struct {
+	code    int
+	message string
+}
+
+func newAuthError(code int, format string, args ...interface{}) *authError {
+	return &authError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+func (e *authError) Error() string {
+	return e.message
+}
+
+type errorMessage struct {
+	Success   bool   `json:"success"`
+	Error     string `json:"error"`
+	ErrorCode int    `json:"error_code"`
+}
+
+// reportAuthError sends the client an error frame if the given error is an
+// authError, once the delay for the failures from its address has passed.
+// Other errors, such as those reading from the connection, are not reported.
+// The connection is closed after, so an error writing the frame is ignored.
+func reportAuthError(conn net.Conn, failures *AuthFailures, err error) {
+	authErr, ok := err.(*authError)
+	if !ok {
+		return
+	}
+	time.Sleep(failures.Fail(conn.RemoteAddr()))
+	payloadBuf, err := json.Marshal(errorMessage{Success: false, Error: authErr.message, ErrorCode: authErr.code})
+	if err != nil {
+		return
+	}
+	conn.Write(append(payloadBuf, '\x00'))
 }
 
 type versionMessage struct {
@@ -94,7 +150,14 @@ func writeVersionMessage(conn net.Conn) error {
 	return nil
 }
 
+// scramUsernameEscapes undoes the escaping of a username in a SCRAM message.
+var scramUsernameEscapes = strings.NewReplacer("=2C", ",", "=3D", "=")
+
 type scramAuthenticator struct {
+	users *users.Store
+	// user is the user the client authenticates as.
+	user *users.User
+
 	authMessage     string
 	clientNonce     string
 	serverNonce     string
@@ -118,19 +181,19 @@ func (a *scramAuthenticator) readClientAuthenticationMessage(reader *bufio.Reade
 
 	var message clientAuthenticationMessage
 	if err := json.Unmarshal(buf, &message); err != nil {
-		return fmt.Errorf("unable to JSON decode client authentication message: %s", err)
+		return newAuthError(errorCodeInvalidMessage, "Unable to decode the client authentication message: %s", err)
 	}
 
 	if message.ProtocolVersion != 0 {
-		return fmt.Errorf("unrecognized protocol version: %d", message.ProtocolVersion)
+		return newAuthError(errorCodeUnsupportedVersion, "Unsupported protocol version %d, expected 0.", message.ProtocolVersion)
 	}
 
 	if message.AuthenticationMethod != "SCRAM-SHA-256" {
-		return fmt.Errorf("unrecognized authentication method: %s", message.AuthenticationMethod)
+		return newAuthError(errorCodeUnsupportedMethod, "Unsupported authentication method `%s`, expected `SCRAM-SHA-256`.", message.AuthenticationMethod)
 	}
 
 	if !strings.HasPrefix(message.Authentication, "n,,") {
-		return fmt.Errorf("invalid authentication encoding")
+		return newAuthError(errorCodeInvalidMessage, "Invalid encoding of the client authentication message.")
 	}
 
 	a.authMessage = strings.TrimPrefix(message.Authentication, "n,,")
@@ -139,19 +202,27 @@ func (a *scramAuthenticator) readClientAuthenticationMessage(reader *bufio.Reade
 		if pair := strings.SplitN(attr, "=", 2); len(pair) == 2 {
 			switch pair[0] {
 			case "n":
-				if pair[1] != adminUsername {
-					return fmt.Errorf("username must be %q", adminUsername)
+				name := scramUsernameEscapes.Replace(pair[1])
+				if a.user, err = a.users.Get(name); err != nil {
+					return newAuthError(errorCodeInternal, "Unable to look up user `%s`: %s", name, err)
+				}
+				if a.user == nil {
+					return newAuthError(errorCodeUnknownUser, "Unknown user `%s`.", name)
 				}
 			case "r":
 				a.clientNonce = pair[1]
 			default:
-				return fmt.Errorf("invalid authentication attribute key: %q", pair[0])
+				return newAuthError(errorCodeInvalidMessage, "Invalid authentication attribute key `%s`.", pair[0])
 			}
 		} else {
-			return fmt.Errorf("invalid authentication attribute: %q", attr)
+			return newAuthError(errorCodeInvalidMessage, "Invalid authentication attribute `%s`.", attr)
 		}
 	}
 
+	if a.user == nil {
+		return newAuthError(errorCodeInvalidMessage, "Missing username.")
+	}
+
 	return nil
 }
 
@@ -169,8 +240,8 @@ func (a *scramAuthenticator) writeServerAuthenticationMessage(conn net.Conn) err
 
 	attributes := []string{
 		fmt.Sprintf("r=%s", a.serverNonce),
-		fmt.Sprintf("s=%s", adminPasswordSalt),
-		fmt.Sprintf("i=%d", passwordIterations),
+		fmt.Sprintf("s=%s", base64.StdEncoding.EncodeToString(a.user.Credentials.Salt)),
+		fmt.Sprintf("i=%d", a.user.Credentials.Iterations),
 	}
 
 	message := serverAuthenticationMessage{
@@ -208,37 +279,20 @@ func (a *scramAuthenticator) readClientAuthenticationProof(reader *bufio.Reader)
 
 	var message clientAuthenticationMessage
 	if err := json.Unmarshal(buf, &message); err != nil {
-		return fmt.Errorf("unable to JSON decode client authentication proof message: %s", err)
-	}
-
-	// Calculate the client proof.
-	decodedPasswordHash, err := base64.StdEncoding.DecodeString(adminPasswordHash)
-	if err != nil {
-		return fmt.Errorf("unable to decode stored password hash: %s", err)
+		return newAuthError(errorCodeInvalidMessage, "Unable to decode the client authentication proof: %s", err)
 	}
-	mac := hmac.New(sha256.New, decodedPasswordHash)
-	mac.Write([]byte("Client Key"))
-	clientKey := mac.Sum(nil)
-
-	storedKey := sha256.Sum256(clientKey)
-
-	a.authMessage += "," + message.Authentication[:strings.Index(message.Authentication, ",p=")]
-
-	mac = hmac.New(sha256.New, storedKey[:])
-	mac.Write([]byte(a.authMessage))
-	clientSignature := mac.Sum(nil)
-
-	clientProofBuf := make([]byte, len(clientKey))
-	for i := range clientProofBuf {
-		clientProofBuf[i] = clientKey[i] ^ clientSignature[i]
-	}
-	clientProof := base64.StdEncoding.EncodeToString(clientProofBuf)
 
 	if !strings.HasPrefix(message.Authentication, "c=biws,") {
-		return fmt.Errorf("invalid authentication encoding")
+		return newAuthError(errorCodeInvalidMessage, "Invalid encoding of the client authentication proof.")
+	}
+	proofIndex := strings.Index(message.Authentication, ",p=")
+	if proofIndex < 0 {
+		return newAuthError(errorCodeInvalidMessage, "Missing client proof.")
 	}
+	a.authMessage += "," + message.Authentication[:proofIndex]
 	encodedAttributes := strings.TrimPrefix(message.Authentication, "c=biws,")
 
+	creds := a.user.Credentials
 	var validNonce, validProof bool
 	attrs := strings.Split(encodedAttributes, ",")
 	for _, attr := range attrs {
@@ -246,33 +300,31 @@ func (a *scramAuthenticator) readClientAuthenticationProof(reader *bufio.Reader)
 			switch pair[0] {
 			case "r":
 				if pair[1] != a.serverNonce {
-					return fmt.Errorf("invalid server nonce: got %q, expected %q", pair[1], a.serverNonce)
+					return newAuthError(errorCodeInvalidNonce, "Invalid nonce.")
 				}
 				validNonce = true
 			case "p":
-				if pair[1] != clientProof {
-					return fmt.Errorf("invalid client proof: got %q, expected %q", pair[1], clientProof)
+				proof, err := base64.StdEncoding.DecodeString(pair[1])
+				if err != nil {
+					return newAuthError(errorCodeInvalidMessage, "Unable to decode the client proof: %s", err)
+				}
+				if !creds.VerifyProof(a.authMessage, proof) {
+					return newAuthError(errorCodeWrongPassword, "Wrong password")
 				}
 				validProof = true
 			default:
-				return fmt.Errorf("invalid authentication attribute key: %q", pair[0])
+				return newAuthError(errorCodeInvalidMessage, "Invalid authentication attribute key `%s`.", pair[0])
 			}
 		} else {
-			return fmt.Errorf("invalid authentication attribute: %q", attr)
+			return newAuthError(errorCodeInvalidMessage, "Invalid authentication attribute `%s`.", attr)
 		}
 	}
 	if !(validNonce && validProof) {
-		return fmt.Errorf("invalid authentication attributes")
+		return newAuthError(errorCodeInvalidMessage, "Missing nonce or proof.")
 	}
 
 	// Create the server signature.
-	mac = hmac.New(sha256.New, decodedPasswordHash)
-	mac.Write([]byte("Server Key"))
-	serverKey := mac.Sum(nil)
-
-	mac = hmac.New(sha256.New, serverKey)
-	mac.Write([]byte(a.authMessage))
-	a.serverSignature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	a.serverSignature = base64.StdEncoding.EncodeToString(creds.ServerSignature(a.authMessage))
 
 	return nil
 }
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/users"
+)
+
+// scramHandshake authenticates as the given user with a proof which is
+// never valid, and returns the error frame sent by the server.
+func scramHandshake(t *testing.T, userStore *users.Store, user string) errorMessage {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := DoHandshake(serverConn, bufio.NewReader(serverConn), userStore, nil)
+		done <- err
+		serverConn.Close()
+	}()
+
+	reader := bufio.NewReader(clientConn)
+	send := func(msg interface{}) {
+		buf, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := clientConn.Write(append(buf, '\x00')); err != nil {
+			t.Fatal(err)
+		}
+	}
+	receive := func(msg interface{}) {
+		buf, err := reader.ReadBytes('\x00')
+		if err != nil {
+			t.Fatalf("unable to read handshake reply: %s", err)
+		}
+		if err := json.Unmarshal(buf[:len(buf)-1], msg); err != nil {
+			t.Fatalf("unable to decode handshake reply %q: %s", buf, err)
+		}
+	}
+
+	if _, err := clientConn.Write(binary.LittleEndian.AppendUint32(nil, uint32(ql2.VersionDummy_V1_0))); err != nil {
+		t.Fatal(err)
+	}
+	var version versionMessage
+	receive(&version)
+	send(clientAuthenticationMessage{
+		ProtocolVersion:      0,
+		AuthenticationMethod: "SCRAM-SHA-256",
+		Authentication:       "n,,n=" + user + ",r=clientnonce",
+	})
+
+	var reply struct {
+		errorMessage
+		Authentication string `json:"authentication"`
+	}
+	receive(&reply)
+	msg := reply.errorMessage
+	if msg.ErrorCode == 0 {
+		var nonce string
+		for _, attr := range strings.Split(reply.Authentication, ",") {
+			if strings.HasPrefix(attr, "r=") {
+				nonce = attr[2:]
+			}
+		}
+		proof := base64.StdEncoding.EncodeToString(make([]byte, 32))
+		send(clientAuthenticationMessage{Authentication: "c=biws,r=" + nonce + ",p=" + proof})
+		receive(&msg)
+	}
+	if err := <-done; err == nil {
+		t.Errorf("expected the handshake as %q to fail", user)
+	}
+	return msg
+}
+
+func TestHandshakeErrors(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	userStore, err := users.Open(db, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := scramHandshake(t, userStore, users.Admin)
+	if msg.Success || msg.ErrorCode != errorCodeWrongPassword || msg.Error != "Wrong password" {
+		t.Errorf("expected a wrong password error but got %+v", msg)
+	}
+	msg = scramHandshake(t, userStore, "nobody")
+	if msg.Success || msg.ErrorCode != errorCodeUnknownUser {
+		t.Errorf("expected an unknown user error but got %+v", msg)
+	}
+}
+
+func TestHandshakeUnsupportedVersion(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go func() {
+		DoHandshake(serverConn, bufio.NewReader(serverConn), nil, nil)
+		serverConn.Close()
+	}()
+
+	if _, err := clientConn.Write(binary.LittleEndian.AppendUint32(nil, 12345)); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := bufio.NewReader(clientConn).ReadString('\x00')
+	if err != nil || !strings.HasPrefix(reply, "ERROR: Received an unsupported protocol version.") {
+		t.Errorf("expected an unsupported version error but got %q, %v", reply, err)
+	}
+}
+
+func TestAuthFailures(t *testing.T) {
+	now := time.Unix(0, 0)
+	failures := NewAuthFailures()
+	failures.now = func() time.Time { return now }
+
+	client := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}
+	sameHost := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5678}
+	other := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 1234}
+
+	expected := []time.Duration{0, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, 1600 * time.Millisecond, 3200 * time.Millisecond, 5 * time.Second, 5 * time.Second}
+	for i, delay := range expected {
+		addr := net.Addr(client)
+		if i%2 == 1 {
+			addr = sameHost
+		}
+		if got := failures.Fail(addr); got != delay {
+			t.Errorf("expected failure %d to wait %s but got %s", i+1, delay, got)
+		}
+	}
+	if got := failures.Fail(other); got != 0 {
+		t.Errorf("expected the first failure from another host not to wait but got %s", got)
+	}
+
+	failures.Succeed(client)
+	if got := failures.Fail(client); got != 0 {
+		t.Errorf("expected a failure after a success not to wait but got %s", got)
+	}
+
+	now = now.Add(failureWindow + time.Second)
+	if got := failures.Fail(other); got != 0 {
+		t.Errorf("expected old failures to be forgotten but waited %s", got)
+	}
+
+	var none *AuthFailures
+	if got := none.Fail(client); got != 0 {
+		t.Errorf("expected a nil tracker not to wait but got %s", got)
+	}
+}
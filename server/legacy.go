@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/users"
+)
+
+// maxAuthKeyLength is the longest auth key a legacy client may send.
+const maxAuthKeyLength = 2048
+
+// doLegacyHandshake performs the handshake of the V0_3 and V0_4 protocols,
+// whose magic number has already been read. The client sends an auth key,
+// which is the password of the admin user, and the magic number of its wire
+// protocol, which must be JSON. The server replies with a null-terminated
+// "SUCCESS" or error message.
+func doLegacyHandshake(conn net.Conn, reader *bufio.Reader, userStore *users.Store, failures *AuthFailures) (string, error) {
+	var lengthBuf [4]byte
+	if _, err := io.ReadFull(reader, lengthBuf[:]); err != nil {
+		return "", fmt.Errorf("unable to read auth key length into buffer: %s", err)
+	}
+	length := binary.LittleEndian.Uint32(lengthBuf[:])
+	if length > maxAuthKeyLength {
+		writeLegacyError(conn, "Client provided an authorization key that is too long.")
+		return "", fmt.Errorf("auth key too long: %d bytes", length)
+	}
+	authKey := make([]byte, length)
+	if _, err := io.ReadFull(reader, authKey); err != nil {
+		return "", fmt.Errorf("unable to read auth key into buffer: %s", err)
+	}
+
+	var protocolBuf [4]byte
+	if _, err := io.ReadFull(reader, protocolBuf[:]); err != nil {
+		return "", fmt.Errorf("unable to read protocol magic number into buffer: %s", err)
+	}
+	protocol := ql2.VersionDummy_Protocol(binary.LittleEndian.Uint32(protocolBuf[:]))
+	if protocol != ql2.VersionDummy_JSON {
+		writeLegacyError(conn, "The PROTOBUF client protocol is not supported; use the JSON protocol.")
+		return "", fmt.Errorf("unsupported protocol magic number: %d", protocol)
+	}
+
+	admin, err := userStore.Get(users.Admin)
+	if err != nil {
+		return "", fmt.Errorf("unable to look up the admin user: %s", err)
+	}
+	if admin == nil || !admin.Credentials.VerifyPassword(string(authKey)) {
+		time.Sleep(failures.Fail(conn.RemoteAddr()))
+		writeLegacyError(conn, "Incorrect authorization key.")
+		return "", fmt.Errorf("incorrect auth key")
+	}
+	failures.Succeed(conn.RemoteAddr())
+
+	if _, err := conn.Write([]byte("SUCCESS\x00")); err != nil {
+		return "", fmt.Errorf("unable to write handshake response: %s", err)
+	}
+	return users.Admin, nil
+}
+
+// writeLegacyError sends a legacy client the reason its handshake failed.
+// The connection is closed after, so an error writing it is ignored.
+func writeLegacyError(conn net.Conn, message string) {
+	conn.Write([]byte("ERROR: " + message + "\n\x00"))
+}
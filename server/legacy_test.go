@@ -0,0 +1,77 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/users"
+)
+
+// legacyHandshake sends the handshake of a legacy client and returns the
+// server's reply and result.
+func legacyHandshake(t *testing.T, userStore *users.Store, version ql2.VersionDummy_Version, authKey string, protocol ql2.VersionDummy_Protocol) (string, string, error) {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	type result struct {
+		user string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		user, err := DoHandshake(serverConn, bufio.NewReader(serverConn), userStore, nil)
+		done <- result{user, err}
+		serverConn.Close()
+	}()
+
+	msg := make([]byte, 0, 12+len(authKey))
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(version))
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(len(authKey)))
+	msg = append(msg, authKey...)
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(protocol))
+	if _, err := clientConn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := bufio.NewReader(clientConn).ReadString('\x00')
+	if err != nil {
+		t.Fatalf("unable to read handshake reply: %s", err)
+	}
+	r := <-done
+	return reply, r.user, r.err
+}
+
+func TestLegacyHandshake(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	userStore, err := users.Open(db, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, version := range []ql2.VersionDummy_Version{ql2.VersionDummy_V0_3, ql2.VersionDummy_V0_4} {
+		reply, user, err := legacyHandshake(t, userStore, version, "secret", ql2.VersionDummy_JSON)
+		if err != nil || reply != "SUCCESS\x00" || user != users.Admin {
+			t.Errorf("expected %s to authenticate as admin but got %q, %q, %v", version, reply, user, err)
+		}
+	}
+
+	reply, _, err := legacyHandshake(t, userStore, ql2.VersionDummy_V0_4, "wrong", ql2.VersionDummy_JSON)
+	if err == nil || reply != "ERROR: Incorrect authorization key.\n\x00" {
+		t.Errorf("expected an incorrect auth key to fail but got %q, %v", reply, err)
+	}
+	reply, _, err = legacyHandshake(t, userStore, ql2.VersionDummy_V0_4, "secret", ql2.VersionDummy_PROTOBUF)
+	if err == nil || reply[:6] != "ERROR:" {
+		t.Errorf("expected the protobuf protocol to fail but got %q, %v", reply, err)
+	}
+}
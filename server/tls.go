@@ -0,0 +1,58 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSOptions names the files which configure TLS on a port: the server's
+// certificate and private key, and optionally the certificates of the
+// authorities whose client certificates are accepted.
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// CAFile, if set, requires clients to present a certificate signed by
+	// one of the authorities it holds.
+	CAFile string
+}
+
+// Enabled reports whether TLS is configured.
+func (o TLSOptions) Enabled() bool {
+	return o.CertFile != "" || o.KeyFile != "" || o.CAFile != ""
+}
+
+// TLSConfig returns the TLS configuration of a port, or nil if TLS is not
+// enabled. It serves the driver port and may serve any other port, such as
+// an HTTP port, with the same certificates.
+func TLSConfig(opts TLSOptions) (*tls.Config, error) {
+	if !opts.Enabled() {
+		return nil, nil
+	}
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, fmt.Errorf("TLS requires both a certificate and a key file")
+	}
+	cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load TLS certificate: %s", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read TLS CA file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS CA file %s", opts.CAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a generated certificate and its key, signed by its parent or
+// by itself if it has none.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, name string, isCA bool, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write writes the certificate and key as PEM files, returning their paths.
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+// handshake performs a TLS handshake between the given configurations,
+// returning the client's error.
+func handshake(server, client *tls.Config) error {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn := tls.Server(serverConn, server)
+		err := conn.Handshake()
+		if err == nil {
+			// TLS 1.3 clients only learn that their certificate was
+			// rejected when they read from the connection.
+			_, err = conn.Write([]byte{0})
+		}
+		serverErr <- err
+		conn.Close()
+	}()
+	conn := tls.Client(clientConn, client)
+	err := conn.Handshake()
+	if err == nil {
+		_, err = conn.Read(make([]byte, 1))
+	}
+	if err != nil {
+		return err
+	}
+	return <-serverErr
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", true, nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCert := newTestCert(t, "localhost", false, ca)
+	certFile, keyFile := serverCert.write(t, dir, "server")
+	clientCert := newTestCert(t, "client", false, ca)
+
+	if config, err := TLSConfig(TLSOptions{}); config != nil || err != nil {
+		t.Errorf("expected no TLS configuration but got %v, %v", config, err)
+	}
+	if _, err := TLSConfig(TLSOptions{CertFile: certFile}); err == nil {
+		t.Error("expected a certificate without a key to fail")
+	}
+	if _, err := TLSConfig(TLSOptions{CertFile: certFile, KeyFile: keyFile, CAFile: filepath.Join(dir, "missing.crt")}); err == nil {
+		t.Error("expected a missing CA file to fail")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	config, err := TLSConfig(TLSOptions{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handshake(config, &tls.Config{RootCAs: roots, ServerName: "localhost"}); err != nil {
+		t.Errorf("unable to connect with TLS: %s", err)
+	}
+
+	config, err = TLSConfig(TLSOptions{CertFile: certFile, KeyFile: keyFile, CAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handshake(config, &tls.Config{RootCAs: roots, ServerName: "localhost"}); err == nil {
+		t.Error("expected a client without a certificate to be rejected")
+	}
+	client := &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: []tls.Certificate{clientCert.tlsCertificate()}}
+	if err := handshake(config, client); err != nil {
+		t.Errorf("unable to connect with a client certificate: %s", err)
+	}
+}
@@ -0,0 +1,215 @@
+// Package stats counts the queries, connections and document reads and
+// writes of a server, which are listed in the stats system table.
+package stats
+
+import (
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// meter counts events in total and in the last complete second.
+type meter struct {
+	total int64
+	// second is the Unix time of the second counted by current, and
+	// previous counts the second before it.
+	second            int64
+	current, previous int64
+}
+
+// roll moves the counts of the current second into the previous one once
+// the given time is past it.
+func (m *meter) roll(now time.Time) {
+	second := now.Unix()
+	switch second {
+	case m.second:
+	case m.second + 1:
+		m.previous, m.current = m.current, 0
+	default:
+		m.previous, m.current = 0, 0
+	}
+	m.second = second
+}
+
+func (m *meter) add(now time.Time, n int64) {
+	m.roll(now)
+	m.total += n
+	m.current += n
+}
+
+func (m *meter) rate(now time.Time) Rate {
+	m.roll(now)
+	return Rate{PerSec: float64(m.previous), Total: m.total}
+}
+
+// Rate is a count of events in the last second and in total.
+type Rate struct {
+	PerSec float64
+	Total  int64
+}
+
+// Docs counts the documents read and written.
+type Docs struct {
+	Read, Written Rate
+}
+
+// TableStats counts the documents read and written in a table and through
+// each of its secondary indexes.
+type TableStats struct {
+	Docs
+	Indexes map[string]Docs
+}
+
+// Snapshot holds the counters of a server at one time.
+type Snapshot struct {
+	Queries Rate
+	Docs
+	ClientConnections, ClientsActive int
+	// Tables holds the counters of each table which has been read or
+	// written, by table ID.
+	Tables map[string]TableStats
+	// Bolt holds the statistics of the bolt database, including the totals
+	// of the statistics of its transactions.
+	Bolt bolt.Stats
+}
+
+type tableMeters struct {
+	read, written meter
+	indexes       map[string]*indexMeters
+}
+
+type indexMeters struct {
+	read, written meter
+}
+
+// Stats holds the counters of a server.
+type Stats struct {
+	db  *bolt.DB
+	now func() time.Time
+
+	mu            sync.Mutex
+	queries       meter
+	read, written meter
+	connections   int
+	activeClients int
+	tables        map[string]*tableMeters
+}
+
+// New returns the counters of a server which stores its data in the given
+// bolt database.
+func New(db *bolt.DB) *Stats {
+	return &Stats{db: db, now: time.Now, tables: map[string]*tableMeters{}}
+}
+
+// Connected counts a client connection until it is disconnected.
+func (s *Stats) Connected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connections++
+}
+
+func (s *Stats) Disconnected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connections--
+}
+
+// ClientActive counts a client connection as active, which it is while it
+// has queries running, until ClientIdle is called.
+func (s *Stats) ClientActive() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activeClients++
+}
+
+func (s *Stats) ClientIdle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activeClients--
+}
+
+// Query counts a query.
+func (s *Stats) Query() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries.add(s.now(), 1)
+}
+
+// tableIndex returns the meters of a table, or of one of its secondary
+// indexes if index is not empty.
+func (s *Stats) tableIndex(table, index string) (read, written *meter) {
+	t, ok := s.tables[table]
+	if !ok {
+		t = &tableMeters{indexes: map[string]*indexMeters{}}
+		s.tables[table] = t
+	}
+	if index == "" {
+		return &t.read, &t.written
+	}
+	i, ok := t.indexes[index]
+	if !ok {
+		i = &indexMeters{}
+		t.indexes[index] = i
+	}
+	return &i.read, &i.written
+}
+
+// Read counts documents read from the table with the given ID through the
+// named secondary index, or the primary key if index is empty. Reads of
+// system tables, which have no ID, are only counted in the server's totals.
+func (s *Stats) Read(table, index string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if table != "" {
+		read, _ := s.tableIndex(table, index)
+		read.add(now, int64(n))
+	}
+	if index == "" {
+		s.read.add(now, int64(n))
+	}
+}
+
+// Written counts documents written to the table with the given ID, or to
+// the named secondary index of it.
+func (s *Stats) Written(table, index string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if table != "" {
+		_, written := s.tableIndex(table, index)
+		written.add(now, int64(n))
+	}
+	if index == "" {
+		s.written.add(now, int64(n))
+	}
+}
+
+// Snapshot returns the current counters.
+func (s *Stats) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	snapshot := Snapshot{
+		Queries:           s.queries.rate(now),
+		Docs:              Docs{Read: s.read.rate(now), Written: s.written.rate(now)},
+		ClientConnections: s.connections,
+		ClientsActive:     s.activeClients,
+		Tables:            make(map[string]TableStats, len(s.tables)),
+	}
+	for id, t := range s.tables {
+		table := TableStats{
+			Docs:    Docs{Read: t.read.rate(now), Written: t.written.rate(now)},
+			Indexes: make(map[string]Docs, len(t.indexes)),
+		}
+		for name, i := range t.indexes {
+			table.Indexes[name] = Docs{Read: i.read.rate(now), Written: i.written.rate(now)}
+		}
+		snapshot.Tables[id] = table
+	}
+	if s.db != nil {
+		snapshot.Bolt = s.db.Stats()
+	}
+	return snapshot
+}
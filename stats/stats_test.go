@@ -0,0 +1,59 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRates(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s := New(nil)
+	s.now = func() time.Time { return now }
+
+	s.Query()
+	s.Read("users", "", 3)
+	s.Read("users", "email", 2)
+	s.Written("users", "", 1)
+	s.Read("", "", 4)
+
+	// Rates count the last complete second.
+	snapshot := s.Snapshot()
+	if snapshot.Queries != (Rate{PerSec: 0, Total: 1}) {
+		t.Errorf("unexpected query rate %v", snapshot.Queries)
+	}
+	now = now.Add(time.Second)
+	snapshot = s.Snapshot()
+	if snapshot.Queries != (Rate{PerSec: 1, Total: 1}) {
+		t.Errorf("unexpected query rate %v", snapshot.Queries)
+	}
+	if snapshot.Read != (Rate{PerSec: 7, Total: 7}) || snapshot.Written != (Rate{PerSec: 1, Total: 1}) {
+		t.Errorf("unexpected document rates %v", snapshot.Docs)
+	}
+	users := snapshot.Tables["users"]
+	if users.Read != (Rate{PerSec: 3, Total: 3}) || users.Indexes["email"].Read != (Rate{PerSec: 2, Total: 2}) {
+		t.Errorf("unexpected table rates %v", users)
+	}
+	if len(snapshot.Tables) != 1 {
+		t.Errorf("expected only reads of the users table to be counted by table but got %v", snapshot.Tables)
+	}
+
+	now = now.Add(5 * time.Second)
+	if snapshot := s.Snapshot(); snapshot.Read != (Rate{PerSec: 0, Total: 7}) {
+		t.Errorf("expected no reads in the last second but got %v", snapshot.Read)
+	}
+}
+
+func TestClients(t *testing.T) {
+	s := New(nil)
+	s.Connected()
+	s.Connected()
+	s.ClientActive()
+	s.Disconnected()
+	if snapshot := s.Snapshot(); snapshot.ClientConnections != 1 || snapshot.ClientsActive != 1 {
+		t.Errorf("expected one connection, which is active, but got %d and %d", snapshot.ClientConnections, snapshot.ClientsActive)
+	}
+	s.ClientIdle()
+	if snapshot := s.Snapshot(); snapshot.ClientsActive != 0 {
+		t.Errorf("expected no active clients but got %d", snapshot.ClientsActive)
+	}
+}
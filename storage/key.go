@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// The tags which begin the encoding of each type of key, in the order of the
+// types in ReQL. The end of an array is marked by a zero byte, which sorts
+// before any of them.
+const (
+	arrayEnd   = 0x00
+	arrayTag   = 0x11
+	boolTag    = 0x12
+	numberTag  = 0x14
+	binaryTag  = 0x16
+	timeTag    = 0x18
+	stringTag  = 0x19
+	escapeByte = 0x00
+)
+
+// EncodeKey encodes a primary key or the value of a secondary index as bytes
+// which sort in the same order as the values do in ReQL. No encoding is a
+// prefix of another, so an index entry may be followed by the primary key of
+// its row. Only arrays, booleans, numbers, binary values, strings and times
+// may be keys.
+func EncodeKey(d values.Datum) ([]byte, *values.Error) {
+	var buf bytes.Buffer
+	if err := encodeKey(&buf, d); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeKey(buf *bytes.Buffer, d values.Datum) *values.Error {
+	switch {
+	case d.IsArray():
+		buf.WriteByte(arrayTag)
+		for _, item := range d.AsArray().Items() {
+			if err := encodeKey(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(arrayEnd)
+	case d.IsBool():
+		buf.WriteByte(boolTag)
+		if d.AsBool().Value() {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case d.IsNumber():
+		buf.WriteByte(numberTag)
+		encodeNumber(buf, d.AsNumber().Float64())
+	case d.IsBinary():
+		buf.WriteByte(binaryTag)
+		encodeBytes(buf, d.AsBinary().Data())
+	case d.IsTime():
+		buf.WriteByte(timeTag)
+		encodeNumber(buf, d.AsTime().EpochTime())
+	case d.IsString():
+		buf.WriteByte(stringTag)
+		encodeBytes(buf, []byte(d.AsString().Value()))
+	default:
+		return values.NewError(ql2.Response_QUERY_LOGIC, "Cannot use %s as a key.", typeName(d))
+	}
+	return nil
+}
+
+// encodeNumber writes a float as 8 bytes which sort in numeric order: the
+// sign bit is flipped for positive numbers, and every bit for negative ones.
+func encodeNumber(buf *bytes.Buffer, f float64) {
+	if f == 0 {
+		f = 0 // -0 is equal to 0.
+	}
+	bits := math.Float64bits(f)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], bits)
+	buf.Write(b[:])
+}
+
+// encodeBytes writes bytes terminated by two zero bytes, escaping each zero
+// byte as a zero followed by 0xff, which keeps their order.
+func encodeBytes(buf *bytes.Buffer, data []byte) {
+	for _, c := range data {
+		buf.WriteByte(c)
+		if c == escapeByte {
+			buf.WriteByte(0xff)
+		}
+	}
+	buf.WriteByte(escapeByte)
+	buf.WriteByte(0)
+}
+
+func typeName(d values.Datum) string {
+	switch {
+	case d.IsMinVal():
+		return "MINVAL"
+	case d.IsMaxVal():
+		return "MAXVAL"
+	case d.IsNull():
+		return "NULL"
+	case d.IsGeometry():
+		return "PTYPE<GEOMETRY>"
+	}
+	return "OBJECT"
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/jlhawn/reboltdb/json"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func parseDatum(t *testing.T, data string) values.Datum {
+	val, err := json.Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("unable to parse %s: %s", data, err)
+	}
+	return values.FromJSON(val)
+}
+
+func TestEncodeKeyOrder(t *testing.T) {
+	// The keys are in ReQL order.
+	keys := []string{
+		`[]`, `[-1]`, `[-1, "a"]`, `[0]`, `[0, 0]`, `["a"]`,
+		`false`, `true`,
+		`-1e300`, `-2.5`, `-1`, `0`, `1e-300`, `1`, `2.5`, `1e300`,
+		`{"$reql_type$": "BINARY", "data": ""}`,
+		`{"$reql_type$": "BINARY", "data": "AA=="}`,
+		`{"$reql_type$": "BINARY", "data": "AAE="}`,
+		`{"$reql_type$": "BINARY", "data": "AQ=="}`,
+		`{"$reql_type$": "TIME", "epoch_time": -5, "timezone": "+00:00"}`,
+		`{"$reql_type$": "TIME", "epoch_time": 5, "timezone": "-07:00"}`,
+		`""`, `"\u0000"`, `"\u0000a"`, `"a"`, `"a\u0000"`, `"ab"`, `"b"`,
+	}
+	var prev values.Datum
+	var prevKey []byte
+	for _, data := range keys {
+		d := parseDatum(t, data)
+		k, err := EncodeKey(d)
+		if err != nil {
+			t.Fatalf("unable to encode %s: %s", data, err.Message)
+		}
+		if prev != nil {
+			if values.Compare(prev, d) >= 0 {
+				t.Fatalf("expected %v to sort before %s", prev, data)
+			}
+			if bytes.Compare(prevKey, k) >= 0 {
+				t.Errorf("expected the key of %v to sort before that of %s", prev, data)
+			}
+			if bytes.HasPrefix(k, prevKey) {
+				t.Errorf("expected the key of %v not to be a prefix of that of %s", prev, data)
+			}
+		}
+		prev, prevKey = d, k
+	}
+
+	negZero, _ := EncodeKey(values.NewNumber(math.Copysign(0, -1)))
+	zero, _ := EncodeKey(values.NewNumber(0))
+	if !bytes.Equal(negZero, zero) {
+		t.Errorf("expected -0 and 0 to have the same key")
+	}
+
+	for _, data := range []string{`null`, `{"a": 1}`, `[{"a": 1}]`} {
+		if _, err := EncodeKey(parseDatum(t, data)); err == nil {
+			t.Errorf("expected %s not to be a key", data)
+		}
+	}
+}
@@ -0,0 +1,849 @@
+// Package storage stores the rows of tables, and their secondary indexes, in
+// a bolt database.
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/feed"
+	"github.com/jlhawn/reboltdb/geo"
+	rjson "github.com/jlhawn/reboltdb/json"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// The data of each table is kept in a bucket named by its ID in the data
+// bucket, which holds its rows keyed by primary key, the definitions of its
+// indexes, and a bucket of entries for each index.
+var (
+	dataBucketName    = []byte("table_data")
+	rowsBucketName    = []byte("rows")
+	indexesBucketName = []byte("indexes")
+	entriesBucketName = []byte("index_entries")
+)
+
+// Index is a secondary index of a table.
+type Index struct {
+	Name string `json:"name"`
+	// Function is the JSON encoding of the FUNC term of the index, from
+	// which it is compiled.
+	Function []byte `json:"function"`
+	// Query is the readable form of the index.
+	Query string `json:"query"`
+	// Multi is set if the rows are indexed by each element of the array
+	// returned by the function rather than by the array itself.
+	Multi bool `json:"multi"`
+	// Geo is set if the rows are indexed by geometries, which are stored
+	// by the cells which cover them rather than as keys.
+	Geo bool `json:"geo"`
+}
+
+// Compiler compiles the function of an index or write hook from its source.
+type Compiler func(source []byte) (values.Function, *values.Error)
+
+// HookRunner runs a write hook on a write of a row, at the given time, to a
+// table with the given primary key. It returns the document to write instead
+// of the new value, which is null to delete the row.
+type HookRunner func(hook *values.WriteHook, primaryKey string, timestamp time.Time, oldVal, newVal values.Datum) (values.Datum, *values.Error)
+
+// WriteHook is the write hook of a table.
+type WriteHook struct {
+	// Function is the JSON encoding of the FUNC term of the hook, from
+	// which it is compiled.
+	Function []byte
+	// Query is the readable form of the hook.
+	Query string
+}
+
+// Store holds the data of every table. The changes made to the rows of each
+// table are published to its broker, under the ID of the table, once the
+// transaction which makes them commits.
+type Store struct {
+	db      *bolt.DB
+	compile Compiler
+	runHook HookRunner
+	broker  *feed.Broker
+
+	mu sync.Mutex
+	// functions holds the compiled index functions by source.
+	functions map[string]values.Function
+}
+
+// Open opens the table data of the given database, which compiles index
+// functions and write hooks with the given function and runs write hooks
+// with the given runner.
+func Open(db *bolt.DB, compile Compiler, runHook HookRunner) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(dataBucketName)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create table data bucket: %s", err)
+	}
+	return &Store{db: db, compile: compile, runHook: runHook, broker: feed.NewBroker(), functions: map[string]values.Function{}}, nil
+}
+
+// Table returns the data of the table with the given ID, which is named as
+// given in errors. Each row written to it is run through its write hook, if
+// hook is not nil.
+func (s *Store) Table(id, name, primaryKey string, hook *WriteHook) *Table {
+	return &Table{store: s, id: []byte(id), name: name, primaryKey: primaryKey, hook: hook}
+}
+
+// DropTable deletes the data of the table with the given ID.
+func (s *Store) DropTable(id string) *values.Error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(dataBucketName)
+		if data.Bucket([]byte(id)) == nil {
+			return nil
+		}
+		return data.DeleteBucket([]byte(id))
+	})
+	if err != nil {
+		return values.NewError(ql2.Response_OP_FAILED, "Unable to drop table data: %s", err)
+	}
+	return nil
+}
+
+// Usage is the space used by the data of a table in the bolt database.
+type Usage struct {
+	// DataBytes is the space used by the leaf pages of the rows and index
+	// entries of the table, and MetadataBytes by their branch pages.
+	DataBytes, MetadataBytes int
+	// GarbageBytes is the space allocated to those pages but unused.
+	GarbageBytes int
+}
+
+// Usage returns the space used by the data of the table with the given ID,
+// which is none if nothing has been written to it.
+func (s *Store) Usage(id string) (usage Usage, verr *values.Error) {
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(dataBucketName).Bucket([]byte(id))
+		if b == nil {
+			return nil
+		}
+		st := b.Stats()
+		usage.DataBytes = st.LeafInuse + st.InlineBucketInuse
+		usage.MetadataBytes = st.BranchInuse
+		usage.GarbageBytes = st.LeafAlloc + st.BranchAlloc - st.LeafInuse - st.BranchInuse
+		return nil
+	})
+	if err != nil {
+		return usage, values.NewError(ql2.Response_OP_FAILED, "Unable to read table data: %s", err)
+	}
+	return usage, nil
+}
+
+func (s *Store) function(source []byte) (values.Function, *values.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fn, ok := s.functions[string(source)]; ok {
+		return fn, nil
+	}
+	fn, err := s.compile(source)
+	if err != nil {
+		return nil, err
+	}
+	s.functions[string(source)] = fn
+	return fn, nil
+}
+
+// Table is the data of a table.
+type Table struct {
+	store      *Store
+	id         []byte
+	name       string
+	primaryKey string
+	hook       *WriteHook
+}
+
+// view runs a read transaction on the bucket of the table, which is nil if
+// nothing has been written to it.
+func (t *Table) view(fn func(b *bolt.Bucket) error) *values.Error {
+	return t.result("read", t.store.db.View(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(dataBucketName).Bucket(t.id))
+	}))
+}
+
+// update runs a write transaction on the bucket of the table, which is
+// created if it does not exist.
+func (t *Table) update(fn func(b *bolt.Bucket) error) *values.Error {
+	return t.result("write", t.store.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(dataBucketName).CreateBucketIfNotExists(t.id)
+		if err != nil {
+			return err
+		}
+		for _, name := range [][]byte{rowsBucketName, indexesBucketName, entriesBucketName} {
+			if _, err := b.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return fn(b)
+	}))
+}
+
+// result returns the error of a transaction as a query error.
+func (t *Table) result(op string, err error) *values.Error {
+	if verr, ok := err.(*values.Error); ok {
+		return verr
+	}
+	if err != nil {
+		return values.NewError(ql2.Response_OP_FAILED, "Unable to %s table `%s`: %s", op, t.name, err)
+	}
+	return nil
+}
+
+func decodeRow(data []byte) (values.Datum, error) {
+	val, err := rjson.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode row: %s", err)
+	}
+	return values.FromJSON(val), nil
+}
+
+func getRow(b *bolt.Bucket, pk []byte) (values.Datum, error) {
+	data := b.Bucket(rowsBucketName).Get(pk)
+	if data == nil {
+		return nil, nil
+	}
+	return decodeRow(data)
+}
+
+// Get returns the row with the given primary key, or nil if there is none.
+func (t *Table) Get(key values.Datum) (row values.Datum, verr *values.Error) {
+	pk, verr := EncodeKey(key)
+	if verr != nil {
+		return nil, nil
+	}
+	verr = t.view(func(b *bolt.Bucket) (err error) {
+		if b != nil {
+			row, err = getRow(b, pk)
+		}
+		return err
+	})
+	return row, verr
+}
+
+// Rows returns every row of the table, ordered by primary key.
+func (t *Table) Rows() (rows []values.Datum, verr *values.Error) {
+	verr = t.view(func(b *bolt.Bucket) error {
+		if b == nil {
+			return nil
+		}
+		return b.Bucket(rowsBucketName).ForEach(func(_, v []byte) error {
+			row, err := decodeRow(v)
+			rows = append(rows, row)
+			return err
+		})
+	})
+	return rows, verr
+}
+
+// Count returns the number of rows of the table.
+func (t *Table) Count() (n int, verr *values.Error) {
+	verr = t.view(func(b *bolt.Bucket) error {
+		if b != nil {
+			n = b.Bucket(rowsBucketName).Stats().KeyN
+		}
+		return nil
+	})
+	return n, verr
+}
+
+// Write writes the row with the given primary key, or deletes it if newVal
+// is nil, as WriteFunc does.
+func (t *Table) Write(key, newVal values.Datum) (written values.Datum, indexes []string, verr *values.Error) {
+	_, written, indexes, verr = t.WriteFunc(key, func(values.Datum) (values.Datum, *values.Error) {
+		return newVal, nil
+	})
+	return written, indexes, verr
+}
+
+// WriteFunc writes the row with the given primary key as the given function
+// returns it, or deletes it if the function returns nil, and updates the
+// entries of every index. The function is given the current row, or nil if
+// there is none, and is called in the same transaction as the write, so that
+// concurrent writes to a row cannot be lost. Nothing is written if the row
+// does not change or the function returns an error. The write hook of the
+// table, if it has one, is run in the same transaction and may change what
+// is written. It returns the old row and the row as written, either of which
+// is nil if there is none, and the names of the indexes whose entries for
+// the row changed.
+func (t *Table) WriteFunc(key values.Datum, change func(oldVal values.Datum) (values.Datum, *values.Error)) (oldVal, written values.Datum, indexes []string, verr *values.Error) {
+	pk, verr := EncodeKey(key)
+	if verr != nil {
+		return nil, nil, nil, verr
+	}
+	verr = t.update(func(b *bolt.Bucket) error {
+		var err error
+		if oldVal, err = getRow(b, pk); err != nil {
+			return err
+		}
+		newVal, verr := change(oldVal)
+		if verr != nil {
+			return verr
+		}
+		written = newVal
+		if (oldVal == nil && newVal == nil) || (oldVal != nil && newVal != nil && values.Equal(oldVal, newVal)) {
+			return nil
+		}
+		if t.hook != nil {
+			if written, err = t.runHook(oldVal, newVal); err != nil {
+				return err
+			}
+		}
+		var encoded []byte
+		if written != nil {
+			if encoded, verr = values.ToJSON(written); verr != nil {
+				return verr
+			}
+		}
+		all, err := listIndexes(b)
+		if err != nil {
+			return err
+		}
+		indexes = nil
+		for _, index := range all {
+			changed, err := t.updateEntries(b, index, pk, oldVal, written)
+			if err != nil {
+				return err
+			}
+			if changed {
+				indexes = append(indexes, index.Name)
+			}
+		}
+		changed := oldVal != nil || written != nil
+		if oldVal != nil && written != nil {
+			changed = !values.Equal(oldVal, written)
+		}
+		if changed {
+			t.store.broker.Record(b.Tx(), feed.Change{Table: string(t.id), OldVal: oldVal, NewVal: written})
+		}
+		if written == nil {
+			return b.Bucket(rowsBucketName).Delete(pk)
+		}
+		return b.Bucket(rowsBucketName).Put(pk, encoded)
+	})
+	if verr != nil {
+		return nil, nil, nil, verr
+	}
+	return oldVal, written, indexes, nil
+}
+
+// runHook runs the write hook of the table on a write of a row, and returns
+// the row to write instead, or nil to delete it.
+func (t *Table) runHook(oldVal, newVal values.Datum) (values.Datum, error) {
+	fn, verr := t.store.function(t.hook.Function)
+	if verr != nil {
+		return nil, verr
+	}
+	hook := &values.WriteHook{Function: fn, Source: t.hook.Function, Query: t.hook.Query}
+	row, verr := t.store.runHook(hook, t.primaryKey, time.Now(), oldVal, newVal)
+	if verr != nil {
+		return nil, verr
+	}
+	if row.IsNull() {
+		return nil, nil
+	}
+	return row, nil
+}
+
+// Subscribe returns a feed of the changes to the rows of the table which are
+// described by the given subscription, whatever table it names.
+func (t *Table) Subscribe(sub feed.Subscription) values.Feed {
+	sub.DB, sub.Table = "", string(t.id)
+	return t.store.broker.Subscribe(sub)
+}
+
+// updateEntries replaces the entries of an index for the old value of a row
+// with those for its new value, either of which may be nil, and reports
+// whether they differ.
+func (t *Table) updateEntries(b *bolt.Bucket, index Index, pk []byte, oldVal, newVal values.Datum) (bool, error) {
+	fn, verr := t.store.function(index.Function)
+	if verr != nil {
+		return false, verr
+	}
+	entries := b.Bucket(entriesBucketName).Bucket([]byte(index.Name))
+	if index.Geo {
+		var oldGeometries, newGeometries []geo.Geometry
+		if oldVal != nil {
+			oldGeometries = indexGeometries(index, fn, oldVal)
+		}
+		if newVal != nil {
+			newGeometries = indexGeometries(index, fn, newVal)
+		}
+		idx := geo.NewIndex(entries)
+		if err := idx.Delete(pk, oldGeometries...); err != nil {
+			return false, err
+		}
+		if len(newGeometries) > 0 {
+			if err := idx.Insert(pk, newGeometries...); err != nil {
+				return false, err
+			}
+		}
+		return !reflect.DeepEqual(oldGeometries, newGeometries), nil
+	}
+	var oldKeys, newKeys [][]byte
+	if oldVal != nil {
+		oldKeys = indexKeys(index, fn, oldVal)
+	}
+	if newVal != nil {
+		newKeys = indexKeys(index, fn, newVal)
+	}
+	for _, k := range oldKeys {
+		if err := entries.Delete(entryKey(k, pk)); err != nil {
+			return false, err
+		}
+	}
+	for _, k := range newKeys {
+		if err := entries.Put(entryKey(k, pk), pk); err != nil {
+			return false, err
+		}
+	}
+	return !sameKeys(oldKeys, newKeys), nil
+}
+
+// sameKeys reports whether two lists of encoded index keys are the same.
+func sameKeys(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexKeys returns the encoded values by which an index holds a row. Rows
+// for which the function fails, or returns a value which cannot be a key,
+// are not indexed, and a multi index holds a row by each distinct element of
+// the array which the function returns.
+func indexKeys(index Index, fn values.Function, row values.Datum) [][]byte {
+	val, err := fn.Call(row)
+	if err != nil || !val.IsDatum() {
+		return nil
+	}
+	d := val.(values.Datum)
+	items := []values.Datum{d}
+	if index.Multi && d.IsArray() {
+		items = d.AsArray().Items()
+	}
+	var keys [][]byte
+	for _, item := range items {
+		k, err := EncodeKey(item)
+		if err != nil {
+			continue
+		}
+		duplicate := false
+		for _, existing := range keys {
+			duplicate = duplicate || bytes.Equal(existing, k)
+		}
+		if !duplicate {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// indexGeometries returns the geometries by which a geo index holds a row,
+// which are the value the function returns or, for a multi index, the
+// elements of the array it returns. Values which are not geometries are not
+// indexed.
+func indexGeometries(index Index, fn values.Function, row values.Datum) []geo.Geometry {
+	val, err := fn.Call(row)
+	if err != nil || !val.IsDatum() {
+		return nil
+	}
+	d := val.(values.Datum)
+	items := []values.Datum{d}
+	if index.Multi && d.IsArray() {
+		items = d.AsArray().Items()
+	}
+	var geometries []geo.Geometry
+	for _, item := range items {
+		if item.IsGeometry() {
+			geometries = append(geometries, item.AsGeometry().Geo())
+		}
+	}
+	return geometries
+}
+
+// entryKey returns the key of the entry of an index which holds the row with
+// the given primary key by the given value.
+func entryKey(k, pk []byte) []byte {
+	entry := make([]byte, 0, len(k)+len(pk))
+	return append(append(entry, k...), pk...)
+}
+
+func listIndexes(b *bolt.Bucket) ([]Index, error) {
+	var indexes []Index
+	if b == nil {
+		return nil, nil
+	}
+	err := b.Bucket(indexesBucketName).ForEach(func(_, v []byte) error {
+		var index Index
+		if err := json.Unmarshal(v, &index); err != nil {
+			return fmt.Errorf("unable to decode index: %s", err)
+		}
+		indexes = append(indexes, index)
+		return nil
+	})
+	return indexes, err
+}
+
+// Indexes returns the indexes of the table, ordered by name.
+func (t *Table) Indexes() (indexes []Index, verr *values.Error) {
+	verr = t.view(func(b *bolt.Bucket) (err error) {
+		indexes, err = listIndexes(b)
+		return err
+	})
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+	return indexes, verr
+}
+
+// CreateIndex creates an index of the rows of the table, returning false if
+// there already is one with the same name.
+func (t *Table) CreateIndex(index Index) (created bool, verr *values.Error) {
+	encoded, err := json.Marshal(index)
+	if err != nil {
+		return false, values.NewError(ql2.Response_OP_FAILED, "Unable to encode index `%s`: %s", index.Name, err)
+	}
+	verr = t.update(func(b *bolt.Bucket) error {
+		if b.Bucket(indexesBucketName).Get([]byte(index.Name)) != nil {
+			return nil
+		}
+		if _, err := b.Bucket(entriesBucketName).CreateBucket([]byte(index.Name)); err != nil {
+			return err
+		}
+		err := b.Bucket(rowsBucketName).ForEach(func(pk, v []byte) error {
+			row, err := decodeRow(v)
+			if err != nil {
+				return err
+			}
+			_, err = t.updateEntries(b, index, pk, nil, row)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		created = true
+		return b.Bucket(indexesBucketName).Put([]byte(index.Name), encoded)
+	})
+	return created, verr
+}
+
+// DropIndex drops the named index, returning false if there is none.
+func (t *Table) DropIndex(name string) (dropped bool, verr *values.Error) {
+	verr = t.update(func(b *bolt.Bucket) error {
+		if b.Bucket(indexesBucketName).Get([]byte(name)) == nil {
+			return nil
+		}
+		dropped = true
+		if err := b.Bucket(entriesBucketName).DeleteBucket([]byte(name)); err != nil {
+			return err
+		}
+		return b.Bucket(indexesBucketName).Delete([]byte(name))
+	})
+	return dropped, verr
+}
+
+// entries returns the entries of the named index, or an error if the table
+// has no such index or it is a geo index and isGeo is not set, or the
+// reverse.
+func (t *Table) entries(b *bolt.Bucket, name string, isGeo bool) (*bolt.Bucket, error) {
+	var entries *bolt.Bucket
+	var index Index
+	if b != nil {
+		if encoded := b.Bucket(indexesBucketName).Get([]byte(name)); encoded != nil {
+			if err := json.Unmarshal(encoded, &index); err != nil {
+				return nil, fmt.Errorf("unable to decode index: %s", err)
+			}
+			entries = b.Bucket(entriesBucketName).Bucket([]byte(name))
+		}
+	}
+	switch {
+	case entries == nil:
+		return nil, values.NewError(ql2.Response_OP_FAILED, "Index `%s` was not found on table `%s`.", name, t.name)
+	case index.Geo && !isGeo:
+		return nil, values.NewError(ql2.Response_QUERY_LOGIC, "Index `%s` is a geospatial index.  Only get_nearest and get_intersecting can use a geospatial index.", name)
+	case !index.Geo && isGeo:
+		return nil, values.NewError(ql2.Response_QUERY_LOGIC, "Index `%s` is not a geospatial index.  get_intersecting and get_nearest can only be used with a geospatial index.", name)
+	}
+	return entries, nil
+}
+
+// GetAll returns the rows which the named index holds by any of the given
+// keys, or those with any of the keys as their primary key if the name is
+// empty.
+func (t *Table) GetAll(index string, keys []values.Datum) (rows []values.Datum, verr *values.Error) {
+	if index == "" {
+		for _, key := range keys {
+			row, err := t.Get(key)
+			if err != nil {
+				return nil, err
+			}
+			if row != nil {
+				rows = append(rows, row)
+			}
+		}
+		return rows, nil
+	}
+	verr = t.view(func(b *bolt.Bucket) error {
+		entries, err := t.entries(b, index, false)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			prefix, verr := EncodeKey(key)
+			if verr != nil {
+				continue
+			}
+			c := entries.Cursor()
+			for k, pk := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, pk = c.Next() {
+				row, err := getRow(b, pk)
+				if err != nil {
+					return err
+				}
+				if row != nil {
+					rows = append(rows, row)
+				}
+			}
+		}
+		return nil
+	})
+	return rows, verr
+}
+
+// Between returns the rows with values of the named index, or primary keys if
+// the name is empty, between the given bounds, ordered by those values and
+// then by primary key. Either bound may be MINVAL or MAXVAL, and is excluded
+// if it is open.
+func (t *Table) Between(index string, lower, upper values.Datum, leftOpen, rightOpen bool) (rows []values.Datum, verr *values.Error) {
+	s, verr := t.Scan(index, lower, upper, leftOpen, rightOpen, false)
+	if verr != nil {
+		return nil, verr
+	}
+	for {
+		row, verr := s.Next()
+		if verr != nil || row == nil {
+			return rows, verr
+		}
+		rows = append(rows, row)
+	}
+}
+
+// scanBatchSize is the number of rows which a Scanner reads in each
+// transaction.
+const scanBatchSize = 100
+
+// Scanner reads the rows of a table in the order of an index, or of their
+// primary keys, in batches which are each read in their own transaction, so
+// that neither every row nor a transaction is held while they are read.
+type Scanner struct {
+	table              *Table
+	index              string
+	lowerKey, upperKey []byte
+	leftOpen           bool
+	rightOpen          bool
+	descending         bool
+	// last is the key of the last entry read, from which the next batch is
+	// read, or nil if none has been.
+	last []byte
+	rows []values.Datum
+	done bool
+}
+
+// Scan returns a Scanner of the rows which Between returns, which are read in
+// descending order if descending is set.
+func (t *Table) Scan(index string, lower, upper values.Datum, leftOpen, rightOpen, descending bool) (*Scanner, *values.Error) {
+	s := &Scanner{table: t, index: index, leftOpen: leftOpen, rightOpen: rightOpen, descending: descending}
+	var verr *values.Error
+	if !lower.IsMinVal() {
+		if s.lowerKey, verr = EncodeKey(lower); verr != nil {
+			return nil, verr
+		}
+	}
+	if !upper.IsMaxVal() {
+		if s.upperKey, verr = EncodeKey(upper); verr != nil {
+			return nil, verr
+		}
+	}
+	return s, nil
+}
+
+// Next returns the next row, or nil once every row has been read.
+func (s *Scanner) Next() (values.Datum, *values.Error) {
+	if len(s.rows) == 0 && !s.done {
+		if verr := s.table.view(s.read); verr != nil {
+			return nil, verr
+		}
+	}
+	if len(s.rows) == 0 {
+		return nil, nil
+	}
+	row := s.rows[0]
+	s.rows = s.rows[1:]
+	return row, nil
+}
+
+// read reads the next batch of rows from the bucket of the table.
+func (s *Scanner) read(b *bolt.Bucket) error {
+	if b == nil {
+		s.done = true
+		if s.index == "" {
+			return nil
+		}
+		_, err := s.table.entries(b, s.index, false)
+		return err
+	}
+	bucket := b.Bucket(rowsBucketName)
+	if s.index != "" {
+		var err error
+		if bucket, err = s.table.entries(b, s.index, false); err != nil {
+			return err
+		}
+	}
+	c := bucket.Cursor()
+	k, v := s.start(c)
+	for ; k != nil; k, v = s.advance(c) {
+		if len(s.rows) == scanBatchSize {
+			return nil
+		}
+		below := s.lowerKey != nil && (bytes.Compare(k, s.lowerKey) < 0 || (s.leftOpen && bytes.HasPrefix(k, s.lowerKey)))
+		above := s.upperKey != nil && ((s.rightOpen && bytes.HasPrefix(k, s.upperKey)) || (!bytes.HasPrefix(k, s.upperKey) && bytes.Compare(k, s.upperKey) > 0))
+		if (below && !s.descending) || (above && s.descending) {
+			// Entries before the start of the range are only
+			// passed over when reading in the other direction.
+			continue
+		}
+		if below || above {
+			break
+		}
+		s.last = append(s.last[:0], k...)
+		var row values.Datum
+		var err error
+		if s.index == "" {
+			row, err = decodeRow(v)
+		} else {
+			row, err = getRow(b, v)
+		}
+		if err != nil {
+			return err
+		}
+		if row != nil {
+			s.rows = append(s.rows, row)
+		}
+	}
+	s.done = true
+	return nil
+}
+
+// start positions the cursor at the first entry of the next batch.
+func (s *Scanner) start(c *bolt.Cursor) ([]byte, []byte) {
+	if s.descending {
+		var k []byte
+		switch {
+		case s.last != nil:
+			k, _ = c.Seek(s.last)
+		case s.upperKey != nil:
+			// Every entry with the upper bound as its prefix is within
+			// the range, if it is closed.
+			for k, _ = c.Seek(s.upperKey); k != nil && bytes.HasPrefix(k, s.upperKey); k, _ = c.Next() {
+			}
+		default:
+			return c.Last()
+		}
+		if k == nil {
+			return c.Last()
+		}
+		return c.Prev()
+	}
+	switch {
+	case s.last != nil:
+		k, v := c.Seek(s.last)
+		if k != nil && bytes.Equal(k, s.last) {
+			return c.Next()
+		}
+		return k, v
+	case s.lowerKey != nil:
+		return c.Seek(s.lowerKey)
+	}
+	return c.First()
+}
+
+// advance moves the cursor to the next entry in the order of the scan.
+func (s *Scanner) advance(c *bolt.Cursor) ([]byte, []byte) {
+	if s.descending {
+		return c.Prev()
+	}
+	return c.Next()
+}
+
+// GetIntersecting returns the rows which the named geo index holds by a
+// geometry which intersects the given one, ordered by primary key.
+func (t *Table) GetIntersecting(index string, g geo.Geometry) (rows []values.Datum, verr *values.Error) {
+	verr = t.view(func(b *bolt.Bucket) error {
+		entries, err := t.entries(b, index, true)
+		if err != nil {
+			return err
+		}
+		pks, err := geo.NewIndex(entries).Intersecting(g)
+		if err != nil {
+			return err
+		}
+		for _, pk := range pks {
+			row, err := getRow(b, pk)
+			if err != nil {
+				return err
+			}
+			if row != nil {
+				rows = append(rows, row)
+			}
+		}
+		return nil
+	})
+	return rows, verr
+}
+
+// Neighbor is a row found by GetNearest along with its distance.
+type Neighbor struct {
+	Row      values.Datum
+	Distance float64
+}
+
+// GetNearest returns up to maxResults rows which the named geo index holds
+// by a geometry within maxDist of the given point on the given ellipsoid,
+// ordered by distance.
+func (t *Table) GetNearest(index string, center geo.Point, e geo.Ellipsoid, maxDist float64, maxResults int) (neighbors []Neighbor, verr *values.Error) {
+	verr = t.view(func(b *bolt.Bucket) error {
+		entries, err := t.entries(b, index, true)
+		if err != nil {
+			return err
+		}
+		found, err := geo.NewIndex(entries).Nearest(center, e, maxDist, maxResults)
+		if err != nil {
+			return err
+		}
+		for _, neighbor := range found {
+			row, err := getRow(b, neighbor.Key)
+			if err != nil {
+				return err
+			}
+			if row != nil {
+				neighbors = append(neighbors, Neighbor{Row: row, Distance: neighbor.Distance})
+			}
+		}
+		return nil
+	})
+	return neighbors, verr
+}
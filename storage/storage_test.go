@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// fieldCompiler compiles the source of an index as the name of the field of
+// each row which it indexes.
+func fieldCompiler(source []byte) (values.Function, *values.Error) {
+	field := string(source)
+	return values.NewFunction(1, func(args ...values.Datum) (values.Top, *values.Error) {
+		val, ok := args[0].AsObject().Items()[field]
+		if !ok {
+			return nil, values.NewError(0, "No attribute `%s` in object.", field)
+		}
+		return val, nil
+	}), nil
+}
+
+func openTestTable(t *testing.T) (*Store, *Table) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s, err := Open(db, fieldCompiler, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, s.Table("table-id", "test.events", "id", nil)
+}
+
+func ids(rows []values.Datum) []string {
+	var ids []string
+	for _, row := range rows {
+		ids = append(ids, row.AsObject().Items()["id"].AsString().Value())
+	}
+	return ids
+}
+
+func expectIDs(t *testing.T, what string, rows []values.Datum, err *values.Error, expected ...string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unable to read %s: %s", what, err.Message)
+	}
+	actual := ids(rows)
+	if len(actual) != len(expected) {
+		t.Errorf("expected %s to be %v but got %v", what, expected, actual)
+		return
+	}
+	for i := range actual {
+		if actual[i] != expected[i] {
+			t.Errorf("expected %s to be %v but got %v", what, expected, actual)
+			return
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	s, table := openTestTable(t)
+	rows := []string{
+		`{"id": "c", "kind": "click", "tags": ["a", "b", "a"]}`,
+		`{"id": "a", "kind": "view", "tags": ["b"]}`,
+		`{"id": "b", "kind": "click"}`,
+		`{"id": "d", "kind": {"nested": true}}`,
+	}
+	for _, data := range rows {
+		row := parseDatum(t, data)
+		if _, _, err := table.Write(row.AsObject().Items()["id"], row); err != nil {
+			t.Fatal(err.Message)
+		}
+	}
+
+	// Rows written before an index is created are indexed by it.
+	if created, err := table.CreateIndex(Index{Name: "kind", Function: []byte("kind")}); err != nil || !created {
+		t.Fatalf("expected the index to be created: %v", err)
+	}
+	if created, _ := table.CreateIndex(Index{Name: "kind", Function: []byte("kind")}); created {
+		t.Error("expected the index to exist already")
+	}
+	if _, err := table.CreateIndex(Index{Name: "tags", Function: []byte("tags"), Multi: true}); err != nil {
+		t.Fatal(err.Message)
+	}
+
+	all, err := table.Rows()
+	expectIDs(t, "the rows", all, err, "a", "b", "c", "d")
+	if n, _ := table.Count(); n != 4 {
+		t.Errorf("expected 4 rows but counted %d", n)
+	}
+
+	clicks, err := table.GetAll("kind", []values.Datum{values.NewString("click")})
+	expectIDs(t, "the clicks", clicks, err, "b", "c")
+	tagged, err := table.GetAll("tags", []values.Datum{values.NewString("a")})
+	expectIDs(t, "the rows tagged a", tagged, err, "c")
+	tagged, err = table.GetAll("tags", []values.Datum{values.NewString("b")})
+	expectIDs(t, "the rows tagged b", tagged, err, "a", "c")
+	byKey, err := table.GetAll("", []values.Datum{values.NewString("d"), values.NewString("x"), values.NewString("a")})
+	expectIDs(t, "the rows by primary key", byKey, err, "d", "a")
+	if _, err := table.GetAll("missing", []values.Datum{values.NewString("a")}); err == nil {
+		t.Error("expected reading a missing index to fail")
+	}
+
+	// Rewriting and deleting rows updates the indexes.
+	_, indexes, err := table.Write(values.NewString("c"), parseDatum(t, `{"id": "c", "kind": "view"}`))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if !reflect.DeepEqual(indexes, []string{"kind", "tags"}) {
+		t.Errorf("expected both indexes to be written but got %v", indexes)
+	}
+	_, indexes, err = table.Write(values.NewString("b"), nil)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if !reflect.DeepEqual(indexes, []string{"kind"}) {
+		t.Errorf("expected only the kind index to be written but got %v", indexes)
+	}
+	if _, indexes, _ = table.Write(values.NewString("c"), parseDatum(t, `{"id": "c", "kind": "view", "seen": true}`)); len(indexes) != 0 {
+		t.Errorf("expected no index to be written but got %v", indexes)
+	}
+	clicks, err = table.GetAll("kind", []values.Datum{values.NewString("click")})
+	expectIDs(t, "the clicks", clicks, err)
+	tagged, err = table.GetAll("tags", []values.Datum{values.NewString("b")})
+	expectIDs(t, "the rows tagged b", tagged, err, "a")
+
+	views, err := table.Between("kind", values.NewString("view"), values.MaxVal{}, false, true)
+	expectIDs(t, "the views", views, err, "a", "c")
+	views, err = table.Between("kind", values.NewString("view"), values.MaxVal{}, true, true)
+	expectIDs(t, "the rows after views", views, err)
+	keys, err := table.Between("", values.MinVal{}, values.NewString("c"), false, false)
+	expectIDs(t, "the rows up to c", keys, err, "a", "c")
+	keys, err = table.Between("", values.NewString("a"), values.NewString("c"), true, true)
+	expectIDs(t, "the rows between a and c", keys, err)
+
+	if dropped, err := table.DropIndex("kind"); err != nil || !dropped {
+		t.Fatalf("expected the index to be dropped: %v", err)
+	}
+	if indexes, _ := table.Indexes(); len(indexes) != 1 || indexes[0].Name != "tags" {
+		t.Errorf("expected only the tags index to remain but got %v", indexes)
+	}
+
+	if usage, err := s.Usage("table-id"); err != nil || usage.DataBytes == 0 {
+		t.Errorf("expected the table to use space but got %+v (%v)", usage, err)
+	}
+	if err := s.DropTable("table-id"); err != nil {
+		t.Fatal(err.Message)
+	}
+	all, err = table.Rows()
+	expectIDs(t, "the rows of the dropped table", all, err)
+	if usage, _ := s.Usage("table-id"); usage != (Usage{}) {
+		t.Errorf("expected the dropped table to use no space but got %+v", usage)
+	}
+}
+
+func TestBinaryKeys(t *testing.T) {
+	_, table := openTestTable(t)
+	if _, err := table.CreateIndex(Index{Name: "thumb", Function: []byte("thumb")}); err != nil {
+		t.Fatal(err.Message)
+	}
+	row := parseDatum(t, `{"id": {"$reql_type$": "BINARY", "data": "AAEC"}, "thumb": {"$reql_type$": "BINARY", "data": "/wA="}}`)
+	key := row.AsObject().Items()["id"]
+	if _, _, err := table.Write(key, row); err != nil {
+		t.Fatal(err.Message)
+	}
+
+	stored, err := table.Get(key)
+	if err != nil || stored == nil || !values.Equal(stored, row) {
+		t.Fatalf("expected the row with a binary key to be stored but got %v (%v)", stored, err)
+	}
+	if !stored.AsObject().Items()["thumb"].IsBinary() {
+		t.Errorf("expected the binary field to be read as binary")
+	}
+	found, err := table.GetAll("thumb", []values.Datum{row.AsObject().Items()["thumb"]})
+	if err != nil || len(found) != 1 {
+		t.Errorf("expected the row to be found by its binary index value but got %v (%v)", found, err)
+	}
+	if missing, _ := table.Get(parseDatum(t, `{"$reql_type$": "BINARY", "data": "AAE="}`)); missing != nil {
+		t.Errorf("expected a prefix of the binary key not to match but got %v", missing)
+	}
+}
+
+func TestScan(t *testing.T) {
+	_, table := openTestTable(t)
+	if _, err := table.CreateIndex(Index{Name: "n", Function: []byte("n")}); err != nil {
+		t.Fatal(err.Message)
+	}
+	// More rows are written than are read in one batch.
+	const n = scanBatchSize*2 + 10
+	for i := 0; i < n; i++ {
+		row := values.NewObject(map[string]values.Datum{"id": values.NewNumber(float64(i)), "n": values.NewNumber(float64(n - i))})
+		if _, _, err := table.Write(row.Items()["id"], row); err != nil {
+			t.Fatal(err.Message)
+		}
+	}
+
+	scan := func(index string, lower, upper values.Datum, leftOpen, rightOpen, descending bool) []float64 {
+		t.Helper()
+		s, err := table.Scan(index, lower, upper, leftOpen, rightOpen, descending)
+		if err != nil {
+			t.Fatal(err.Message)
+		}
+		var ids []float64
+		for {
+			row, err := s.Next()
+			if err != nil {
+				t.Fatal(err.Message)
+			}
+			if row == nil {
+				return ids
+			}
+			ids = append(ids, row.AsObject().Items()["id"].AsNumber().Float64())
+		}
+	}
+	expect := func(what string, actual []float64, first, last float64) {
+		t.Helper()
+		step := 1.0
+		if last < first {
+			step = -1
+		}
+		if len(actual) != int((last-first)*step)+1 {
+			t.Fatalf("expected %s to read %v to %v but got %d rows", what, first, last, len(actual))
+		}
+		for i, id := range actual {
+			if id != first+float64(i)*step {
+				t.Fatalf("expected %s to read %v to %v but got %v", what, first, last, actual)
+			}
+		}
+	}
+
+	expect("every row", scan("", values.MinVal{}, values.MaxVal{}, false, false, false), 0, n-1)
+	expect("every row descending", scan("", values.MinVal{}, values.MaxVal{}, false, false, true), n-1, 0)
+	expect("a closed range", scan("", values.NewNumber(5), values.NewNumber(150), false, false, false), 5, 150)
+	expect("a closed range descending", scan("", values.NewNumber(5), values.NewNumber(150), false, false, true), 150, 5)
+	expect("an open range descending", scan("", values.NewNumber(5), values.NewNumber(150), true, true, true), 149, 6)
+	// The index orders the rows in reverse.
+	expect("the index", scan("n", values.MinVal{}, values.MaxVal{}, false, false, false), n-1, 0)
+	expect("the index descending", scan("n", values.MinVal{}, values.NewNumber(n), false, true, true), 1, n-1)
+
+	s, _ := table.Scan("missing", values.MinVal{}, values.MaxVal{}, false, false, false)
+	if _, err := s.Next(); err == nil {
+		t.Error("expected scanning a missing index to fail")
+	}
+}
@@ -0,0 +1,692 @@
+// Package system implements the rethinkdb database of virtual tables, which
+// describe and configure the server, its databases and tables, and its users.
+package system
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/catalog"
+	"github.com/jlhawn/reboltdb/jobs"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/stats"
+	"github.com/jlhawn/reboltdb/storage"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+// Server describes the server, which is the only server of its cluster.
+type Server struct {
+	ID, Name string
+	Hostname string
+	ReqlPort int
+	// CacheSizeMB is the configured cache size, or zero if it is chosen
+	// automatically.
+	CacheSizeMB float64
+	Version     string
+	Started     time.Time
+	// Argv is the command line of the process, with the values of secret
+	// options redacted.
+	Argv []string
+}
+
+// System resolves the databases and tables named in queries: those of the
+// catalog and the system tables of the rethinkdb database.
+type System struct {
+	catalog *catalog.Catalog
+	data    *storage.Store
+	users   *users.Store
+	jobs    *jobs.Registry
+	stats   *stats.Stats
+	server  Server
+	tables  map[string]*Table
+}
+
+// New returns the system database of a server with the given catalog, table
+// data, users, running jobs and counters.
+func New(c *catalog.Catalog, data *storage.Store, u *users.Store, j *jobs.Registry, st *stats.Stats, server Server) *System {
+	s := &System{catalog: c, data: data, users: u, jobs: j, stats: st, server: server}
+	s.tables = map[string]*Table{
+		"db_config":      s.systemTable("db_config", s.dbConfigRows, s.writeDBConfig),
+		"table_config":   s.systemTable("table_config", s.tableConfigRows, s.writeTableConfig),
+		"table_status":   s.systemTable("table_status", s.tableStatusRows, nil),
+		"server_config":  s.systemTable("server_config", s.serverConfigRows, nil),
+		"server_status":  s.systemTable("server_status", s.serverStatusRows, nil),
+		"cluster_config": s.systemTable("cluster_config", s.clusterConfigRows, nil),
+		"current_issues": s.systemTable("current_issues", noRows, nil),
+		"jobs":           s.systemTable("jobs", s.jobRows, s.writeJobs),
+		"stats":          s.systemTable("stats", s.statsRows, nil),
+		"logs":           s.systemTable("logs", noRows, nil),
+		"users":          s.systemTable("users", u.Rows, u.Write),
+		"permissions":    s.systemTable("permissions", s.permissionRows, nil),
+	}
+	return s
+}
+
+func (s *System) systemTable(name string, rows func() ([]values.Datum, *values.Error), write func(key, newVal values.Datum) *values.Error) *Table {
+	return &Table{id: name, dbID: catalog.SystemDB, db: catalog.SystemDB, name: name, primaryKey: "id", rows: rows, write: write, stats: s.stats}
+}
+
+func noRows() ([]values.Datum, *values.Error) { return nil, nil }
+
+// Database returns the named database.
+func (s *System) Database(name string) (values.Database, *values.Error) {
+	if name == catalog.SystemDB {
+		return values.NewDatabase(name, name), nil
+	}
+	db, err := s.catalog.Database(name)
+	if err != nil {
+		return nil, err
+	}
+	return values.NewDatabase(db.ID, db.Name), nil
+}
+
+// Table returns the named table of the named database.
+func (s *System) Table(dbName, name string) (values.Table, *values.Error) {
+	if dbName == catalog.SystemDB {
+		if table, ok := s.tables[name]; ok {
+			return table, nil
+		}
+		return nil, values.NewError(ql2.Response_OP_FAILED, "Table `%s.%s` does not exist.", dbName, name)
+	}
+	table, err := s.catalog.Table(dbName, name)
+	if err != nil {
+		return nil, err
+	}
+	data := s.tableData(table, dbName)
+	return &Table{
+		id: table.ID, dbID: table.DB, db: dbName, name: table.Name, primaryKey: table.PrimaryKey, stats: s.stats,
+		rows: data.Rows, data: data,
+		hook: table.WriteHook,
+		setHook: func(hook *catalog.WriteHook) *values.Error {
+			return s.catalog.SetWriteHook(table.ID, hook)
+		},
+	}, nil
+}
+
+func (s *System) tableData(table catalog.Table, dbName string) *storage.Table {
+	var hook *storage.WriteHook
+	if table.WriteHook != nil {
+		hook = &storage.WriteHook{Function: table.WriteHook.Function, Query: table.WriteHook.Query}
+	}
+	return s.data.Table(table.ID, dbName+"."+table.Name, table.PrimaryKey, hook)
+}
+
+// dropTable drops the table with the given ID and its data.
+func (s *System) dropTable(id string) *values.Error {
+	if err := s.catalog.DropTable(id); err != nil {
+		return err
+	}
+	return s.data.DropTable(id)
+}
+
+// dropDatabase drops the database with the given ID, its tables and their
+// data.
+func (s *System) dropDatabase(id string) *values.Error {
+	tables, err := s.catalog.Tables()
+	if err != nil {
+		return err
+	}
+	if err := s.catalog.DropDatabase(id); err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if table.DB != id {
+			continue
+		}
+		if err := s.data.DropTable(table.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DatabaseNames returns the sorted names of the databases, including the
+// system database.
+func (s *System) DatabaseNames() ([]string, *values.Error) {
+	dbs, err := s.catalog.Databases()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{catalog.SystemDB}
+	for _, db := range dbs {
+		names = append(names, db.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// TableNames returns the sorted names of the tables of the named database.
+func (s *System) TableNames(dbName string) ([]string, *values.Error) {
+	var names []string
+	if dbName == catalog.SystemDB {
+		for name := range s.tables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+	db, err := s.catalog.Database(dbName)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := s.catalog.Tables()
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range tables {
+		if table.DB == db.ID {
+			names = append(names, table.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CreateDatabase creates a database and returns its row of db_config.
+func (s *System) CreateDatabase(name string) (values.Datum, *values.Error) {
+	db, err := s.catalog.CreateDatabase(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.tables["db_config"].find(str(db.ID))
+}
+
+// DropDatabase drops the named database and its tables, and returns its row
+// of db_config and the number of tables dropped.
+func (s *System) DropDatabase(name string) (values.Datum, int, *values.Error) {
+	if name == catalog.SystemDB {
+		return nil, 0, values.NewError(ql2.Response_OP_FAILED, "Database `%s` is special; you can't delete it.", name)
+	}
+	db, err := s.catalog.Database(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	row, err := s.tables["db_config"].find(str(db.ID))
+	if err != nil {
+		return nil, 0, err
+	}
+	tables, err := s.TableNames(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return row, len(tables), s.dropDatabase(db.ID)
+}
+
+// CreateTable creates a table in the named database and returns its row of
+// table_config.
+func (s *System) CreateTable(dbName, name, primaryKey, durability string) (values.Datum, *values.Error) {
+	if dbName == catalog.SystemDB {
+		return nil, values.NewError(ql2.Response_OP_FAILED, "Database `%s` is special; you can't create new tables in it.", dbName)
+	}
+	table, err := s.catalog.CreateTable(dbName, name, primaryKey, durability)
+	if err != nil {
+		return nil, err
+	}
+	return s.tables["table_config"].find(str(table.ID))
+}
+
+// DropTable drops the named table and its data, and returns its row of
+// table_config.
+func (s *System) DropTable(dbName, name string) (values.Datum, *values.Error) {
+	if dbName == catalog.SystemDB {
+		return nil, values.NewError(ql2.Response_OP_FAILED, "Database `%s` is special; you can't delete tables in it.", dbName)
+	}
+	table, err := s.catalog.Table(dbName, name)
+	if err != nil {
+		return nil, err
+	}
+	row, err := s.tables["table_config"].find(str(table.ID))
+	if err != nil {
+		return nil, err
+	}
+	return row, s.dropTable(table.ID)
+}
+
+func str(s string) values.Datum { return values.NewString(s) }
+
+func num(n float64) values.Datum { return values.NewNumber(n) }
+
+func array(items ...values.Datum) values.Datum { return values.NewArray(items) }
+
+func object(items map[string]values.Datum) values.Datum { return values.NewObject(items) }
+
+// dbNames maps the IDs of the databases of the catalog to their names.
+func (s *System) dbNames() (map[string]string, *values.Error) {
+	dbs, err := s.catalog.Databases()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(dbs))
+	for _, db := range dbs {
+		names[db.ID] = db.Name
+	}
+	return names, nil
+}
+
+// permissionRows returns the rows of the permissions table, whose grants are
+// scoped by the IDs of databases and tables, and named here by their
+// current names.
+func (s *System) permissionRows() ([]values.Datum, *values.Error) {
+	dbNames, err := s.dbNames()
+	if err != nil {
+		return nil, err
+	}
+	dbNames[catalog.SystemDB] = catalog.SystemDB
+	tables, err := s.catalog.Tables()
+	if err != nil {
+		return nil, err
+	}
+	tableNames := make(map[string]string, len(tables)+len(s.tables))
+	for _, table := range tables {
+		tableNames[table.ID] = table.Name
+	}
+	for name := range s.tables {
+		tableNames[name] = name
+	}
+	return s.users.PermissionRows(func(dbID, tableID string) (string, string, bool) {
+		db, ok := dbNames[dbID]
+		if !ok || tableID == "" {
+			return db, "", ok
+		}
+		table, ok := tableNames[tableID]
+		return db, table, ok
+	})
+}
+
+func (s *System) dbConfigRows() ([]values.Datum, *values.Error) {
+	dbs, err := s.catalog.Databases()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]values.Datum, len(dbs))
+	for i, db := range dbs {
+		rows[i] = object(map[string]values.Datum{"id": str(db.ID), "name": str(db.Name)})
+	}
+	return rows, nil
+}
+
+// writeDBConfig renames or drops a database. Databases are created with
+// dbCreate rather than by inserting rows.
+func (s *System) writeDBConfig(key, newVal values.Datum) *values.Error {
+	id, old, err := s.findRow(s.tables["db_config"], key)
+	if err != nil {
+		return err
+	}
+	if newVal == nil {
+		return s.dropDatabase(id)
+	}
+	if err := checkUnchanged(old, newVal, "name"); err != nil {
+		return err
+	}
+	name, err := stringField(newVal, "name")
+	if err != nil {
+		return err
+	}
+	return s.catalog.RenameDatabase(id, name)
+}
+
+func (s *System) tableConfigRows() ([]values.Datum, *values.Error) {
+	tables, err := s.catalog.Tables()
+	if err != nil {
+		return nil, err
+	}
+	dbNames, err := s.dbNames()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]values.Datum, len(tables))
+	for i, table := range tables {
+		indexes, err := s.tableData(table, dbNames[table.DB]).Indexes()
+		if err != nil {
+			return nil, err
+		}
+		indexNames := make([]values.Datum, len(indexes))
+		for j, index := range indexes {
+			indexNames[j] = str(index.Name)
+		}
+		rows[i] = object(map[string]values.Datum{
+			"id":          str(table.ID),
+			"name":        str(table.Name),
+			"db":          str(dbNames[table.DB]),
+			"primary_key": str(table.PrimaryKey),
+			"durability":  str(table.Durability),
+			"write_acks":  str("majority"),
+			"indexes":     array(indexNames...),
+			"shards": array(object(map[string]values.Datum{
+				"primary_replica":    str(s.server.Name),
+				"replicas":           array(str(s.server.Name)),
+				"nonvoting_replicas": array(),
+			})),
+		})
+	}
+	return rows, nil
+}
+
+// writeTableConfig renames a table, changes its durability or drops it.
+// Tables are created with tableCreate rather than by inserting rows.
+func (s *System) writeTableConfig(key, newVal values.Datum) *values.Error {
+	id, old, err := s.findRow(s.tables["table_config"], key)
+	if err != nil {
+		return err
+	}
+	if newVal == nil {
+		return s.dropTable(id)
+	}
+	if err := checkUnchanged(old, newVal, "name", "durability"); err != nil {
+		return err
+	}
+
+	tables, err := s.catalog.Tables()
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if table.ID != id {
+			continue
+		}
+		if table.Name, err = stringField(newVal, "name"); err != nil {
+			return err
+		}
+		if table.Durability, err = stringField(newVal, "durability"); err != nil {
+			return err
+		}
+		return s.catalog.UpdateTable(table)
+	}
+	return values.NewError(ql2.Response_OP_FAILED, "Table `%s` does not exist.", id)
+}
+
+// findRow returns the ID and current value of the row of a config table
+// with the given primary key, which must exist.
+func (s *System) findRow(table *Table, key values.Datum) (string, values.Datum, *values.Error) {
+	row, err := table.find(key)
+	if err != nil {
+		return "", nil, err
+	}
+	if row == nil {
+		return "", nil, values.NewError(ql2.Response_OP_FAILED, "It's illegal to insert new rows into the `%s.%s` table.", table.db, table.name)
+	}
+	return key.AsString().Value(), row, nil
+}
+
+// checkUnchanged checks that a row of a config table changes none of the
+// fields of the current row other than those named.
+func checkUnchanged(old, newVal values.Datum, mutable ...string) *values.Error {
+	if !newVal.IsObject() {
+		return values.NewError(ql2.Response_QUERY_LOGIC, "Expected type OBJECT.")
+	}
+	isMutable := map[string]bool{}
+	for _, field := range mutable {
+		isMutable[field] = true
+	}
+	oldFields, newFields := old.AsObject().Items(), newVal.AsObject().Items()
+	for field, oldVal := range oldFields {
+		if newVal, ok := newFields[field]; !isMutable[field] && (!ok || !values.Equal(oldVal, newVal)) {
+			return values.NewError(ql2.Response_OP_FAILED, "It's illegal to change the `%s` field.", field)
+		}
+	}
+	for field := range newFields {
+		if _, ok := oldFields[field]; !ok {
+			return values.NewError(ql2.Response_OP_FAILED, "Unexpected field `%s`.", field)
+		}
+	}
+	return nil
+}
+
+func stringField(row values.Datum, field string) (string, *values.Error) {
+	val, ok := row.AsObject().Items()[field]
+	if !ok || !val.IsString() {
+		return "", values.NewError(ql2.Response_QUERY_LOGIC, "Expected a STRING for `%s`.", field)
+	}
+	return val.AsString().Value(), nil
+}
+
+func (s *System) tableStatusRows() ([]values.Datum, *values.Error) {
+	configs, err := s.tableConfigRows()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]values.Datum, len(configs))
+	for i, config := range configs {
+		fields := config.AsObject().Items()
+		rows[i] = object(map[string]values.Datum{
+			"id":          fields["id"],
+			"name":        fields["name"],
+			"db":          fields["db"],
+			"raft_leader": str(s.server.Name),
+			"status": object(map[string]values.Datum{
+				"all_replicas_ready":       values.NewBool(true),
+				"ready_for_outdated_reads": values.NewBool(true),
+				"ready_for_reads":          values.NewBool(true),
+				"ready_for_writes":         values.NewBool(true),
+			}),
+			"shards": array(object(map[string]values.Datum{
+				"primary_replicas": array(str(s.server.Name)),
+				"replicas":         array(object(map[string]values.Datum{"server": str(s.server.Name), "state": str("ready")})),
+			})),
+		})
+	}
+	return rows, nil
+}
+
+func (s *System) serverConfigRows() ([]values.Datum, *values.Error) {
+	return []values.Datum{object(map[string]values.Datum{
+		"id":            str(s.server.ID),
+		"name":          str(s.server.Name),
+		"tags":          array(str("default")),
+		"cache_size_mb": s.cacheSize(str("auto")),
+	})}, nil
+}
+
+// cacheSize returns the configured cache size, or the given value if it is
+// chosen automatically.
+func (s *System) cacheSize(auto values.Datum) values.Datum {
+	if s.server.CacheSizeMB == 0 {
+		return auto
+	}
+	return num(s.server.CacheSizeMB)
+}
+
+func (s *System) serverStatusRows() ([]values.Datum, *values.Error) {
+	started := values.TimeFromGo(s.server.Started.UTC())
+	argv := make([]values.Datum, len(s.server.Argv))
+	for i, arg := range s.server.Argv {
+		argv[i] = str(arg)
+	}
+	return []values.Datum{object(map[string]values.Datum{
+		"id":   str(s.server.ID),
+		"name": str(s.server.Name),
+		"network": object(map[string]values.Datum{
+			"hostname":            str(s.server.Hostname),
+			"reql_port":           num(float64(s.server.ReqlPort)),
+			"cluster_port":        values.Null{},
+			"http_admin_port":     str("<no http admin>"),
+			"canonical_addresses": array(object(map[string]values.Datum{"host": str(s.server.Hostname), "port": values.Null{}})),
+			"time_connected":      started,
+			"connected_to":        object(map[string]values.Datum{}),
+		}),
+		"process": object(map[string]values.Datum{
+			"argv":          array(argv...),
+			"cache_size_mb": s.cacheSize(values.Null{}),
+			"pid":           num(float64(os.Getpid())),
+			"time_started":  started,
+			"version":       str(s.server.Version),
+		}),
+	})}, nil
+}
+
+func (s *System) jobRows() ([]values.Datum, *values.Error) {
+	running := s.jobs.List()
+	rows := make([]values.Datum, len(running))
+	for i, job := range running {
+		rows[i] = object(map[string]values.Datum{
+			"id":           array(str("query"), str(job.ID)),
+			"type":         str("query"),
+			"duration_sec": num(job.Duration().Seconds()),
+			"servers":      array(str(s.server.Name)),
+			"info": object(map[string]values.Datum{
+				"client_address": str(job.ClientAddress),
+				"client_port":    num(float64(job.ClientPort)),
+				"token":          num(float64(job.Token)),
+				"query":          str(job.Query),
+				"user":           str(job.User),
+			}),
+		})
+	}
+	return rows, nil
+}
+
+// writeJobs interrupts the query of a job when its row is deleted.
+func (s *System) writeJobs(key, newVal values.Datum) *values.Error {
+	if newVal != nil {
+		return values.NewError(ql2.Response_OP_FAILED, "It's illegal to write to the `%s.jobs` table.", catalog.SystemDB)
+	}
+	if !key.IsArray() {
+		return nil
+	}
+	if parts := key.AsArray().Items(); len(parts) == 2 && parts[1].IsString() {
+		s.jobs.Interrupt(parts[1].AsString().Value(), jobs.ErrDeleted)
+	}
+	return nil
+}
+
+func (s *System) clusterConfigRows() ([]values.Datum, *values.Error) {
+	return []values.Datum{
+		object(map[string]values.Datum{"id": str("auth"), "auth_key": values.Null{}}),
+		object(map[string]values.Datum{"id": str("heartbeat"), "heartbeat_timeout_secs": num(10)}),
+	}, nil
+}
+
+// rate returns the fields of a rate of events named by prefix, which counts
+// them per second and in total.
+func rate(fields map[string]values.Datum, prefix string, r stats.Rate, total bool) {
+	fields[prefix+"_per_sec"] = num(r.PerSec)
+	if total {
+		fields[prefix+"_total"] = num(float64(r.Total))
+	}
+}
+
+func docsFields(docs stats.Docs, total bool) map[string]values.Datum {
+	fields := map[string]values.Datum{}
+	rate(fields, "read_docs", docs.Read, total)
+	rate(fields, "written_docs", docs.Written, total)
+	return fields
+}
+
+// statsRows returns the rows of the stats table, which are laid out as
+// RethinkDB's are: one for the cluster, one for the server and two for each
+// table. The server's row also holds the statistics of the bolt database.
+func (s *System) statsRows() ([]values.Datum, *values.Error) {
+	snapshot := s.stats.Snapshot()
+	tables, err := s.catalog.Tables()
+	if err != nil {
+		return nil, err
+	}
+	dbNames, err := s.dbNames()
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := docsFields(snapshot.Docs, false)
+	rate(cluster, "queries", snapshot.Queries, false)
+	cluster["client_connections"] = num(float64(snapshot.ClientConnections))
+	cluster["clients_active"] = num(float64(snapshot.ClientsActive))
+	server := docsFields(snapshot.Docs, true)
+	rate(server, "queries", snapshot.Queries, true)
+	server["client_connections"] = num(float64(snapshot.ClientConnections))
+	server["clients_active"] = num(float64(snapshot.ClientsActive))
+
+	rows := []values.Datum{
+		object(map[string]values.Datum{
+			"id":           array(str("cluster")),
+			"query_engine": object(cluster),
+		}),
+		object(map[string]values.Datum{
+			"id":           array(str("server"), str(s.server.ID)),
+			"server":       str(s.server.Name),
+			"query_engine": object(server),
+			"bolt":         boltStats(snapshot.Bolt),
+		}),
+	}
+	for _, table := range tables {
+		counts := snapshot.Tables[table.ID]
+		indexes := make(map[string]values.Datum, len(counts.Indexes))
+		for name, docs := range counts.Indexes {
+			indexes[name] = object(docsFields(docs, true))
+		}
+		tableServer := docsFields(counts.Docs, true)
+		tableServer["indexes"] = object(indexes)
+		engine, err := s.storageEngine(table.ID)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows,
+			object(map[string]values.Datum{
+				"id":           array(str("table"), str(table.ID)),
+				"table":        str(table.Name),
+				"db":           str(dbNames[table.DB]),
+				"query_engine": object(docsFields(counts.Docs, false)),
+			}),
+			object(map[string]values.Datum{
+				"id":             array(str("table_server"), str(table.ID), str(s.server.ID)),
+				"server":         str(s.server.Name),
+				"table":          str(table.Name),
+				"db":             str(dbNames[table.DB]),
+				"query_engine":   object(tableServer),
+				"storage_engine": engine,
+			}),
+		)
+	}
+	return rows, nil
+}
+
+// storageEngine returns the storage statistics of a table, which are the
+// space used by its data in the bolt database. Its cache and disk rates are
+// not counted, so are omitted.
+func (s *System) storageEngine(id string) (values.Datum, *values.Error) {
+	usage, err := s.data.Usage(id)
+	if err != nil {
+		return nil, err
+	}
+	return object(map[string]values.Datum{
+		"disk": object(map[string]values.Datum{
+			"space_usage": object(map[string]values.Datum{
+				"metadata_bytes":     num(float64(usage.MetadataBytes)),
+				"data_bytes":         num(float64(usage.DataBytes)),
+				"garbage_bytes":      num(float64(usage.GarbageBytes)),
+				"preallocated_bytes": num(0),
+			}),
+		}),
+	}), nil
+}
+
+// boltStats returns the fields of the statistics of a bolt database, with the
+// totals of the statistics of its transactions as `tx`.
+func boltStats(st bolt.Stats) values.Datum {
+	tx := st.TxStats
+	return object(map[string]values.Datum{
+		"free_page_n":    num(float64(st.FreePageN)),
+		"pending_page_n": num(float64(st.PendingPageN)),
+		"free_alloc":     num(float64(st.FreeAlloc)),
+		"freelist_inuse": num(float64(st.FreelistInuse)),
+		"tx_n":           num(float64(st.TxN)),
+		"open_tx_n":      num(float64(st.OpenTxN)),
+		"tx": object(map[string]values.Datum{
+			"page_count":     num(float64(tx.PageCount)),
+			"page_alloc":     num(float64(tx.PageAlloc)),
+			"cursor_count":   num(float64(tx.CursorCount)),
+			"node_count":     num(float64(tx.NodeCount)),
+			"node_deref":     num(float64(tx.NodeDeref)),
+			"rebalance":      num(float64(tx.Rebalance)),
+			"rebalance_time": num(tx.RebalanceTime.Seconds()),
+			"split":          num(float64(tx.Split)),
+			"spill":          num(float64(tx.Spill)),
+			"spill_time":     num(tx.SpillTime.Seconds()),
+			"write":          num(float64(tx.Write)),
+			"write_time":     num(tx.WriteTime.Seconds()),
+		}),
+	})
+}
@@ -0,0 +1,233 @@
+package system
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/jlhawn/reboltdb/catalog"
+	"github.com/jlhawn/reboltdb/jobs"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/stats"
+	"github.com/jlhawn/reboltdb/storage"
+	"github.com/jlhawn/reboltdb/users"
+)
+
+func newTestSystem(t *testing.T) (*System, *catalog.Catalog) {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	c, err := catalog.Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := users.Open(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := storage.Open(db, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(c, data, u, jobs.NewRegistry(), stats.New(db), Server{ID: c.ServerID(), Name: "test_server", Hostname: "test-server", ReqlPort: 28015, Version: "test", Started: time.Now()}), c
+}
+
+func readRows(t *testing.T, table values.Table) []values.Datum {
+	t.Helper()
+	var rows []values.Datum
+	stream := table.AsStream()
+	for {
+		row, err := stream.NextItem()
+		if err != nil {
+			t.Fatal(err.Message)
+		}
+		if row == nil {
+			return rows
+		}
+		rows = append(rows, row)
+	}
+}
+
+func field(row values.Datum, name string) string {
+	return row.AsObject().Items()[name].AsString().Value()
+}
+
+func TestTableConfig(t *testing.T) {
+	s, c := newTestSystem(t)
+	if _, err := c.CreateTable(catalog.DefaultDB, "users", "id", "hard"); err != nil {
+		t.Fatal(err.Message)
+	}
+
+	config, err := s.Table(catalog.SystemDB, "table_config")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	rows := readRows(t, config)
+	if len(rows) != 1 || field(rows[0], "db") != "test" || field(rows[0], "name") != "users" || field(rows[0], "primary_key") != "id" {
+		t.Fatalf("unexpected table_config rows %v", rows)
+	}
+	id := rows[0].AsObject().Items()["id"]
+
+	rename := values.NewObject(map[string]values.Datum{"id": id, "name": values.NewString("people")})
+	result := config.InsertObject(rename, "update", "hard", false).Items()
+	if result["replaced"].AsNumber().Float64() != 1 {
+		t.Fatalf("expected the table to be renamed but got %v", result)
+	}
+	if _, err := c.Table(catalog.DefaultDB, "people"); err != nil {
+		t.Errorf("expected the renamed table: %s", err.Message)
+	}
+
+	changeKey := values.NewObject(map[string]values.Datum{"id": id, "primary_key": values.NewString("name")})
+	result = config.InsertObject(changeKey, "update", "hard", false).Items()
+	if result["errors"].AsNumber().Float64() != 1 {
+		t.Errorf("expected changing the primary key to fail but got %v", result)
+	}
+
+	status, err := s.Table(catalog.SystemDB, "table_status")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if rows := readRows(t, status); len(rows) != 1 || field(rows[0], "name") != "people" {
+		t.Errorf("unexpected table_status rows %v", rows)
+	}
+
+	if result := config.Delete([]values.Datum{id}, "hard", false).Items(); result["deleted"].AsNumber().Float64() != 1 {
+		t.Fatalf("expected the table to be dropped but got %v", result)
+	}
+	if rows := readRows(t, config); len(rows) != 0 {
+		t.Errorf("expected the table to be dropped but got %v", rows)
+	}
+}
+
+func TestDBConfig(t *testing.T) {
+	s, c := newTestSystem(t)
+	config, err := s.Table(catalog.SystemDB, "db_config")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	rows := readRows(t, config)
+	if len(rows) != 1 || field(rows[0], "name") != "test" {
+		t.Fatalf("unexpected db_config rows %v", rows)
+	}
+
+	rename := values.NewObject(map[string]values.Datum{"id": rows[0].AsObject().Items()["id"], "name": values.NewString("rethinkdb")})
+	if result := config.InsertObject(rename, "replace", "hard", false).Items(); result["errors"].AsNumber().Float64() != 1 {
+		t.Errorf("expected renaming to the system database to fail but got %v", result)
+	}
+	insert := values.NewObject(map[string]values.Datum{"id": values.NewString("new"), "name": values.NewString("other")})
+	if result := config.InsertObject(insert, "error", "hard", false).Items(); result["errors"].AsNumber().Float64() != 1 {
+		t.Errorf("expected inserting a database to fail but got %v", result)
+	}
+	if _, err := c.Database("other"); err == nil {
+		t.Error("expected no database to be created")
+	}
+
+	if _, err := s.Table(catalog.SystemDB, "missing"); err == nil {
+		t.Error("expected a missing system table to fail")
+	}
+	if _, err := s.Database(catalog.SystemDB); err != nil {
+		t.Errorf("expected the system database: %s", err.Message)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	s, _ := newTestSystem(t)
+	job := s.jobs.Start(&jobs.Job{ClientAddress: "127.0.0.1", ClientPort: 40000, Token: 7, Query: "r.table(\"users\")", User: "admin"})
+
+	table, err := s.Table(catalog.SystemDB, "jobs")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	rows := readRows(t, table)
+	if len(rows) != 1 {
+		t.Fatalf("expected one job but got %v", rows)
+	}
+	info := rows[0].AsObject().Items()["info"]
+	if field(info, "query") != job.Query || field(info, "client_address") != "127.0.0.1" || info.AsObject().Items()["token"].AsNumber().Float64() != 7 {
+		t.Errorf("unexpected job row %v", rows[0])
+	}
+
+	result := table.Delete([]values.Datum{rows[0].AsObject().Items()["id"]}, "hard", false).Items()
+	if result["deleted"].AsNumber().Float64() != 1 {
+		t.Fatalf("expected the job to be deleted but got %v", result)
+	}
+	select {
+	case <-job.Interrupted():
+	default:
+		t.Error("expected the job to be interrupted")
+	}
+	if rows := readRows(t, table); len(rows) != 0 {
+		t.Errorf("expected no jobs but got %v", rows)
+	}
+}
+
+func TestStats(t *testing.T) {
+	s, c := newTestSystem(t)
+	users, err := c.CreateTable(catalog.DefaultDB, "users", "id", "hard")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	s.stats.Connected()
+
+	stored, err := s.Table(catalog.DefaultDB, "users")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	row := values.NewObject(map[string]values.Datum{"id": values.NewString("ada")})
+	if result := stored.InsertObject(row.AsObject(), "error", "hard", false); result.Items()["inserted"].AsNumber().Float64() != 1 {
+		t.Fatalf("expected the row to be inserted but got %v", result)
+	}
+
+	config, err := s.Table(catalog.SystemDB, "table_config")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	readRows(t, config)
+
+	table, err := s.Table(catalog.SystemDB, "stats")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	rows := map[string]values.Datum{}
+	for _, row := range readRows(t, table) {
+		encoded, err := values.ToJSON(row.AsObject().Items()["id"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows[string(encoded)] = row
+	}
+	if len(rows) != 4 {
+		t.Fatalf("expected rows for the cluster, server, table and table_server but got %v", rows)
+	}
+
+	server := rows[`["server","`+s.server.ID+`"]`]
+	if server == nil {
+		t.Fatalf("expected the server's row in %v", rows)
+	}
+	engine := server.AsObject().Items()["query_engine"].AsObject().Items()
+	if engine["client_connections"].AsNumber().Float64() != 1 || engine["read_docs_total"].AsNumber().Float64() != 1 {
+		t.Errorf("unexpected server query engine stats %v", engine)
+	}
+	if _, ok := server.AsObject().Items()["bolt"].AsObject().Items()["tx"]; !ok {
+		t.Errorf("expected bolt stats in %v", server)
+	}
+	tableServer := rows[`["table_server","`+users.ID+`","`+s.server.ID+`"]`]
+	if tableServer == nil || field(tableServer, "table") != "users" || field(tableServer, "db") != "test" {
+		t.Fatalf("unexpected table_server row %v", tableServer)
+	}
+	if written := tableServer.AsObject().Items()["query_engine"].AsObject().Items()["written_docs_total"]; written.AsNumber().Float64() != 1 {
+		t.Errorf("expected one row written to the table but got %v", written)
+	}
+	disk := tableServer.AsObject().Items()["storage_engine"].AsObject().Items()["disk"].AsObject().Items()
+	if used := disk["space_usage"].AsObject().Items()["data_bytes"]; used.AsNumber().Float64() == 0 {
+		t.Errorf("expected the table's data to use space but got %v", disk)
+	}
+	if rows[`["cluster"]`] == nil || rows[`["table","`+users.ID+`"]`] == nil {
+		t.Errorf("expected the cluster and table rows in %v", rows)
+	}
+}
@@ -0,0 +1,939 @@
+package system
+
+import (
+	"sort"
+	"sync"
+
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/catalog"
+	"github.com/jlhawn/reboltdb/feed"
+	"github.com/jlhawn/reboltdb/geo"
+	"github.com/jlhawn/reboltdb/query/values"
+	"github.com/jlhawn/reboltdb/stats"
+	"github.com/jlhawn/reboltdb/storage"
+)
+
+// Table is a table of rows stored by the storage package, or a virtual table
+// whose rows are generated when it is read, such as the system tables of the
+// rethinkdb database. Only stored tables have secondary indexes.
+type Table struct {
+	// id is the ID of the table in the catalog and dbID that of its
+	// database. System tables, which are not in the catalog, use their names.
+	id, dbID   string
+	db, name   string
+	primaryKey string
+	// rows returns the current rows of the table.
+	rows func() ([]values.Datum, *values.Error)
+	// write writes the row with the given primary key of a virtual table,
+	// or deletes it if newVal is nil. It is nil if the table is read-only.
+	write func(key, newVal values.Datum) *values.Error
+	// stats counts the documents read from and written to the table.
+	stats *stats.Stats
+	// data holds the rows and indexes of a stored table, which reads and
+	// writes them through it. It is nil for virtual tables.
+	data *storage.Table
+	// hook is the write hook of a stored table, which setHook replaces in
+	// the catalog.
+	hook    *catalog.WriteHook
+	setHook func(hook *catalog.WriteHook) *values.Error
+	// interrupted returns an error once the query reading the table has
+	// been interrupted, if it is not nil.
+	interrupted func() *values.Error
+}
+
+var _ values.Table = (*Table)(nil)
+
+func (t *Table) IsDatum() bool    { return false }
+func (t *Table) IsSequence() bool { return true }
+func (t *Table) IsDatabase() bool { return false }
+func (t *Table) IsFunction() bool { return false }
+func (t *Table) IsOrdering() bool { return false }
+func (t *Table) IsPathSpec() bool { return false }
+
+func (t *Table) IsArray() bool         { return false }
+func (t *Table) IsStream() bool        { return true }
+func (t *Table) AsArray() values.Array { return values.Array{} }
+
+// AsStream returns a new stream of the rows of the table.
+func (t *Table) AsStream() values.Stream { return t.stream(true, "", nil) }
+
+func (t *Table) IsSelectionStream() bool                   { return true }
+func (t *Table) AsSelectionStream() values.SelectionStream { return t.stream(true, "", nil) }
+
+// NextItem must not be called on the table itself, only on the streams
+// returned by AsStream.
+func (t *Table) NextItem() (values.Datum, *values.Error) {
+	return nil, values.NewError(ql2.Response_INTERNAL, "A table must be read through a stream.")
+}
+
+func (t *Table) Next() (values.Selection, *values.Error) {
+	return nil, values.NewError(ql2.Response_INTERNAL, "A table must be read through a stream.")
+}
+
+func (t *Table) Changes(options values.Object) (values.Feed, *values.Error) {
+	return t.subscribe(options, nil, t.stream(true, "", nil), false)
+}
+
+// subscribe returns a feed of the changes to the rows of a stored table which
+// are selected by the given function, or to every row if it is nil. The feed
+// begins with the rows of the initial stream if the options include them.
+func (t *Table) subscribe(options values.Object, selects func(row values.Datum) bool, initial values.Stream, atom bool) (values.Feed, *values.Error) {
+	if t.data == nil {
+		return nil, t.unsupported("changefeeds")
+	}
+	opts, err := feed.ParseOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	return t.data.Subscribe(feed.Subscription{PrimaryKey: t.primaryKey, Select: selects, Initial: initial, Atom: atom, Options: opts}), nil
+}
+
+func (t *Table) DB() string            { return t.db }
+func (t *Table) Table() string         { return t.name }
+func (t *Table) IsTable() bool         { return true }
+func (t *Table) AsTable() values.Table { return t }
+func (t *Table) Name() string          { return t.name }
+func (t *Table) ID() string            { return t.id }
+func (t *Table) DBID() string          { return t.dbID }
+func (t *Table) PrimaryKey() string    { return t.primaryKey }
+
+func (t *Table) WithInterrupt(interrupted func() *values.Error) values.Table {
+	copied := *t
+	copied.interrupted = interrupted
+	return &copied
+}
+
+func (t *Table) unsupported(what string) *values.Error {
+	return values.NewError(ql2.Response_OP_FAILED, "The table `%s.%s` does not support %s.", t.db, t.name, what)
+}
+
+func (t *Table) DocCountEstimate() int64 {
+	if t.data != nil {
+		n, _ := t.data.Count()
+		return int64(n)
+	}
+	rows, err := t.rows()
+	if err != nil {
+		return 0
+	}
+	return int64(len(rows))
+}
+
+// key returns the primary key of a row, or nil if it has none.
+func (t *Table) key(row values.Datum) values.Datum {
+	if !row.IsObject() {
+		return nil
+	}
+	return row.AsObject().Items()[t.primaryKey]
+}
+
+// selectRows returns a stream of the rows of the table which match the given
+// function, or of every row if it is nil, read through the named index.
+func (t *Table) selectRows(index string, match func(row values.Datum) bool) values.SelectionStream {
+	return t.stream(false, index, match)
+}
+
+// countRead counts rows read through the named index, or the primary key if
+// the name is empty.
+func (t *Table) countRead(index string, n int) {
+	if t.stats == nil || n == 0 {
+		return
+	}
+	if index == t.primaryKey {
+		index = ""
+	}
+	t.stats.Read(t.id, index, n)
+}
+
+// countWritten counts rows written to the named secondary index, or to the
+// table if the name is empty.
+func (t *Table) countWritten(index string, n int) {
+	if t.stats != nil {
+		t.stats.Written(t.id, index, n)
+	}
+}
+
+func (t *Table) find(key values.Datum) (values.Datum, *values.Error) {
+	if t.data != nil {
+		return t.data.Get(key)
+	}
+	rows, err := t.rows()
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if k := t.key(row); k != nil && values.Equal(k, key) {
+			return row, nil
+		}
+	}
+	return nil, nil
+}
+
+func (t *Table) Get(key values.Datum) values.Selection {
+	row, err := t.find(key)
+	if err != nil || row == nil {
+		return nil
+	}
+	t.countRead("", 1)
+	return selection{Object: row.AsObject(), table: t}
+}
+
+// GetChanges returns a feed of the changes to the row with the given primary
+// key, whose initial value is null if it does not exist.
+func (t *Table) GetChanges(key values.Datum, options values.Object) (values.Feed, *values.Error) {
+	read := false
+	initial := values.NewStream(func() (values.Datum, *values.Error) {
+		if read {
+			return nil, nil
+		}
+		read = true
+		row, err := t.find(key)
+		if err != nil || row != nil {
+			return row, err
+		}
+		return values.Null{}, nil
+	})
+	return t.subscribe(options, t.hasKey(key), initial, true)
+}
+
+// hasKey returns a function which reports whether a row has one of the given
+// primary keys.
+func (t *Table) hasKey(keys ...values.Datum) func(row values.Datum) bool {
+	return func(row values.Datum) bool {
+		k := t.key(row)
+		for _, key := range keys {
+			if k != nil && values.Equal(k, key) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// field returns the value of the named field of a row, which is the primary
+// key if the name is empty.
+func (t *Table) field(row values.Datum, name string) values.Datum {
+	if name == "" {
+		name = t.primaryKey
+	}
+	if !row.IsObject() {
+		return nil
+	}
+	return row.AsObject().Items()[name]
+}
+
+// secondaryIndex returns the name of the given index, or an empty name if it
+// is the primary key.
+func (t *Table) secondaryIndex(index string) string {
+	if index == t.primaryKey {
+		return ""
+	}
+	return index
+}
+
+func (t *Table) GetAll(keys []values.Datum, index string) values.SelectionStream {
+	if t.data != nil {
+		stream := t.streamRows(false, index, loadRows(func() ([]values.Datum, *values.Error) {
+			return t.data.GetAll(t.secondaryIndex(index), keys)
+		}))
+		if t.secondaryIndex(index) == "" {
+			stream.selects = t.hasKey(keys...)
+		}
+		return stream
+	}
+	return t.selectRows(index, func(row values.Datum) bool {
+		val := t.field(row, index)
+		for _, key := range keys {
+			if val != nil && values.Equal(val, key) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (t *Table) Between(lowerKey, upperKey values.Datum, index string, options values.Object) values.SelectionStream {
+	if t.data != nil {
+		leftOpen, rightOpen := openBounds(options)
+		stream := t.streamRows(false, index, t.scanRows(t.secondaryIndex(index), lowerKey, upperKey, leftOpen, rightOpen, false))
+		if t.secondaryIndex(index) == "" {
+			stream.selects = inRange(t.key, lowerKey, upperKey, options)
+		}
+		return stream
+	}
+	return t.selectRows(index, inRange(func(row values.Datum) values.Datum { return t.field(row, index) }, lowerKey, upperKey, options))
+}
+
+// openBounds returns whether the lower and upper bounds of a range are open,
+// as given by the `left_bound` and `right_bound` options.
+func openBounds(options values.Object) (leftOpen, rightOpen bool) {
+	leftOpen, rightOpen = false, true
+	if options != nil {
+		if bound, ok := options.Items()["left_bound"]; ok && bound.IsString() {
+			leftOpen = bound.AsString().Value() == "open"
+		}
+		if bound, ok := options.Items()["right_bound"]; ok && bound.IsString() {
+			rightOpen = bound.AsString().Value() == "open"
+		}
+	}
+	return leftOpen, rightOpen
+}
+
+// inRange returns a function which reports whether the key of a row is
+// between the given bounds, which are closed or open as given by the
+// `left_bound` and `right_bound` options.
+func inRange(key func(row values.Datum) values.Datum, lower, upper values.Datum, options values.Object) func(row values.Datum) bool {
+	leftOpen, rightOpen := openBounds(options)
+	return func(row values.Datum) bool {
+		k := key(row)
+		if k == nil {
+			return false
+		}
+		l, u := values.Compare(lower, k), values.Compare(k, upper)
+		return (l < 0 || (l == 0 && !leftOpen)) && (u < 0 || (u == 0 && !rightOpen))
+	}
+}
+
+// OrderBy orders the rows of the table by their primary keys or, if it is a
+// stored table, by a secondary index.
+func (t *Table) OrderBy(index string, descending bool, nextOrdering values.Ordering) (values.IndexOrderedSelectionStream, *values.Error) {
+	if t.data != nil {
+		return t.orderedRange(t.secondaryIndex(index), values.MinVal{}, values.MaxVal{}, false, false, descending), nil
+	}
+	if index != t.primaryKey {
+		return nil, values.NewError(ql2.Response_OP_FAILED, "Index `%s` was not found on table `%s.%s`.", index, t.db, t.name)
+	}
+	return &orderedStream{rowStream: t.stream(false, "", nil), descending: descending}, nil
+}
+
+// orderedRange returns a stream of the rows of a stored table with values of
+// the named index, or primary keys if the name is empty, between the given
+// bounds, which are read in order.
+func (t *Table) orderedRange(index string, lower, upper values.Datum, leftOpen, rightOpen, descending bool) *orderedStream {
+	return &orderedStream{
+		rowStream:  t.streamRows(false, index, t.scanRows(index, lower, upper, leftOpen, rightOpen, descending)),
+		index:      index,
+		descending: descending,
+		inOrder:    true,
+	}
+}
+
+func (t *Table) Distinct(index string) (values.Stream, *values.Error) {
+	return nil, t.unsupported("distinct")
+}
+
+// writeResult counts the outcomes of writes to the table.
+type writeResult struct {
+	inserted, replaced, unchanged, errors int
+	deleted, skipped                      int
+	firstError                            string
+	changes                               []values.Datum
+	// generatedKeys are the primary keys generated for inserted rows which
+	// had none.
+	generatedKeys []values.Datum
+}
+
+func (r *writeResult) fail(err *values.Error) {
+	if r.errors == 0 {
+		r.firstError = err.Message
+	}
+	r.errors++
+}
+
+func (r *writeResult) object(returnChanges bool) values.Object {
+	items := map[string]values.Datum{
+		"inserted":  values.NewNumber(float64(r.inserted)),
+		"replaced":  values.NewNumber(float64(r.replaced)),
+		"unchanged": values.NewNumber(float64(r.unchanged)),
+		"errors":    values.NewNumber(float64(r.errors)),
+		"deleted":   values.NewNumber(float64(r.deleted)),
+		"skipped":   values.NewNumber(float64(r.skipped)),
+	}
+	if r.errors > 0 {
+		items["first_error"] = values.NewString(r.firstError)
+	}
+	if returnChanges {
+		items["changes"] = values.NewArray(append([]values.Datum{}, r.changes...))
+	}
+	if len(r.generatedKeys) > 0 {
+		items["generated_keys"] = values.NewArray(r.generatedKeys)
+	}
+	return values.NewObject(items)
+}
+
+// change records the change of a row from oldVal to newVal, either of which
+// is nil if the row did not or does not exist.
+func (r *writeResult) change(oldVal, newVal values.Datum) {
+	if oldVal == nil {
+		oldVal = values.Null{}
+	}
+	if newVal == nil {
+		newVal = values.Null{}
+	}
+	r.changes = append(r.changes, values.NewObject(map[string]values.Datum{"old_val": oldVal, "new_val": newVal}))
+}
+
+// checkWritable returns an error if the table is read-only.
+func (t *Table) checkWritable() *values.Error {
+	if t.data == nil && t.write == nil {
+		return values.NewError(ql2.Response_OP_FAILED, "It's illegal to write to the `%s.%s` table.", t.db, t.name)
+	}
+	return nil
+}
+
+// virtualWrites serializes the writes to virtual tables, whose rows are read
+// and written by separate functions.
+var virtualWrites sync.Mutex
+
+// commit writes the row with the given primary key as the given function
+// returns it, or deletes it if the function returns nil, and records the
+// outcome. The function is given the current row, or nil if there is none,
+// and the row is read and written as one transaction so that concurrent
+// writes to it cannot be lost. The write hook of a stored table may change
+// what is written.
+func (t *Table) commit(key values.Datum, change func(oldVal values.Datum) (values.Datum, *values.Error), result *writeResult) {
+	var oldVal, written values.Datum
+	var indexes []string
+	var err *values.Error
+	if t.data != nil {
+		oldVal, written, indexes, err = t.data.WriteFunc(key, change)
+	} else {
+		oldVal, written, err = t.writeVirtual(key, change)
+	}
+	if err != nil {
+		result.fail(err)
+		return
+	}
+	switch {
+	case oldVal == nil && written == nil:
+		result.skipped++
+		return
+	case oldVal != nil && written != nil && values.Equal(oldVal, written):
+		result.unchanged++
+		return
+	case written == nil:
+		result.deleted++
+	case oldVal == nil:
+		result.inserted++
+	default:
+		result.replaced++
+	}
+	t.countWritten("", 1)
+	for _, index := range indexes {
+		t.countWritten(index, 1)
+	}
+	result.change(oldVal, written)
+}
+
+// writeVirtual writes a row of a virtual table as commit does, holding
+// virtualWrites while it does.
+func (t *Table) writeVirtual(key values.Datum, change func(oldVal values.Datum) (values.Datum, *values.Error)) (oldVal, newVal values.Datum, err *values.Error) {
+	virtualWrites.Lock()
+	defer virtualWrites.Unlock()
+	if oldVal, err = t.find(key); err != nil {
+		return nil, nil, err
+	}
+	if newVal, err = change(oldVal); err != nil {
+		return nil, nil, err
+	}
+	if (oldVal == nil && newVal == nil) || (oldVal != nil && newVal != nil && values.Equal(oldVal, newVal)) {
+		return oldVal, newVal, nil
+	}
+	if err = t.write(key, newVal); err != nil {
+		return nil, nil, err
+	}
+	return oldVal, newVal, nil
+}
+
+// insert writes one row as INSERT does, replacing or updating any row with
+// the same primary key as the conflict option says. A row of a stored table
+// which has no primary key is given a new one.
+func (t *Table) insert(obj values.Object, conflict string, result *writeResult) {
+	if err := t.checkWritable(); err != nil {
+		result.fail(err)
+		return
+	}
+	key, ok := obj.Items()[t.primaryKey]
+	if !ok && t.data != nil {
+		key = values.NewString(catalog.NewID())
+		items := make(map[string]values.Datum, len(obj.Items())+1)
+		for k, v := range obj.Items() {
+			items[k] = v
+		}
+		items[t.primaryKey] = key
+		obj = values.NewObject(items)
+		result.generatedKeys = append(result.generatedKeys, key)
+	} else if !ok {
+		result.fail(values.NewError(ql2.Response_OP_FAILED, "Rows of the `%s.%s` table must have a primary key `%s`.", t.db, t.name, t.primaryKey))
+		return
+	}
+
+	t.commit(key, func(oldVal values.Datum) (values.Datum, *values.Error) {
+		if oldVal == nil {
+			return obj, nil
+		}
+		switch conflict {
+		case "replace":
+			return obj, nil
+		case "update":
+			items := make(map[string]values.Datum, len(oldVal.AsObject().Items()))
+			for k, v := range oldVal.AsObject().Items() {
+				items[k] = v
+			}
+			for k, v := range obj.Items() {
+				items[k] = v
+			}
+			return values.NewObject(items), nil
+		}
+		encoded, _ := values.ToJSON(key)
+		return nil, values.NewError(ql2.Response_OP_FAILED, "Duplicate primary key `%s`: %s", t.primaryKey, encoded)
+	}, result)
+}
+
+func (t *Table) InsertObject(obj values.Object, conflict, durability string, returnChanges bool) values.Object {
+	var result writeResult
+	t.insert(obj, conflict, &result)
+	return result.object(returnChanges)
+}
+
+func (t *Table) InsertSequence(seq values.Sequence, conflict, durability string, returnChanges bool) values.Object {
+	var result writeResult
+	stream := seq.AsStream()
+	for {
+		item, err := stream.NextItem()
+		if err != nil {
+			result.fail(err)
+			break
+		}
+		if item == nil {
+			break
+		}
+		if !item.IsObject() {
+			result.fail(values.NewError(ql2.Response_QUERY_LOGIC, "Expected type OBJECT."))
+			continue
+		}
+		t.insert(item.AsObject(), conflict, &result)
+	}
+	return result.object(returnChanges)
+}
+
+func (t *Table) Delete(keys []values.Datum, durability string, returnChanges bool) values.Object {
+	var result writeResult
+	for _, key := range keys {
+		if err := t.checkWritable(); err != nil {
+			result.fail(err)
+			continue
+		}
+		t.commit(key, func(values.Datum) (values.Datum, *values.Error) { return nil, nil }, &result)
+	}
+	return result.object(returnChanges)
+}
+
+// Replace writes each row with one of the given primary keys as the given
+// function returns it, or deletes it if the function returns null. The
+// function is given the current row, or null if there is none. Unless
+// nonAtomic is set, it is called in the same transaction as the write.
+func (t *Table) Replace(keys []values.Datum, fn func(oldVal values.Datum) (values.Datum, *values.Error), nonAtomic bool, durability string, returnChanges bool) values.Object {
+	var result writeResult
+	for _, key := range keys {
+		if err := t.checkWritable(); err != nil {
+			result.fail(err)
+			continue
+		}
+		replace := func(oldVal values.Datum) (values.Datum, *values.Error) {
+			var arg values.Datum = values.Null{}
+			if oldVal != nil {
+				arg = oldVal
+			}
+			newVal, err := fn(arg)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case newVal.IsNull():
+				return nil, nil
+			case !newVal.IsObject() || newVal.IsTime() || newVal.IsBinary() || newVal.IsGeometry():
+				return nil, values.NewError(ql2.Response_QUERY_LOGIC, "Expected type OBJECT.")
+			}
+			if newKey, ok := newVal.AsObject().Items()[t.primaryKey]; !ok || !values.Equal(newKey, key) {
+				oldJSON, _ := values.ToJSON(arg)
+				newJSON, _ := values.ToJSON(newVal)
+				return nil, values.NewError(ql2.Response_OP_FAILED, "Primary key `%s` cannot be changed (`%s` -> `%s`).", t.primaryKey, oldJSON, newJSON)
+			}
+			return newVal, nil
+		}
+		if nonAtomic {
+			// The row is read, and the function called, before the
+			// transaction which writes it, so that the function may
+			// read and write tables.
+			oldVal, err := t.find(key)
+			if err != nil {
+				result.fail(err)
+				continue
+			}
+			newVal, err := replace(oldVal)
+			if err != nil {
+				result.fail(err)
+				continue
+			}
+			replace = func(values.Datum) (values.Datum, *values.Error) { return newVal, nil }
+		}
+		t.commit(key, replace, &result)
+	}
+	return result.object(returnChanges)
+}
+
+func (t *Table) Wait() values.Object {
+	return values.NewObject(map[string]values.Datum{"ready": values.NewNumber(1)})
+}
+
+func (t *Table) Sync() values.Object {
+	return values.NewObject(map[string]values.Datum{"synced": values.NewNumber(1)})
+}
+
+func (t *Table) IndexCreate(name string, indexFunc *values.IndexFunction, multi, geo bool) (values.Object, *values.Error) {
+	if t.data == nil {
+		return nil, t.unsupported("secondary indexes")
+	}
+	if name == t.primaryKey {
+		return nil, values.NewError(ql2.Response_OP_FAILED, "Index name conflict: `%s` is the name of the primary key.", name)
+	}
+	created, err := t.data.CreateIndex(storage.Index{Name: name, Function: indexFunc.Source, Query: indexFunc.Query, Multi: multi, Geo: geo})
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, values.NewError(ql2.Response_OP_FAILED, "Index `%s` already exists on table `%s.%s`.", name, t.db, t.name)
+	}
+	return values.NewObject(map[string]values.Datum{"created": values.NewNumber(1)}), nil
+}
+
+func (t *Table) GetIntersecting(geometry values.Geometry, index string) (values.SelectionStream, *values.Error) {
+	if t.data == nil {
+		return nil, t.unsupported("geo indexes")
+	}
+	rows, err := t.data.GetIntersecting(index, geometry.Geo())
+	if err != nil {
+		return nil, err
+	}
+	return t.streamRows(false, index, loadRows(func() ([]values.Datum, *values.Error) { return rows, nil })), nil
+}
+
+// GetNearest returns the rows nearest to a point as objects with the distance
+// in meters as `dist` and the row as `doc`, ordered by distance.
+func (t *Table) GetNearest(point values.Geometry, index string, e geo.Ellipsoid, maxDist float64, maxResults int) (values.Array, *values.Error) {
+	if t.data == nil {
+		return values.Array{}, t.unsupported("geo indexes")
+	}
+	neighbors, err := t.data.GetNearest(index, point.Geo().Rings[0][0], e, maxDist, maxResults)
+	if err != nil {
+		return values.Array{}, err
+	}
+	results := make([]values.Datum, len(neighbors))
+	for i, neighbor := range neighbors {
+		results[i] = values.NewObject(map[string]values.Datum{
+			"dist": values.NewNumber(neighbor.Distance),
+			"doc":  neighbor.Row,
+		})
+	}
+	t.countRead(index, len(results))
+	return values.NewArray(results), nil
+}
+
+func (t *Table) IndexDrop(name string) (values.Object, *values.Error) {
+	if t.data == nil {
+		return nil, t.unsupported("secondary indexes")
+	}
+	dropped, err := t.data.DropIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	if !dropped {
+		return nil, values.NewError(ql2.Response_OP_FAILED, "Index `%s` does not exist on table `%s.%s`.", name, t.db, t.name)
+	}
+	return values.NewObject(map[string]values.Datum{"dropped": values.NewNumber(1)}), nil
+}
+
+// indexes returns the secondary indexes of the table, ordered by name.
+func (t *Table) indexes() []storage.Index {
+	if t.data == nil {
+		return nil
+	}
+	indexes, _ := t.data.Indexes()
+	return indexes
+}
+
+func (t *Table) IndexList() values.Array {
+	names := []values.Datum{}
+	for _, index := range t.indexes() {
+		names = append(names, values.NewString(index.Name))
+	}
+	return values.NewArray(names)
+}
+
+// IndexStatus returns the status of the named indexes, or of every index if
+// none are named. Indexes are built when they are created, so every index is
+// ready.
+func (t *Table) IndexStatus(names ...string) values.Array {
+	statuses := []values.Datum{}
+	for _, index := range t.indexes() {
+		wanted := len(names) == 0
+		for _, name := range names {
+			wanted = wanted || name == index.Name
+		}
+		if !wanted {
+			continue
+		}
+		statuses = append(statuses, values.NewObject(map[string]values.Datum{
+			"index":    values.NewString(index.Name),
+			"ready":    values.NewBool(true),
+			"outdated": values.NewBool(false),
+			"multi":    values.NewBool(index.Multi),
+			"geo":      values.NewBool(index.Geo),
+			"function": values.NewBinary(index.Function),
+			"query":    values.NewString(index.Query),
+		}))
+	}
+	return values.NewArray(statuses)
+}
+
+func (t *Table) IndexWait(names ...string) values.Array { return t.IndexStatus(names...) }
+
+func (t *Table) IndexRename(oldName, newName string, overwrite bool) (values.Object, *values.Error) {
+	return nil, t.unsupported("secondary indexes")
+}
+
+// WriteHook returns the write hook of a stored table, without its compiled
+// function, or nil if it has none.
+func (t *Table) WriteHook() *values.WriteHook {
+	if t.hook == nil {
+		return nil
+	}
+	return &values.WriteHook{Source: t.hook.Function, Query: t.hook.Query}
+}
+
+// SetWriteHook stores the write hook of a stored table in its catalog entry,
+// or removes it if hook is nil.
+func (t *Table) SetWriteHook(hook *values.WriteHook) (values.Object, *values.Error) {
+	if t.setHook == nil {
+		return nil, t.unsupported("write hooks")
+	}
+	var stored *catalog.WriteHook
+	if hook != nil {
+		stored = &catalog.WriteHook{Function: hook.Source, Query: hook.Query}
+	}
+	if err := t.setHook(stored); err != nil {
+		return nil, err
+	}
+	result := "replaced"
+	switch {
+	case t.hook == nil && hook == nil:
+		result = "unchanged"
+	case t.hook == nil:
+		result = "created"
+	case hook == nil:
+		result = "deleted"
+	}
+	t.hook = stored
+	return values.NewObject(map[string]values.Datum{result: values.NewNumber(1)}), nil
+}
+
+// rowStream is a stream of some or all of the rows of a table, which are
+// read when the first is.
+type rowStream struct {
+	values.Stream
+	table   *Table
+	isTable bool
+	// selects reports whether a row of a stored table is one of those of
+	// the stream, to select the changes to them. It is nil if changes are
+	// only supported on the whole table.
+	selects func(row values.Datum) bool
+}
+
+// stream returns a stream of the rows of the table which match the given
+// function, or of every row if it is nil, counted as read through the named
+// index. The rows of a stored table are read as the stream is.
+func (t *Table) stream(isTable bool, index string, match func(row values.Datum) bool) *rowStream {
+	var next func() (values.Datum, *values.Error)
+	if t.data != nil {
+		next = t.scanRows("", values.MinVal{}, values.MaxVal{}, false, false, false)
+	} else {
+		next = loadRows(t.rows)
+	}
+	if match == nil {
+		return t.streamRows(isTable, index, next)
+	}
+	return t.streamRows(isTable, index, func() (values.Datum, *values.Error) {
+		for {
+			row, err := next()
+			if err != nil || row == nil || match(row) {
+				return row, err
+			}
+		}
+	})
+}
+
+// streamRows returns a stream of the rows returned by next, counting them as
+// read through the named index, which fails once the query reading it is
+// interrupted.
+func (t *Table) streamRows(isTable bool, index string, next func() (values.Datum, *values.Error)) *rowStream {
+	count := func() (values.Datum, *values.Error) {
+		if t.interrupted != nil {
+			if err := t.interrupted(); err != nil {
+				return nil, err
+			}
+		}
+		row, err := next()
+		if err == nil && row != nil {
+			t.countRead(index, 1)
+		}
+		return row, err
+	}
+	return &rowStream{Stream: values.NewStream(count), table: t, isTable: isTable}
+}
+
+// loadRows returns a function which returns each of the rows returned by
+// load, which is called when the first is read.
+func loadRows(load func() ([]values.Datum, *values.Error)) func() (values.Datum, *values.Error) {
+	var rows []values.Datum
+	loaded := false
+	return func() (values.Datum, *values.Error) {
+		if !loaded {
+			var err *values.Error
+			if rows, err = load(); err != nil {
+				return nil, err
+			}
+			loaded = true
+		}
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, nil
+	}
+}
+
+// scanRows returns a function which returns each of the rows of a stored
+// table which storage.Table.Scan reads with the given arguments.
+func (t *Table) scanRows(index string, lower, upper values.Datum, leftOpen, rightOpen, descending bool) func() (values.Datum, *values.Error) {
+	var scanner *storage.Scanner
+	return func() (values.Datum, *values.Error) {
+		if scanner == nil {
+			var err *values.Error
+			if scanner, err = t.data.Scan(index, lower, upper, leftOpen, rightOpen, descending); err != nil {
+				return nil, err
+			}
+		}
+		return scanner.Next()
+	}
+}
+
+func (s *rowStream) AsStream() values.Stream                   { return s }
+func (s *rowStream) IsSelectionStream() bool                   { return true }
+func (s *rowStream) AsSelectionStream() values.SelectionStream { return s }
+func (s *rowStream) DB() string                                { return s.table.db }
+func (s *rowStream) Table() string                             { return s.table.name }
+func (s *rowStream) IsTable() bool                             { return s.isTable }
+func (s *rowStream) AsTable() values.Table                     { return s.table }
+
+func (s *rowStream) Next() (values.Selection, *values.Error) {
+	row, err := s.NextItem()
+	if err != nil || row == nil {
+		return nil, err
+	}
+	return selection{Object: row.AsObject(), table: s.table}, nil
+}
+
+// Changes returns a feed of the changes to the whole table, or to a range of
+// primary keys or some of them, beginning with the rows of this stream if the
+// options include initial values.
+func (s *rowStream) Changes(options values.Object) (values.Feed, *values.Error) {
+	switch {
+	case s.isTable:
+		return s.table.subscribe(options, nil, s, false)
+	case s.selects == nil:
+		return nil, s.table.unsupported("changefeeds on this selection")
+	}
+	return s.table.subscribe(options, s.selects, s, false)
+}
+
+// orderedStream is a stream of the rows of a table ordered by primary key, or
+// by the named secondary index of a stored table. The rows of a stored table
+// are read in order while those of a virtual table are sorted once read.
+type orderedStream struct {
+	*rowStream
+	index      string
+	descending bool
+	inOrder    bool
+	sorted     []values.Datum
+	loaded     bool
+}
+
+func (s *orderedStream) AsStream() values.Stream                   { return s }
+func (s *orderedStream) AsSelectionStream() values.SelectionStream { return s }
+
+func (s *orderedStream) NextItem() (values.Datum, *values.Error) {
+	if s.inOrder {
+		return s.rowStream.NextItem()
+	}
+	if !s.loaded {
+		for {
+			row, err := s.rowStream.NextItem()
+			if err != nil {
+				return nil, err
+			}
+			if row == nil {
+				break
+			}
+			s.sorted = append(s.sorted, row)
+		}
+		sort.SliceStable(s.sorted, func(i, j int) bool {
+			c := values.Compare(s.table.key(s.sorted[i]), s.table.key(s.sorted[j]))
+			if s.descending {
+				return c > 0
+			}
+			return c < 0
+		})
+		s.loaded = true
+	}
+	if len(s.sorted) == 0 {
+		return nil, nil
+	}
+	row := s.sorted[0]
+	s.sorted = s.sorted[1:]
+	return row, nil
+}
+
+func (s *orderedStream) Next() (values.Selection, *values.Error) {
+	row, err := s.NextItem()
+	if err != nil || row == nil {
+		return nil, err
+	}
+	return selection{Object: row.AsObject(), table: s.table}, nil
+}
+
+func (s *orderedStream) Between(lowerKey, upperKey values.Datum, options values.Object) values.SelectionStream {
+	if s.inOrder {
+		leftOpen, rightOpen := openBounds(options)
+		return s.table.orderedRange(s.index, lowerKey, upperKey, leftOpen, rightOpen, s.descending)
+	}
+	match := inRange(s.table.key, lowerKey, upperKey, options)
+	return &orderedStream{rowStream: s.table.stream(false, "", match), descending: s.descending}
+}
+
+// selection is a single row of a table.
+type selection struct {
+	values.Object
+	table *Table
+}
+
+func (s selection) IsSelection() bool             { return true }
+func (s selection) AsSelection() values.Selection { return s }
+func (s selection) DB() string                    { return s.table.db }
+func (s selection) Table() string                 { return s.table.name }
+
+func (s selection) Changes(options values.Object) (values.Feed, *values.Error) {
+	return s.table.GetChanges(s.table.key(s.Object), options)
+}
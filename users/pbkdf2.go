@@ -0,0 +1,27 @@
+package users
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// pbkdf2SHA256 derives a key from a password as PBKDF2 does (RFC 8018) with
+// HMAC-SHA256 as its pseudorandom function. The key is a single block, the
+// size of a SHA256 hash, which is the salted password of SCRAM-SHA-256.
+func pbkdf2SHA256(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1}) // The index of the block.
+	u := mac.Sum(nil)
+
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
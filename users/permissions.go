@@ -0,0 +1,275 @@
+package users
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/catalog"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// Permission is something a user may be permitted to do.
+type Permission string
+
+const (
+	// Read permits reading the rows of tables.
+	Read Permission = "read"
+	// Write permits writing the rows of tables.
+	Write Permission = "write"
+	// Connect permits opening HTTP connections with r.http.
+	Connect Permission = "connect"
+	// Config permits configuring tables and databases, such as creating
+	// indexes, and granting permissions.
+	Config Permission = "config"
+)
+
+var permissionsBucketName = []byte("permissions")
+
+// Scope is the scope of a grant of permissions: every database but the system
+// database if DB is empty, every table of a database if Table is empty, or a
+// single table. DB and Table are IDs rather than names, so that a database or
+// table which is dropped and created again does not inherit the grants of the
+// old one.
+type Scope struct {
+	DB, Table string
+}
+
+// Global is the scope which encloses every database but the system database.
+var Global = Scope{}
+
+// enclosing returns the scopes which enclose this one, innermost first,
+// starting with this one. The system database is not enclosed by the global
+// scope, so its tables are only reached by grants on it or them.
+func (s Scope) enclosing() []Scope {
+	scopes := []Scope{s}
+	if s.Table != "" {
+		scopes = append(scopes, Scope{DB: s.DB})
+	}
+	if s.DB != "" && s.DB != catalog.SystemDB {
+		scopes = append(scopes, Global)
+	}
+	return scopes
+}
+
+// Permissions are the permissions granted to a user in a scope. Those which
+// are not set are inherited from the enclosing scope.
+type Permissions map[Permission]bool
+
+func (p Permissions) datum() values.Datum {
+	if len(p) == 0 {
+		return values.Null{}
+	}
+	items := make(map[string]values.Datum, len(p))
+	for perm, allowed := range p {
+		items[string(perm)] = values.NewBool(allowed)
+	}
+	return values.NewObject(items)
+}
+
+type grantKey struct {
+	User  string `json:"user"`
+	DB    string `json:"db,omitempty"`
+	Table string `json:"table,omitempty"`
+}
+
+func (k grantKey) encode() []byte {
+	encoded, _ := json.Marshal(k)
+	return encoded
+}
+
+func getPermissions(bucket *bolt.Bucket, key grantKey) (Permissions, error) {
+	encoded := bucket.Get(key.encode())
+	if encoded == nil {
+		return nil, nil
+	}
+	var perms Permissions
+	if err := json.Unmarshal(encoded, &perms); err != nil {
+		return nil, fmt.Errorf("unable to decode permissions of user %q: %s", key.User, err)
+	}
+	return perms, nil
+}
+
+// Allowed reports whether the named user has the given permission in a
+// scope. The admin user may do anything and other users may do nothing they
+// have not been granted.
+func (s *Store) Allowed(name string, perm Permission, scope Scope) (allowed bool, err error) {
+	if name == Admin {
+		return true, nil
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(permissionsBucketName)
+		for _, scope := range scope.enclosing() {
+			perms, err := getPermissions(bucket, grantKey{name, scope.DB, scope.Table})
+			if err != nil {
+				return err
+			}
+			if granted, ok := perms[perm]; ok {
+				allowed = granted
+				return nil
+			}
+		}
+		return nil
+	})
+	return allowed, err
+}
+
+// Grant sets the permissions of the named user in a scope to those of the
+// given object, which holds a BOOL or null for any of `read`, `write`,
+// `connect` and `config`. A permission which is null is no longer set in the
+// scope. The result is the result of r.grant().
+func (s *Store) Grant(name string, scope Scope, changes values.Object) (values.Object, *values.Error) {
+	if name == Admin {
+		return nil, values.NewError(ql2.Response_OP_FAILED, "The permissions of the user `%s` can't be modified.", Admin)
+	}
+	for key, val := range changes.Items() {
+		switch Permission(key) {
+		case Read, Write, Config:
+		case Connect:
+			if scope != Global {
+				return nil, values.NewError(ql2.Response_QUERY_LOGIC, "The `connect` permission is only valid at the global scope.")
+			}
+		default:
+			return nil, values.NewError(ql2.Response_QUERY_LOGIC, "Unexpected key(s) `%s`.", key)
+		}
+		if !val.IsBool() && !val.IsNull() {
+			return nil, values.NewError(ql2.Response_QUERY_LOGIC, "Expected a boolean or `null` for `%s`.", key)
+		}
+	}
+
+	var oldPerms, newPerms Permissions
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		user, err := get(tx.Bucket(bucketName), name)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return values.NewError(ql2.Response_OP_FAILED, "User `%s` not found.", name)
+		}
+
+		bucket := tx.Bucket(permissionsBucketName)
+		key := grantKey{name, scope.DB, scope.Table}
+		if oldPerms, err = getPermissions(bucket, key); err != nil {
+			return err
+		}
+		newPerms = Permissions{}
+		for perm, allowed := range oldPerms {
+			newPerms[perm] = allowed
+		}
+		for perm, val := range changes.Items() {
+			if val.IsNull() {
+				delete(newPerms, Permission(perm))
+			} else {
+				newPerms[Permission(perm)] = val.AsBool().Value()
+			}
+		}
+
+		if len(newPerms) == 0 {
+			return bucket.Delete(key.encode())
+		}
+		encoded, err := json.Marshal(newPerms)
+		if err != nil {
+			return fmt.Errorf("unable to encode permissions of user %q: %s", name, err)
+		}
+		return bucket.Put(key.encode(), encoded)
+	})
+	if verr, ok := err.(*values.Error); ok {
+		return nil, verr
+	}
+	if err != nil {
+		return nil, values.NewError(ql2.Response_OP_FAILED, "Unable to grant permissions to user `%s`: %s", name, err)
+	}
+
+	return values.NewObject(map[string]values.Datum{
+		"granted": values.NewNumber(1),
+		"permissions_changes": values.NewArray([]values.Datum{values.NewObject(map[string]values.Datum{
+			"old_val": oldPerms.datum(),
+			"new_val": newPerms.datum(),
+		})}),
+	}), nil
+}
+
+// deletePermissions removes every permission granted to the named user.
+func deletePermissions(tx *bolt.Tx, name string) error {
+	bucket := tx.Bucket(permissionsBucketName)
+	var keys [][]byte
+	err := bucket.ForEach(func(k, _ []byte) error {
+		var key grantKey
+		if err := json.Unmarshal(k, &key); err == nil && key.User == name {
+			keys = append(keys, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Names returns the names of the database and table with the given IDs, the
+// latter of which may be empty, and whether they still exist.
+type Names func(dbID, tableID string) (db, table string, ok bool)
+
+// PermissionRows returns the rows of the rethinkdb.permissions system table:
+// one for each existing scope in which a user has been granted permissions,
+// and one for the global permissions of the admin user. The rows identify
+// their scopes by ID and name them with the given function.
+func (s *Store) PermissionRows(names Names) ([]values.Datum, *values.Error) {
+	rows := []values.Datum{permissionRow(grantKey{User: Admin}, "", "", Permissions{Read: true, Write: true, Connect: true, Config: true})}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(permissionsBucketName).ForEach(func(k, v []byte) error {
+			var key grantKey
+			var perms Permissions
+			if err := json.Unmarshal(k, &key); err != nil {
+				return err
+			}
+			if err := json.Unmarshal(v, &perms); err != nil {
+				return err
+			}
+			var dbName, tableName string
+			if key.DB != "" {
+				var ok bool
+				if dbName, tableName, ok = names(key.DB, key.Table); !ok {
+					return nil
+				}
+			}
+			rows = append(rows, permissionRow(key, dbName, tableName, perms))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, values.NewError(ql2.Response_OP_FAILED, "Unable to read permissions: %s", err)
+	}
+
+	// Order the rows by their ids, which sort users before their scopes.
+	sort.SliceStable(rows, func(i, j int) bool {
+		return values.Compare(rows[i].AsObject().Items()["id"], rows[j].AsObject().Items()["id"]) < 0
+	})
+	return rows, nil
+}
+
+func permissionRow(key grantKey, dbName, tableName string, perms Permissions) values.Datum {
+	id := []values.Datum{values.NewString(key.User)}
+	row := map[string]values.Datum{
+		"user":        values.NewString(key.User),
+		"permissions": perms.datum(),
+	}
+	if key.DB != "" {
+		id = append(id, values.NewString(key.DB))
+		row["database"] = values.NewString(dbName)
+	}
+	if key.Table != "" {
+		id = append(id, values.NewString(key.Table))
+		row["table"] = values.NewString(tableName)
+	}
+	row["id"] = values.NewArray(id)
+	return values.NewObject(row)
+}
@@ -0,0 +1,120 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func TestGrant(t *testing.T) {
+	s := openTestStore(t, "")
+	if err := s.Write(values.NewString("analytics"), parseRow(t, `{"id": "analytics", "password": "x"}`)); err != nil {
+		t.Fatal(err.Message)
+	}
+
+	grants := []struct {
+		scope Scope
+		perms string
+	}{
+		{Global, `{"read": true, "connect": false}`},
+		{Scope{DB: "test"}, `{"read": false, "write": true}`},
+		{Scope{DB: "test", Table: "events"}, `{"read": true}`},
+		{Scope{DB: "test", Table: "dropped"}, `{"read": true}`},
+	}
+	for _, grant := range grants {
+		if _, err := s.Grant("analytics", grant.scope, parseRow(t, grant.perms).AsObject()); err != nil {
+			t.Fatalf("unable to grant %s: %s", grant.perms, err.Message)
+		}
+	}
+
+	checks := []struct {
+		name     string
+		perm     Permission
+		scope    Scope
+		expected bool
+	}{
+		{"analytics", Read, Scope{DB: "other", Table: "t"}, true},
+		{"analytics", Read, Scope{DB: "test", Table: "users"}, false},
+		{"analytics", Read, Scope{DB: "test", Table: "events"}, true},
+		{"analytics", Write, Scope{DB: "test", Table: "events"}, true},
+		{"analytics", Write, Scope{DB: "other", Table: "t"}, false},
+		{"analytics", Config, Global, false},
+		{"nobody", Read, Global, false},
+		{Admin, Config, Global, true},
+	}
+	for _, check := range checks {
+		allowed, err := s.Allowed(check.name, check.perm, check.scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != check.expected {
+			t.Errorf("expected %s to have %s permission in %+v: %v", check.name, check.perm, check.scope, check.expected)
+		}
+	}
+
+	// A null permission is inherited again.
+	result, err := s.Grant("analytics", Scope{DB: "test"}, parseRow(t, `{"read": null}`).AsObject())
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	encoded, _ := values.ToJSON(result)
+	expected := `{"granted":1,"permissions_changes":[{"new_val":{"write":true},"old_val":{"read":false,"write":true}}]}`
+	if string(encoded) != expected {
+		t.Errorf("expected %s but got %s", expected, encoded)
+	}
+	if allowed, _ := s.Allowed("analytics", Read, Scope{DB: "test", Table: "users"}); !allowed {
+		t.Errorf("expected the global read permission to be inherited")
+	}
+
+	for _, grant := range []struct {
+		name  string
+		scope Scope
+		perms string
+	}{
+		{"nobody", Global, `{"read": true}`},
+		{Admin, Global, `{"read": false}`},
+		{"analytics", Scope{DB: "test"}, `{"connect": true}`},
+		{"analytics", Global, `{"delete": true}`},
+		{"analytics", Global, `{"read": 1}`},
+	} {
+		if _, err := s.Grant(grant.name, grant.scope, parseRow(t, grant.perms).AsObject()); err == nil {
+			t.Errorf("expected grant of %s to %s to fail", grant.perms, grant.name)
+		}
+	}
+
+	// Scopes are named by their IDs here, and grants on those which no
+	// longer exist are not listed.
+	names := func(dbID, tableID string) (string, string, bool) {
+		return "db_" + dbID, "table_" + tableID, tableID != "dropped"
+	}
+	rows, err := s.PermissionRows(names)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	var ids []string
+	for _, row := range rows {
+		id, _ := values.ToJSON(row.AsObject().Items()["id"])
+		ids = append(ids, string(id))
+	}
+	if table := rows[len(rows)-1].AsObject().Items()["table"]; !values.Equal(table, values.NewString("table_events")) {
+		t.Errorf("expected the table of the last row to be named table_events but got %v", table)
+	}
+	expectedIDs := []string{`["admin"]`, `["analytics"]`, `["analytics","test"]`, `["analytics","test","events"]`}
+	if len(ids) != len(expectedIDs) {
+		t.Fatalf("expected rows %v but got %v", expectedIDs, ids)
+	}
+	for i := range ids {
+		if ids[i] != expectedIDs[i] {
+			t.Errorf("expected rows %v but got %v", expectedIDs, ids)
+			break
+		}
+	}
+
+	// Deleting a user removes its permissions.
+	if err := s.Write(values.NewString("analytics"), nil); err != nil {
+		t.Fatal(err.Message)
+	}
+	if rows, _ := s.PermissionRows(names); len(rows) != 1 {
+		t.Errorf("expected only the admin permissions to remain but got %d rows", len(rows))
+	}
+}
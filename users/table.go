@@ -0,0 +1,122 @@
+package users
+
+import (
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/rethinkdb/rethinkdb-go.v5/ql2"
+
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+// Row returns the row of the rethinkdb.users system table which describes
+// this user. The password is only reported as set or not.
+func (u *User) Row() values.Datum {
+	return values.NewObject(map[string]values.Datum{
+		"id":       values.NewString(u.Name),
+		"password": values.NewBool(u.HasPassword),
+	})
+}
+
+// Rows returns the rows of the rethinkdb.users system table.
+func (s *Store) Rows() ([]values.Datum, *values.Error) {
+	users, err := s.List()
+	if err != nil {
+		return nil, values.NewError(ql2.Response_OP_FAILED, "Unable to read users: %s", err)
+	}
+	rows := make([]values.Datum, len(users))
+	for i, user := range users {
+		rows[i] = user.Row()
+	}
+	return rows, nil
+}
+
+// Write writes the row of the rethinkdb.users system table with the given
+// primary key, which is the name of a user, or deletes it if newVal is nil.
+// The `password` field of a row is a string to set the password of the user
+// or false to remove it. It may be true to keep the current password.
+func (s *Store) Write(key, newVal values.Datum) *values.Error {
+	if !key.IsString() {
+		return values.NewError(ql2.Response_QUERY_LOGIC, "Expected a STRING username as the primary key.")
+	}
+	name := key.AsString().Value()
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		existing, err := get(bucket, name)
+		if err != nil {
+			return err
+		}
+
+		if newVal == nil {
+			if name == Admin {
+				return values.NewError(ql2.Response_OP_FAILED, "The user `%s` can't be deleted.", Admin)
+			}
+			if err := deletePermissions(tx, name); err != nil {
+				return err
+			}
+			return bucket.Delete([]byte(name))
+		}
+
+		user, verr := userFromRow(name, existing, newVal)
+		if verr != nil {
+			return verr
+		}
+		return put(bucket, user)
+	})
+	if verr, ok := err.(*values.Error); ok {
+		return verr
+	}
+	if err != nil {
+		return values.NewError(ql2.Response_OP_FAILED, "Unable to write user `%s`: %s", name, err)
+	}
+	return nil
+}
+
+// userFromRow returns the user described by a row of the rethinkdb.users
+// system table, which replaces the existing user, if any.
+func userFromRow(name string, existing *User, row values.Datum) (*User, *values.Error) {
+	if !row.IsObject() {
+		return nil, values.NewError(ql2.Response_QUERY_LOGIC, "Expected an OBJECT for a user.")
+	}
+	fields := row.AsObject().Items()
+
+	var unexpected []string
+	for field := range fields {
+		if field != "id" && field != "password" {
+			unexpected = append(unexpected, "`"+field+"`")
+		}
+	}
+	if len(unexpected) > 0 {
+		sort.Strings(unexpected)
+		return nil, values.NewError(ql2.Response_QUERY_LOGIC, "Unexpected key(s) %s.", strings.Join(unexpected, ", "))
+	}
+	if id, ok := fields["id"]; !ok || !id.IsString() || id.AsString().Value() != name {
+		return nil, values.NewError(ql2.Response_QUERY_LOGIC, "The `id` of a user must be the STRING `%s`.", name)
+	}
+
+	password, ok := fields["password"]
+	switch {
+	case !ok && existing == nil:
+		return nil, values.NewError(ql2.Response_QUERY_LOGIC, "Expected a field named `password`.")
+	case !ok:
+		return existing, nil
+	case password.IsString():
+		user, err := newUser(name, password.AsString().Value(), true)
+		if err != nil {
+			return nil, values.NewError(ql2.Response_OP_FAILED, "%s", err)
+		}
+		return user, nil
+	case password.IsBool() && !password.AsBool().Value():
+		user, err := newUser(name, "", false)
+		if err != nil {
+			return nil, values.NewError(ql2.Response_OP_FAILED, "%s", err)
+		}
+		return user, nil
+	case password.IsBool() && existing != nil && existing.HasPassword:
+		// The row as it was read, which keeps the current password.
+		return existing, nil
+	}
+	return nil, values.NewError(ql2.Response_QUERY_LOGIC, "Expected a STRING or `false` for `password`.")
+}
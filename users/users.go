@@ -0,0 +1,177 @@
+// Package users stores the user accounts of a server and the SCRAM-SHA-256
+// credentials with which they authenticate.
+package users
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Admin is the name of the user which always exists and may do anything.
+const Admin = "admin"
+
+// Iterations is the number of PBKDF2 iterations used to salt new passwords.
+const Iterations = 4096
+
+var bucketName = []byte("users")
+
+// Credentials are the keys with which a user authenticates by SCRAM. The
+// password itself is not stored, nor is the salted password from which a
+// client proves that it knows the password.
+type Credentials struct {
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	StoredKey  []byte `json:"stored_key"`
+	ServerKey  []byte `json:"server_key"`
+}
+
+// User is a stored user account.
+type User struct {
+	Name string `json:"name"`
+	// HasPassword is false for a user with no password, who authenticates
+	// with an empty one.
+	HasPassword bool        `json:"has_password"`
+	Credentials Credentials `json:"credentials"`
+}
+
+// NewCredentials salts the given password.
+func NewCredentials(password string) (Credentials, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return Credentials{}, fmt.Errorf("unable to generate salt: %s", err)
+	}
+	return credentials([]byte(password), salt, Iterations), nil
+}
+
+func credentials(password, salt []byte, iterations int) Credentials {
+	saltedPassword := pbkdf2SHA256(password, salt, iterations)
+	clientKey := hmacSHA256(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	return Credentials{
+		Salt:       salt,
+		Iterations: iterations,
+		StoredKey:  storedKey[:],
+		ServerKey:  hmacSHA256(saltedPassword, "Server Key"),
+	}
+}
+
+// VerifyProof reports whether a client proof of the given SCRAM auth message
+// was made with the password of these credentials.
+func (c Credentials) VerifyProof(authMessage string, proof []byte) bool {
+	clientSignature := hmacSHA256(c.StoredKey, authMessage)
+	if len(proof) != len(clientSignature) {
+		return false
+	}
+	clientKey := make([]byte, len(proof))
+	for i := range proof {
+		clientKey[i] = proof[i] ^ clientSignature[i]
+	}
+	storedKey := sha256.Sum256(clientKey)
+	return hmac.Equal(storedKey[:], c.StoredKey)
+}
+
+// VerifyPassword reports whether the given password is the password of these
+// credentials.
+func (c Credentials) VerifyPassword(password string) bool {
+	return hmac.Equal(credentials([]byte(password), c.Salt, c.Iterations).StoredKey, c.StoredKey)
+}
+
+// ServerSignature returns the signature of the given SCRAM auth message by
+// which the server proves to a client that it knows these credentials.
+func (c Credentials) ServerSignature(authMessage string) []byte {
+	return hmacSHA256(c.ServerKey, authMessage)
+}
+
+func hmacSHA256(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// Store holds the user accounts of a server in a bolt database.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens the store of users and their permissions in the given database.
+// If there is no admin user, one is created with the given initial password,
+// or with no password if it is empty.
+func Open(db *bolt.DB, adminPassword string) (*Store, error) {
+	s := &Store{db: db}
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(permissionsBucketName); err != nil {
+			return fmt.Errorf("unable to create permissions bucket: %s", err)
+		}
+		bucket, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return fmt.Errorf("unable to create users bucket: %s", err)
+		}
+		if bucket.Get([]byte(Admin)) != nil {
+			return nil
+		}
+		admin, err := newUser(Admin, adminPassword, adminPassword != "")
+		if err != nil {
+			return err
+		}
+		return put(bucket, admin)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newUser(name, password string, hasPassword bool) (*User, error) {
+	creds, err := NewCredentials(password)
+	if err != nil {
+		return nil, err
+	}
+	return &User{Name: name, HasPassword: hasPassword, Credentials: creds}, nil
+}
+
+func put(bucket *bolt.Bucket, user *User) error {
+	encoded, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("unable to encode user %q: %s", user.Name, err)
+	}
+	return bucket.Put([]byte(user.Name), encoded)
+}
+
+func get(bucket *bolt.Bucket, name string) (*User, error) {
+	encoded := bucket.Get([]byte(name))
+	if encoded == nil {
+		return nil, nil
+	}
+	var user User
+	if err := json.Unmarshal(encoded, &user); err != nil {
+		return nil, fmt.Errorf("unable to decode user %q: %s", name, err)
+	}
+	return &user, nil
+}
+
+// Get returns the user with the given name, or nil if there is none.
+func (s *Store) Get(name string) (user *User, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		user, err = get(tx.Bucket(bucketName), name)
+		return err
+	})
+	return user, err
+}
+
+// List returns every user, ordered by name.
+func (s *Store) List() ([]*User, error) {
+	var users []*User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).ForEach(func(name, _ []byte) error {
+			user, err := get(tx.Bucket(bucketName), string(name))
+			users = append(users, user)
+			return err
+		})
+	})
+	return users, err
+}
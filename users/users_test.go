@@ -0,0 +1,150 @@
+package users
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/jlhawn/reboltdb/json"
+	"github.com/jlhawn/reboltdb/query/values"
+)
+
+func openTestStore(t *testing.T, adminPassword string) *Store {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s, err := Open(db, adminPassword)
+	if err != nil {
+		t.Fatalf("unable to open users: %s", err)
+	}
+	return s
+}
+
+func parseRow(t *testing.T, data string) values.Datum {
+	t.Helper()
+	val, err := json.Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("unable to parse row %s: %s", data, err)
+	}
+	return values.FromJSON(val)
+}
+
+// clientProof makes the proof a SCRAM client sends for the given password.
+func clientProof(c Credentials, password, authMessage string) []byte {
+	saltedPassword := pbkdf2SHA256([]byte(password), c.Salt, c.Iterations)
+	clientKey := hmacSHA256(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	signature := hmacSHA256(storedKey[:], authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range proof {
+		proof[i] = clientKey[i] ^ signature[i]
+	}
+	return proof
+}
+
+func TestPBKDF2(t *testing.T) {
+	// The salted empty password with which RethinkDB's admin user once
+	// authenticated.
+	salt, _ := base64.StdEncoding.DecodeString("6VRzcOVKuS8WWbOKM5Vurw==")
+	expected := "NsWJkSBxXNSiI1Bh0UWM7UXAE3fId5RR1ZnA7Cldtws="
+	if actual := base64.StdEncoding.EncodeToString(pbkdf2SHA256(nil, salt, 4096)); actual != expected {
+		t.Errorf("expected %s but got %s", expected, actual)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	creds, err := NewCredentials("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const authMessage = "n=admin,r=abc,r=abcdef,s=c2FsdA==,i=4096,c=biws,r=abcdef"
+	if !creds.VerifyProof(authMessage, clientProof(creds, "secret", authMessage)) {
+		t.Errorf("expected the proof of the right password to be accepted")
+	}
+	if creds.VerifyProof(authMessage, clientProof(creds, "guess", authMessage)) {
+		t.Errorf("expected the proof of the wrong password to be rejected")
+	}
+	if !creds.VerifyPassword("secret") || creds.VerifyPassword("guess") {
+		t.Errorf("expected only the right password to be verified")
+	}
+
+	saltedPassword := pbkdf2SHA256([]byte("secret"), creds.Salt, creds.Iterations)
+	expected := hmacSHA256(hmacSHA256(saltedPassword, "Server Key"), authMessage)
+	if !hmac.Equal(creds.ServerSignature(authMessage), expected) {
+		t.Errorf("unexpected server signature")
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := openTestStore(t, "initial")
+	admin, err := s.Get(Admin)
+	if err != nil || admin == nil || !admin.HasPassword {
+		t.Fatalf("expected an admin user with a password but got %+v, %v", admin, err)
+	}
+	if !admin.Credentials.VerifyProof("m", clientProof(admin.Credentials, "initial", "m")) {
+		t.Errorf("expected the admin user to have the initial password")
+	}
+
+	writes := []struct {
+		key, row string
+		ok       bool
+	}{
+		{`"bob"`, `{"id": "bob", "password": "hunter2"}`, true},
+		{`"bob"`, `{"id": "bob", "password": true}`, true},
+		{`"carol"`, `{"id": "carol", "password": false}`, true},
+		{`"carol"`, `{"id": "carol", "password": true}`, false},
+		{`"dave"`, `{"id": "dave"}`, false},
+		{`"dave"`, `{"id": "eve", "password": "x"}`, false},
+		{`"dave"`, `{"id": "dave", "password": "x", "admin": true}`, false},
+		{`1`, `{"id": 1, "password": "x"}`, false},
+	}
+	for _, write := range writes {
+		err := s.Write(parseRow(t, write.key), parseRow(t, write.row))
+		if ok := err == nil; ok != write.ok {
+			t.Errorf("write of %s: expected success %v but got %v", write.row, write.ok, err)
+		}
+	}
+
+	bob, _ := s.Get("bob")
+	if bob == nil || !bob.Credentials.VerifyProof("m", clientProof(bob.Credentials, "hunter2", "m")) {
+		t.Errorf("expected bob to keep the same password")
+	}
+
+	if err := s.Write(values.NewString(Admin), nil); err == nil {
+		t.Errorf("expected the admin user not to be deleted")
+	}
+	if err := s.Write(values.NewString("bob"), nil); err != nil {
+		t.Errorf("unable to delete bob: %s", err.Message)
+	}
+
+	rows, err2 := s.Rows()
+	if err2 != nil {
+		t.Fatal(err2.Message)
+	}
+	var encoded []string
+	for _, row := range rows {
+		data, _ := values.ToJSON(row)
+		encoded = append(encoded, string(data))
+	}
+	expected := []string{`{"id":"admin","password":true}`, `{"id":"carol","password":false}`}
+	if len(encoded) != len(expected) || encoded[0] != expected[0] || encoded[1] != expected[1] {
+		t.Errorf("expected rows %v but got %v", expected, encoded)
+	}
+}
+
+func TestOpenWithoutPassword(t *testing.T) {
+	admin, err := openTestStore(t, "").Get(Admin)
+	if err != nil || admin == nil || admin.HasPassword {
+		t.Fatalf("expected an admin user with no password but got %+v, %v", admin, err)
+	}
+	if !admin.Credentials.VerifyProof("m", clientProof(admin.Credentials, "", "m")) {
+		t.Errorf("expected the admin user to authenticate with an empty password")
+	}
+}